@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/bench"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	protopkg "github.com/heytom-labs/heytom-gateway/internal/proto"
+)
+
+// runBench sends synthetic load to one method through a running gateway and
+// prints the achieved rate, error rate, statuses and latency percentiles.
+// It returns the exit code: 1 when the load test could not run.
+func runBench(cmd *command, out io.Writer) int {
+	opts := cmd.bench
+	if opts.HTTPTarget == "" {
+		body, err := encodeRequest(cmd.options, opts.Service, opts.Method, opts.Body)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		opts.Body = body
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	target := opts.HTTPTarget
+	if target == "" {
+		target = opts.GRPCTarget
+	}
+	fmt.Fprintf(out, "sending %s/%s to %s at %g/s for %s\n", opts.Service, opts.Method, target, opts.Rate, opts.Duration)
+	report, err := bench.Run(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "requests  %d in %s (%.1f/s), %d dropped\n", report.Requests, report.Duration.Round(1e6), report.Rate(), report.Dropped)
+	fmt.Fprintf(out, "errors    %d (%.2f%%)\n", report.Errors, report.ErrorRate()*100)
+	fmt.Fprintf(out, "latency   p50 %s  p90 %s  p99 %s  max %s\n",
+		report.Percentile(0.5), report.Percentile(0.9), report.Percentile(0.99), report.Max())
+	codes := make([]string, 0, len(report.Statuses))
+	for code := range report.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	statuses := make([]string, 0, len(codes))
+	for _, code := range codes {
+		statuses = append(statuses, fmt.Sprintf("%s: %d", code, report.Statuses[code]))
+	}
+	fmt.Fprintf(out, "status    %s\n", strings.Join(statuses, "  "))
+	return 0
+}
+
+// encodeRequest converts the JSON body into the protobuf request message of
+// the method, using the protosets of the gateway config
+func encodeRequest(options *config.Options, service, method string, body []byte) ([]byte, error) {
+	cfg, err := config.Reload(options)
+	if err != nil {
+		return nil, err
+	}
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+	loader, _, err := protopkg.LoadAll(cfg, quiet)
+	if err != nil {
+		return nil, fmt.Errorf("protosets: %w", err)
+	}
+	files, err := protodesc.NewFiles(loader.GetFileDescriptorSet())
+	if err != nil {
+		return nil, fmt.Errorf("protosets: %w", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s is not defined in the loaded protosets", service)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s/%s is not defined in the loaded protosets", service, method)
+	}
+	if md.IsStreamingClient() {
+		return nil, fmt.Errorf("client streaming method %s/%s is not supported", service, method)
+	}
+
+	msg := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	return proto.Marshal(msg)
+}
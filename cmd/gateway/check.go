@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"time"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// routeRef is a config value naming routes or messages of the loaded descriptors
+type routeRef struct {
+	field   string // Config path of the value, e.g. routes[0].match
+	pattern string // Glob on "package.Service/Method", or a message name
+	message bool   // pattern is a fully-qualified message name
+	// option is set when pattern is the full name of a google.protobuf.MethodOptions extension of this type
+	option descriptorpb.FieldDescriptorProto_Type
+}
+
+// checker collects the problems found by the check command
+type checker struct {
+	out      io.Writer
+	problems int
+}
+
+// ok reports a passed check
+func (c *checker) ok(format string, args ...any) {
+	fmt.Fprintf(c.out, "ok   "+format+"\n", args...)
+}
+
+// fail reports a problem
+func (c *checker) fail(format string, args ...any) {
+	c.problems++
+	fmt.Fprintf(c.out, "FAIL "+format+"\n", args...)
+}
+
+// runCheck validates the configuration without starting the gateway: it loads
+// the config, fetches and parses every configured protoset, verifies that
+// route references resolve to loaded methods and messages, and probes the
+// registry. It returns the exit code: 1 when any check failed.
+func runCheck(cmd *command, out io.Writer) int {
+	c := &checker{out: out}
+
+	cfgPath := config.ResolvePath(cmd.options)
+	cfg, err := config.Reload(cmd.options)
+	if err != nil {
+		c.fail("config %s: %v", cfgPath, err)
+		return c.done()
+	}
+	c.ok("config %s", cfgPath)
+
+	// Progress of protoset downloads is not interesting here, failures are reported below
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+	loader, tenants, err := proto.LoadAll(cfg, quiet)
+	if err != nil {
+		c.fail("protosets: %v", err)
+	} else {
+		c.ok("protosets: %d services, %d methods", len(loader.ServiceNames()), len(loader.MethodNames()))
+	}
+	// Routes are still checked when only some remote protosets failed to load
+	if loader != nil {
+		loaders := []*proto.DescriptorLoader{loader}
+		for _, name := range tenants.Names() {
+			loaders = append(loaders, tenants.Get(name))
+		}
+		c.checkRoutes(cfg, loaders)
+	}
+
+	c.checkRegistry(cfg, cmd.timeout)
+	return c.done()
+}
+
+// done prints the outcome and returns the exit code
+func (c *checker) done() int {
+	if c.problems > 0 {
+		fmt.Fprintf(c.out, "check failed: %d problems\n", c.problems)
+		return 1
+	}
+	fmt.Fprintln(c.out, "check passed")
+	return 0
+}
+
+// checkRoutes verifies that every route glob matches a loaded method and every
+// message type is loaded, in the shared descriptors or those of any tenant
+func (c *checker) checkRoutes(cfg *config.Config, loaders []*proto.DescriptorLoader) {
+	var methods []string
+	for _, l := range loaders {
+		methods = append(methods, l.MethodNames()...)
+	}
+
+	refs := routeRefs(cfg)
+	failed := 0
+	for _, ref := range refs {
+		if ref.message {
+			if !findMessage(loaders, ref.pattern) {
+				c.fail("%s: message %s is not defined in the loaded protosets", ref.field, ref.pattern)
+				failed++
+			}
+			continue
+		}
+		if ref.option != 0 {
+			if !findOption(loaders, ref.pattern, ref.option) {
+				c.fail("%s: %s is not a loaded %s extension of google.protobuf.MethodOptions", ref.field, ref.pattern, optionKind(ref.option))
+				failed++
+			}
+			continue
+		}
+		if _, err := path.Match(ref.pattern, ""); err != nil {
+			c.fail("%s: invalid pattern %q: %v", ref.field, ref.pattern, err)
+			failed++
+			continue
+		}
+		if !matchesAny(ref.pattern, methods) {
+			c.fail("%s: %q matches no loaded method", ref.field, ref.pattern)
+			failed++
+		}
+	}
+	if failed == 0 {
+		c.ok("routes: %d references resolve", len(refs))
+	}
+}
+
+// routeRefs returns the route globs and message types referenced by the config
+func routeRefs(cfg *config.Config) []routeRef {
+	var refs []routeRef
+	add := func(field, pattern string) {
+		if pattern != "" {
+			refs = append(refs, routeRef{field: field, pattern: pattern})
+		}
+	}
+	for i, r := range cfg.Routes {
+		add(fmt.Sprintf("routes[%d].match", i), r.Match)
+		if r.Publish != nil && r.Publish.MessageType != "" {
+			refs = append(refs, routeRef{field: fmt.Sprintf("routes[%d].publish.message_type", i), pattern: r.Publish.MessageType, message: true})
+		}
+	}
+	for i, pattern := range cfg.Exposure.Allow {
+		add(fmt.Sprintf("exposure.allow[%d]", i), pattern)
+	}
+	for i, pattern := range cfg.Exposure.Deny {
+		add(fmt.Sprintf("exposure.deny[%d]", i), pattern)
+	}
+	if cfg.Exposure.Option != "" {
+		refs = append(refs, routeRef{field: "exposure.option", pattern: cfg.Exposure.Option, option: descriptorpb.FieldDescriptorProto_TYPE_BOOL})
+	}
+	// An unset visibility falls back to gateway.visibility, which services need not import
+	if cfg.Exposure.Visibility != "" {
+		refs = append(refs, routeRef{field: "exposure.visibility", pattern: cfg.Exposure.Visibility, option: descriptorpb.FieldDescriptorProto_TYPE_ENUM})
+	}
+	for i, r := range cfg.AccessLog.Sampling {
+		add(fmt.Sprintf("access_log.sampling[%d].match", i), r.Match)
+	}
+	for i, slo := range cfg.Latency.SLOs {
+		add(fmt.Sprintf("latency.slos[%d].match", i), slo.Match)
+	}
+	for i, m := range cfg.Log.Payload.Methods {
+		add(fmt.Sprintf("log.payload.methods[%d]", i), m)
+	}
+	for i, m := range cfg.Capture.Match {
+		add(fmt.Sprintf("capture.match[%d]", i), m)
+	}
+	for i, m := range cfg.Server.HTTP.JSON.Lenient {
+		add(fmt.Sprintf("server.http.json.lenient[%d]", i), m)
+	}
+	for i, r := range cfg.PathRoutes {
+		add(fmt.Sprintf("path_routes[%d].target", i), r.Target)
+	}
+	for i, m := range cfg.Collapse.Methods {
+		add(fmt.Sprintf("collapse.methods[%d]", i), m)
+	}
+	for i, m := range cfg.Cache.Methods {
+		add(fmt.Sprintf("cache.methods[%d]", i), m)
+	}
+	for i, r := range cfg.Errors.Routes {
+		add(fmt.Sprintf("errors.routes[%d].match", i), r.Match)
+	}
+	for i, v := range cfg.Validation {
+		add(fmt.Sprintf("validation[%d].match", i), v.Match)
+	}
+	for i, d := range cfg.Maintenance.DisabledMethods {
+		add(fmt.Sprintf("maintenance.disabled_methods[%d].method", i), d.Method)
+	}
+	for i, l := range cfg.Server.Listeners {
+		for j, r := range l.Routes {
+			add(fmt.Sprintf("server.listeners[%d].routes[%d]", i, j), r)
+		}
+		if l.TLS == nil {
+			continue
+		}
+		for j, sni := range l.TLS.SNI {
+			for k, r := range sni.Routes {
+				add(fmt.Sprintf("server.listeners[%d].tls.sni[%d].routes[%d]", i, j, k), r)
+			}
+		}
+	}
+	return refs
+}
+
+// matchesAny reports whether the glob matches one of the methods
+func matchesAny(pattern string, methods []string) bool {
+	for _, m := range methods {
+		if ok, _ := path.Match(pattern, m); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// findMessage reports whether one of the loaders defines the message
+func findMessage(loaders []*proto.DescriptorLoader, name string) bool {
+	for _, l := range loaders {
+		if l.FindMessageDescriptor(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findOption reports whether one of the loaders defines the method option with the given type
+func findOption(loaders []*proto.DescriptorLoader, name string, typ descriptorpb.FieldDescriptorProto_Type) bool {
+	for _, l := range loaders {
+		if t, ok := l.MethodOptionType(name); ok && t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// optionKind names the option type in check failures
+func optionKind(typ descriptorpb.FieldDescriptorProto_Type) string {
+	if typ == descriptorpb.FieldDescriptorProto_TYPE_ENUM {
+		return "enum"
+	}
+	return "bool"
+}
+
+// checkRegistry probes the registry by discovering the gateway's own service
+func (c *checker) checkRegistry(cfg *config.Config, timeout time.Duration) {
+	if !cfg.Registry.Enabled {
+		c.ok("registry: disabled")
+		return
+	}
+	reg, err := registry.ProvideRecorder(cfg)
+	if err != nil {
+		c.fail("registry: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := reg.Discover(ctx, cfg.Registry.ServiceName); err != nil {
+		c.fail("registry %s at %s: %v", cfg.Registry.Type, cfg.Registry.Address, err)
+		return
+	}
+	c.ok("registry %s at %s", cfg.Registry.Type, cfg.Registry.Address)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/bench"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// command is a parsed command line
+type command struct {
+	name    string // run, check, replay, bench or version
+	options *config.Options
+	timeout time.Duration         // Bound on the registry probe of the check command
+	replay  capture.ReplayOptions // Options of the replay command
+	files   []string              // Capture files or directories to replay
+	bench   bench.Options         // Options of the bench command
+}
+
+// headerFlag collects repeated "key: value" flags
+type headerFlag map[string]string
+
+// String implements flag.Value
+func (h headerFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key: value, got %q", value)
+	}
+	h[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+	return nil
+}
+
+// parseArgs parses the command line.
+//
+//	gateway [flags]          start the gateway
+//	gateway run [flags]      start the gateway
+//	gateway check [flags]    validate the config, protosets, route references and registry
+//	gateway replay [flags] FILE|DIR...
+//	                         replay captured traffic against a target environment
+//	gateway bench [flags]    send synthetic load to one method and report latency and errors
+//	gateway version          print build information
+func parseArgs(args []string, output io.Writer) (*command, error) {
+	name := "run"
+	if len(args) > 0 && (args[0] == "run" || args[0] == "check" || args[0] == "replay" || args[0] == "bench" || args[0] == "version") {
+		name, args = args[0], args[1:]
+	}
+
+	opts := &config.Options{}
+	cmd := &command{name: name, options: opts}
+	fs := flag.NewFlagSet("gateway "+name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	if name == "run" || name == "check" || name == "bench" {
+		fs.StringVar(&opts.ConfigPath, "config", "", "path to the config file (.json, .yaml, .yml or .toml)")
+		fs.StringVar(&opts.Env, "env", os.Getenv("GATEWAY_ENV"), "environment overlay to apply, e.g. prod loads config.prod.json over config.json")
+	}
+	if name == "check" {
+		fs.DurationVar(&cmd.timeout, "timeout", 5*time.Second, "timeout of the registry connectivity check")
+	}
+	if name == "run" {
+		fs.StringVar(&opts.LogLevel, "log-level", "", "override log level (debug, info, warn, error)")
+		fs.StringVar(&opts.HTTPPort, "http-port", "", "override HTTP listen address, e.g. :8080")
+		fs.StringVar(&opts.GRPCPort, "grpc-port", "", "override gRPC listen address, e.g. :9091")
+	}
+	if name == "replay" {
+		headers := headerFlag{}
+		cmd.replay.Headers = headers
+		fs.StringVar(&cmd.replay.HTTPTarget, "http-target", "", "base URL HTTP requests are replayed to, e.g. http://staging:8080")
+		fs.StringVar(&cmd.replay.GRPCTarget, "grpc-target", "", "address gRPC calls are replayed to, e.g. staging:9090")
+		fs.BoolVar(&cmd.replay.TLS, "tls", false, "connect to the gRPC target with TLS")
+		fs.Var(headers, "H", "header set on every request, e.g. \"authorization: Bearer token\" (repeatable)")
+		fs.IntVar(&cmd.replay.Concurrency, "concurrency", 1, "requests in flight")
+		fs.Float64Var(&cmd.replay.Rate, "rate", 0, "requests per second (0 replays as fast as possible)")
+		fs.DurationVar(&cmd.replay.Timeout, "timeout", 10*time.Second, "timeout of each request")
+	}
+	var method, data string
+	if name == "bench" {
+		headers := headerFlag{}
+		cmd.bench.Headers = headers
+		fs.StringVar(&cmd.bench.HTTPTarget, "http-target", "", "base URL of the gateway's HTTP listener, e.g. http://staging:8080")
+		fs.StringVar(&cmd.bench.GRPCTarget, "grpc-target", "", "address of the gateway's gRPC listener, e.g. staging:9091; the body is encoded with the protosets of -config")
+		fs.BoolVar(&cmd.bench.TLS, "tls", false, "connect to the gRPC target with TLS")
+		fs.StringVar(&method, "method", "", "method to call, e.g. order.OrderService/GetOrder")
+		fs.StringVar(&data, "d", "{}", "JSON request body")
+		fs.Var(headers, "H", "header set on every request, e.g. \"authorization: Bearer token\" (repeatable)")
+		fs.Float64Var(&cmd.bench.Rate, "rate", 10, "requests per second")
+		fs.DurationVar(&cmd.bench.Duration, "duration", 10*time.Second, "how long to send requests")
+		fs.IntVar(&cmd.bench.Concurrency, "concurrency", 100, "requests in flight at most, requests beyond it are dropped")
+		fs.DurationVar(&cmd.bench.Timeout, "timeout", 10*time.Second, "timeout of each request")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if name == "bench" {
+		service, methodName, ok := strings.Cut(method, "/")
+		if !ok || service == "" || methodName == "" {
+			return nil, fmt.Errorf("bench requires -method package.Service/Method")
+		}
+		if cmd.bench.HTTPTarget == "" && cmd.bench.GRPCTarget == "" {
+			return nil, fmt.Errorf("bench requires -http-target or -grpc-target")
+		}
+		cmd.bench.Service, cmd.bench.Method = service, methodName
+		cmd.bench.Body = []byte(data)
+	}
+	if name == "replay" {
+		if fs.NArg() == 0 {
+			return nil, fmt.Errorf("replay requires capture files or directories")
+		}
+		if cmd.replay.HTTPTarget == "" && cmd.replay.GRPCTarget == "" {
+			return nil, fmt.Errorf("replay requires -http-target or -grpc-target")
+		}
+		cmd.files = fs.Args()
+	} else if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	return cmd, nil
+}
@@ -2,132 +2,91 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
-	"time"
 
-	"github.com/heytom-labs/heytom-gateway/internal/config"
-	"github.com/heytom-labs/heytom-gateway/internal/proto"
-	"github.com/heytom-labs/heytom-gateway/internal/registry"
-	_ "github.com/heytom-labs/heytom-gateway/internal/registry/consul" // Register Consul implementation
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/plugins"
+	"github.com/heytom-labs/heytom-gateway/internal/version"
+	"github.com/heytom-labs/heytom-gateway/pkg/gateway"
 )
 
 func main() {
-	// Use Wire to initialize app
-	app, err := InitializeApp()
+	cmd, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Failed to initialize app: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-
-	// Print configuration info
-	log.Printf("HTTP server port: %s", app.Config.Server.HTTPPort)
-	log.Printf("gRPC server port: %s", app.Config.Server.GRPCPort)
-	if app.Config.Registry.Enabled {
-		log.Printf("Registry: %s at %s", app.Config.Registry.Type, app.Config.Registry.Address)
+	if cmd.name == "version" {
+		fmt.Println(version.String())
+		return
 	}
-
-	// Create and setup HotReloadManager if enabled
-	var hotReloadMgr *proto.HotReloadManager
-	if app.Config.Proto.HotReload.Enabled {
-		log.Println("Hot reload is enabled, starting protoset update monitor")
-		// Get the proto loader from HTTP proxy
-		// Note: We need access to the loader, this is a simplified approach
-		// In production, you might want to refactor to expose the loader
+	if cmd.name == "check" {
+		os.Exit(runCheck(cmd, os.Stdout))
 	}
-
-	// Start HTTP server in goroutine
-	go func() {
-		log.Printf("HTTP server starting on %s", app.Config.Server.HTTPPort)
-		if err := app.HTTPServer.Start(); err != nil {
-			log.Fatalf("HTTP server failed to start: %v", err)
-		}
-	}()
-
-	// Start gRPC server in goroutine
-	go func() {
-		log.Printf("gRPC server starting on %s", app.Config.Server.GRPCPort)
-		if err := app.GRPCServer.Start(); err != nil {
-			log.Fatalf("gRPC server failed to start: %v", err)
-		}
-	}()
-
-	// Register service to registry
-	if app.Registry != nil {
-		if err := registerService(context.Background(), app.Registry, app.Config); err != nil {
-			log.Fatalf("Failed to register service: %v", err)
-		}
-		log.Printf("Service registered: %s (ID: %s)", app.Config.Registry.ServiceName, app.Config.Registry.ServiceID)
+	if cmd.name == "replay" {
+		os.Exit(runReplay(cmd, os.Stdout))
 	}
-
-	// Wait for interrupt signal to gracefully shutdown servers
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down servers...")
-
-	// Stop hot reload manager if running
-	if hotReloadMgr != nil {
-		hotReloadMgr.Stop()
-		log.Println("Hot reload manager stopped")
+	if cmd.name == "bench" {
+		os.Exit(runBench(cmd, os.Stdout))
 	}
 
-	// Create shutdown context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Gracefully shutdown HTTP server
-	if err := app.HTTPServer.Stop(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+	// Load configuration and descriptors and build the proxies
+	gw, err := gateway.New(
+		gateway.WithConfigFile(cmd.options.ConfigPath),
+		gateway.WithEnv(cmd.options.Env),
+		gateway.WithLogLevel(cmd.options.LogLevel),
+		gateway.WithHTTPPort(cmd.options.HTTPPort),
+		gateway.WithGRPCPort(cmd.options.GRPCPort),
+	)
+	if err != nil {
+		fatal(slog.Default(), "Bootstrap failed: could not load configuration, descriptors or proxies", err)
 	}
+	logger := gw.Logger()
 
-	// Shutdown gRPC server
-	app.GRPCServer.Stop()
-
-	// Deregister service from registry
-	if app.Registry != nil {
-		if err := app.Registry.Deregister(ctx, app.Config.Registry.ServiceID); err != nil {
-			log.Printf("Failed to deregister service: %v", err)
-		} else {
-			log.Printf("Service deregistered: %s", app.Config.Registry.ServiceID)
-		}
+	// Listen, serve and register once the readiness checks pass
+	if err := gw.Start(context.Background()); err != nil {
+		fatal(logger, "Bootstrap failed", err)
 	}
 
-	log.Println("Servers gracefully stopped")
-}
-
-// registerService registers service to registry
-func registerService(ctx context.Context, reg registry.Registry, cfg *config.Config) error {
-	// 解析gRPC端口
-	grpcPort, err := parsePort(cfg.Server.GRPCPort)
-	if err != nil {
-		return fmt.Errorf("invalid grpc port: %w", err)
+	// Wait for interrupt signal to gracefully shutdown servers, or for an
+	// upgrade signal to hand the listeners over to a new process first
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	upgrade := make(chan os.Signal, 1)
+	if handover.Signal != nil {
+		signal.Notify(upgrade, handover.Signal)
 	}
-
-	// 解析HTTP端口
-	httpPort := strings.TrimPrefix(cfg.Server.HTTPPort, ":")
-
-	instance := &registry.ServiceInstance{
-		ID:      cfg.Registry.ServiceID,
-		Name:    cfg.Registry.ServiceName,
-		Address: cfg.Server.Host,
-		Port:    grpcPort,
-		Tags:    cfg.Registry.Tags,
-		Metadata: map[string]string{
-			"http_port": httpPort,
-			"protocol":  "grpc",
-		},
+wait:
+	for {
+		select {
+		case <-quit:
+			break wait
+		case err := <-gw.Err():
+			fatal(logger, "Server failed", err)
+		case <-upgrade:
+			logger.Info("Upgrade requested, starting new process")
+			if err := gw.Upgrade(); err != nil {
+				logger.Error("Upgrade failed, continuing to serve", "error", err)
+				continue
+			}
+			break wait
+		}
 	}
-
-	return reg.Register(ctx, instance)
+	gw.Shutdown(context.Background())
 }
 
-// parsePort 解析端口号
-func parsePort(portStr string) (int, error) {
-	portStr = strings.TrimPrefix(portStr, ":")
-	return strconv.Atoi(portStr)
+// fatal logs an error, stops any plugin processes and exits the process
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	plugins.Cleanup()
+	os.Exit(1)
 }
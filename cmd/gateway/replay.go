@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+)
+
+// runReplay replays capture files and prints every mismatch and failure,
+// returning the exit code: 1 when any request did not reproduce its captured status
+func runReplay(cmd *command, out io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := capture.Replay(ctx, cmd.replay, cmd.files, func(r *capture.Result) {
+		rec := r.Record
+		route := rec.Protocol + " " + rec.Service + "/" + rec.Method
+		switch {
+		case r.Skipped != "":
+		case r.Err != nil:
+			fmt.Fprintf(out, "FAIL     %s: %v\n", route, r.Err)
+		case r.Matched():
+		case rec.Protocol == "grpc":
+			fmt.Fprintf(out, "MISMATCH %s: captured %s, got %s\n", route, rec.GRPCCode, r.GRPCCode)
+		default:
+			fmt.Fprintf(out, "MISMATCH %s: captured %d, got %d\n", route, rec.Status, r.Status)
+		}
+	})
+	fmt.Fprintf(out, "replayed %d requests: %d matched, %d mismatched, %d failed, %d skipped\n",
+		summary.Total, summary.Matched, summary.Mismatched, summary.Failed, summary.Skipped)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if summary.Mismatched > 0 || summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
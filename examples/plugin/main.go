@@ -0,0 +1,31 @@
+// Command plugin is an example filter plugin. It rejects requests without a
+// tenant and tags the upstream request and the response.
+//
+// Build it and reference the binary from the gateway configuration:
+//
+//	go build -o bin/example-plugin ./examples/plugin
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/pkg/plugin"
+)
+
+type filter struct{}
+
+func (filter) FilterRequest(_ context.Context, req *plugin.Request) (*plugin.Result, error) {
+	if req.Tenant == "" {
+		return &plugin.Result{Reject: true, Status: http.StatusBadRequest, Reason: "tenant is required"}, nil
+	}
+	return &plugin.Result{Headers: map[string]string{"x-tenant-checked": "true"}}, nil
+}
+
+func (filter) FilterResponse(context.Context, *plugin.Response) (*plugin.Result, error) {
+	return &plugin.Result{Headers: map[string]string{"X-Filtered-By": "example-plugin"}}, nil
+}
+
+func main() {
+	plugin.Serve(filter{})
+}
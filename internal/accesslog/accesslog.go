@@ -0,0 +1,344 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+// Entry is a single access log record
+type Entry = requestinfo.Info
+
+// fieldNames lists all supported fields in their default order
+var fieldNames = []string{
+	"time", "protocol", "remote_addr", "http_method", "path", "tenant", "service", "method",
+	"upstream", "instance", "conn_reused", "attempts", "status", "grpc_code", "bytes_in", "bytes_out", "duration_ms", "user_agent", "error",
+}
+
+// field returns the value of a named field
+func field(e *Entry, name string) any {
+	switch name {
+	case "time":
+		return e.Time.Format(time.RFC3339Nano)
+	case "protocol":
+		return e.Protocol
+	case "remote_addr":
+		return e.RemoteAddr
+	case "http_method":
+		return e.HTTPMethod
+	case "path":
+		return e.Path
+	case "tenant":
+		return e.Tenant
+	case "service":
+		return e.Service
+	case "method":
+		return e.Method
+	case "upstream":
+		return e.Upstream
+	case "instance":
+		return e.Instance
+	case "conn_reused":
+		return e.ConnReused
+	case "attempts":
+		return e.Attempts
+	case "status":
+		return e.Status
+	case "grpc_code":
+		return e.GRPCCode
+	case "bytes_in":
+		return e.BytesIn
+	case "bytes_out":
+		return e.BytesOut
+	case "duration_ms":
+		return float64(e.Duration.Microseconds()) / 1000
+	case "user_agent":
+		return e.UserAgent
+	case "error":
+		return e.Error
+	}
+	return nil
+}
+
+// samplingRule applies a sample rate to requests matching a service/method glob
+type samplingRule struct {
+	match string
+	rate  float64
+}
+
+// sampler holds the sampling settings, replaced atomically on config reload
+type sampler struct {
+	rate  float64
+	rules []samplingRule
+}
+
+// Logger writes access log entries, separate from the application log
+type Logger struct {
+	format   string
+	template string
+	fields   []string
+	sampler  atomic.Pointer[sampler]
+	sinks    []*sink
+}
+
+// New creates an access logger writing to the configured sinks, or to output
+// when no sinks are configured. publish sends lines of kafka sinks and may be
+// nil when none are configured.
+func New(cfg config.AccessLogConfig, publish PublishFunc, logger *slog.Logger) (*Logger, error) {
+	format, err := parseFormat(cfg.Format, cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = fieldNames
+	}
+	for _, f := range fields {
+		if !isField(f) {
+			return nil, fmt.Errorf("unknown access log field: %s", f)
+		}
+	}
+
+	l := &Logger{
+		format:   format,
+		template: cfg.Template,
+		fields:   fields,
+	}
+	if err := l.SetSampling(cfg); err != nil {
+		return nil, err
+	}
+
+	sinks := cfg.Sinks
+	if len(sinks) == 0 {
+		sinks = []config.AccessLogSinkConfig{outputSink(cfg.Output)}
+	}
+	names := make(map[string]bool, len(sinks))
+	for i, sc := range sinks {
+		sinkFormat := format
+		if sc.Format != "" {
+			if sinkFormat, err = parseFormat(sc.Format, cfg.Template); err != nil {
+				l.Close()
+				return nil, fmt.Errorf("access log sink %d: %w", i, err)
+			}
+		}
+		s, err := newSink(sc, sinkFormat, publish, logger)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("access log sink %d: %w", i, err)
+		}
+		l.sinks = append(l.sinks, s)
+		if names[s.name] {
+			l.Close()
+			return nil, fmt.Errorf("duplicate access log sink name %q", s.name)
+		}
+		names[s.name] = true
+	}
+	return l, nil
+}
+
+// outputSink returns the sink of the output setting: stdout, stderr or a file path
+func outputSink(output string) config.AccessLogSinkConfig {
+	switch output {
+	case "", "stdout":
+		return config.AccessLogSinkConfig{Type: "stdout"}
+	case "stderr":
+		return config.AccessLogSinkConfig{Type: "stderr"}
+	default:
+		return config.AccessLogSinkConfig{Type: "file", Path: output}
+	}
+}
+
+// parseFormat normalizes a configured output format
+func parseFormat(format, template string) (string, error) {
+	switch format = strings.ToLower(format); format {
+	case "", "json":
+		return "json", nil
+	case "common":
+		return format, nil
+	case "template":
+		if template == "" {
+			return "", fmt.Errorf("access log template is required for template format")
+		}
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported access log format: %s", format)
+	}
+}
+
+// SetSampling replaces the global sample rate and per-route sampling rules.
+// A rate of 0 logs nothing, in sample_rate as in the rules; an unset
+// sample_rate logs everything.
+func (l *Logger) SetSampling(cfg config.AccessLogConfig) error {
+	rate := 1.0
+	if cfg.SampleRate != nil {
+		rate = *cfg.SampleRate
+	}
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("access_log.sample_rate must be in [0, 1]")
+	}
+	rules := make([]samplingRule, 0, len(cfg.Sampling))
+	for _, s := range cfg.Sampling {
+		if _, err := path.Match(s.Match, ""); err != nil {
+			return fmt.Errorf("invalid access log sampling pattern %q: %w", s.Match, err)
+		}
+		if s.Rate < 0 || s.Rate > 1 {
+			return fmt.Errorf("access log sampling rate of %q must be in [0, 1]", s.Match)
+		}
+		rules = append(rules, samplingRule{match: s.Match, rate: s.Rate})
+	}
+	l.sampler.Store(&sampler{rate: rate, rules: rules})
+	return nil
+}
+
+// Observe implements requestinfo.Observer
+func (l *Logger) Observe(e *Entry) {
+	l.Log(e)
+}
+
+// Log writes the entry if it is selected by sampling
+func (l *Logger) Log(e *Entry) {
+	if l == nil || !l.sampled(e) {
+		return
+	}
+
+	// Sinks sharing a format share the rendered line
+	lines := make(map[string][]byte, 1)
+	for _, s := range l.sinks {
+		line, ok := lines[s.format]
+		if !ok {
+			line = l.formatEntry(e, s.format)
+			lines[s.format] = line
+		}
+		s.write(line)
+	}
+}
+
+// Close writes the queued lines of every sink and closes them
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	for _, s := range l.sinks {
+		s.close()
+	}
+}
+
+// sampled decides whether the entry should be written
+func (l *Logger) sampled(e *Entry) bool {
+	s := l.sampler.Load()
+	rate := s.rate
+	route := e.Service + "/" + e.Method
+	for _, rule := range s.rules {
+		if ok, _ := path.Match(rule.match, route); ok {
+			rate = rule.rate
+			break
+		}
+	}
+	if rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
+
+// formatEntry renders the entry in a format
+func (l *Logger) formatEntry(e *Entry, format string) []byte {
+	switch format {
+	case "common":
+		return []byte(formatCommon(e))
+	case "template":
+		return []byte(formatTemplate(l.template, e) + "\n")
+	default:
+		record := make(map[string]any, len(l.fields))
+		for _, f := range l.fields {
+			record[f] = field(e, f)
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return []byte(fmt.Sprintf("{\"error\":%q}\n", err.Error()))
+		}
+		return append(data, '\n')
+	}
+}
+
+// formatCommon renders the entry in Common Log Format
+func formatCommon(e *Entry) string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+	if host == "" {
+		host = "-"
+	}
+	method := e.HTTPMethod
+	if method == "" {
+		method = "POST"
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %d\n",
+		host, e.Time.Format("02/Jan/2006:15:04:05 -0700"), method, e.Path, strings.ToUpper(e.Protocol), e.Status, e.BytesOut)
+}
+
+// formatTemplate replaces {field} placeholders in the template
+func formatTemplate(tmpl string, e *Entry) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			b.WriteString(tmpl)
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			b.WriteString(tmpl)
+			break
+		}
+		name := tmpl[start+1 : start+end]
+		b.WriteString(tmpl[:start])
+		if isField(name) {
+			b.WriteString(toString(field(e, name)))
+		} else {
+			b.WriteString(tmpl[start : start+end+1])
+		}
+		tmpl = tmpl[start+end+1:]
+	}
+	return b.String()
+}
+
+// toString formats a field value for text output
+func toString(v any) string {
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return "-"
+		}
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', 3, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// isField reports whether name is a supported field
+func isField(name string) bool {
+	for _, f := range fieldNames {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
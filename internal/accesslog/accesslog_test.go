@@ -0,0 +1,47 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+func TestFormatCommonRemoteHost(t *testing.T) {
+	for addr, want := range map[string]string{
+		"10.0.0.1:52100":        "10.0.0.1 ",
+		"[2001:db8::1]:52100":   "2001:db8::1 ",
+		"2001:db8::1":           "2001:db8::1 ",
+		"/var/run/gateway.sock": "/var/run/gateway.sock ",
+		"":                      "- ",
+	} {
+		line := formatCommon(&Entry{RemoteAddr: addr, Time: time.Now(), Path: "/rpc/order.OrderService/GetOrder", Protocol: "http"})
+		if !strings.HasPrefix(line, want) {
+			t.Errorf("remote address %q: line %q, want host %q", addr, line, want)
+		}
+	}
+}
+
+func TestSamplingZeroRate(t *testing.T) {
+	zero := 0.0
+	entry := &Entry{Service: "order.OrderService", Method: "GetOrder"}
+	for _, tc := range []struct {
+		name string
+		cfg  config.AccessLogConfig
+		want bool
+	}{
+		{"unset sample_rate", config.AccessLogConfig{}, true},
+		{"zero sample_rate", config.AccessLogConfig{SampleRate: &zero}, false},
+		{"zero rule rate", config.AccessLogConfig{Sampling: []config.AccessLogSamplingRule{{Match: "order.OrderService/*", Rate: 0}}}, false},
+		{"rule overrides zero sample_rate", config.AccessLogConfig{SampleRate: &zero, Sampling: []config.AccessLogSamplingRule{{Match: "order.OrderService/GetOrder", Rate: 1}}}, true},
+	} {
+		l := &Logger{}
+		if err := l.SetSampling(tc.cfg); err != nil {
+			t.Fatal(err)
+		}
+		if got := l.sampled(entry); got != tc.want {
+			t.Errorf("%s: sampled = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
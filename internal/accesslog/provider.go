@@ -0,0 +1,46 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet access log provider set
+var ProviderSet = wire.NewSet(
+	ProvideLogger,
+)
+
+// ProvideLogger provides the access logger, or nil when access logging is disabled
+func ProvideLogger(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher, brokers *publish.Manager) (*Logger, error) {
+	if !cfg.AccessLog.Enabled {
+		return nil, nil
+	}
+	for i, sc := range cfg.AccessLog.Sinks {
+		if sc.Type != "kafka" {
+			continue
+		}
+		if b, ok := cfg.Brokers[sc.Broker]; !ok || b.Type != "kafka" {
+			return nil, fmt.Errorf("access log sink %d: %q is not a kafka broker", i, sc.Broker)
+		}
+	}
+	publishLine := func(ctx context.Context, broker, topic string, line []byte) error {
+		return brokers.Publish(ctx, broker, &publish.Message{Topic: topic, Payload: line})
+	}
+	l, err := New(cfg.AccessLog, publishLine, log)
+	if err != nil {
+		return nil, err
+	}
+
+	applySampling := func(_, next *config.Config) error {
+		return l.SetSampling(next.AccessLog)
+	}
+	watcher.OnChange("access_log.sample_rate", applySampling)
+	watcher.OnChange("access_log.sampling", applySampling)
+	return l, nil
+}
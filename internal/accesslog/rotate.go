@@ -0,0 +1,99 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// rotatingFile is a log file that is renamed aside and reopened when it
+// exceeds a size or age. It is only written by the sink's writer goroutine.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// openRotatingFile opens or creates the log file, appending to existing content
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, interval: interval, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file, taking its size and modification time from an existing file
+func (f *rotatingFile) open() error {
+	if dir := filepath.Dir(f.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create access log dir: %w", err)
+		}
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log file: %w", err)
+	}
+	f.file, f.size, f.opened = file, 0, time.Now()
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		f.size, f.opened = info.Size(), info.ModTime()
+	}
+	return nil
+}
+
+// Write implements io.Writer, rotating the file before a line that would
+// exceed max_size or once the file is older than rotate_interval. When the
+// rotation fails, the line is written to the current file and the rotation
+// error is returned; the next line tries to rotate again.
+func (f *rotatingFile) Write(line []byte) (int, error) {
+	var rotateErr error
+	if f.size > 0 && (f.maxSize > 0 && f.size+int64(len(line)) > f.maxSize || f.interval > 0 && time.Since(f.opened) >= f.interval) {
+		rotateErr = f.rotate()
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// rotate renames the file to path.<timestamp>, reopens it and removes the
+// oldest backups. The current file is only closed once the new one is open;
+// on failure it stays open at its original path.
+func (f *rotatingFile) rotate() error {
+	backup := f.path + "." + time.Now().UTC().Format("20060102T150405.000000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate access log file: %w", err)
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		if renameErr := os.Rename(backup, f.path); renameErr != nil {
+			return fmt.Errorf("%w, writing to %s: %v", err, backup, renameErr)
+		}
+		return err
+	}
+	old.Close()
+
+	if f.maxBackups > 0 {
+		backups, _ := filepath.Glob(f.path + ".*")
+		sort.Strings(backups)
+		for len(backups) > f.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return nil
+}
+
+// Close implements io.Closer
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
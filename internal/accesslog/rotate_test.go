@@ -0,0 +1,61 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateKeepsFileOpenWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("first line\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming a removed file fails
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte("second line\n")
+	n, err := f.Write(line)
+	if err == nil {
+		t.Fatal("failed rotation not reported")
+	}
+	if n != len(line) {
+		t.Fatalf("wrote %d bytes after the failed rotation, want %d: %v", n, len(line), err)
+	}
+	if _, err := f.file.Write(line); err != nil {
+		t.Fatalf("file closed by the failed rotation: %v", err)
+	}
+}
+
+func TestRotateRenamesAndReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"first line\n", "second line\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second line\n" {
+		t.Fatalf("log file %q, %v, want the line after rotation", data, err)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("backups %v, want 1", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != "first line\n" {
+		t.Fatalf("backup %q, want the line before rotation", data)
+	}
+}
@@ -0,0 +1,181 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+// defaultSinkBuffer is the number of lines queued for a sink when no buffer size is configured
+const defaultSinkBuffer = 4096
+
+var (
+	droppedLines = metrics.NewCounterVec(
+		"gateway_access_log_dropped_total",
+		"Access log lines dropped because the sink's queue was full.",
+		"sink",
+	)
+	failedLines = metrics.NewCounterVec(
+		"gateway_access_log_errors_total",
+		"Access log lines that a sink failed to write.",
+		"sink",
+	)
+)
+
+// PublishFunc publishes an access log line to a topic of a named broker
+type PublishFunc func(ctx context.Context, broker, topic string, line []byte) error
+
+// sink writes access log lines in the background. Lines are dropped when the
+// queue is full, so a slow sink never delays requests.
+type sink struct {
+	name   string
+	format string
+	out    io.WriteCloser
+	logger *slog.Logger
+
+	mu     sync.RWMutex // Guards sending on lines against close
+	closed bool
+	lines  chan []byte
+	done   chan struct{}
+	lost   atomic.Uint64
+}
+
+// newSink opens the destination of a sink and starts its writer
+func newSink(cfg config.AccessLogSinkConfig, format string, publish PublishFunc, logger *slog.Logger) (*sink, error) {
+	out, err := openSink(cfg, publish)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultSinkBuffer
+	}
+	s := &sink{
+		name:   name,
+		format: format,
+		out:    out,
+		logger: logger,
+		lines:  make(chan []byte, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// openSink opens the destination of a sink type
+func openSink(cfg config.AccessLogSinkConfig, publish PublishFunc) (io.WriteCloser, error) {
+	switch cfg.Type {
+	case "", "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("access log file sink requires a path")
+		}
+		return openRotatingFile(cfg.Path, cfg.MaxSize, cfg.RotateInterval, cfg.MaxBackups)
+	case "syslog":
+		return openSyslog(cfg.Network, cfg.Address, cfg.Tag)
+	case "kafka":
+		if cfg.Broker == "" || cfg.Topic == "" {
+			return nil, fmt.Errorf("access log kafka sink requires a broker and a topic")
+		}
+		if publish == nil {
+			return nil, fmt.Errorf("access log kafka sink requires brokers")
+		}
+		return &topicWriter{publish: publish, broker: cfg.Broker, topic: cfg.Topic}, nil
+	default:
+		return nil, fmt.Errorf("unsupported access log sink type: %s", cfg.Type)
+	}
+}
+
+// write queues a line, dropping it when the queue is full
+func (s *sink) write(line []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.lines <- line:
+	default:
+		s.lost.Add(1)
+		droppedLines.Inc(s.name)
+	}
+}
+
+// run writes lines until the sink is closed
+func (s *sink) run() {
+	defer close(s.done)
+	for line := range s.lines {
+		if _, err := s.out.Write(line); err != nil {
+			failedLines.Inc(s.name)
+			s.logger.Debug("Failed to write access log line", "sink", s.name, "error", err)
+		}
+	}
+	if err := s.out.Close(); err != nil {
+		s.logger.Warn("Failed to close access log sink", "sink", s.name, "error", err)
+	}
+}
+
+// close writes the queued lines and closes the destination
+func (s *sink) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.lines)
+	s.mu.Unlock()
+
+	<-s.done
+	if lost := s.lost.Load(); lost > 0 {
+		s.logger.Warn("Access log lines were dropped because the sink fell behind", "sink", s.name, "dropped", lost)
+	}
+}
+
+// nopCloser leaves the standard streams open
+type nopCloser struct {
+	io.Writer
+}
+
+// Close implements io.Closer
+func (nopCloser) Close() error {
+	return nil
+}
+
+// topicWriter publishes each line as a message to a broker topic
+type topicWriter struct {
+	publish PublishFunc
+	broker  string
+	topic   string
+}
+
+// Write implements io.Writer, publishing the line without its newline
+func (w *topicWriter) Write(line []byte) (int, error) {
+	payload := line
+	if n := len(payload); n > 0 && payload[n-1] == '\n' {
+		payload = payload[:n-1]
+	}
+	if err := w.publish(context.Background(), w.broker, w.topic, payload); err != nil {
+		return 0, err
+	}
+	return len(line), nil
+}
+
+// Close implements io.Closer; the broker is closed with the other brokers
+func (w *topicWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// defaultSyslogTag tags access log messages when no tag is configured
+const defaultSyslogTag = "heytom-gateway"
+
+// openSyslog connects to a syslog server, or the local syslog daemon when network is empty
+func openSyslog(network, address, tag string) (io.WriteCloser, error) {
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
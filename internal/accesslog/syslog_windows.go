@@ -0,0 +1,13 @@
+//go:build windows
+
+package accesslog
+
+import (
+	"fmt"
+	"io"
+)
+
+// openSyslog fails because log/syslog is not available on Windows
+func openSyslog(network, address, tag string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("access log syslog sink is not supported on windows")
+}
@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Handler serves the gateway admin API under /admin/
+type Handler struct {
+	mux   *http.ServeMux
+	open  *http.ServeMux // Endpoints that authenticate requests themselves
+	token string
+}
+
+// New creates an admin handler; a non-empty token requires "Authorization: Bearer <token>"
+func New(token string) *Handler {
+	return &Handler{
+		mux:   http.NewServeMux(),
+		open:  http.NewServeMux(),
+		token: token,
+	}
+}
+
+// Handle registers an admin endpoint; pattern follows http.ServeMux syntax, e.g. "GET /admin/descriptors"
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers an admin endpoint function
+func (h *Handler) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	h.mux.HandleFunc(pattern, handler)
+}
+
+// HandleUnauthenticated registers an endpoint that is not checked against the
+// admin token, for callers such as webhooks that authenticate in their own way
+func (h *Handler) HandleUnauthenticated(pattern string, handler http.Handler) {
+	h.open.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, pattern := h.open.Handler(r); pattern != "" {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized checks the bearer token when one is configured
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// WriteJSON writes v as a JSON response
+func WriteJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// WriteError writes a JSON error response
+func WriteError(w http.ResponseWriter, code int, msg string) {
+	WriteJSON(w, code, map[string]string{"error": msg})
+}
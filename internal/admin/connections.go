@@ -0,0 +1,14 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+)
+
+// ConnectionsHandler lists pooled upstream connections with their state, age and reuse counts
+func ConnectionsHandler(pool *proxy.ConnectionPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, pool.Stats())
+	}
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+)
+
+// DescriptorsHandler lists all loaded services, methods and message schemas
+func DescriptorsHandler(loader *proto.DescriptorLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			WriteError(w, http.StatusServiceUnavailable, "no descriptors loaded")
+			return
+		}
+		WriteJSON(w, http.StatusOK, loader.Describe())
+	}
+}
+
+// DescriptorVersionsHandler lists the recent descriptor snapshots of every protoset source
+func DescriptorVersionsHandler(loader *proto.DescriptorLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			WriteError(w, http.StatusServiceUnavailable, "no descriptors loaded")
+			return
+		}
+		WriteJSON(w, http.StatusOK, loader.Versions())
+	}
+}
+
+// DescriptorDiffHandler shows the services and methods that changed between two
+// snapshots of a source.
+//
+// Query parameters: source (required), from and to (default: the current
+// snapshot and the one before it).
+func DescriptorDiffHandler(loader *proto.DescriptorLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			WriteError(w, http.StatusServiceUnavailable, "no descriptors loaded")
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("source") == "" {
+			WriteError(w, http.StatusBadRequest, "source is required")
+			return
+		}
+		diff, err := loader.Diff(q.Get("source"), q.Get("from"), q.Get("to"))
+		if err != nil {
+			WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, diff)
+	}
+}
+
+// DescriptorRollbackHandler makes a previous snapshot of a source current again.
+// rebuild refreshes registries derived from the descriptors and may be nil.
+//
+// Query parameters: source and version (both required).
+func DescriptorRollbackHandler(loader *proto.DescriptorLoader, rebuild func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			WriteError(w, http.StatusServiceUnavailable, "no descriptors loaded")
+			return
+		}
+		q := r.URL.Query()
+		source, version := q.Get("source"), q.Get("version")
+		if source == "" || version == "" {
+			WriteError(w, http.StatusBadRequest, "source and version are required")
+			return
+		}
+		if err := loader.Rollback(source, version); err != nil {
+			WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if rebuild != nil {
+			if err := rebuild(); err != nil {
+				WriteError(w, http.StatusInternalServerError, "rolled back, but the proxy keeps serving the previous descriptors: "+err.Error())
+				return
+			}
+		}
+		diff, err := loader.Diff(source, "", "")
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, diff)
+	}
+}
@@ -0,0 +1,14 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/latency"
+)
+
+// LatencyHandler reports p50/p95/p99 latency per method
+func LatencyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, latency.Summary())
+	}
+}
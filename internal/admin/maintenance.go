@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+)
+
+// maxMaintenanceBodySize limits the body of a maintenance action
+const maxMaintenanceBodySize = 64 << 10
+
+// maintenanceResult is the response of a maintenance action
+type maintenanceResult struct {
+	maintenance.Status
+	RegistryError string `json:"registry_error,omitempty"`
+}
+
+// MaintenanceStatusHandler shows the gateway and services under maintenance
+func MaintenanceStatusHandler(m *maintenance.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, m.Status())
+	}
+}
+
+// MaintenanceEnableHandler puts the gateway into maintenance, or the upstream
+// service of the {service} path value when present.
+//
+// The optional JSON body sets "reason", "routes" ("package.Service/Method"
+// globs, all routes when empty) and "retry_after_seconds".
+func MaintenanceEnableHandler(m *maintenance.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mode maintenance.Mode
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxMaintenanceBodySize)).Decode(&mode); err != nil && !errors.Is(err, io.EOF) {
+			WriteError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if err := mode.Validate(); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		result := maintenanceResult{}
+		if service := r.PathValue("service"); service != "" {
+			m.EnableService(service, mode)
+		} else if err := m.Enable(r.Context(), mode); err != nil {
+			// Requests are rejected, only the registry could not be updated
+			result.RegistryError = err.Error()
+		}
+		result.Status = m.Status()
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// MaintenanceDisableHandler resumes the gateway, or the upstream service of
+// the {service} path value when present
+func MaintenanceDisableHandler(m *maintenance.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if service := r.PathValue("service"); service != "" {
+			if !m.DisableService(service) {
+				WriteError(w, http.StatusNotFound, "service "+service+" is not under maintenance")
+				return
+			}
+			WriteJSON(w, http.StatusOK, maintenanceResult{Status: m.Status()})
+			return
+		}
+		result := maintenanceResult{}
+		if err := m.Disable(r.Context()); err != nil {
+			result.RegistryError = err.Error()
+		}
+		result.Status = m.Status()
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// MethodDisableHandler disables the {service}/{method} route. The optional
+// JSON body sets "code" (UNAVAILABLE, the default, or UNIMPLEMENTED) and the
+// "message" returned to callers.
+func MethodDisableHandler(m *maintenance.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		disabled := maintenance.DisabledMethod{Code: codes.Unavailable}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxMaintenanceBodySize)).Decode(&disabled); err != nil && !errors.Is(err, io.EOF) {
+			WriteError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		disabled.Source = maintenance.SourceAdmin
+		if err := m.DisableMethod(r.PathValue("service")+"/"+r.PathValue("method"), disabled); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, maintenanceResult{Status: m.Status()})
+	}
+}
+
+// MethodRestoreHandler forwards the requests to the disabled {service}/{method}
+// route again
+func MethodRestoreHandler(m *maintenance.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := r.PathValue("service") + "/" + r.PathValue("method")
+		if !m.RestoreMethod(route) {
+			WriteError(w, http.StatusNotFound, "method "+route+" is not disabled")
+			return
+		}
+		WriteJSON(w, http.StatusOK, maintenanceResult{Status: m.Status()})
+	}
+}
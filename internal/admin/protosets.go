@@ -0,0 +1,251 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+)
+
+// Size limits of uploaded protosets and webhook payloads
+const (
+	maxProtosetSize = 32 << 20
+	maxWebhookSize  = 1 << 20
+)
+
+// webhookTolerance is how far the timestamp of a webhook delivery may be from
+// the gateway's clock; older deliveries are rejected as replays
+const webhookTolerance = 5 * time.Minute
+
+// uploadResult is the response of a protoset upload
+type uploadResult struct {
+	Service         string   `json:"service"`
+	Version         string   `json:"version"`
+	BreakingChanges []string `json:"breaking_changes"`
+}
+
+// ProtosetUploadHandler loads the protoset in the request body as the
+// descriptors of the {service} path value and applies it immediately.
+// The protoset must be self-contained and define the service; breaking changes
+// are handled according to breaking (see ProtoHotReloadConfig.BreakingChanges).
+// rebuild refreshes registries derived from the descriptors and may be nil.
+func ProtosetUploadHandler(loader *proto.DescriptorLoader, rebuild func() error, breaking string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			WriteError(w, http.StatusServiceUnavailable, "no descriptors loaded")
+			return
+		}
+		service := r.PathValue("service")
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProtosetSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				WriteError(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := proto.ValidateProtoset(service, data); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		changes, err := loader.CheckBreakingChanges(service, data, breaking)
+		if err != nil {
+			WriteJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "breaking_changes": changes})
+			return
+		}
+		if err := loader.LoadProtosetData(service, data); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if rebuild != nil {
+			if err := rebuild(); err != nil {
+				WriteError(w, http.StatusInternalServerError, "protoset loaded, but the proxy keeps serving the previous descriptors: "+err.Error())
+				return
+			}
+		}
+
+		result := uploadResult{Service: service, BreakingChanges: changes}
+		if result.BreakingChanges == nil {
+			result.BreakingChanges = []string{}
+		}
+		if versions := loader.Versions()[service]; len(versions) > 0 {
+			result.Version = versions[0].Version
+		}
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// protosetReload is the reload result of one service
+type protosetReload struct {
+	Service string `json:"service"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProtosetReloadHandler reloads protosets on demand instead of waiting for the
+// next check period. The service query parameter limits the reload to one
+// service; the response lists the result of every reloaded service.
+func ProtosetReloadHandler(mgr *proto.HotReloadManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var results []protosetReload
+		if service := r.URL.Query().Get("service"); service != "" {
+			if !registered(mgr, service) {
+				WriteError(w, http.StatusNotFound, "no protoset registered for service "+service)
+				return
+			}
+			result := protosetReload{Service: service}
+			if err := mgr.ReloadServiceProtoset(service); err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		} else {
+			errs := mgr.ReloadAll()
+			for _, ps := range mgr.GetRegisteredProtosets() {
+				result := protosetReload{Service: ps.ServiceName}
+				if err := errs[ps.ServiceName]; err != nil {
+					result.Error = err.Error()
+				}
+				results = append(results, result)
+			}
+			sort.Slice(results, func(i, j int) bool { return results[i].Service < results[j].Service })
+		}
+
+		code := http.StatusOK
+		for _, result := range results {
+			if result.Error != "" {
+				code = http.StatusInternalServerError
+			}
+		}
+		WriteJSON(w, code, map[string]any{"reloaded": results})
+	}
+}
+
+// ProtosetStatusHandler reports the reload health of every protoset source:
+// whether the last reload succeeded, the last error and when polling retries
+// a failing source
+func ProtosetStatusHandler(mgr *proto.HotReloadManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]any{"protosets": mgr.Status()})
+	}
+}
+
+// registered reports whether the hot reload manager tracks a protoset for service
+func registered(mgr *proto.HotReloadManager, service string) bool {
+	for _, ps := range mgr.GetRegisteredProtosets() {
+		if ps.ServiceName == service {
+			return true
+		}
+	}
+	return false
+}
+
+// ProtosetWebhookHandler receives publish notifications from artifact
+// repositories. Each delivery carries its unix time in an X-Webhook-Timestamp
+// header and is signed with secret in an X-Hub-Signature-256 header: "sha256="
+// followed by the hex HMAC-SHA256 of "<timestamp>.<service>.<body>", where
+// service is the service query parameter (empty when absent). Deliveries more
+// than webhookTolerance away from the current time, and repeated signatures
+// within it, are rejected so a captured delivery cannot be replayed. The
+// service query parameter selects the protoset to reload; otherwise protosets
+// whose location is mentioned in the payload are reloaded, or all of them when
+// none is. Reloads run in the background so the sender is answered immediately.
+func ProtosetWebhookHandler(mgr *proto.HotReloadManager, secret string) http.HandlerFunc {
+	seen := &deliveries{signatures: make(map[string]time.Time)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		timestamp := r.Header.Get("X-Webhook-Timestamp")
+		service := r.URL.Query().Get("service")
+		signature := r.Header.Get("X-Hub-Signature-256")
+		if !validSignature(secret, signedContent(timestamp, service, payload), signature) {
+			WriteError(w, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+		sent, err := strconv.ParseInt(timestamp, 10, 64)
+		now := time.Now()
+		if err != nil || now.Sub(time.Unix(sent, 0)).Abs() > webhookTolerance {
+			WriteError(w, http.StatusUnauthorized, "stale or missing X-Webhook-Timestamp")
+			return
+		}
+		if !seen.add(signature, now) {
+			WriteError(w, http.StatusConflict, "delivery already received")
+			return
+		}
+
+		var services []string
+		if service != "" {
+			services = []string{service}
+		} else {
+			services = mgr.MatchProtosets(payload)
+		}
+		mgr.TriggerReload(services...)
+		if services == nil {
+			services = []string{}
+		}
+		WriteJSON(w, http.StatusAccepted, map[string]any{"services": services})
+	}
+}
+
+// signedContent returns the content covered by a webhook signature
+func signedContent(timestamp, service string, payload []byte) []byte {
+	content := make([]byte, 0, len(timestamp)+len(service)+len(payload)+2)
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	content = append(content, service...)
+	content = append(content, '.')
+	return append(content, payload...)
+}
+
+// deliveries remembers the signatures of recent webhook deliveries
+type deliveries struct {
+	mu         sync.Mutex
+	signatures map[string]time.Time // Signature to the time it was received
+}
+
+// add records a signature, reporting false when it was already received
+// within webhookTolerance
+func (d *deliveries) add(signature string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// A timestamp is accepted for up to twice the tolerance after it is first seen
+	for sig, received := range d.signatures {
+		if now.Sub(received) > 2*webhookTolerance {
+			delete(d.signatures, sig)
+		}
+	}
+	if _, ok := d.signatures[signature]; ok {
+		return false
+	}
+	d.signatures[signature] = now
+	return true
+}
+
+// validSignature checks a "sha256=<hex>" HMAC signature of content
+func validSignature(secret string, content []byte, signature string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	return hmac.Equal(got, mac.Sum(nil))
+}
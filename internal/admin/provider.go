@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+	"github.com/heytom-labs/heytom-gateway/internal/tap"
+	"github.com/heytom-labs/heytom-gateway/internal/upstreams"
+)
+
+// ProviderSet admin API provider set
+var ProviderSet = wire.NewSet(
+	ProvideHandler,
+)
+
+// ProvideHandler provides the admin API handler, or nil when the admin API is disabled
+func ProvideHandler(cfg *config.Config, loader *proto.DescriptorLoader, httpProxy *proxy.HTTPProxy, pool *proxy.ConnectionPool, hub *tap.Hub, watcher *reload.Watcher, hotReload *proto.HotReloadManager, tracker *upstreams.Tracker, maintenanceManager *maintenance.Manager) *Handler {
+	if !cfg.Admin.Enabled {
+		return nil
+	}
+
+	h := New(cfg.Admin.Token)
+	h.HandleFunc("GET /admin/descriptors", DescriptorsHandler(loader))
+	h.HandleFunc("GET /admin/descriptors/versions", DescriptorVersionsHandler(loader))
+	h.HandleFunc("GET /admin/descriptors/diff", DescriptorDiffHandler(loader))
+	var rebuild func() error
+	if httpProxy != nil {
+		rebuild = httpProxy.RebuildDescriptors
+	}
+	h.HandleFunc("POST /admin/descriptors/rollback", DescriptorRollbackHandler(loader, rebuild))
+	// Uploading descriptors changes what the gateway serves, so it is only
+	// available when the admin API is authenticated
+	if cfg.Admin.Token != "" {
+		h.HandleFunc("POST /admin/protosets/{service}", ProtosetUploadHandler(loader, rebuild, cfg.Proto.HotReload.BreakingChanges))
+	}
+	if hotReload != nil {
+		h.HandleFunc("POST /admin/reload", ProtosetReloadHandler(hotReload))
+		h.HandleFunc("GET /admin/protosets/status", ProtosetStatusHandler(hotReload))
+		if secret := cfg.Proto.HotReload.WebhookSecret; secret != "" {
+			h.HandleUnauthenticated("POST /admin/webhooks/protosets", ProtosetWebhookHandler(hotReload, secret))
+		}
+	}
+	h.HandleFunc("GET /admin/latency", LatencyHandler())
+	h.HandleFunc("GET /admin/connections", ConnectionsHandler(pool))
+	h.HandleFunc("GET /admin/upstreams", UpstreamsHandler(tracker))
+	h.HandleFunc("GET /admin/maintenance", MaintenanceStatusHandler(maintenanceManager))
+	h.HandleFunc("POST /admin/maintenance", MaintenanceEnableHandler(maintenanceManager))
+	h.HandleFunc("DELETE /admin/maintenance", MaintenanceDisableHandler(maintenanceManager))
+	h.HandleFunc("POST /admin/maintenance/services/{service}", MaintenanceEnableHandler(maintenanceManager))
+	h.HandleFunc("DELETE /admin/maintenance/services/{service}", MaintenanceDisableHandler(maintenanceManager))
+	h.HandleFunc("POST /admin/maintenance/methods/{service}/{method}", MethodDisableHandler(maintenanceManager))
+	h.HandleFunc("DELETE /admin/maintenance/methods/{service}/{method}", MethodRestoreHandler(maintenanceManager))
+	if hub != nil {
+		h.HandleFunc("GET /admin/tap", hub.Handler())
+	}
+	if watcher != nil {
+		h.HandleFunc("POST /admin/config/reload", ReloadHandler(watcher))
+		h.HandleFunc("GET /admin/config/reload", LastReloadHandler(watcher))
+	}
+	return h
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ReloadHandler reloads the config file and reports which fields were applied
+// and which require a restart
+func ReloadHandler(watcher *reload.Watcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := watcher.Reload()
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
+
+// LastReloadHandler returns the report of the most recent config reload
+func LastReloadHandler(watcher *reload.Watcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := watcher.LastReport()
+		if report == nil {
+			WriteError(w, http.StatusNotFound, "config has not been reloaded")
+			return
+		}
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,15 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/upstreams"
+)
+
+// UpstreamsHandler lists every known upstream service with its instance
+// counts, circuit state, recent error rate and last discovery refresh
+func UpstreamsHandler(tracker *upstreams.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, tracker.Snapshot(r.Context()))
+	}
+}
@@ -0,0 +1,176 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Request is the authorization check sent to the external service
+type Request struct {
+	Protocol   string            `json:"protocol"` // http or grpc
+	Service    string            `json:"service"`  // Full protobuf service name
+	Method     string            `json:"method"`   // Method name
+	Tenant     string            `json:"tenant,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Claims     map[string]any    `json:"claims,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+}
+
+// Decision is the authorization result returned by the external service
+type Decision struct {
+	Allowed bool              `json:"allowed"`
+	Status  int               `json:"status,omitempty"`  // HTTP status to return on denial
+	Reason  string            `json:"reason,omitempty"`  // Human readable reason
+	Headers map[string]string `json:"headers,omitempty"` // Headers to add to the upstream request
+	// Claims of the caller authenticated by the service, e.g. from a verified
+	// token. They replace the claims of the request context for the rest of
+	// the request: route rules and tenant derivation see them.
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+// ErrUnavailable is returned when the authorization service cannot be
+// reached and fail-open is disabled. The cause is logged, not returned, so
+// addresses and TLS details of the service are not exposed to clients.
+var ErrUnavailable = errors.New("authorization service unavailable")
+
+// Authorizer delegates authorization decisions to an external service
+type Authorizer interface {
+	Check(ctx context.Context, req *Request) (*Decision, error)
+}
+
+// DeniedError is returned when a request is rejected by the authorization service
+type DeniedError struct {
+	Decision *Decision
+}
+
+// Error implements error
+func (e *DeniedError) Error() string {
+	if e.Decision.Reason != "" {
+		return "permission denied: " + e.Decision.Reason
+	}
+	return "permission denied"
+}
+
+// HTTPStatus returns the HTTP status code for the denial
+func (e *DeniedError) HTTPStatus() int {
+	if e.Decision.Status != 0 {
+		return e.Decision.Status
+	}
+	return http.StatusForbidden
+}
+
+// GRPCCode returns the gRPC status code for the denial
+func (e *DeniedError) GRPCCode() codes.Code {
+	if e.Decision.Status == http.StatusUnauthorized {
+		return codes.Unauthenticated
+	}
+	return codes.PermissionDenied
+}
+
+// Client wraps an Authorizer with timeout and fail-open/fail-closed handling
+type Client struct {
+	authorizer     Authorizer
+	timeout        atomic.Int64 // time.Duration
+	failOpen       atomic.Bool
+	forwardHeaders map[string]bool
+	logger         *slog.Logger
+}
+
+// NewClient creates an authorization client
+func NewClient(authorizer Authorizer, timeout time.Duration, failOpen bool, forwardHeaders []string, logger *slog.Logger) *Client {
+	var allowed map[string]bool
+	if len(forwardHeaders) > 0 {
+		allowed = make(map[string]bool, len(forwardHeaders))
+		for _, h := range forwardHeaders {
+			allowed[strings.ToLower(h)] = true
+		}
+	}
+	c := &Client{
+		authorizer:     authorizer,
+		forwardHeaders: allowed,
+		logger:         logger,
+	}
+	c.SetPolicy(timeout, failOpen)
+	return c
+}
+
+// SetPolicy updates the timeout and fail-open behaviour at runtime
+func (c *Client) SetPolicy(timeout time.Duration, failOpen bool) {
+	c.timeout.Store(int64(timeout))
+	c.failOpen.Store(failOpen)
+}
+
+// Authorize checks the request against the external service.
+// It returns the decision on success, a *DeniedError when the request is rejected,
+// or ErrUnavailable when the service is unavailable and fail-open is disabled.
+func (c *Client) Authorize(ctx context.Context, req *Request) (*Decision, error) {
+	if timeout := time.Duration(c.timeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	decision, err := c.authorizer.Check(ctx, req)
+	if err != nil {
+		if c.failOpen.Load() {
+			c.logger.Warn("Authorization service unavailable, allowing request (fail-open)",
+				"service", req.Service, "method", req.Method, "error", err)
+			return &Decision{Allowed: true}, nil
+		}
+		c.logger.Error("Authorization service unavailable, rejecting request (fail-closed)",
+			"service", req.Service, "method", req.Method, "error", err)
+		return nil, ErrUnavailable
+	}
+
+	if !decision.Allowed {
+		return nil, &DeniedError{Decision: decision}
+	}
+	return decision, nil
+}
+
+// HeadersFromHTTP collects the forwarded headers of an HTTP request
+func (c *Client) HeadersFromHTTP(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for key, values := range h {
+		key = strings.ToLower(key)
+		if len(values) == 0 || !c.forwarded(key) {
+			continue
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+	return headers
+}
+
+// HeadersFromMetadata collects the forwarded headers of gRPC metadata
+func (c *Client) HeadersFromMetadata(md metadata.MD) map[string]string {
+	headers := make(map[string]string, len(md))
+	for key, values := range md {
+		if len(values) == 0 || strings.HasSuffix(key, "-bin") || !c.forwarded(key) {
+			continue
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+	return headers
+}
+
+// forwarded reports whether a header should be sent to the authorization service
+func (c *Client) forwarded(key string) bool {
+	return c.forwardHeaders == nil || c.forwardHeaders[key]
+}
+
+// IsDenied reports whether err is an authorization denial
+func IsDenied(err error) (*DeniedError, bool) {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		return denied, true
+	}
+	return nil, false
+}
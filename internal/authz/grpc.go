@@ -0,0 +1,71 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// CheckMethod is the full gRPC method invoked on the authorization service.
+// Both the request and the response are google.protobuf.Struct messages
+// carrying the JSON form of Request and Decision.
+const CheckMethod = "/heytom.gateway.authz.v1.Authorization/Check"
+
+// GRPCAuthorizer checks requests against a gRPC authorization service
+type GRPCAuthorizer struct {
+	conn *grpc.ClientConn
+}
+
+// NewGRPCAuthorizer creates a gRPC authorizer
+func NewGRPCAuthorizer(target string) (*GRPCAuthorizer, error) {
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial authorization service: %w", err)
+	}
+	return &GRPCAuthorizer{conn: conn}, nil
+}
+
+// Check implements Authorizer
+func (a *GRPCAuthorizer) Check(ctx context.Context, req *Request) (*Decision, error) {
+	in, err := toStruct(req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &structpb.Struct{}
+	if err := a.conn.Invoke(ctx, CheckMethod, in, out); err != nil {
+		return nil, fmt.Errorf("authorization request failed: %w", err)
+	}
+
+	data, err := out.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal authorization response: %w", err)
+	}
+	decision := &Decision{}
+	if err := json.Unmarshal(data, decision); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization response: %w", err)
+	}
+	return decision, nil
+}
+
+// Close closes the connection to the authorization service
+func (a *GRPCAuthorizer) Close() error {
+	return a.conn.Close()
+}
+
+// toStruct converts the request into a google.protobuf.Struct
+func toStruct(req *Request) (*structpb.Struct, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal authorization request: %w", err)
+	}
+	s := &structpb.Struct{}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to convert authorization request: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,68 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPAuthorizer checks requests against an HTTP authorization service.
+// The request is POSTed as JSON; a 2xx response allows the request and any
+// other status denies it. An optional JSON Decision body refines the result.
+type HTTPAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPAuthorizer creates an HTTP authorizer
+func NewHTTPAuthorizer(url string) *HTTPAuthorizer {
+	return &HTTPAuthorizer{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+// Check implements Authorizer
+func (a *HTTPAuthorizer) Check(ctx context.Context, req *Request) (*Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal authorization request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("authorization request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("authorization service returned status code %d", resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization response: %w", err)
+	}
+
+	// The status code decides by default; a JSON body may refine the result
+	decision := &Decision{Allowed: true}
+	if len(bytes.TrimSpace(respBody)) > 0 {
+		_ = json.Unmarshal(respBody, decision)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		decision.Allowed = false
+		if decision.Status == 0 {
+			decision.Status = resp.StatusCode
+		}
+	}
+	return decision, nil
+}
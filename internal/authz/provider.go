@@ -0,0 +1,50 @@
+package authz
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet authorization provider set
+var ProviderSet = wire.NewSet(
+	ProvideClient,
+)
+
+// ProvideClient provides the external authorization client, or nil when disabled
+func ProvideClient(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher) (*Client, error) {
+	authzCfg := cfg.ExtAuthz
+	if !authzCfg.Enabled {
+		return nil, nil
+	}
+
+	var authorizer Authorizer
+	switch authzCfg.Type {
+	case "", "http":
+		authorizer = NewHTTPAuthorizer(authzCfg.Address)
+	case "grpc":
+		grpcAuthorizer, err := NewGRPCAuthorizer(authzCfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		authorizer = grpcAuthorizer
+	default:
+		return nil, fmt.Errorf("unsupported ext_authz type: %s", authzCfg.Type)
+	}
+
+	client := NewClient(authorizer, authzCfg.Timeout, authzCfg.FailOpen, authzCfg.ForwardHeaders,
+		logger.Component(log, "authz"))
+	watcher.OnChange("ext_authz.timeout", client.applyPolicy)
+	watcher.OnChange("ext_authz.fail_open", client.applyPolicy)
+	return client, nil
+}
+
+// applyPolicy applies a reloaded timeout and fail-open setting
+func (c *Client) applyPolicy(_, next *config.Config) error {
+	c.SetPolicy(next.ExtAuthz.Timeout, next.ExtAuthz.FailOpen)
+	return nil
+}
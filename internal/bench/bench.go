@@ -0,0 +1,239 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+)
+
+// Options configures a load test of one method
+type Options struct {
+	HTTPTarget  string            // Base URL of the gateway's HTTP listener, e.g. http://staging:8080
+	GRPCTarget  string            // Address of the gateway's gRPC listener, used when HTTPTarget is empty
+	TLS         bool              // Connect to the gRPC target with TLS
+	Service     string            // Fully-qualified service name
+	Method      string            // Method name
+	Body        []byte            // JSON request body for HTTP, protobuf-encoded request message for gRPC
+	Headers     map[string]string // Headers or metadata set on every request
+	Rate        float64           // Requests started per second (0 means 10)
+	Duration    time.Duration     // How long requests are started (0 means 10s)
+	Concurrency int               // Requests in flight at most; ticks finding none free are dropped (0 means 100)
+	Timeout     time.Duration     // Bound on each request (0 means 10s)
+}
+
+// Report summarizes a load test
+type Report struct {
+	Duration  time.Duration  // Time from the first request to the last response
+	Requests  int            // Requests sent
+	Errors    int            // Requests that failed or got an error status
+	Dropped   int            // Ticks skipped because Concurrency requests were in flight
+	Statuses  map[string]int // Requests by HTTP status, gRPC code, or "error" when no response arrived
+	latencies []time.Duration
+}
+
+// Percentile returns the latency below which the fraction q of the requests completed
+func (r *Report) Percentile(q float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(r.latencies))+0.5) - 1
+	return r.latencies[min(max(i, 0), len(r.latencies)-1)]
+}
+
+// Max returns the highest latency
+func (r *Report) Max() time.Duration {
+	return r.Percentile(1)
+}
+
+// Rate returns the achieved requests per second
+func (r *Report) Rate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// ErrorRate returns the fraction of requests that failed
+func (r *Report) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+// Run starts requests at opts.Rate for opts.Duration, waits for the
+// outstanding ones and reports the results. Requests run open-loop: a slow
+// target does not lower the offered rate, extra requests are dropped once
+// opts.Concurrency are in flight. Canceling ctx stops starting requests.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Service == "" || opts.Method == "" {
+		return nil, fmt.Errorf("a service and method are required")
+	}
+	if opts.Rate <= 0 {
+		opts.Rate = 10
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = 10 * time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 100
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	send, closeTarget, err := newSender(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTarget()
+
+	report := &Report{Statuses: make(map[string]int)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer ticker.Stop()
+	timer := time.NewTimer(opts.Duration)
+	defer timer.Stop()
+
+	start := time.Now()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-timer.C:
+			break loop
+		case <-ticker.C:
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			report.Dropped++
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			reqCtx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+			defer cancel()
+			begin := time.Now()
+			code, failed := send(reqCtx)
+			latency := time.Since(begin)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Requests++
+			report.Statuses[code]++
+			if failed {
+				report.Errors++
+			}
+			report.latencies = append(report.latencies, latency)
+		}()
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+	sort.Slice(report.latencies, func(i, j int) bool { return report.latencies[i] < report.latencies[j] })
+	return report, nil
+}
+
+// sender sends one request and returns its status and whether it failed
+type sender func(ctx context.Context) (code string, failed bool)
+
+// newSender returns the sender for the configured target and a function releasing its connections
+func newSender(opts Options) (sender, func(), error) {
+	if opts.HTTPTarget != "" {
+		return httpSender(opts), func() {}, nil
+	}
+	if opts.GRPCTarget == "" {
+		return nil, nil, fmt.Errorf("an HTTP or gRPC target is required")
+	}
+
+	creds := insecure.NewCredentials()
+	if opts.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.Dial(opts.GRPCTarget, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", opts.GRPCTarget, err)
+	}
+	return grpcSender(conn, opts), func() { conn.Close() }, nil
+}
+
+// httpSender posts the JSON body to the gateway's /rpc route of the method
+func httpSender(opts Options) sender {
+	url := strings.TrimSuffix(opts.HTTPTarget, "/") + "/rpc/" + opts.Service + "/" + opts.Method
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.Concurrency
+	client := &http.Client{Transport: transport}
+	return func(ctx context.Context) (string, bool) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(opts.Body))
+		if err != nil {
+			return "error", true
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range opts.Headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "error", true
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return strconv.Itoa(resp.StatusCode), resp.StatusCode >= http.StatusBadRequest
+	}
+}
+
+// grpcSender calls the method with the encoded request message, reading every
+// response so that server streaming calls complete
+func grpcSender(conn *grpc.ClientConn, opts Options) sender {
+	fullMethod := "/" + opts.Service + "/" + opts.Method
+	md := metadata.New(opts.Headers)
+	return func(ctx context.Context) (string, bool) {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+		err := call(ctx, conn, fullMethod, opts.Body)
+		code := status.Code(err)
+		return code.String(), err != nil
+	}
+}
+
+// call sends one request message and receives until the call ends
+func call(ctx context.Context, conn *grpc.ClientConn, fullMethod string, payload []byte) error {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod, grpc.ForceCodec(proxy.Codec()))
+	if err != nil {
+		return err
+	}
+	// io.EOF means the call already ended, its status is returned by RecvMsg
+	if err := stream.SendMsg(&proxy.Frame{Payload: payload}); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	stream.CloseSend()
+	for {
+		if err := stream.RecvMsg(&proxy.Frame{}); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const (
+	defaultTTL         = time.Minute
+	defaultLockTimeout = 5 * time.Second
+
+	// pollInterval is how often a request waiting for another one to fill an
+	// entry checks whether it was stored
+	pollInterval = 20 * time.Millisecond
+)
+
+// Results of a cached call, also sent as the X-Cache response header
+const (
+	Hit    = "HIT"    // Served from a fresh entry
+	Stale  = "STALE"  // Served from an entry older than soft_ttl, refreshed in the background
+	Miss   = "MISS"   // Filled by this request, or by another one it waited for
+	Bypass = "BYPASS" // Called upstream without the cache: the backend failed or the entry was not filled in time
+)
+
+var (
+	requests = metrics.NewCounterVec(
+		"gateway_cache_requests_total",
+		"Requests to cached methods by result: hit, stale, miss or bypass",
+		"service", "method", "result",
+	)
+	refreshes = metrics.NewCounterVec(
+		"gateway_cache_refreshes_total",
+		"Background refreshes of entries older than soft_ttl by result: ok or failed",
+		"result",
+	)
+	backendErrors = metrics.NewCounterVec(
+		"gateway_cache_backend_errors_total",
+		"Failed operations of the cache backend",
+		"op",
+	)
+)
+
+// Store is a cache backend. Values expire after their TTL; locks make a
+// single request fill or refresh an entry, across gateways for a shared
+// backend.
+type Store interface {
+	// Get returns the value of a key, or nil when it is missing
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the value of a key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Lock acquires the lock of a key for at most ttl, returning the token
+	// to release it with, or an empty token when another holder has it
+	Lock(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Unlock releases the lock of a key if token still holds it
+	Unlock(ctx context.Context, key, token string) error
+	// Close releases the resources of the store
+	Close() error
+}
+
+// settings holds the cached methods and expiry, replaced atomically on config reload
+type settings struct {
+	methods     []string
+	ttl         time.Duration
+	softTTL     time.Duration
+	lockTimeout time.Duration
+	vary        []string
+}
+
+// Cache stores the responses of cached methods, protecting upstreams from
+// stampedes: a missing entry is filled by one request while identical
+// requests wait for it, and an entry older than soft_ttl is served while one
+// request refreshes it in the background
+type Cache struct {
+	store    Store
+	settings atomic.Pointer[settings]
+	logger   *slog.Logger
+	wg       sync.WaitGroup // Background refreshes
+}
+
+// New creates the cache of cfg on its backend
+func New(cfg config.CacheConfig, logger *slog.Logger) (*Cache, error) {
+	var store Store
+	switch cfg.Backend {
+	case "", "memory":
+		store = newMemoryStore(cfg.MaxEntries)
+	case "redis":
+		s, err := newRedisStore(cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	default:
+		return nil, fmt.Errorf("unknown cache.backend %q, expected memory or redis", cfg.Backend)
+	}
+	c := &Cache{store: store, logger: logger}
+	if err := c.Update(cfg); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the cached methods, expiry and vary headers
+func (c *Cache) Update(cfg config.CacheConfig) error {
+	for _, pattern := range cfg.Methods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid cache pattern %q: %w", pattern, err)
+		}
+	}
+	s := &settings{methods: cfg.Methods, ttl: cfg.TTL, softTTL: cfg.SoftTTL, lockTimeout: cfg.LockTimeout, vary: cfg.Vary}
+	if s.ttl <= 0 {
+		s.ttl = defaultTTL
+	}
+	if s.softTTL < 0 || s.softTTL > 0 && s.softTTL >= s.ttl {
+		return fmt.Errorf("cache.soft_ttl must be shorter than cache.ttl")
+	}
+	if s.lockTimeout <= 0 {
+		s.lockTimeout = defaultLockTimeout
+	}
+	if len(s.vary) == 0 {
+		s.vary = []string{"Authorization", "Cookie"}
+	}
+	c.settings.Store(s)
+	return nil
+}
+
+// Cached reports whether the responses of a package.Service/Method route are cached
+func (c *Cache) Cached(route string) bool {
+	if c == nil {
+		return false
+	}
+	for _, pattern := range c.settings.Load().methods {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Vary returns the request headers that must be equal for requests to share an entry
+func (c *Cache) Vary() []string {
+	return c.settings.Load().vary
+}
+
+// Do returns the cached response of key or calls call and stores its
+// successful response. Failures of the backend never fail the request, which
+// then calls upstream directly. It returns the result of the lookup.
+func (c *Cache) Do(ctx context.Context, key, service, method string, call func(ctx context.Context) ([]byte, error)) ([]byte, string, error) {
+	s := c.settings.Load()
+	key = hex.EncodeToString([]byte(key))
+	deadline := time.Now().Add(s.lockTimeout)
+	waited := false
+	for {
+		value, err := c.store.Get(ctx, key)
+		if err != nil {
+			return c.bypass(ctx, "get", err, service, method, call)
+		}
+		if value != nil {
+			if stored, body, ok := decode(value); ok {
+				result := Hit
+				if waited {
+					result = Miss
+				} else if s.softTTL > 0 && time.Since(stored) >= s.softTTL {
+					result = Stale
+					c.refresh(ctx, s, key, call)
+				}
+				requests.Inc(service, method, result)
+				return body, result, nil
+			}
+		}
+
+		token, err := c.store.Lock(ctx, key, s.lockTimeout)
+		if err != nil {
+			return c.bypass(ctx, "lock", err, service, method, call)
+		}
+		if token != "" {
+			requests.Inc(service, method, Miss)
+			body, err := c.fill(ctx, s, key, token, call)
+			return body, Miss, err
+		}
+
+		// Another request is filling the entry, possibly on another gateway
+		if time.Now().After(deadline) {
+			requests.Inc(service, method, Bypass)
+			body, err := call(ctx)
+			return body, Bypass, err
+		}
+		waited = true
+		select {
+		case <-ctx.Done():
+			return nil, Miss, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// bypass calls upstream without the cache after a backend failure
+func (c *Cache) bypass(ctx context.Context, op string, err error, service, method string, call func(ctx context.Context) ([]byte, error)) ([]byte, string, error) {
+	backendErrors.Inc(op)
+	c.logger.Debug("Cache backend failed, calling upstream directly", "op", op, "error", err)
+	requests.Inc(service, method, Bypass)
+	body, err := call(ctx)
+	return body, Bypass, err
+}
+
+// fill calls upstream holding the lock of key and stores a successful response
+func (c *Cache) fill(ctx context.Context, s *settings, key, token string, call func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	defer func() {
+		if err := c.store.Unlock(context.WithoutCancel(ctx), key, token); err != nil {
+			backendErrors.Inc("unlock")
+		}
+	}()
+	body, err := call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.store.Set(context.WithoutCancel(ctx), key, encode(time.Now(), body), s.ttl); err != nil {
+		backendErrors.Inc("set")
+		c.logger.Warn("Failed to store cache entry", "error", err)
+	}
+	return body, nil
+}
+
+// refresh refreshes a stale entry in the background unless another request,
+// possibly on another gateway, holds its lock
+func (c *Cache) refresh(ctx context.Context, s *settings, key string, call func(ctx context.Context) ([]byte, error)) {
+	// The refresh outlives the request, whose information is read by the
+	// observers once it completes, so it must not record into it
+	ctx = requestinfo.WithInfo(context.WithoutCancel(ctx), nil)
+	token, err := c.store.Lock(ctx, key, s.lockTimeout)
+	if err != nil {
+		backendErrors.Inc("lock")
+		return
+	}
+	if token == "" {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ctx, cancel := context.WithTimeout(ctx, s.lockTimeout)
+		defer cancel()
+		if _, err := c.fill(ctx, s, key, token, call); err != nil {
+			refreshes.Inc("failed")
+			c.logger.Debug("Failed to refresh cache entry", "error", err)
+			return
+		}
+		refreshes.Inc("ok")
+	}()
+}
+
+// Close waits for the background refreshes and closes the backend
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.wg.Wait()
+	return c.store.Close()
+}
+
+// encode prefixes a response with the time it was stored
+func encode(stored time.Time, body []byte) []byte {
+	value := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint64(value, uint64(stored.UnixNano()))
+	return append(value, body...)
+}
+
+// decode returns the time an entry was stored and its response
+func decode(value []byte) (time.Time, []byte, bool) {
+	if len(value) < 8 {
+		return time.Time{}, nil, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value))), value[8:], true
+}
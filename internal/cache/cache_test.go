@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+func newCache(t *testing.T, cfg config.CacheConfig) *Cache {
+	c, err := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestDoCallsUpstreamOnceForConcurrentMisses(t *testing.T) {
+	c := newCache(t, config.CacheConfig{Methods: []string{"order.OrderService/*"}})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	call := func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("order"), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, result, err := c.Do(context.Background(), "key", "order.OrderService", "GetOrder", call)
+			if err != nil || string(body) != "order" {
+				t.Errorf("Do returned %q, %v", body, err)
+			}
+			results[i] = result
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("upstream called %d times, want 1", calls.Load())
+	}
+	for _, result := range results {
+		if result != Miss {
+			t.Fatalf("results %v, want every request to miss", results)
+		}
+	}
+	if _, result, _ := c.Do(context.Background(), "key", "order.OrderService", "GetOrder", call); result != Hit {
+		t.Fatalf("result %s after the entry was filled, want %s", result, Hit)
+	}
+}
+
+func TestDoDoesNotCacheFailures(t *testing.T) {
+	c := newCache(t, config.CacheConfig{Methods: []string{"*"}})
+	failure := errors.New("unavailable")
+	if _, _, err := c.Do(context.Background(), "key", "s", "m", func(ctx context.Context) ([]byte, error) {
+		return nil, failure
+	}); !errors.Is(err, failure) {
+		t.Fatalf("error %v, want the upstream error", err)
+	}
+	body, result, err := c.Do(context.Background(), "key", "s", "m", func(ctx context.Context) ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil || string(body) != "ok" || result != Miss {
+		t.Fatalf("Do after a failure returned %q, %s, %v", body, result, err)
+	}
+}
+
+func TestDoServesStaleEntryWhileRefreshing(t *testing.T) {
+	c := newCache(t, config.CacheConfig{Methods: []string{"*"}, TTL: time.Minute, SoftTTL: 10 * time.Millisecond})
+	var version atomic.Int32
+	call := func(ctx context.Context) ([]byte, error) {
+		return []byte(strconv.Itoa(int(version.Add(1)))), nil
+	}
+	if _, _, err := c.Do(context.Background(), "key", "s", "m", call); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	body, result, err := c.Do(context.Background(), "key", "s", "m", call)
+	if err != nil || string(body) != "1" || result != Stale {
+		t.Fatalf("Do returned %q, %s, %v, want the stale entry", body, result, err)
+	}
+	c.wg.Wait()
+	body, result, _ = c.Do(context.Background(), "key", "s", "m", call)
+	if string(body) != "2" || result != Hit {
+		t.Fatalf("Do returned %q, %s after the refresh, want the refreshed entry", body, result)
+	}
+}
+
+func TestDoBypassesWhenTheEntryIsNotFilledInTime(t *testing.T) {
+	c := newCache(t, config.CacheConfig{Methods: []string{"*"}, LockTimeout: 50 * time.Millisecond})
+	token, err := c.store.Lock(context.Background(), hex.EncodeToString([]byte("key")), time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("Lock returned %q, %v", token, err)
+	}
+	_, result, err := c.Do(context.Background(), "key", "s", "m", func(ctx context.Context) ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	if err != nil || result != Bypass {
+		t.Fatalf("result %s, %v while another request holds the lock, want %s", result, err, Bypass)
+	}
+}
+
+func TestUpdateValidatesSoftTTL(t *testing.T) {
+	c := newCache(t, config.CacheConfig{})
+	if err := c.Update(config.CacheConfig{TTL: time.Second, SoftTTL: time.Second}); err == nil {
+		t.Fatal("soft_ttl equal to ttl accepted")
+	}
+	if err := c.Update(config.CacheConfig{Methods: []string{"["}}); err == nil {
+		t.Fatal("invalid pattern accepted")
+	}
+}
+
+func TestMemoryStoreEvictsEarliestExpiring(t *testing.T) {
+	s := newMemoryStore(2)
+	ctx := context.Background()
+	s.Set(ctx, "a", []byte("a"), time.Second)
+	s.Set(ctx, "b", []byte("b"), time.Minute)
+	s.Set(ctx, "c", []byte("c"), time.Minute)
+	if value, _ := s.Get(ctx, "a"); value != nil {
+		t.Fatalf("entry expiring first kept: %q", value)
+	}
+	if value, _ := s.Get(ctx, "c"); string(value) != "c" {
+		t.Fatalf("new entry %q", value)
+	}
+}
+
+// fakeRedis serves the commands used by the Redis store
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string) {
+	f := &fakeRedis{values: make(map[string]string)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ := r.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+		io.WriteString(conn, f.reply(args))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, args[0])
+	switch args[0] {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "SET":
+		if len(args) > 3 && args[3] == "NX" {
+			if _, ok := f.values[args[1]]; ok {
+				return "$-1\r\n"
+			}
+		}
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "EVAL":
+		if f.values[args[3]] != args[4] {
+			return ":0\r\n"
+		}
+		delete(f.values, args[3])
+		return ":1\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRedisStore(t *testing.T) {
+	f, address := newFakeRedis(t)
+	s, err := newRedisStore(config.RedisConfig{Address: address, DB: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	if value, err := s.Get(ctx, "key"); value != nil || err != nil {
+		t.Fatalf("Get of a missing key returned %q, %v", value, err)
+	}
+	if err := s.Set(ctx, "key", []byte("value\r\n"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get(ctx, "key"); string(value) != "value\r\n" || err != nil {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	f.mu.Lock()
+	_, prefixed := f.values[defaultKeyPrefix+"key"]
+	f.mu.Unlock()
+	if !prefixed {
+		t.Fatal("key stored without the key prefix")
+	}
+
+	token, err := s.Lock(ctx, "key", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("Lock returned %q, %v", token, err)
+	}
+	if other, err := s.Lock(ctx, "key", time.Minute); other != "" || err != nil {
+		t.Fatalf("second Lock returned %q, %v, want the lock held", other, err)
+	}
+	if err := s.Unlock(ctx, "key", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := s.Lock(ctx, "key", time.Minute); other != "" {
+		t.Fatal("lock released with another token")
+	}
+	if err := s.Unlock(ctx, "key", token); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := s.Lock(ctx, "key", time.Minute); again == "" {
+		t.Fatal("lock not released with its token")
+	}
+
+	// Error replies keep the connection usable
+	if _, err := s.do(ctx, "FLUSHALL"); err == nil {
+		t.Fatal("error reply not returned")
+	}
+	if _, err := s.Get(ctx, "key"); err != nil {
+		t.Fatalf("Get after an error reply: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.commands[0] != "SELECT" {
+		t.Fatalf("commands %v, want the database selected on dial", f.commands)
+	}
+}
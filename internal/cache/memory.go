@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const defaultMaxEntries = 10000
+
+// item is a value or lock of the memory store with its expiry
+type item struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStore keeps entries in the gateway process, shared by its requests only
+type memoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]item
+	locks      map[string]item // Lock tokens by key
+}
+
+// newMemoryStore creates a memory store keeping at most maxEntries entries
+func newMemoryStore(maxEntries int) *memoryStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return &memoryStore{maxEntries: maxEntries, entries: make(map[string]item), locks: make(map[string]item)}
+}
+
+// Get implements Store
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.entries[key]
+	if !ok || time.Now().After(it.expires) {
+		return nil, nil
+	}
+	return it.value, nil
+}
+
+// Set implements Store. When the store is full, expired entries are removed
+// and then the entry expiring first.
+func (m *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.maxEntries {
+		var first string
+		for k, it := range m.entries {
+			if now.After(it.expires) {
+				delete(m.entries, k)
+			} else if first == "" || it.expires.Before(m.entries[first].expires) {
+				first = k
+			}
+		}
+		if len(m.entries) >= m.maxEntries {
+			delete(m.entries, first)
+		}
+	}
+	m.entries[key] = item{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// Lock implements Store
+func (m *memoryStore) Lock(_ context.Context, key string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if it, ok := m.locks[key]; ok && now.Before(it.expires) {
+		return "", nil
+	}
+	token := newToken()
+	m.locks[key] = item{value: []byte(token), expires: now.Add(ttl)}
+	return token, nil
+}
+
+// Unlock implements Store
+func (m *memoryStore) Unlock(_ context.Context, key, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if it, ok := m.locks[key]; ok && string(it.value) == token {
+		delete(m.locks, key)
+	}
+	return nil
+}
+
+// Close implements Store
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// newToken returns a random lock token
+func newToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet response cache provider set
+var ProviderSet = wire.NewSet(
+	ProvideCache,
+)
+
+// ProvideCache provides the response cache. The cached methods, expiry and
+// vary headers are updated on reload; the backend requires a restart.
+func ProvideCache(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher) (*Cache, error) {
+	c, err := New(cfg.Cache, logger.Component(log, "cache"))
+	if err != nil {
+		return nil, err
+	}
+	apply := func(_, next *config.Config) error {
+		return c.Update(next.Cache)
+	}
+	for _, section := range []string{"cache.methods", "cache.ttl", "cache.soft_ttl", "cache.lock_timeout", "cache.vary"} {
+		watcher.OnChange(section, apply)
+	}
+	return c, nil
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+const (
+	defaultKeyPrefix    = "heytom-gateway:cache:"
+	defaultRedisTimeout = time.Second
+	defaultPoolSize     = 10
+
+	// unlockScript deletes a lock only while it still holds the caller's
+	// token, so that a lock that expired and was taken by another gateway is
+	// not released
+	unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+// redisError is an error reply of the server, after which the connection can still be used
+type redisError string
+
+// Error implements error
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection to the server speaking RESP
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisStore keeps entries in a Redis server shared by the gateways. It
+// speaks RESP over a small pool of connections.
+type redisStore struct {
+	address  string
+	username string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	poolSize int
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// newRedisStore creates the store of cfg, checking that the server is reachable
+func newRedisStore(cfg config.RedisConfig) (*redisStore, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("cache.redis.address is required")
+	}
+	s := &redisStore{
+		address:  cfg.Address,
+		username: cfg.Username,
+		password: cfg.Password,
+		db:       cfg.DB,
+		prefix:   cfg.KeyPrefix,
+		timeout:  cfg.Timeout,
+		poolSize: cfg.PoolSize,
+	}
+	if s.prefix == "" {
+		s.prefix = defaultKeyPrefix
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultRedisTimeout
+	}
+	if s.poolSize <= 0 {
+		s.poolSize = defaultPoolSize
+	}
+	if _, err := s.do(context.Background(), "PING"); err != nil {
+		return nil, fmt.Errorf("failed to connect to cache redis %s: %w", cfg.Address, err)
+	}
+	return s, nil
+}
+
+// Get implements Store
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := s.do(ctx, "GET", s.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := reply.([]byte)
+	return value, nil
+}
+
+// Set implements Store
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.do(ctx, "SET", s.prefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Lock implements Store with SET NX, which succeeds for a single gateway
+func (s *redisStore) Lock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	token := newToken()
+	reply, err := s.do(ctx, "SET", s.prefix+key+":lock", token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil || reply == nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Unlock implements Store
+func (s *redisStore) Unlock(ctx context.Context, key, token string) error {
+	_, err := s.do(ctx, "EVAL", unlockScript, "1", s.prefix+key+":lock", token)
+	return err
+}
+
+// Close implements Store, closing the idle connections
+func (s *redisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, c := range s.idle {
+		c.conn.Close()
+	}
+	s.idle = nil
+	return nil
+}
+
+// do sends a command and returns its reply: a string, an integer, a byte
+// slice, a slice of replies or nil
+func (s *redisStore) do(ctx context.Context, args ...string) (any, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(s.deadline(ctx), args...)
+	s.put(c, err)
+	return reply, err
+}
+
+// deadline returns the deadline of a command
+func (s *redisStore) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// get returns an idle connection or dials a new one, authenticated and with the database selected
+func (s *redisStore) get(ctx context.Context) (*redisConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("redis: store closed")
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	dialer := net.Dialer{Deadline: s.deadline(ctx)}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	var setup [][]string
+	if s.password != "" {
+		if s.username != "" {
+			setup = append(setup, []string{"AUTH", s.username, s.password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.password})
+		}
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.do(s.deadline(ctx), args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put returns a connection to the pool unless the command failed on it or the pool is full
+func (s *redisStore) put(c *redisConn, err error) {
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.idle) >= s.poolSize {
+		c.conn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// do writes a command as an array of bulk strings and reads its reply
+func (c *redisConn) do(deadline time.Time, args ...string) (any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads a RESP2 reply
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// Every element is read, even after an error reply, to keep the connection usable
+		values := make([]any, n)
+		var first error
+		for i := range values {
+			values[i], err = c.read()
+			var replyErr redisError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return nil, first
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
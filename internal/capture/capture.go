@@ -0,0 +1,278 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const (
+	defaultMaxFileBytes = 64 << 20
+	defaultBufferSize   = 1024
+)
+
+// FilePattern matches capture files in the capture directory
+const FilePattern = "capture-*.jsonl"
+
+// droppedHeaders are never recorded: credentials, and headers describing the
+// connection or encoding that the replaying client sets itself
+var droppedHeaders = []string{
+	"authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key",
+	"content-length", "connection", "host", "te", "transfer-encoding", "accept-encoding",
+	"user-agent", "grpc-accept-encoding", "grpc-timeout", "grpc-encoding",
+}
+
+// Record is one captured request, written as a line of JSON
+type Record struct {
+	Time       time.Time           `json:"time"`
+	Protocol   string              `json:"protocol"` // http or grpc
+	HTTPMethod string              `json:"http_method,omitempty"`
+	Path       string              `json:"path"` // HTTP path or gRPC full method
+	Tenant     string              `json:"tenant,omitempty"`
+	Service    string              `json:"service"`
+	Method     string              `json:"method"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	Body       []byte              `json:"body,omitempty"`      // JSON request body, or the protobuf request message of gRPC calls
+	Streaming  bool                `json:"streaming,omitempty"` // The gRPC call sent more than one message, only the first is recorded
+	Status     int                 `json:"status"`
+	GRPCCode   string              `json:"grpc_code,omitempty"`
+}
+
+// Recorder writes sampled requests to rotating capture files. Records are
+// written asynchronously and dropped when the writer falls behind, so capture
+// never slows down requests.
+type Recorder struct {
+	dir          string
+	match        []string
+	sampleRate   float64
+	dropped      map[string]bool
+	maxFileBytes int64
+	maxFiles     int
+	logger       *slog.Logger
+
+	mu      sync.RWMutex // Guards sending on records against Close
+	closed  bool
+	records chan *Record
+	done    chan struct{}
+	lost    atomic.Uint64
+
+	file    *os.File
+	writer  *bufio.Writer
+	written int64
+}
+
+// New creates a recorder and starts its writer
+func New(cfg config.CaptureConfig, logger *slog.Logger) (*Recorder, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("capture dir is required")
+	}
+	for _, m := range cfg.Match {
+		if _, err := path.Match(m, ""); err != nil {
+			return nil, fmt.Errorf("invalid capture pattern %q: %w", m, err)
+		}
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("capture sample_rate must be in [0, 1]")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture dir: %w", err)
+	}
+
+	r := &Recorder{
+		dir:          cfg.Dir,
+		match:        cfg.Match,
+		sampleRate:   cfg.SampleRate,
+		dropped:      make(map[string]bool),
+		maxFileBytes: cfg.MaxFileBytes,
+		maxFiles:     cfg.MaxFiles,
+		logger:       logger,
+		done:         make(chan struct{}),
+	}
+	if r.maxFileBytes <= 0 {
+		r.maxFileBytes = defaultMaxFileBytes
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	r.records = make(chan *Record, bufferSize)
+	for _, h := range append(droppedHeaders, cfg.DropHeaders...) {
+		r.dropped[strings.ToLower(h)] = true
+	}
+	go r.run()
+	return r, nil
+}
+
+// Capturing reports whether the recorder is active; nil recorders capture nothing
+func (r *Recorder) Capturing() bool {
+	return r != nil
+}
+
+// Observe implements requestinfo.Observer
+func (r *Recorder) Observe(info *requestinfo.Info) {
+	if r == nil || info.Service == "" || !r.selects(info.Service+"/"+info.Method) {
+		return
+	}
+	rec := r.record(info)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.records <- rec:
+	default:
+		r.lost.Add(1)
+	}
+}
+
+// selects reports whether the route matches and is sampled
+func (r *Recorder) selects(route string) bool {
+	if len(r.match) > 0 {
+		matched := false
+		for _, m := range r.match {
+			if ok, _ := path.Match(m, route); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return r.sampleRate <= 0 || rand.Float64() < r.sampleRate
+}
+
+// record builds the record of a completed request
+func (r *Recorder) record(info *requestinfo.Info) *Record {
+	rec := &Record{
+		Time:       info.Time,
+		Protocol:   info.Protocol,
+		HTTPMethod: info.HTTPMethod,
+		Path:       info.Path,
+		Tenant:     info.Tenant,
+		Service:    info.Service,
+		Method:     info.Method,
+		Metadata:   make(map[string][]string),
+		Status:     info.Status,
+		GRPCCode:   info.GRPCCode,
+	}
+	for key, values := range info.Metadata {
+		key = strings.ToLower(key)
+		if r.dropped[key] || strings.HasPrefix(key, ":") {
+			continue
+		}
+		rec.Metadata[key] = append([]string(nil), values...)
+	}
+	if info.Protocol == "grpc" {
+		delete(rec.Metadata, "content-type")
+		rec.Body = info.RequestMessage
+		rec.Streaming = info.RequestMessages > 1
+	} else if info.RequestBody != nil {
+		// Bodies of RPC and Twirp requests are recorded as the JSON sent upstream
+		rec.Body = info.RequestBody
+		rec.Metadata["content-type"] = []string{"application/json"}
+	} else if info.RequestMessage != nil {
+		// Protobuf bodies forwarded without decoding are recorded with their own content type
+		rec.Body = info.RequestMessage
+	}
+	return rec
+}
+
+// run writes records until the recorder is closed
+func (r *Recorder) run() {
+	defer close(r.done)
+	for rec := range r.records {
+		if err := r.write(rec); err != nil {
+			r.logger.Warn("Failed to write capture record", "error", err)
+		}
+	}
+	if r.file != nil {
+		r.writer.Flush()
+		r.file.Close()
+	}
+}
+
+// write appends a record, rotating the file when it is full
+func (r *Recorder) write(rec *Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if r.file == nil || r.written+int64(len(line)) > r.maxFileBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.writer.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		return err
+	}
+	// Flush once the buffer drains so a capture file is complete while the gateway runs
+	if len(r.records) == 0 {
+		return r.writer.Flush()
+	}
+	return nil
+}
+
+// rotate closes the current file, opens a new one and removes the oldest files
+func (r *Recorder) rotate() error {
+	if r.file != nil {
+		r.writer.Flush()
+		r.file.Close()
+		r.file = nil
+	}
+	name := filepath.Join(r.dir, "capture-"+time.Now().UTC().Format("20060102T150405.000000")+".jsonl")
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	r.file, r.writer, r.written = f, bufio.NewWriter(f), 0
+	r.logger.Info("Capturing traffic", "file", name)
+
+	if r.maxFiles > 0 {
+		files, _ := filepath.Glob(filepath.Join(r.dir, FilePattern))
+		sort.Strings(files)
+		for len(files) > r.maxFiles {
+			os.Remove(files[0])
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+// Close writes the buffered records and closes the capture file
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.records)
+	r.mu.Unlock()
+
+	<-r.done
+	if lost := r.lost.Load(); lost > 0 {
+		r.logger.Warn("Capture records were dropped because the writer fell behind", "dropped", lost)
+	}
+}
@@ -0,0 +1,22 @@
+package capture
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet traffic capture provider set
+var ProviderSet = wire.NewSet(
+	ProvideRecorder,
+)
+
+// ProvideRecorder provides the traffic capture recorder, or nil when capture is disabled
+func ProvideRecorder(cfg *config.Config, log *slog.Logger) (*Recorder, error) {
+	if !cfg.Capture.Enabled {
+		return nil, nil
+	}
+	return New(cfg.Capture, logger.Component(log, "capture"))
+}
@@ -0,0 +1,318 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+)
+
+// ReplayOptions configures a replay of captured requests
+type ReplayOptions struct {
+	HTTPTarget  string            // Base URL HTTP records are sent to, e.g. http://staging:8080; empty skips them
+	GRPCTarget  string            // Address gRPC records are sent to, e.g. staging:9090; empty skips them
+	TLS         bool              // Connect to the gRPC target with TLS
+	Headers     map[string]string // Metadata set on every request, e.g. credentials that were not captured
+	Concurrency int               // Requests in flight (0 means 1)
+	Rate        float64           // Requests per second (0 means as fast as possible)
+	Timeout     time.Duration     // Bound on each request (0 means 10s)
+}
+
+// Result is the outcome of replaying one record
+type Result struct {
+	Record   *Record
+	Status   int    // HTTP status of HTTP records
+	GRPCCode string // Status code of gRPC records
+	Err      error  // Transport error, the request got no response
+	Skipped  string // Why the record was not replayed
+}
+
+// Matched reports whether the response status equals the captured one
+func (r *Result) Matched() bool {
+	if r.Record.Protocol == "grpc" {
+		return r.GRPCCode == r.Record.GRPCCode
+	}
+	return r.Status == r.Record.Status
+}
+
+// Summary counts the outcomes of a replay
+type Summary struct {
+	Total      int `json:"total"`
+	Skipped    int `json:"skipped"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	Failed     int `json:"failed"`
+}
+
+// Replay sends the records of capture files, or of every capture file in a
+// directory, to the target environment and reports each result. Records are
+// sent in capture order, up to opts.Concurrency at a time.
+func Replay(ctx context.Context, opts ReplayOptions, paths []string, report func(*Result)) (Summary, error) {
+	files, err := captureFiles(paths)
+	if err != nil {
+		return Summary{}, err
+	}
+	r, err := newReplayer(opts)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer r.close()
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var summary Summary
+	var mu sync.Mutex
+	records := make(chan *Record)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range records {
+				result := r.replay(ctx, rec)
+				mu.Lock()
+				summary.Total++
+				switch {
+				case result.Skipped != "":
+					summary.Skipped++
+				case result.Err != nil:
+					summary.Failed++
+				case result.Matched():
+					summary.Matched++
+				default:
+					summary.Mismatched++
+				}
+				report(result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err = readRecords(files, func(rec *Record) error {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case records <- rec:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(records)
+	wg.Wait()
+	return summary, err
+}
+
+// captureFiles expands directories into their capture files in capture order
+func captureFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(p, FilePattern))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no capture files found")
+	}
+	return files, nil
+}
+
+// readRecords decodes the records of the files in order
+func readRecords(files []string, fn func(*Record) error) error {
+	for _, name := range files {
+		if err := readFile(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile decodes the records of one capture file
+func readFile(name string, fn func(*Record) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			rec := &Record{}
+			if err := json.Unmarshal(data, rec); err != nil {
+				return fmt.Errorf("%s:%d: invalid record: %w", name, line, err)
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+}
+
+// replayer sends records to the target environment
+type replayer struct {
+	opts   ReplayOptions
+	client *http.Client
+	conn   *grpc.ClientConn
+}
+
+// newReplayer connects to the targets
+func newReplayer(opts ReplayOptions) (*replayer, error) {
+	if opts.HTTPTarget == "" && opts.GRPCTarget == "" {
+		return nil, fmt.Errorf("an HTTP or gRPC target is required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	r := &replayer{opts: opts, client: &http.Client{}}
+	if opts.GRPCTarget != "" {
+		creds := insecure.NewCredentials()
+		if opts.TLS {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+		conn, err := grpc.Dial(opts.GRPCTarget, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", opts.GRPCTarget, err)
+		}
+		r.conn = conn
+	}
+	return r, nil
+}
+
+// close closes the gRPC connection
+func (r *replayer) close() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+// replay sends one record
+func (r *replayer) replay(ctx context.Context, rec *Record) *Result {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	result := &Result{Record: rec}
+	switch {
+	case rec.Protocol == "grpc" && r.conn == nil:
+		result.Skipped = "no gRPC target"
+	case rec.Protocol == "grpc" && rec.Streaming:
+		result.Skipped = "client streaming call"
+	case rec.Protocol == "grpc":
+		result.GRPCCode = r.replayGRPC(ctx, rec)
+	case r.opts.HTTPTarget == "":
+		result.Skipped = "no HTTP target"
+	default:
+		result.Status, result.Err = r.replayHTTP(ctx, rec)
+	}
+	return result
+}
+
+// replayHTTP sends an HTTP record and returns the response status
+func (r *replayer) replayHTTP(ctx context.Context, rec *Record) (int, error) {
+	method := rec.HTTPMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.opts.HTTPTarget, "/")+rec.Path, bytes.NewReader(rec.Body))
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range rec.Metadata {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	for key, value := range r.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// replayGRPC sends the request message of a gRPC record, reading every
+// response so server streaming calls complete, and returns the status code.
+// Connection failures are reported as status codes like the gateway would.
+func (r *replayer) replayGRPC(ctx context.Context, rec *Record) string {
+	md := metadata.MD{}
+	for key, values := range rec.Metadata {
+		md.Append(key, values...)
+	}
+	for key, value := range r.opts.Headers {
+		md.Set(key, value)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	stream, err := r.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, rec.Path, grpc.ForceCodec(proxy.Codec()))
+	if err != nil {
+		return status.Code(err).String()
+	}
+	// io.EOF means the call already ended, its status is returned by RecvMsg
+	if err := stream.SendMsg(&proxy.Frame{Payload: rec.Body}); err != nil && !errors.Is(err, io.EOF) {
+		return status.Code(err).String()
+	}
+	stream.CloseSend()
+	for {
+		if err := stream.RecvMsg(&proxy.Frame{}); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return status.Code(err).String()
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package concurrency
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// ProviderSet concurrency limiter provider set
+var ProviderSet = wire.NewSet(
+	ProvideLimiter,
+)
+
+// ProvideLimiter provides the limiter shared by the HTTP and gRPC servers for
+// proxied requests, or nil when server.concurrency is not configured
+func ProvideLimiter(cfg *config.Config) *Limiter {
+	c := cfg.Server.Concurrency
+	return New("gateway", c.MaxInFlight, c.QueueSize, c.QueueTimeout)
+}
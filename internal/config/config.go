@@ -1,21 +1,154 @@
 package config
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Registry RegistryConfig `json:"registry"`
-	Proto    ProtoConfig    `json:"proto"`
+	Server         ServerConfig             `json:"server"`
+	Registry       RegistryConfig           `json:"registry"`
+	Proto          ProtoConfig              `json:"proto"`
+	ExtAuthz       ExtAuthzConfig           `json:"ext_authz"`
+	TrustedHeaders TrustedHeadersConfig     `json:"trusted_headers"` // 可信的边缘代理传入的身份请求头
+	Vault          VaultConfig              `json:"vault"`
+	Log            LogConfig                `json:"log"`
+	AccessLog      AccessLogConfig          `json:"access_log"`
+	Health         HealthConfig             `json:"health"`
+	Admin          AdminConfig              `json:"admin"`
+	Latency        LatencyConfig            `json:"latency"`
+	Tap            TapConfig                `json:"tap"`
+	Capture        CaptureConfig            `json:"capture"` // 采样记录请求到文件，供 gateway replay 回放
+	Reload         ReloadConfig             `json:"reload"`
+	Upstream       UpstreamConfig           `json:"upstream"`        // 上游服务全局默认配置
+	Pool           ConnectionPoolConfig     `json:"connection_pool"` // 上游连接池
+	Services       map[string]ServiceConfig `json:"services"`        // 按服务名覆盖上游配置
+	Plugins        []PluginConfig           `json:"plugins"`         // 外部过滤插件
+	Routes         []RouteConfig            `json:"routes"`          // 按条件拒绝或改写 HTTP 请求的规则
+	Exposure       ExposureConfig           `json:"exposure"`        // 对外开放的方法，默认开放已加载 protoset 中的全部方法
+	Brokers        map[string]BrokerConfig  `json:"brokers"`         // 路由规则发布消息使用的消息队列
+	HTTPRoutes     []HTTPRouteConfig        `json:"http_routes"`     // 反向代理到普通 HTTP 服务的路由
+	PathRoutes     []PathRouteConfig        `json:"path_routes"`     // 按自定义路径调用 gRPC 方法的路由
+	Fallback       FallbackConfig           `json:"fallback"`        // 未知路径与方法的处理
+	Collapse       CollapseConfig           `json:"collapse"`        // 合并进行中的相同请求
+	Cache          CacheConfig              `json:"cache"`           // 缓存方法的响应，可通过 Redis 在网关实例间共享
+	Errors         ErrorsConfig             `json:"errors"`          // 网关错误响应的格式
+	Validation     []ValidationRuleConfig   `json:"validation"`      // 按方法校验 HTTP 请求的请求头与请求体
+	Maintenance    MaintenanceConfig        `json:"maintenance"`     // 停用的方法
+	ErrorReporting ErrorReportingConfig     `json:"error_reporting"` // 上报网关内部错误与 panic
+	Tracing        TracingConfig            `json:"tracing"`         // 传播 W3C 追踪上下文并导出每个转发请求的 span
+	Tenants        TenantsConfig            `json:"tenants"`         // 多租户
+
+	Sources []string `json:"-"` // 加载的配置文件，包括 include 与环境覆盖文件
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
 	HTTPPort string `json:"http_port"`
 	GRPCPort string `json:"grpc_port"`
-	Host     string `json:"host"` // 服务主机地址
+	Host     string `json:"host"` // 注册到注册中心的地址，为空或 auto 时按 advertise 自动检测
+
+	Advertise AdvertiseConfig `json:"advertise"` // 自动检测注册地址的方式
+
+	StartupTimeout  time.Duration `json:"startup_timeout"`  // 启动时等待就绪检查通过的最长时间，通过后才注册到注册中心（默认 30s）
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"` // 停止时等待进行中的请求与流结束的最长时间（默认 30s）
+	DeregisterDelay time.Duration `json:"deregister_delay"` // 从注册中心注销后、停止接受新请求前的等待时间，供调用方感知实例下线
+	HandoverTimeout time.Duration `json:"handover_timeout"` // 热重启时等待新进程就绪并完成注册的最长时间，超时后旧进程继续服务（默认 60s）
+
+	Concurrency ConcurrencyConfig `json:"concurrency"` // 网关同时转发的请求数上限，HTTP 与 gRPC 共享，健康检查与管理接口不计入
+
+	HTTP HTTPServerConfig `json:"http"` // HTTP监听器配置
+	GRPC GRPCServerConfig `json:"grpc"` // gRPC监听器配置
+
+	Listeners []ListenerConfig `json:"listeners"` // http_port 与 grpc_port 之外的监听器，如内网与公网分别监听
+}
+
+// AdvertiseConfig 自动检测注册地址的方式：从已启用网卡的地址中选择，跳过回环与链路本地地址
+type AdvertiseConfig struct {
+	Interface string   `json:"interface"` // 只使用该网卡的地址，如 eth0
+	CIDRs     []string `json:"cidrs"`     // 优先选择的网段，按顺序匹配；都不匹配时使用第一个 IPv4 地址
+	IPv6      bool     `json:"ipv6"`      // 同时考虑 IPv6 地址
+}
+
+// ListenerConfig 额外的监听器，各自配置绑定地址、TLS 与开放的路由
+type ListenerConfig struct {
+	Name     string             `json:"name"`     // 日志中的监听器名称，为空时使用地址
+	Protocol string             `json:"protocol"` // http 或 grpc
+	Address  string             `json:"address"`  // 绑定地址，如 10.0.0.1:8443
+	TLS      *ListenerTLSConfig `json:"tls"`      // 为空时不使用 TLS
+	Internal bool               `json:"internal"` // 内网监听器，同时开放 visibility 选项为 INTERNAL 的方法
+	// Routes 开放的 package.Service/Method 通配符，为空时开放全部路由；不在其中的调用返回 404（Twirp 为 bad_route，gRPC 为 UNIMPLEMENTED）
+	Routes []string `json:"routes"`
+	// Paths HTTP 监听器开放的路径前缀，如 /rpc/、/admin/，为空时开放全部路径；反向代理到普通 HTTP 服务的路由只受 Paths 限制
+	Paths []string `json:"paths"`
+}
+
+// ListenerTLSConfig 监听器的 TLS 配置。证书按客户端的 SNI 选择：先使用匹配的 sni 条目的证书，
+// 再使用 cert_dir 中包含该域名的证书，最后使用 cert_file；证书文件变化后自动重新加载
+type ListenerTLSConfig struct {
+	CertFile     string      `json:"cert_file"`      // 默认的服务端证书，设置了 cert_dir 或 sni 时可以为空
+	KeyFile      string      `json:"key_file"`       // 默认的服务端私钥
+	ClientCAFile string      `json:"client_ca_file"` // 校验客户端证书的 CA，设置后要求客户端证书（mTLS）
+	CertDir      string      `json:"cert_dir"`       // 证书目录：每对 <name>.crt 与 <name>.key 用于证书中的域名（含通配符域名）
+	SNI          []SNIConfig `json:"sni"`            // 按 SNI 选择证书，并将域名映射到租户、后端命名空间与开放的路由，按顺序匹配
+}
+
+// SNIConfig 一组 TLS 服务器名称的证书与路由
+type SNIConfig struct {
+	Hosts     []string `json:"hosts"`     // 服务器名称，*.example.com 匹配一级子域名
+	CertFile  string   `json:"cert_file"` // 这些名称使用的证书，为空时按 cert_dir 与默认证书选择
+	KeyFile   string   `json:"key_file"`  // 证书的私钥
+	Tenant    string   `json:"tenant"`    // 经这些名称到达的请求属于该租户，请求中指定的其他租户被拒绝（需要配置 tenants）
+	Namespace string   `json:"namespace"` // 请求只转发到元数据 namespace 与之相同的上游实例，租户配置了命名空间时以租户的为准
+	Routes    []string `json:"routes"`    // 经这些名称开放的 package.Service/Method 通配符，在监听器的 routes 之内进一步限制，为空时不限制
+}
+
+// HTTPServerConfig HTTP监听器配置
+type HTTPServerConfig struct {
+	// Middleware 路由解析之后按顺序（由外到内）应用的中间件: auth, rate_limit, routes 以及插件和嵌入网关时注册的自定义中间件；
+	// 为空时使用 auth, rate_limit, routes 与所有自定义中间件。未列出的 auth 与 routes 追加在最内层
+	Middleware []string        `json:"middleware"`
+	RateLimit  RateLimitConfig `json:"rate_limit"` // rate_limit 中间件的全局限流，所有调用方共享
+	// MaxBufferedResponse JSON 响应在内存中缓冲的最大字节数（默认 1 MiB）：更大的响应边生成边写出，
+	// 服务端流式方法的响应消息逐条发送；开始写出后上游调用失败时中断连接
+	MaxBufferedResponse int `json:"max_buffered_response"`
+	// UpstreamHeaders 在响应中加入处理请求的上游实例信息（X-Upstream-Instance、X-Upstream-Address、X-Upstream-Conn-Reused），用于排查问题
+	UpstreamHeaders bool `json:"upstream_headers"`
+	// JSON 请求与响应中 protobuf 类型的表示，默认为 protojson 的标准映射
+	JSON JSONConfig `json:"json"`
+
+	// 连接的超时与请求头大小限制，防止慢速客户端长期占用连接，同时作用于 server.listeners 中的 HTTP 监听器
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout"` // 读取请求头的超时（默认 10s）
+	ReadTimeout       time.Duration `json:"read_timeout"`        // 读取整个请求（含请求体）的超时（默认 60s）
+	WriteTimeout      time.Duration `json:"write_timeout"`       // 读取请求头之后到写完响应的超时（默认 0，不限制：流式响应与实时流量查看的连接持续较久）
+	IdleTimeout       time.Duration `json:"idle_timeout"`        // keep-alive 连接的空闲超时（默认 120s）
+	MaxHeaderBytes    int           `json:"max_header_bytes"`    // 请求头的最大字节数（默认 1 MiB）
+}
+
+// JSONConfig JSON 请求与响应中 protobuf 类型的表示。请求同时接受标准映射与配置的表示
+type JSONConfig struct {
+	Timestamp       string `json:"timestamp"`        // google.protobuf.Timestamp: rfc3339（默认）或 unix_millis（毫秒时间戳数值）
+	Duration        string `json:"duration"`         // google.protobuf.Duration: string（默认，如 "1.5s"）或 millis（毫秒数值）
+	Int64           string `json:"int64"`            // 64 位整数及其包装类型: string（默认）或 number
+	UseProtoNames   bool   `json:"use_proto_names"`  // 响应使用 protobuf 字段名而不是 lowerCamelCase 的 JSON 名
+	EmitUnpopulated bool   `json:"emit_unpopulated"` // 响应包含未设置的字段
+	EnumNumbers     bool   `json:"enum_numbers"`     // 枚举输出为数值而不是名称
+	// Lenient 宽松解析请求的方法（"package.Service/Method" 通配符）：枚举名称不区分大小写，
+	// 数值字段接受带空白或小数部分为零的数值字符串，忽略未知字段，便于迁移不规范的旧客户端
+	Lenient []string `json:"lenient"`
+}
+
+// GRPCServerConfig gRPC监听器配置
+type GRPCServerConfig struct {
+	// Interceptors 按顺序（由外到内）应用的拦截器: recovery, logging, metrics, rate_limit, auth；
+	// 为空时使用 recovery, auth。配置了外部授权而未列出 auth 时，auth 追加在最内层
+	Interceptors []string        `json:"interceptors"`
+	RateLimit    RateLimitConfig `json:"rate_limit"` // rate_limit 拦截器的全局限流，所有调用方共享
+	Channelz     bool            `json:"channelz"`   // 注册 channelz 服务，用于查看服务端与上游连接的状态和调用计数
+	// PreferUpstream 嵌入网关时在进程内注册的服务中优先转发到上游的服务（服务全名）：注册中心中有可用实例时转发，
+	// 没有时由网关本地处理；未列出的本地服务始终由网关处理
+	PreferUpstream []string `json:"prefer_upstream"`
 }
 
 // RegistryConfig 注册中心配置
@@ -23,18 +156,72 @@ type RegistryConfig struct {
 	Enabled            bool          `json:"enabled"`              // 是否启用注册中心
 	Type               string        `json:"type"`                 // 注册中心类型: consul, etcd, nacos
 	Address            string        `json:"address"`              // 注册中心地址
+	Token              string        `json:"token"`                // 注册中心ACL Token
 	ServiceName        string        `json:"service_name"`         // 服务名称
-	ServiceID          string        `json:"service_id"`           // 服务实例ID
+	ServiceID          string        `json:"service_id"`           // 服务实例ID，为空时按 service_id_template 生成
+	ServiceIDTemplate  string        `json:"service_id_template"`  // 生成实例ID的模板，支持 {service}、{hostname}、{port} 与 {rand}（默认 {service}-{hostname}-{port}）
 	Tags               []string      `json:"tags"`                 // 服务标签
 	HealthCheckTimeout time.Duration `json:"health_check_timeout"` // 健康检查超时
 	HealthCheckTTL     time.Duration `json:"health_check_ttl"`     // 健康检查TTL
+	// CloudMetadata 注册时从云厂商实例元数据或 Kubernetes Downward API 获取注册的地址、可用区、区域与标签
+	CloudMetadata CloudMetadataConfig `json:"cloud_metadata"`
+}
+
+// CloudMetadataConfig 查询实例元数据的配置
+type CloudMetadataConfig struct {
+	Provider   string        `json:"provider"`    // aws, gcp 或 kubernetes；为空时不查询，注册 server.host
+	Timeout    time.Duration `json:"timeout"`     // 查询的超时（默认 2s）
+	LabelsFile string        `json:"labels_file"` // kubernetes: Downward API 挂载的 Pod 标签文件（默认 /etc/podinfo/labels）
 }
 
 // ProtoConfig Protobuf 配置
 type ProtoConfig struct {
-	ProtoSetPath string               `json:"protoset_path"` // 主 protoset 文件路径
+	ProtoSetPath string               `json:"protoset_path"` // 主 protoset 文件路径，也可以是 .proto 源文件或源文件目录
 	ProtoSets    []ProtoSetInfo       `json:"protosets"`     // 不同服务的 protoset 列表
 	HotReload    ProtoHotReloadConfig `json:"hot_reload"`    // 热更新配置
+	ImportPaths  []string             `json:"import_paths"`  // 编译 .proto 源文件时的额外导入目录
+	BSR          BSRConfig            `json:"bsr"`           // Buf Schema Registry 访问配置
+	HistorySize  int                  `json:"history_size"`  // 每个 protoset 保留的历史版本数，用于回滚（默认 5）
+
+	// Tenants 按租户配置独立的描述符集合，/rpc/{tenant}/... 的请求使用对应租户的描述符
+	Tenants map[string]TenantProtoConfig `json:"tenants"`
+}
+
+// TenantProtoConfig descriptor sources of one tenant. The tenant's schema is
+// built only from these sources; protoset_path defaults to proto.protoset_path.
+type TenantProtoConfig struct {
+	ProtoSetPath string         `json:"protoset_path"` // Main protoset of the tenant
+	ProtoSets    []ProtoSetInfo `json:"protosets"`     // Service protosets of the tenant
+}
+
+// TenantsConfig multi-tenancy configuration. HTTP requests carry the tenant
+// in the path (/rpc/{tenant}/...), gRPC calls in the metadata_key metadata;
+// either may instead be derived from an authenticated claim.
+type TenantsConfig struct {
+	MetadataKey string                  `json:"metadata_key"` // Metadata carrying the tenant, read from gRPC callers and injected upstream (default x-tenant-id)
+	Claim       string                  `json:"claim"`        // Claim holding the tenant of authenticated requests; a different requested tenant is rejected
+	Strict      bool                    `json:"strict"`       // Reject requests for tenants that are not configured, including requests without a tenant
+	Tenants     map[string]TenantConfig `json:"tenants"`      // Settings by tenant name
+}
+
+// Enabled 是否配置了多租户：配置任一项后租户被注入到上游元数据
+func (c TenantsConfig) Enabled() bool {
+	return c.MetadataKey != "" || c.Claim != "" || c.Strict || len(c.Tenants) > 0
+}
+
+// TenantConfig settings of one tenant
+type TenantConfig struct {
+	TenantProtoConfig                   // Descriptors of the tenant; without them the shared descriptors are used
+	APIKeys           []string          `json:"api_keys"`   // When set, requests must present one of the keys in the X-API-Key header
+	RateLimit         RateLimitConfig   `json:"rate_limit"` // Shared by all requests of the tenant
+	Namespace         string            `json:"namespace"`  // Only upstream instances whose "namespace" metadata matches receive the tenant's requests
+	Metadata          map[string]string `json:"metadata"`   // Additional metadata sent upstream with the tenant's requests
+}
+
+// BSRConfig Buf Schema Registry access configuration
+type BSRConfig struct {
+	Token   string        `json:"token"`   // BSR API token (falls back to BUF_TOKEN)
+	Timeout time.Duration `json:"timeout"` // Request timeout (default 30s)
 }
 
 // ProtoSetInfo single protoset information
@@ -42,11 +229,544 @@ type ProtoSetInfo struct {
 	ServiceName string `json:"service_name"` // Microservice name
 	Path        string `json:"path"`         // Local file path
 	URL         string `json:"url"`          // Download URL (artifact repository)
+	Module      string `json:"module"`       // Buf Schema Registry module, e.g. buf.build/acme/orders:v1.2.0
+	CheckPeriod int64  `json:"check_period"` // Poll period (seconds) overriding proto.hot_reload.check_period
+
+	// Verification of downloaded protosets, checked before they are loaded
+	SHA256       string `json:"sha256"`        // Expected hex SHA-256 of the protoset
+	ChecksumURL  string `json:"checksum_url"`  // Sidecar checksum file, e.g. <url>.sha256 in sha256sum format
+	SignatureURL string `json:"signature_url"` // Base64 signature produced by cosign sign-blob --key
+	PublicKey    string `json:"public_key"`    // PEM public key file used to verify the signature
 }
 
 // ProtoHotReloadConfig hot reload configuration
 type ProtoHotReloadConfig struct {
 	Enabled     bool   `json:"enabled"`      // Enable hot reload
-	CheckPeriod int64  `json:"check_period"` // Check period (seconds)
+	CheckPeriod int64  `json:"check_period"` // Check period (seconds), 0 disables polling when watch_files is set
 	AuthToken   string `json:"auth_token"`   // Auth token for artifact repository
+	WatchFiles  bool   `json:"watch_files"`  // Reload local protosets as soon as their files change
+	DebounceMS  int64  `json:"debounce_ms"`  // Wait for file changes to settle before reloading (milliseconds, default 200)
+
+	// Jitter moves each check of a protoset by a random amount of up to this
+	// fraction of its check period (0-1), so that many gateways do not hit the
+	// artifact repository at the same second.
+	Jitter float64 `json:"jitter"`
+
+	// WebhookSecret enables POST /admin/webhooks/protosets for artifact
+	// repositories; requests must carry an X-Webhook-Timestamp and an
+	// X-Hub-Signature-256 HMAC of the timestamp, service parameter and body.
+	WebhookSecret string `json:"webhook_secret"`
+
+	// BreakingChanges decides what happens when a reloaded protoset removes or
+	// changes methods and fields that are currently served: warn (default)
+	// applies it and logs the changes, reject keeps the current descriptors,
+	// ignore skips the check.
+	BreakingChanges string `json:"breaking_changes"`
+
+	// Download configures the HTTP client that fetches protosets by URL
+	Download ProtosetDownloadConfig `json:"download"`
+
+	// Notify posts the descriptor changes of every applied reload
+	Notify ReloadNotifyConfig `json:"notify"`
+}
+
+// ReloadNotifyConfig configures notifications about applied protoset reloads
+type ReloadNotifyConfig struct {
+	URL     string        `json:"url"`     // Webhook URL; empty disables notifications
+	Format  string        `json:"format"`  // json (default) posts the change as JSON, slack posts a Slack message
+	Timeout time.Duration `json:"timeout"` // Request timeout (default 5s)
+}
+
+// ProtosetDownloadConfig configures downloads of remote protosets
+type ProtosetDownloadConfig struct {
+	Proxy        string        `json:"proxy"`         // Proxy URL; empty uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	CAFile       string        `json:"ca_file"`       // PEM bundle trusted in addition to the system roots
+	CertFile     string        `json:"cert_file"`     // Client certificate (mTLS)
+	KeyFile      string        `json:"key_file"`      // Client private key (mTLS)
+	Timeout      time.Duration `json:"timeout"`       // Timeout of each attempt (default 30s)
+	Retries      int           `json:"retries"`       // Retries after network errors, 429 and 5xx responses
+	RetryBackoff time.Duration `json:"retry_backoff"` // Wait before the first retry, doubled for each further retry (default 1s)
+}
+
+// ExtAuthzConfig external authorization configuration
+type ExtAuthzConfig struct {
+	Enabled        bool          `json:"enabled"`         // Enable external authorization
+	Type           string        `json:"type"`            // Authorization service type: http, grpc
+	Address        string        `json:"address"`         // HTTP URL or gRPC target of the authorization service
+	Timeout        time.Duration `json:"timeout"`         // Per-check timeout
+	FailOpen       bool          `json:"fail_open"`       // Allow requests when the authorization service is unavailable
+	ForwardHeaders []string      `json:"forward_headers"` // Headers sent to the authorization service (empty means all)
+}
+
+// TrustedHeadersConfig trusts an edge proxy in front of the gateway, such as a
+// corporate SSO proxy, to authenticate callers and pass their identity in
+// request headers. Identity headers from trusted peers are converted into
+// normalized metadata; from any other peer they are removed.
+type TrustedHeadersConfig struct {
+	Enabled   bool              `json:"enabled"`   // Enable identity headers
+	Proxies   []string          `json:"proxies"`   // Addresses or CIDRs of trusted peers, e.g. 10.0.0.0/8
+	Listeners []string          `json:"listeners"` // Names of server.listeners whose requests are trusted, e.g. an mTLS listener for the proxy
+	Headers   map[string]string `json:"headers"`   // Identity field to the request header carrying it, e.g. {"user": "X-Forwarded-User"}
+	Prefix    string            `json:"prefix"`    // Prefix of the metadata sent upstream for each field (default x-identity-)
+}
+
+// VaultConfig HashiCorp Vault configuration.
+// Config strings of the form ${vault:path#key} are resolved from Vault at load time.
+type VaultConfig struct {
+	Enabled       bool          `json:"enabled"`        // Enable Vault secret resolution
+	Address       string        `json:"address"`        // Vault address (falls back to VAULT_ADDR)
+	Token         string        `json:"token"`          // Vault token (falls back to VAULT_TOKEN)
+	TokenFile     string        `json:"token_file"`     // File containing the Vault token
+	Namespace     string        `json:"namespace"`      // Vault Enterprise namespace
+	KVVersion     int           `json:"kv_version"`     // KV secrets engine version: 1 or 2 (default 2)
+	Timeout       time.Duration `json:"timeout"`        // Request timeout
+	RenewInterval time.Duration `json:"renew_interval"` // Token renewal interval (0 derives it from the token TTL)
+}
+
+// LogConfig logging configuration
+type LogConfig struct {
+	Level     string           `json:"level"`      // Log level: debug, info, warn, error
+	Format    string           `json:"format"`     // Output format: text, json
+	Output    string           `json:"output"`     // stdout, stderr or a file path
+	AddSource bool             `json:"add_source"` // Include source file and line
+	Payload   PayloadLogConfig `json:"payload"`    // Request/response body logging
+}
+
+// PayloadLogConfig request/response body logging configuration
+type PayloadLogConfig struct {
+	Enabled  bool     `json:"enabled"`   // Enable payload logging (debug only)
+	Methods  []string `json:"methods"`   // Globs on "package.Service/Method" whose bodies are logged
+	Redact   []string `json:"redact"`    // Field paths masked before logging, e.g. "password", "user.*.token"
+	MaxBytes int      `json:"max_bytes"` // Truncate logged payloads to this size (0 means unlimited)
+}
+
+// AccessLogConfig access log configuration
+type AccessLogConfig struct {
+	Enabled    bool                    `json:"enabled"`     // Enable access logging
+	Format     string                  `json:"format"`      // Output format: json, common, template
+	Template   string                  `json:"template"`    // Custom template with {field} placeholders
+	Fields     []string                `json:"fields"`      // Fields included in json output (empty means all)
+	Output     string                  `json:"output"`      // stdout, stderr or a file path, used when no sinks are configured
+	SampleRate *float64                `json:"sample_rate"` // Default sample rate in [0, 1]; unset logs everything, 0 logs nothing
+	Sampling   []AccessLogSamplingRule `json:"sampling"`    // Per-route sample rates, first match wins
+	Sinks      []AccessLogSinkConfig   `json:"sinks"`       // Destinations each sampled entry is written to
+}
+
+// AccessLogSinkConfig is a destination of access log lines. Lines are queued
+// and written in the background, and dropped when the queue is full so a slow
+// sink never delays requests.
+type AccessLogSinkConfig struct {
+	Name           string        `json:"name"`            // Identifies the sink in metrics (default the type)
+	Type           string        `json:"type"`            // stdout, stderr, file, syslog or kafka
+	Format         string        `json:"format"`          // Overrides the access log format for this sink
+	Path           string        `json:"path"`            // file: log file
+	MaxSize        int64         `json:"max_size"`        // file: rotate before the file exceeds this many bytes (0 means no limit)
+	RotateInterval time.Duration `json:"rotate_interval"` // file: rotate when the file is older than this (0 means never)
+	MaxBackups     int           `json:"max_backups"`     // file: rotated files kept (0 keeps all)
+	Network        string        `json:"network"`         // syslog: udp, tcp or unixgram; empty uses the local syslog daemon
+	Address        string        `json:"address"`         // syslog: server address
+	Tag            string        `json:"tag"`             // syslog: tag (default heytom-gateway)
+	Broker         string        `json:"broker"`          // kafka: Kafka broker in brokers
+	Topic          string        `json:"topic"`           // kafka: topic
+	BufferSize     int           `json:"buffer_size"`     // Lines queued for the sink (default 4096)
+}
+
+// ErrorReportingConfig reports gateway-internal errors (error-level logs) and
+// recovered panics to a Sentry-compatible service
+type ErrorReportingConfig struct {
+	DSN         string            `json:"dsn"`         // Sentry DSN; empty disables reporting
+	Environment string            `json:"environment"` // Environment of the events, e.g. production
+	Release     string            `json:"release"`     // Release of the events (default heytom-gateway@<version>)
+	Tags        map[string]string `json:"tags"`        // Tags added to every event
+	RateLimit   time.Duration     `json:"rate_limit"`  // Repeated events are reported once per interval (default 1m)
+	Timeout     time.Duration     `json:"timeout"`     // Timeout of sending an event (default 5s)
+	BufferSize  int               `json:"buffer_size"` // Events queued for sending (default 100)
+}
+
+// TracingConfig W3C trace context propagation and export of a span for each
+// proxied request to an OTLP/HTTP collector
+type TracingConfig struct {
+	Enabled       bool                `json:"enabled"`
+	Endpoint      string              `json:"endpoint"`       // OTLP/HTTP traces endpoint, e.g. http://collector:4318/v1/traces
+	ServiceName   string              `json:"service_name"`   // service.name of the spans (default heytom-gateway)
+	Headers       map[string]string   `json:"headers"`        // Headers sent with each export, e.g. for authentication
+	Timeout       time.Duration       `json:"timeout"`        // Timeout of an export request (default 5s)
+	BatchSize     int                 `json:"batch_size"`     // Spans sent per export request (default 512)
+	BufferSize    int                 `json:"buffer_size"`    // Spans queued for export, dropped when full (default 2048)
+	FlushInterval time.Duration       `json:"flush_interval"` // Longest time a span waits for its batch to fill (default 5s)
+	Sampling      TraceSamplingConfig `json:"sampling"`       // Which requests are traced, applied on reload
+}
+
+// TraceSamplingConfig decides which requests are sampled. A request is sampled
+// with probability ratio, or as the caller decided with parent_based, and at
+// most rate_limit requests are sampled per second. The spans of failed and slow
+// requests are exported even when not sampled, for tail-based sampling in the
+// collector.
+type TraceSamplingConfig struct {
+	Ratio         *float64      `json:"ratio"`          // Probability of sampling a request in [0, 1]; unset samples every request
+	RateLimit     float64       `json:"rate_limit"`     // Most requests sampled per second, 0 for no limit
+	ParentBased   bool          `json:"parent_based"`   // Follow the sampled flag of an incoming traceparent instead of the ratio
+	Errors        bool          `json:"errors"`         // Export the spans of failed requests that were not sampled
+	SlowThreshold time.Duration `json:"slow_threshold"` // Export the spans of requests slower than this that were not sampled (0 disables)
+}
+
+// AccessLogSamplingRule sample rate for routes matching a glob
+type AccessLogSamplingRule struct {
+	Match string  `json:"match"` // Glob on "package.Service/Method", e.g. "order.OrderService/*"
+	Rate  float64 `json:"rate"`  // Sample rate in [0, 1]; 0 logs nothing
+}
+
+// HealthConfig readiness check configuration
+type HealthConfig struct {
+	CheckTimeout     time.Duration `json:"check_timeout"`     // Timeout for evaluating all readiness checks
+	CriticalServices []string      `json:"critical_services"` // Upstream services that must have healthy instances
+	ServicePeriod    time.Duration `json:"service_period"`    // How often per-service statuses on the gRPC health service are refreshed (default 10s)
+}
+
+// AdminConfig admin API configuration
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"` // Expose the admin API under /admin/
+	Token   string `json:"token"`   // Bearer token required by the admin API (empty disables auth)
+}
+
+// LatencyConfig slow request logging and latency SLO configuration
+type LatencyConfig struct {
+	SlowThreshold time.Duration      `json:"slow_threshold"` // Requests slower than this are logged (0 disables)
+	SLOs          []LatencySLOConfig `json:"slos"`           // Per-method latency objectives
+}
+
+// LatencySLOConfig latency objective for methods matching a glob
+type LatencySLOConfig struct {
+	Match     string        `json:"match"`     // Glob on "package.Service/Method"
+	Target    time.Duration `json:"target"`    // Requests completing within target are good
+	Objective float64       `json:"objective"` // Target ratio of good requests, e.g. 0.99
+}
+
+// TapConfig live traffic tap configuration
+type TapConfig struct {
+	Enabled        bool     `json:"enabled"`         // Expose the tap endpoint on the admin API
+	MaxSubscribers int      `json:"max_subscribers"` // Concurrent tap sessions (0 means 4)
+	BufferSize     int      `json:"buffer_size"`     // Events buffered per session before dropping (0 means 256)
+	Redact         []string `json:"redact"`          // Field paths masked in tapped bodies
+	MaxBodyBytes   int      `json:"max_body_bytes"`  // Truncate tapped bodies (0 means no limit)
+}
+
+// ExposureConfig selects the methods of the loaded protosets that clients may call.
+// A method is exposed when it matches Allow (or Allow is empty), matches no
+// Deny glob and, when Option is set, has that option set to true. Methods
+// whose Visibility option is INTERNAL are only exposed on internal listeners.
+type ExposureConfig struct {
+	Allow  []string `json:"allow"`  // Globs on "package.Service/Method" that are exposed (empty exposes all)
+	Deny   []string `json:"deny"`   // Globs on "package.Service/Method" that are never exposed, taking precedence over Allow
+	Option string   `json:"option"` // Full name of a bool extension of google.protobuf.MethodOptions, e.g. acme.api.exposed, that must be true
+	// Full name of an enum extension of google.protobuf.MethodOptions marking internal methods with its INTERNAL value (default gateway.visibility)
+	Visibility string `json:"visibility"`
+}
+
+// CaptureConfig traffic capture configuration
+type CaptureConfig struct {
+	Enabled      bool     `json:"enabled"`        // Record sampled requests to capture files
+	Dir          string   `json:"dir"`            // Directory the capture files are written to
+	Match        []string `json:"match"`          // Globs on "package.Service/Method" to capture (empty captures all)
+	SampleRate   float64  `json:"sample_rate"`    // Fraction of matching requests captured in (0, 1]; 0 captures all
+	DropHeaders  []string `json:"drop_headers"`   // Metadata not recorded, in addition to credentials such as authorization and cookie
+	MaxFileBytes int64    `json:"max_file_bytes"` // Size at which a capture file is rotated (0 means 64 MiB)
+	MaxFiles     int      `json:"max_files"`      // Oldest capture files are removed beyond this count (0 keeps all)
+	BufferSize   int      `json:"buffer_size"`    // Records buffered before dropping (0 means 1024)
+}
+
+// PluginConfig out-of-process filter plugin configuration
+type PluginConfig struct {
+	Name     string        `json:"name"`      // Middleware name referenced by server.http.middleware
+	Path     string        `json:"path"`      // Plugin executable
+	Args     []string      `json:"args"`      // Arguments passed to the executable
+	Timeout  time.Duration `json:"timeout"`   // Bound on each filter call (0 means 1s)
+	FailOpen bool          `json:"fail_open"` // Let requests through when the plugin fails instead of returning 502
+}
+
+// HTTPRouteConfig reverse-proxies matching requests to a plain HTTP service
+// discovered in the registry. The service's upstream policy (load balancer,
+// rate limit, timeout, retries and TLS) applies as for gRPC services.
+type HTTPRouteConfig struct {
+	Name        string `json:"name"`         // Identifies the route in logs
+	Host        string `json:"host"`         // Host to match, without port; empty matches any host
+	Prefix      string `json:"prefix"`       // Path prefix to match, e.g. /api/users/
+	Service     string `json:"service"`      // Registry service name of the backend
+	StripPrefix bool   `json:"strip_prefix"` // Remove the prefix from the forwarded path
+}
+
+// CollapseConfig shares one upstream call between identical concurrent HTTP
+// requests (same tenant, method, body, response fields, vary headers and
+// caller identity) to methods without side effects
+type CollapseConfig struct {
+	Methods    []string `json:"methods"`    // Service/method globs whose identical concurrent calls are collapsed
+	Idempotent bool     `json:"idempotent"` // Also collapse GET requests and methods with idempotency_level NO_SIDE_EFFECTS or IDEMPOTENT
+	Vary       []string `json:"vary"`       // Request headers that must be equal as well (default Authorization and Cookie)
+}
+
+// CacheConfig caches the successful responses of HTTP requests to gRPC
+// methods. A missing entry is filled by one request while identical requests
+// wait for it, across gateways sharing a Redis backend as well.
+type CacheConfig struct {
+	Methods     []string      `json:"methods"`      // Service/method globs whose responses are cached; empty disables caching
+	TTL         time.Duration `json:"ttl"`          // Entries expire this long after they were stored (default 1m)
+	SoftTTL     time.Duration `json:"soft_ttl"`     // Older entries are served while one request refreshes them in the background (0 disables)
+	LockTimeout time.Duration `json:"lock_timeout"` // Longest time a request fills or refreshes an entry, and identical requests wait for it (default 5s)
+	Vary        []string      `json:"vary"`         // Request headers that must be equal as well (default Authorization and Cookie)
+	Backend     string        `json:"backend"`      // memory (default) or redis, applied on restart
+	MaxEntries  int           `json:"max_entries"`  // memory: entries kept (default 10000)
+	Redis       RedisConfig   `json:"redis"`        // redis: server shared by the gateways
+}
+
+// RedisConfig connection to a Redis server
+type RedisConfig struct {
+	Address   string        `json:"address"`    // host:port
+	Username  string        `json:"username"`   // ACL user, empty for the default user
+	Password  string        `json:"password"`   // May be a secret reference
+	DB        int           `json:"db"`         // Database selected on each connection
+	KeyPrefix string        `json:"key_prefix"` // Prefix of the keys (default heytom-gateway:cache:)
+	Timeout   time.Duration `json:"timeout"`    // Timeout of connecting and of each command (default 1s)
+	PoolSize  int           `json:"pool_size"`  // Idle connections kept (default 10)
+}
+
+// ErrorsConfig formats the error responses of HTTP requests to gRPC methods,
+// by default plain text, e.g. as the JSON envelope of an organisation's API
+// error standard
+type ErrorsConfig struct {
+	ErrorFormatConfig
+	Routes []ErrorRouteConfig `json:"routes"` // Formats of matching methods, the first match applies
+}
+
+// ErrorRouteConfig formats the errors of the methods matching a glob
+type ErrorRouteConfig struct {
+	Match string `json:"match"` // Glob on "package.Service/Method"
+	ErrorFormatConfig
+}
+
+// ErrorFormatConfig is the body of error responses. Field names set to "-"
+// are left out of the envelope.
+type ErrorFormatConfig struct {
+	Format           string                     `json:"format"`            // "text" (default) or "json"
+	Wrap             string                     `json:"wrap"`              // Nest the fields under this key, e.g. "error"; empty puts them at the top level
+	CodeField        string                     `json:"code_field"`        // Field with the HTTP status code (default "code")
+	StatusField      string                     `json:"status_field"`      // Field with the gRPC status name, e.g. NOT_FOUND (default "status")
+	MessageField     string                     `json:"message_field"`     // Field with the error message (default "message")
+	Extra            map[string]json.RawMessage `json:"extra"`             // Static fields added to every error, e.g. docs_url
+	UpstreamMessages bool                       `json:"upstream_messages"` // Include the messages of upstream errors instead of the HTTP status text
+}
+
+// ValidationRuleConfig rejects HTTP requests to the matching gRPC methods with
+// 400 before their bodies are decoded. Every matching rule applies.
+type ValidationRuleConfig struct {
+	Match        string            `json:"match"`          // Glob on "package.Service/Method"
+	Headers      map[string]string `json:"headers"`        // Required headers: name to a regular expression the value must match; empty only requires the header
+	ContentTypes []string          `json:"content_types"`  // Accepted media types of the body, e.g. application/json; empty accepts any
+	MaxBodyBytes int               `json:"max_body_bytes"` // Largest body in bytes (0 means no limit)
+	MaxJSONDepth int               `json:"max_json_depth"` // Deepest nesting of objects and arrays in JSON bodies (0 means no limit)
+}
+
+// MaintenanceConfig holds back methods without restarting the gateway; the
+// admin API can disable further methods at runtime
+type MaintenanceConfig struct {
+	DisabledMethods []DisabledMethodConfig `json:"disabled_methods"` // Reapplied when the config is reloaded
+}
+
+// DisabledMethodConfig rejects the requests to a method instead of forwarding
+// them, e.g. during a backend incident
+type DisabledMethodConfig struct {
+	Method  string `json:"method"`  // "package.Service/Method"
+	Code    string `json:"code"`    // UNAVAILABLE (default, HTTP 503) or UNIMPLEMENTED (HTTP 501)
+	Message string `json:"message"` // Returned to callers; empty uses "method ... is disabled"
+}
+
+// FallbackConfig handles HTTP requests for paths and methods the gateway does
+// not know, e.g. while migrating away from a legacy monolith.
+type FallbackConfig struct {
+	// Service is the registry service of a plain HTTP backend receiving
+	// requests for paths outside /rpc/ that no route matches and for /rpc
+	// methods missing from the descriptors; empty returns 404
+	Service              string          `json:"service"`
+	NotFoundBody         json.RawMessage `json:"not_found_body"`          // JSON body of 404 responses for unknown paths and methods
+	MethodNotAllowedBody json.RawMessage `json:"method_not_allowed_body"` // JSON body of 405 responses for /rpc requests that are not POST
+}
+
+// PathRouteConfig serves a custom URL shape with a gRPC method. The path is
+// matched by prefix or by a regular expression on the whole path, and the
+// captured groups are set as fields of the JSON request message.
+type PathRouteConfig struct {
+	Name   string            `json:"name"`   // Identifies the route in logs
+	Method string            `json:"method"` // HTTP method to match, e.g. GET; empty matches any
+	Prefix string            `json:"prefix"` // Path prefix to match; the rest of the path is the group "path"
+	Regex  string            `json:"regex"`  // Regular expression matching the whole path, instead of prefix
+	Target string            `json:"target"` // Method called, "package.Service/Method"
+	Fields map[string]string `json:"fields"` // Capture group to dotted request field; named groups not listed set the field of the same name
+	Head   string            `json:"head"`   // HEAD on a GET route: "call" (default) calls the method and returns headers only, "ok" answers 200 without calling it
+}
+
+// RouteConfig conditional rule applied to proxied HTTP requests. Expressions
+// are CEL over the variables request, claims and body.
+type RouteConfig struct {
+	Name       string            `json:"name"`        // Identifies the rule in logs and denials
+	Match      string            `json:"match"`       // Glob on "package.Service/Method" (empty matches all)
+	When       string            `json:"when"`        // Condition; empty always applies
+	Deny       bool              `json:"deny"`        // Reject the request
+	Status     int               `json:"status"`      // HTTP status for a denial (0 means 403)
+	SetHeaders map[string]string `json:"set_headers"` // Upstream metadata set to the result of an expression
+	SetFields  map[string]string `json:"set_fields"`  // Request body fields (dotted paths) set to the result of an expression
+	Webhooks   []WebhookConfig   `json:"webhooks"`    // HTTP hooks called for requests the rule applies to
+	Publish    *PublishConfig    `json:"publish"`     // Publish the request to a message queue instead of proxying it
+}
+
+// PublishConfig publishes the request body, encoded as a protobuf message, to a broker
+type PublishConfig struct {
+	Broker      string `json:"broker"`       // Name of a broker under brokers
+	Topic       string `json:"topic"`        // Kafka topic, NATS subject or RabbitMQ routing key
+	MessageType string `json:"message_type"` // Fully-qualified message the JSON body is validated against and encoded as
+	Key         string `json:"key"`          // Expression for the message key, e.g. for Kafka partitioning; empty means no key
+}
+
+// BrokerConfig message queue connection
+type BrokerConfig struct {
+	Type      string        `json:"type"`      // kafka, nats or rabbitmq
+	Addresses []string      `json:"addresses"` // Kafka bootstrap brokers, NATS server URLs or one AMQP URL
+	Exchange  string        `json:"exchange"`  // RabbitMQ exchange (default exchange when empty)
+	Timeout   time.Duration `json:"timeout"`   // Publish timeout (default 5s)
+}
+
+// WebhookConfig HTTP hook receiving the request context as a JSON POST
+type WebhookConfig struct {
+	URL      string        `json:"url"`
+	Phase    string        `json:"phase"`     // before (default): called before proxying, may enrich or reject; after: notified asynchronously with the response
+	Timeout  time.Duration `json:"timeout"`   // Bound on each call (0 means 1s)
+	FailOpen bool          `json:"fail_open"` // Let the request through when a before hook fails instead of returning 502
+	Headers  []string      `json:"headers"`   // Request headers included in the event (none by default)
+}
+
+// ReloadConfig config file hot reload configuration
+type ReloadConfig struct {
+	Enabled  bool          `json:"enabled"`  // Watch the config file and apply safe changes at runtime
+	Interval time.Duration `json:"interval"` // Polling interval (0 means 5s)
+}
+
+// UpstreamConfig 上游服务调用配置
+type UpstreamConfig struct {
+	Timeout        time.Duration     `json:"timeout"`          // 单次调用超时（含重试，0 表示不限制）
+	Retry          RetryConfig       `json:"retry"`            // 重试策略
+	LoadBalancer   string            `json:"load_balancer"`    // 负载均衡算法：round_robin、random、weighted
+	TLS            UpstreamTLSConfig `json:"tls"`              // 到上游的 TLS 配置
+	MaxMessageSize int               `json:"max_message_size"` // 收发消息最大字节数（0 使用 gRPC 默认值）
+	RateLimit      RateLimitConfig   `json:"rate_limit"`       // 限流
+	Concurrency    ConcurrencyConfig `json:"concurrency"`      // 到每个服务同时进行的调用数上限
+	Protocol       string            `json:"protocol"`         // 上游协议：grpc（默认）、twirp
+	RequiredTags   []string          `json:"required_tags"`    // 只选择带有全部这些标签的实例，如 prod，为空时不限制
+}
+
+// ServiceConfig 单个服务的上游配置，未设置的字段继承全局默认配置
+type ServiceConfig struct {
+	Timeout        time.Duration      `json:"timeout"`
+	Retry          *RetryConfig       `json:"retry"`
+	LoadBalancer   string             `json:"load_balancer"`
+	TLS            *UpstreamTLSConfig `json:"tls"`
+	MaxMessageSize int                `json:"max_message_size"`
+	RateLimit      *RateLimitConfig   `json:"rate_limit"`
+	Concurrency    *ConcurrencyConfig `json:"concurrency"`
+	Protocol       string             `json:"protocol"`
+	RequiredTags   []string           `json:"required_tags"` // 未设置时继承全局配置，设为 [] 时不限制
+}
+
+// RetryConfig 重试策略
+type RetryConfig struct {
+	MaxAttempts    int           `json:"max_attempts"`    // 最大尝试次数（含首次，0 或 1 表示不重试）
+	InitialBackoff time.Duration `json:"initial_backoff"` // 首次重试等待时间
+	MaxBackoff     time.Duration `json:"max_backoff"`     // 最大重试等待时间
+	RetryableCodes []string      `json:"retryable_codes"` // 可重试的 gRPC 状态码，如 UNAVAILABLE
+}
+
+// UpstreamTLSConfig 到上游的 TLS 配置
+type UpstreamTLSConfig struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"ca_file"`              // 校验上游证书的 CA
+	CertFile           string `json:"cert_file"`            // 客户端证书（mTLS）
+	KeyFile            string `json:"key_file"`             // 客户端私钥（mTLS）
+	ServerName         string `json:"server_name"`          // 覆盖 SNI 与证书校验的主机名
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 跳过证书校验（仅用于测试）
+}
+
+// ConnectionPoolConfig 上游连接池配置
+type ConnectionPoolConfig struct {
+	ConnectionsPerTarget int  `json:"connections_per_target"` // 每个上游实例的连接数，按轮询方式使用（0 表示 1）
+	WarmUp               bool `json:"warm_up"`                // 首次访问实例时立即建立全部连接，而不是在轮询选中时才创建
+	// Preconnect 启动时与实例变化时，为 services 中配置的服务预先建立到权重最高的前 N 个实例的连接（0 表示不预先建立），
+	// 第一个请求不必等待建立连接与 TLS 握手
+	Preconnect int `json:"preconnect"`
+
+	IdleTimeout   time.Duration `json:"idle_timeout"`   // 没有进行中的调用且超过该时长未使用的连接被关闭（0 表示不关闭）
+	MaxAge        time.Duration `json:"max_age"`        // 连接的最大存活时间，超过后移出连接池，进行中的调用结束后关闭（0 表示不限制）
+	DrainTimeout  time.Duration `json:"drain_timeout"`  // 移出连接池的连接等待进行中调用结束的最长时间，超过后强制关闭（0 表示一直等待）
+	SweepInterval time.Duration `json:"sweep_interval"` // 后台清理的周期（默认 30s）
+}
+
+// RateLimitConfig 令牌桶限流配置
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second"` // 每秒请求数（0 表示不限流）
+	Burst             int     `json:"burst"`               // 突发容量（0 表示等于每秒请求数）
+}
+
+// ConcurrencyConfig 并发限制配置：超出上限的请求在有界队列中等待空闲名额，队列已满或等待超时的请求被拒绝（RESOURCE_EXHAUSTED，HTTP 429）
+type ConcurrencyConfig struct {
+	MaxInFlight  int           `json:"max_in_flight"` // 同时进行的请求数上限（0 表示不限制）
+	QueueSize    int           `json:"queue_size"`    // 等待名额的请求数上限（0 表示不排队，超出上限立即拒绝）
+	QueueTimeout time.Duration `json:"queue_timeout"` // 排队的最长时间（0 表示一直等到请求取消或超时）
+}
+
+// TenantProtos 返回有独立描述符的租户：tenants 中配置了描述符的租户覆盖 proto.tenants 中的同名租户
+func (c *Config) TenantProtos() map[string]TenantProtoConfig {
+	protos := make(map[string]TenantProtoConfig, len(c.Proto.Tenants))
+	for name, tenant := range c.Proto.Tenants {
+		protos[name] = tenant
+	}
+	for name, tenant := range c.Tenants.Tenants {
+		if tenant.ProtoSetPath != "" || len(tenant.ProtoSets) > 0 {
+			protos[name] = tenant.TenantProtoConfig
+		}
+	}
+	return protos
+}
+
+// ServiceProfile 返回服务的有效上游配置：服务级配置覆盖全局默认配置
+func (c *Config) ServiceProfile(service string) UpstreamConfig {
+	profile := c.Upstream
+	svc, ok := c.Services[service]
+	if !ok {
+		return profile
+	}
+
+	if svc.Timeout > 0 {
+		profile.Timeout = svc.Timeout
+	}
+	if svc.Retry != nil {
+		profile.Retry = *svc.Retry
+	}
+	if svc.LoadBalancer != "" {
+		profile.LoadBalancer = svc.LoadBalancer
+	}
+	if svc.TLS != nil {
+		profile.TLS = *svc.TLS
+	}
+	if svc.MaxMessageSize > 0 {
+		profile.MaxMessageSize = svc.MaxMessageSize
+	}
+	if svc.RateLimit != nil {
+		profile.RateLimit = *svc.RateLimit
+	}
+	if svc.Concurrency != nil {
+		profile.Concurrency = *svc.Concurrency
+	}
+	if svc.Protocol != "" {
+		profile.Protocol = svc.Protocol
+	}
+	if svc.RequiredTags != nil {
+		profile.RequiredTags = svc.RequiredTags
+	}
+	return profile
 }
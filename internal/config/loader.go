@@ -1,25 +1,187 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
-// LoadConfig 从文件加载配置
+// includeKey 配置文件中引用其他配置文件的顶层字段
+const includeKey = "include"
+
+// LoadConfig 从文件加载配置，按扩展名识别格式（.json、.yaml/.yml、.toml）
 func LoadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	return LoadConfigEnv(path, "")
+}
+
+// LoadConfigEnv 加载配置文件及其 include 的文件，env 非空时再叠加环境覆盖文件（如 config.prod.yaml）
+//
+// 合并优先级从低到高：include 的文件（按列出顺序）、文件自身内容、环境覆盖文件。
+// 对象逐字段深度合并，数组与标量整体替换。
+func LoadConfigEnv(path, env string) (*Config, error) {
+	l := &docLoader{visiting: make(map[string]bool)}
+	doc, err := l.load(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	if env != "" {
+		overlay, err := l.load(OverlayPath(path, env))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s overlay: %w", env, err)
+		}
+		doc = mergeDocument(doc, overlay)
+	}
 
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
 	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	config.Sources = l.files
+	return &config, nil
+}
+
+// OverlayPath 返回环境覆盖文件路径，如 configs/config.json 在 prod 环境下为 configs/config.prod.json
+func OverlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// docLoader 递归加载配置文件并记录读取过的文件
+type docLoader struct {
+	visiting map[string]bool
+	files    []string
+}
+
+// load 读取配置文件，展开 include 后返回合并结果
+func (l *docLoader) load(path string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
 		return nil, err
 	}
+	if l.visiting[abs] {
+		return nil, fmt.Errorf("config include cycle at %s", path)
+	}
+	l.visiting[abs] = true
+	defer delete(l.visiting, abs)
 
-	return &config, nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l.files = append(l.files, path)
+
+	doc, err := decodeDocument(filepath.Ext(path), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	includes, err := includePaths(path, doc[includeKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid include in %s: %w", path, err)
+	}
+	delete(doc, includeKey)
+
+	merged := make(map[string]any)
+	for _, include := range includes {
+		included, err := l.load(include)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeDocument(merged, included)
+	}
+	return mergeDocument(merged, doc), nil
+}
+
+// includePaths 解析 include 字段，支持单个路径或路径列表，相对路径基于当前文件所在目录，允许使用通配符
+func includePaths(path string, value any) ([]string, error) {
+	var patterns []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{v}
+	case []any:
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("include entries must be strings")
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, fmt.Errorf("include must be a string or a list of strings")
+	}
+
+	dir := filepath.Dir(path)
+	var paths []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// decodeDocument 将配置内容解析为通用结构，所有格式最终共用结构体上的json标签
+func decodeDocument(ext string, data []byte) (map[string]any, error) {
+	doc := make(map[string]any)
+	switch strings.ToLower(ext) {
+	case ".json", "":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", ext)
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+	return doc, nil
+}
+
+// mergeDocument 将 overlay 深度合并到 base：对象逐字段合并，其他值整体替换
+func mergeDocument(base, overlay map[string]any) map[string]any {
+	for key, value := range overlay {
+		baseMap, baseOK := base[key].(map[string]any)
+		overlayMap, overlayOK := value.(map[string]any)
+		if baseOK && overlayOK {
+			base[key] = mergeDocument(baseMap, overlayMap)
+			continue
+		}
+		base[key] = value
+	}
+	return base
 }
 
 // GetDefaultConfig 返回默认配置
@@ -28,17 +190,19 @@ func GetDefaultConfig() *Config {
 		Server: ServerConfig{
 			HTTPPort: ":8080",
 			GRPCPort: ":9091",
-			Host:     "127.0.0.1",
 		},
 		Registry: RegistryConfig{
 			Enabled:            false,
 			Type:               "consul",
 			Address:            "127.0.0.1:8500",
 			ServiceName:        "heytom-gateway",
-			ServiceID:          "heytom-gateway-1",
 			Tags:               []string{"gateway", "api"},
 			HealthCheckTimeout: 5000000000,  // 5s
 			HealthCheckTTL:     15000000000, // 15s
 		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
 	}
 }
@@ -0,0 +1,36 @@
+package config
+
+import "strings"
+
+// Options 命令行参数，覆盖配置文件中的对应字段
+type Options struct {
+	ConfigPath string // 配置文件路径（为空时按默认路径查找）
+	Env        string // 环境名，非空时叠加对应的覆盖文件，如 config.prod.json
+	LogLevel   string // 日志级别
+	HTTPPort   string // HTTP监听地址，如 ":8080" 或 "8080"
+	GRPCPort   string // gRPC监听地址，如 ":9091" 或 "9091"
+}
+
+// Apply 将非空参数覆盖到配置
+func (o *Options) Apply(cfg *Config) {
+	if o == nil {
+		return
+	}
+	if o.LogLevel != "" {
+		cfg.Log.Level = o.LogLevel
+	}
+	if o.HTTPPort != "" {
+		cfg.Server.HTTPPort = listenAddress(o.HTTPPort)
+	}
+	if o.GRPCPort != "" {
+		cfg.Server.GRPCPort = listenAddress(o.GRPCPort)
+	}
+}
+
+// listenAddress 将纯端口号转换为监听地址
+func listenAddress(port string) string {
+	if strings.Contains(port, ":") {
+		return port
+	}
+	return ":" + port
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
 
 	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/secrets"
 )
 
 // ProviderSet 配置Provider集合
@@ -11,12 +15,121 @@ var ProviderSet = wire.NewSet(
 	ProvideConfig,
 )
 
+// defaultConfigFiles 默认配置文件，按顺序查找第一个存在的文件
+var defaultConfigFiles = []string{
+	"configs/config.json",
+	"configs/config.yaml",
+	"configs/config.yml",
+	"configs/config.toml",
+}
+
 // ProvideConfig 提供配置实例
-func ProvideConfig() *Config {
-	cfg, err := LoadConfig("configs/config.json")
+// 显式指定的配置文件或环境加载失败时返回错误，默认路径加载失败时使用默认配置
+func ProvideConfig(opts *Options) (*Config, error) {
+	explicit := opts != nil && (opts.ConfigPath != "" || opts.Env != "")
+	cfg, err := loadConfig(opts)
 	if err != nil {
-		log.Printf("Failed to load config: %v, using default config", err)
-		return GetDefaultConfig()
+		if explicit {
+			return nil, err
+		}
+		slog.Warn("Failed to load config, using default config", "error", err)
+		cfg = GetDefaultConfig()
+	}
+	opts.Apply(cfg)
+	if err := ResolveSecrets(context.Background(), cfg); err != nil {
+		return nil, fmt.Errorf("failed to resolve config secrets: %w", err)
+	}
+	// 服务名与模板可能引用环境变量，解析后再生成实例 ID
+	if err := resolveServiceID(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Reload 重新加载配置文件并应用命令行参数覆盖，用于运行时热更新
+func Reload(opts *Options) (*Config, error) {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Apply(cfg)
+	if err := resolveSecrets(context.Background(), cfg, false); err != nil {
+		return nil, fmt.Errorf("failed to resolve config secrets: %w", err)
+	}
+	if err := resolveServiceID(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadConfig 加载配置文件并叠加命令行指定环境的覆盖文件
+func loadConfig(opts *Options) (*Config, error) {
+	env := ""
+	if opts != nil {
+		env = opts.Env
+	}
+	return LoadConfigEnv(ResolvePath(opts), env)
+}
+
+// ResolvePath 返回实际使用的配置文件路径：命令行指定的路径优先，否则为第一个存在的默认配置文件
+func ResolvePath(opts *Options) string {
+	if opts != nil && opts.ConfigPath != "" {
+		return opts.ConfigPath
+	}
+	return findConfigFile()
+}
+
+// findConfigFile 返回第一个存在的默认配置文件
+func findConfigFile() string {
+	for _, path := range defaultConfigFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return defaultConfigFiles[0]
+}
+
+// ResolveSecrets 解析配置中的密钥引用（如 ${env:DB_PASSWORD}、${file:/run/secrets/token}、${vault:secret/gateway#token}）
+func ResolveSecrets(ctx context.Context, cfg *Config) error {
+	return resolveSecrets(ctx, cfg, true)
+}
+
+// resolveSecrets 解析密钥引用，renew 为 true 时持续续期 Vault token
+// 先解析环境变量与文件引用，使 Vault 自身的连接配置也可以引用它们
+func resolveSecrets(ctx context.Context, cfg *Config, renew bool) error {
+	local := secrets.NewResolver()
+	local.Register("env", secrets.EnvProvider{})
+	local.Register("file", secrets.FileProvider{})
+	if err := local.ResolveStruct(ctx, cfg); err != nil {
+		return err
+	}
+
+	if !cfg.Vault.Enabled {
+		return nil
+	}
+
+	vault, err := secrets.NewVaultClient(secrets.VaultOptions{
+		Address:       cfg.Vault.Address,
+		Token:         cfg.Vault.Token,
+		TokenFile:     cfg.Vault.TokenFile,
+		Namespace:     cfg.Vault.Namespace,
+		KVVersion:     cfg.Vault.KVVersion,
+		Timeout:       cfg.Vault.Timeout,
+		RenewInterval: cfg.Vault.RenewInterval,
+	})
+	if err != nil {
+		return err
+	}
+
+	resolver := secrets.NewResolver()
+	resolver.Register("vault", vault)
+	if err := resolver.ResolveStruct(ctx, cfg); err != nil {
+		return err
+	}
+
+	// 保持 Vault token 有效，便于后续重新加载时继续读取密钥
+	if renew {
+		vault.StartRenewal(context.Background())
 	}
-	return cfg
+	return nil
 }
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ServiceIDEnv 生成的服务实例 ID 保存在该环境变量中，配置热更新与热重启启动的新进程沿用同一 ID；
+// 也可以由部署环境直接设置
+const ServiceIDEnv = "GATEWAY_SERVICE_ID"
+
+// defaultServiceIDTemplate 未配置 service_id 与 service_id_template 时生成实例 ID 的模板
+const defaultServiceIDTemplate = "{service}-{hostname}-{port}"
+
+// resolveServiceID 未配置 registry.service_id 时使用环境变量中的 ID，仍为空时按模板生成并保存到环境变量
+func resolveServiceID(cfg *Config) error {
+	if cfg.Registry.ServiceID != "" {
+		return nil
+	}
+	if id := os.Getenv(ServiceIDEnv); id != "" {
+		cfg.Registry.ServiceID = id
+		return nil
+	}
+	id, err := expandServiceID(cfg)
+	if err != nil {
+		return err
+	}
+	cfg.Registry.ServiceID = id
+	return os.Setenv(ServiceIDEnv, id)
+}
+
+// expandServiceID 替换模板中的 {service}、{hostname}、{port}（gRPC 端口）与 {rand}（8 位随机十六进制数）
+func expandServiceID(cfg *Config) (string, error) {
+	tmpl := cfg.Registry.ServiceIDTemplate
+	if tmpl == "" {
+		tmpl = defaultServiceIDTemplate
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			b.WriteString(tmpl)
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("invalid registry.service_id_template %q: unclosed placeholder", cfg.Registry.ServiceIDTemplate)
+		}
+		b.WriteString(tmpl[:start])
+		switch name := tmpl[start+1 : start+end]; name {
+		case "service":
+			b.WriteString(cfg.Registry.ServiceName)
+		case "hostname":
+			hostname, err := os.Hostname()
+			if err != nil {
+				return "", fmt.Errorf("failed to get hostname for the service ID: %w", err)
+			}
+			b.WriteString(hostname)
+		case "port":
+			b.WriteString(cfg.Server.GRPCPort[strings.LastIndexByte(cfg.Server.GRPCPort, ':')+1:])
+		case "rand":
+			var buf [4]byte
+			rand.Read(buf[:])
+			b.WriteString(hex.EncodeToString(buf[:]))
+		default:
+			return "", fmt.Errorf("invalid registry.service_id_template %q: unknown placeholder {%s}", cfg.Registry.ServiceIDTemplate, name)
+		}
+		tmpl = tmpl[start+end+1:]
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProvideConfigGeneratesServiceIDFromInterpolatedName(t *testing.T) {
+	t.Setenv(ServiceIDEnv, "")
+	t.Setenv("GATEWAY_TEST_SERVICE", "orders-gateway")
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"server": {"grpc_port": ":9091"},
+		"registry": {"service_name": "${env:GATEWAY_TEST_SERVICE}", "service_id_template": "{service}-{port}"}
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ProvideConfig(&Options{ConfigPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Registry.ServiceID != "orders-gateway-9091" {
+		t.Fatalf("service ID %q, want it generated from the resolved service name", cfg.Registry.ServiceID)
+	}
+	if id := os.Getenv(ServiceIDEnv); id != cfg.Registry.ServiceID {
+		t.Fatalf("%s = %q, want the generated ID", ServiceIDEnv, id)
+	}
+}
+
+func TestReloadKeepsGeneratedServiceID(t *testing.T) {
+	t.Setenv(ServiceIDEnv, "")
+	t.Setenv("GATEWAY_TEST_SERVICE", "orders-gateway")
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"registry": {"service_name": "${env:GATEWAY_TEST_SERVICE}", "service_id_template": "{service}-{rand}"}}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ProvideConfig(&Options{ConfigPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cfg.Registry.ServiceID, "orders-gateway-") {
+		t.Fatalf("service ID %q, want it generated from the resolved service name", cfg.Registry.ServiceID)
+	}
+	reloaded, err := Reload(&Options{ConfigPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Registry.ServiceID != cfg.Registry.ServiceID {
+		t.Fatalf("service ID %q after reload, want %q", reloaded.Registry.ServiceID, cfg.Registry.ServiceID)
+	}
+}
@@ -0,0 +1,210 @@
+package errorreport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// modulePath marks the gateway's own frames as in-app
+const modulePath = "github.com/heytom-labs/heytom-gateway/"
+
+// tagAttrs are attributes reported as tags rather than extra data
+var tagAttrs = map[string]bool{"component": true, "protocol": true, "operation": true, "service": true, "method": true}
+
+// droppedHeaders are credentials never sent with a request
+var droppedHeaders = map[string]bool{
+	"authorization": true, "proxy-authorization": true, "cookie": true, "set-cookie": true, "x-api-key": true,
+}
+
+// Request is the request being handled when an error occurred
+type Request struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+type requestKey struct{}
+
+// NewContext returns a context carrying the request reported with errors
+// logged with it. Credential headers are removed.
+func NewContext(ctx context.Context, method, url, remoteAddr string, headers map[string][]string) context.Context {
+	req := &Request{Method: method, URL: url, Headers: make(map[string]string, len(headers))}
+	for name, values := range headers {
+		if droppedHeaders[strings.ToLower(name)] || len(values) == 0 {
+			continue
+		}
+		req.Headers[name] = strings.Join(values, ", ")
+	}
+	if remoteAddr != "" {
+		req.Env = map[string]string{"REMOTE_ADDR": remoteAddr}
+	}
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// handler reports error-level records before passing them to the next handler
+type handler struct {
+	next     slog.Handler
+	reporter *Reporter
+	attrs    []slog.Attr // Attributes of the logger, with group-qualified keys
+	group    string      // Prefix of attribute keys, ending in a dot
+}
+
+// Handler returns a handler reporting error-level records to the reporter and
+// passing every record to next; it returns next when the reporter is nil
+func (r *Reporter) Handler(next slog.Handler) slog.Handler {
+	if r == nil {
+		return next
+	}
+	return &handler{next: next, reporter: r}
+}
+
+// Enabled implements slog.Handler
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		h.report(ctx, record)
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.next = h.next.WithAttrs(attrs)
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, slog.Attr{Key: h.group + a.Key, Value: a.Value})
+	}
+	return &next
+}
+
+// WithGroup implements slog.Handler
+func (h *handler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.next = h.next.WithGroup(name)
+	next.group = h.group + name + "."
+	return &next
+}
+
+// report converts the record into an event. A "panic" or "error" attribute
+// becomes the exception, reported with the stack the record was logged from.
+func (h *handler) report(ctx context.Context, record slog.Record) {
+	e := &Event{
+		Level:   "error",
+		Logger:  "gateway",
+		Message: record.Message,
+		Tags:    make(map[string]string),
+		Extra:   make(map[string]any),
+	}
+	if req, ok := ctx.Value(requestKey{}).(*Request); ok {
+		e.Request = req
+	}
+	exc := exception{Type: "error", Value: record.Message}
+	add := func(a slog.Attr) {
+		v := a.Value.Resolve()
+		switch {
+		case a.Key == "stack":
+			// Replaced by the stack trace of the exception
+		case a.Key == "panic":
+			e.Level = "fatal"
+			exc.Type, exc.Value = "panic", fmt.Sprint(v.Any())
+		case a.Key == "error":
+			if err, ok := v.Any().(error); ok {
+				exc.Type, exc.Value = fmt.Sprintf("%T", err), err.Error()
+			} else {
+				exc.Value = v.String()
+			}
+		case tagAttrs[a.Key]:
+			e.Tags[a.Key] = v.String()
+			if a.Key == "component" {
+				e.Logger = v.String()
+			}
+		default:
+			e.Extra[a.Key] = extraValue(v)
+		}
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		add(slog.Attr{Key: h.group + a.Key, Value: a.Value})
+		return true
+	})
+	exc.Stacktrace = callers()
+	e.Exception = &exceptions{Values: []exception{exc}}
+
+	h.reporter.Report(record.Message+"\x00"+exc.Type+"\x00"+exc.Value, e)
+}
+
+// extraValue converts an attribute value into a JSON value
+func extraValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := make(map[string]any)
+		for _, a := range v.Group() {
+			group[a.Key] = extraValue(a.Value.Resolve())
+		}
+		return group
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+		if s, ok := v.Any().(fmt.Stringer); ok {
+			return s.String()
+		}
+		return v.Any()
+	default:
+		return v.String()
+	}
+}
+
+// callers returns the stack of the code that logged the record, without the
+// logging frames. A panic is logged while its stack is still unwinding, so the
+// stack includes the frame that panicked.
+func callers() *stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var st []frame
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "log/slog.") && !strings.HasPrefix(f.Function, modulePath+"internal/errorreport.") {
+			module, function := splitFunction(f.Function)
+			st = append(st, frame{
+				Function: function,
+				Module:   module,
+				Filename: filepath.Base(f.File),
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(f.Function, modulePath),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	// Sentry lists frames from the outermost call
+	for i, j := 0, len(st)-1; i < j; i, j = i+1, j-1 {
+		st[i], st[j] = st[j], st[i]
+	}
+	return &stacktrace{Frames: st}
+}
+
+// splitFunction splits a qualified function name into its package path and name
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
@@ -0,0 +1,16 @@
+package errorreport
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// ProviderSet error reporting provider set
+var ProviderSet = wire.NewSet(
+	ProvideReporter,
+)
+
+// ProvideReporter provides the error reporter, or nil when no DSN is configured
+func ProvideReporter(cfg *config.Config) (*Reporter, error) {
+	return New(cfg.ErrorReporting)
+}
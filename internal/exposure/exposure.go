@@ -0,0 +1,76 @@
+package exposure
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+)
+
+// DefaultVisibility is the method option marking internal methods unless
+// exposure.visibility names another one. It is declared by
+// proto/gateway/visibility.proto, which services import to annotate methods.
+const DefaultVisibility = "gateway.visibility"
+
+// internal is the value of the visibility option hiding a method from all
+// but internal listeners
+const internal = "INTERNAL"
+
+// Policy decides which methods of the loaded protosets are reachable from
+// clients. Without allow, deny or option rules every loaded method is
+// callable, except methods marked internal outside internal listeners.
+type Policy struct {
+	allow      []string
+	deny       []string
+	option     string
+	visibility string
+}
+
+// New creates the policy of cfg after validating its globs
+func New(cfg config.ExposureConfig) (*Policy, error) {
+	for _, pattern := range append(append([]string(nil), cfg.Allow...), cfg.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exposure pattern %q: %w", pattern, err)
+		}
+	}
+	p := &Policy{allow: cfg.Allow, deny: cfg.Deny, option: cfg.Option, visibility: cfg.Visibility}
+	if p.visibility == "" {
+		p.visibility = DefaultVisibility
+	}
+	return p, nil
+}
+
+// Exposes reports whether clients may call the method on a listener;
+// internalListener allows methods marked internal. Method options are read
+// from loader, the descriptors the call is resolved against. A nil policy
+// exposes every method.
+func (p *Policy) Exposes(loader *proto.DescriptorLoader, service, method string, internalListener bool) bool {
+	if p == nil {
+		return true
+	}
+	route := service + "/" + method
+	if matchAny(p.deny, route) {
+		return false
+	}
+	if len(p.allow) > 0 && !matchAny(p.allow, route) {
+		return false
+	}
+	if loader == nil {
+		return p.option == ""
+	}
+	if p.option != "" && !loader.MethodOption(service, method, p.option) {
+		return false
+	}
+	return internalListener || loader.MethodEnumOption(service, method, p.visibility) != internal
+}
+
+// matchAny reports whether one of the globs matches the route
+func matchAny(patterns []string, route string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package exposure
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// ProviderSet exposure policy provider set
+var ProviderSet = wire.NewSet(
+	ProvidePolicy,
+)
+
+// ProvidePolicy provides the exposure policy
+func ProvidePolicy(cfg *config.Config) (*Policy, error) {
+	return New(cfg.Exposure)
+}
@@ -0,0 +1,221 @@
+package handover
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables describing the inherited descriptors of a new process
+const (
+	envListeners = "GATEWAY_HANDOVER_LISTENERS" // Comma-separated addresses of the inherited listeners, starting at descriptor 3
+	envReady     = "GATEWAY_HANDOVER_READY"     // Descriptor the new process reports readiness on
+)
+
+// DefaultTimeout bounds the wait for the new process when no timeout is set
+const DefaultTimeout = 60 * time.Second
+
+// Handover passes the listening sockets of the gateway to a new process for
+// zero-downtime binary upgrades. The new process inherits the sockets as file
+// descriptors, so connections queued on them are never refused; the old process
+// drains once the new one reports that it is ready and registered.
+type Handover struct {
+	logger  *slog.Logger
+	timeout time.Duration
+
+	mu        sync.Mutex
+	inherited map[string]net.Listener // Listeners inherited from the previous process, by address
+	listeners map[string]net.Listener // Listeners of this process, by address
+	ready     *os.File                // Readiness pipe to the previous process, nil when not inherited
+	upgrading bool
+}
+
+// New creates a handover and takes the listeners inherited from the previous
+// process, if any. timeout bounds the wait for a new process in Upgrade.
+func New(logger *slog.Logger, timeout time.Duration) (*Handover, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	h := &Handover{
+		logger:    logger,
+		timeout:   timeout,
+		inherited: make(map[string]net.Listener),
+		listeners: make(map[string]net.Listener),
+	}
+
+	addrs := os.Getenv(envListeners)
+	os.Unsetenv(envListeners)
+	ready := os.Getenv(envReady)
+	os.Unsetenv(envReady)
+	if addrs == "" {
+		return h, nil
+	}
+	for i, addr := range strings.Split(addrs, ",") {
+		f := os.NewFile(uintptr(3+i), addr)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inherit listener %s: %w", addr, err)
+		}
+		h.inherited[addr] = l
+	}
+	if ready != "" {
+		fd, err := strconv.Atoi(ready)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envReady, err)
+		}
+		h.ready = os.NewFile(uintptr(fd), "handover-ready")
+	}
+	logger.Info("Inherited listeners from previous process", "addresses", addrs, "parent", os.Getppid())
+	return h, nil
+}
+
+// Inherited reports whether the process was started by an upgrade
+func (h *Handover) Inherited() bool {
+	return h != nil && h.ready != nil
+}
+
+// Listen returns the listener inherited for addr, or binds a new one. Listeners
+// bound this way are passed on to the next process on upgrade.
+func (h *Handover) Listen(addr string) (net.Listener, error) {
+	if h == nil {
+		return net.Listen("tcp", addr)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.inherited[addr]
+	if ok {
+		delete(h.inherited, addr)
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	h.listeners[addr] = l
+	return l, nil
+}
+
+// Ready reports to the previous process that this process serves and is
+// registered, so the previous process starts draining. Inherited listeners
+// the configuration no longer uses are closed.
+func (h *Handover) Ready() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for addr, l := range h.inherited {
+		l.Close()
+		delete(h.inherited, addr)
+	}
+	if h.ready == nil {
+		return nil
+	}
+	_, err := h.ready.Write([]byte{1})
+	h.ready.Close()
+	h.ready = nil
+	return err
+}
+
+// Upgrade starts a new process from the current executable with the same
+// arguments and passes it the listeners. It returns once the new process is
+// ready, after which this process should drain without deregistering, or an
+// error when the new process failed or timed out, in which case this process
+// keeps serving.
+func (h *Handover) Upgrade() error {
+	h.mu.Lock()
+	if h.upgrading {
+		h.mu.Unlock()
+		return fmt.Errorf("upgrade already in progress")
+	}
+	h.upgrading = true
+	addrs := make([]string, 0, len(h.listeners))
+	for addr := range h.listeners {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	files := make([]*os.File, 0, len(addrs)+1)
+	var err error
+	for _, addr := range addrs {
+		var f *os.File
+		if f, err = file(h.listeners[addr]); err != nil {
+			err = fmt.Errorf("failed to pass listener %s: %w", addr, err)
+			break
+		}
+		files = append(files, f)
+	}
+	h.mu.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+		h.mu.Lock()
+		h.upgrading = false
+		h.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		envListeners+"="+strings.Join(addrs, ","),
+		envReady+"="+strconv.Itoa(3+len(files)))
+	cmd.ExtraFiles = append(files, w)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	h.logger.Info("Started new process, waiting for it to become ready", "pid", cmd.Process.Pid, "timeout", h.timeout)
+	go cmd.Wait()
+
+	// The pipe reaches EOF without data when the new process exits before it is ready
+	result := make(chan error, 1)
+	go func() {
+		if _, err := r.Read(make([]byte, 1)); err != nil {
+			result <- fmt.Errorf("new process exited before becoming ready")
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return err
+		}
+	case <-time.After(h.timeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("new process did not become ready within %s", h.timeout)
+	}
+	h.logger.Info("New process is ready", "pid", cmd.Process.Pid)
+	return nil
+}
+
+// file returns a duplicate descriptor of the listening socket
+func file(l net.Listener) (*os.File, error) {
+	f, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("listener %T does not expose its descriptor", l)
+	}
+	return f.File()
+}
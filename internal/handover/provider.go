@@ -0,0 +1,19 @@
+package handover
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet handover provider set
+var ProviderSet = wire.NewSet(
+	ProvideHandover,
+)
+
+// ProvideHandover provides the socket handover and takes the inherited listeners
+func ProvideHandover(cfg *config.Config, log *slog.Logger) (*Handover, error) {
+	return New(logger.Component(log, "handover"), cfg.Server.HandoverTimeout)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package handover
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signal triggers an upgrade
+var Signal os.Signal = syscall.SIGUSR2
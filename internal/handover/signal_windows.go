@@ -0,0 +1,8 @@
+//go:build windows
+
+package handover
+
+import "os"
+
+// Signal triggers an upgrade; nil because descriptors cannot be inherited on Windows
+var Signal os.Signal
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckFunc reports an error when a dependency is not ready
+type CheckFunc func(ctx context.Context) error
+
+// checkResult is the JSON representation of a single check
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// report is the JSON body returned by the health endpoints
+type report struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Health aggregates readiness checks and serves liveness/readiness endpoints
+type Health struct {
+	mu      sync.RWMutex
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+// New creates a health aggregator; timeout bounds each readiness evaluation
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Health{
+		checks:  make(map[string]CheckFunc),
+		timeout: timeout,
+	}
+}
+
+// AddReadinessCheck registers a named readiness check
+func (h *Health) AddReadinessCheck(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Ready runs all readiness checks concurrently and returns the per-check errors
+func (h *Health) Ready(ctx context.Context) map[string]error {
+	h.mu.RLock()
+	checks := make(map[string]CheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+	resultCh := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check CheckFunc) {
+			resultCh <- result{name: name, err: check(ctx)}
+		}(name, check)
+	}
+
+	// Checks that ignore the context are reported as timed out
+	results := make(map[string]error, len(checks))
+	for range checks {
+		select {
+		case r := <-resultCh:
+			results[r.name] = r.err
+		case <-ctx.Done():
+			for name := range checks {
+				if _, ok := results[name]; !ok {
+					results[name] = ctx.Err()
+				}
+			}
+			return results
+		}
+	}
+	return results
+}
+
+// LivenessHandler reports that the process is alive and serving HTTP
+func (h *Health) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, &report{Status: "ok"})
+	}
+}
+
+// ReadinessHandler reports whether all readiness checks pass
+func (h *Health) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results := h.Ready(r.Context())
+
+		rep := &report{Status: "ok", Checks: make(map[string]checkResult, len(results))}
+		code := http.StatusOK
+		for name, err := range results {
+			if err != nil {
+				rep.Checks[name] = checkResult{Status: "unavailable", Error: err.Error()}
+				rep.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			rep.Checks[name] = checkResult{Status: "ok"}
+		}
+		writeReport(w, code, rep)
+	}
+}
+
+// writeReport writes the report as JSON
+func writeReport(w http.ResponseWriter, code int, rep *report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// ProviderSet health provider set
+var ProviderSet = wire.NewSet(
+	ProvideHealth,
+)
+
+// ProvideHealth provides the health aggregator with protoset, registry and critical upstream checks
+func ProvideHealth(cfg *config.Config, reg registry.Registry, httpProxy *proxy.HTTPProxy) *Health {
+	h := New(cfg.Health.CheckTimeout)
+
+	h.AddReadinessCheck("protoset", func(ctx context.Context) error {
+		if httpProxy == nil {
+			return fmt.Errorf("http proxy not configured")
+		}
+		return httpProxy.CheckDescriptors()
+	})
+
+	if reg != nil {
+		h.AddReadinessCheck("registry", func(ctx context.Context) error {
+			// Discovering the gateway itself probes registry connectivity
+			if _, err := reg.Discover(ctx, cfg.Registry.ServiceName); err != nil {
+				return fmt.Errorf("registry unreachable: %w", err)
+			}
+			return nil
+		})
+
+		for _, service := range cfg.Health.CriticalServices {
+			service := service
+			h.AddReadinessCheck("upstream:"+service, func(ctx context.Context) error {
+				instances, err := reg.Discover(ctx, service)
+				if err != nil {
+					return err
+				}
+				if len(instances) == 0 {
+					return fmt.Errorf("no healthy instances")
+				}
+				return nil
+			})
+		}
+	}
+
+	return h
+}
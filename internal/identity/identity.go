@@ -0,0 +1,229 @@
+package identity
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+// DefaultPrefix prefixes the metadata of each identity field when
+// trusted_headers.prefix is not set
+const DefaultPrefix = "x-identity-"
+
+var strippedHeaders = metrics.NewCounterVec(
+	"gateway_identity_headers_stripped_total",
+	"Requests from untrusted peers whose identity headers were removed, by listener protocol",
+	"protocol",
+)
+
+// Identity is the identity of a caller passed by a trusted proxy
+type Identity struct {
+	Fields   map[string]string // Values by identity field, e.g. user
+	Metadata []string          // Key/value pairs of the normalized metadata sent upstream
+}
+
+// Claims returns the identity fields as authenticated claims
+func (id *Identity) Claims() map[string]any {
+	claims := make(map[string]any, len(id.Fields))
+	for field, value := range id.Fields {
+		claims[field] = value
+	}
+	return claims
+}
+
+// settings holds the trusted headers configuration, replaced atomically on
+// config reload
+type settings struct {
+	enabled   bool
+	proxies   []netip.Prefix
+	listeners map[string]bool
+	headers   map[string]string // Lower-case header by identity field
+	prefix    string
+}
+
+// Trust converts the identity headers of trusted peers into normalized
+// metadata and removes them from other requests
+type Trust struct {
+	settings atomic.Pointer[settings]
+}
+
+// New creates the trust of cfg after validating it
+func New(cfg config.TrustedHeadersConfig) (*Trust, error) {
+	t := &Trust{}
+	if err := t.Update(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Update replaces the trusted headers configuration
+func (t *Trust) Update(cfg config.TrustedHeadersConfig) error {
+	s := &settings{enabled: cfg.Enabled, listeners: make(map[string]bool), headers: make(map[string]string), prefix: strings.ToLower(cfg.Prefix)}
+	if s.prefix == "" {
+		s.prefix = DefaultPrefix
+	}
+	if !cfg.Enabled {
+		t.settings.Store(s)
+		return nil
+	}
+	if len(cfg.Headers) == 0 {
+		return fmt.Errorf("trusted_headers.headers is required")
+	}
+	if len(cfg.Proxies) == 0 && len(cfg.Listeners) == 0 {
+		return fmt.Errorf("trusted_headers requires proxies or listeners to trust")
+	}
+	for _, proxy := range cfg.Proxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted_headers.proxies: %w", err)
+		}
+		s.proxies = append(s.proxies, prefix)
+	}
+	for _, name := range cfg.Listeners {
+		s.listeners[name] = true
+	}
+	for field, header := range cfg.Headers {
+		if !validKey(field) || !validKey(strings.ToLower(header)) {
+			return fmt.Errorf("trusted_headers.headers: invalid field %q or header %q", field, header)
+		}
+		s.headers[field] = strings.ToLower(header)
+	}
+	if !validKey(s.prefix) {
+		return fmt.Errorf("trusted_headers.prefix: invalid metadata key prefix %q", cfg.Prefix)
+	}
+	t.settings.Store(s)
+	return nil
+}
+
+// FromHTTP removes the identity headers and the normalized identity headers
+// from an HTTP request. When the request comes from a trusted peer, the
+// identity headers are replaced with the normalized ones, as sent to plain
+// HTTP backends, and the identity is returned; otherwise it returns nil.
+// listener is the name of the listener of the request, empty for http_port.
+func (t *Trust) FromHTTP(header http.Header, remoteAddr, listener string) *Identity {
+	s := t.settings.Load()
+	if !s.enabled {
+		return nil
+	}
+	id := s.extract(remoteAddr, listener, "http", func(key string) ([]string, bool) {
+		key = http.CanonicalHeaderKey(key)
+		values, ok := header[key]
+		delete(header, key)
+		return values, ok
+	})
+	if id != nil {
+		for i := 0; i < len(id.Metadata); i += 2 {
+			header.Set(id.Metadata[i], id.Metadata[i+1])
+		}
+	}
+	return id
+}
+
+// FromMetadata is FromHTTP for the metadata of a gRPC call, which it
+// modifies; the normalized metadata of a trusted peer is set in md.
+func (t *Trust) FromMetadata(md metadata.MD, remoteAddr, listener string) *Identity {
+	s := t.settings.Load()
+	if !s.enabled {
+		return nil
+	}
+	id := s.extract(remoteAddr, listener, "grpc", func(key string) ([]string, bool) {
+		values, ok := md[key]
+		delete(md, key)
+		return values, ok
+	})
+	if id != nil {
+		for i := 0; i < len(id.Metadata); i += 2 {
+			md.Set(id.Metadata[i], id.Metadata[i+1])
+		}
+	}
+	return id
+}
+
+// extract removes the identity and normalized keys with take and returns
+// the identity of a trusted peer. A header sent more than once takes its last
+// value, the one added by the proxy nearest to the gateway.
+func (s *settings) extract(remoteAddr, listener, protocol string, take func(key string) ([]string, bool)) *Identity {
+	trusted := s.trusts(remoteAddr, listener)
+	id := &Identity{Fields: make(map[string]string)}
+	present := false
+	for field, header := range s.headers {
+		take(s.prefix + field)
+		values, ok := take(header)
+		present = present || ok
+		if trusted && len(values) > 0 && values[len(values)-1] != "" {
+			value := values[len(values)-1]
+			id.Fields[field] = value
+			id.Metadata = append(id.Metadata, s.prefix+field, value)
+		}
+	}
+	if !trusted {
+		if present {
+			strippedHeaders.Inc(protocol)
+		}
+		return nil
+	}
+	if len(id.Fields) == 0 {
+		return nil
+	}
+	return id
+}
+
+// trusts reports whether the peer address or the listener is trusted
+func (s *settings) trusts(remoteAddr, listener string) bool {
+	if listener != "" && s.listeners[listener] {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses an address or a CIDR
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// validKey reports whether s is a valid lower-case metadata key
+func validKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
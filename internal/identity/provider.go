@@ -0,0 +1,25 @@
+package identity
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet identity provider set
+var ProviderSet = wire.NewSet(
+	ProvideTrust,
+)
+
+// ProvideTrust provides the trust of identity headers, updated when the
+// trusted_headers section is reloaded
+func ProvideTrust(cfg *config.Config, watcher *reload.Watcher) (*Trust, error) {
+	t, err := New(cfg.TrustedHeaders)
+	if err != nil {
+		return nil, err
+	}
+	watcher.OnChange("trusted_headers", func(_, next *config.Config) error {
+		return t.Update(next.TrustedHeaders)
+	})
+	return t, nil
+}
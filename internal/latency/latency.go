@@ -0,0 +1,237 @@
+package latency
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+var (
+	requestDuration = metrics.NewHistogramVec(
+		"gateway_request_duration_seconds",
+		"Duration of proxied requests in seconds",
+		metrics.DefaultBuckets,
+		"protocol", "service", "method", "code",
+	)
+	slowRequests = metrics.NewCounterVec(
+		"gateway_slow_requests_total",
+		"Requests slower than the configured slow threshold",
+		"protocol", "service", "method",
+	)
+	sloRequests = metrics.NewCounterVec(
+		"gateway_slo_requests_total",
+		"Requests evaluated against a latency SLO",
+		"slo", "service", "method",
+	)
+	sloGoodRequests = metrics.NewCounterVec(
+		"gateway_slo_good_requests_total",
+		"Requests that completed successfully within the SLO target",
+		"slo", "service", "method",
+	)
+	sloObjective = metrics.NewGaugeVec(
+		"gateway_slo_objective_ratio",
+		"Configured ratio of good requests for each latency SLO",
+		"slo",
+	)
+	sloTarget = metrics.NewGaugeVec(
+		"gateway_slo_target_seconds",
+		"Configured latency target for each latency SLO",
+		"slo",
+	)
+)
+
+// labelUnknown replaces the service and method labels of requests for methods
+// missing from the descriptors, which keeps the label cardinality bounded
+// when callers send arbitrary names
+const labelUnknown = "unknown"
+
+// Resolver reports whether the descriptors of a tenant define a method
+type Resolver func(tenant, service, method string) bool
+
+// slo is a latency objective for methods matching a glob
+type slo struct {
+	match     string
+	target    time.Duration
+	objective float64
+}
+
+// settings holds the tracker configuration, replaced atomically on config reload
+type settings struct {
+	slowThreshold time.Duration
+	slos          []slo
+}
+
+// Tracker records per-method latency, evaluates SLOs and logs slow requests
+type Tracker struct {
+	settings atomic.Pointer[settings]
+	resolve  Resolver
+	logger   *slog.Logger
+}
+
+// New creates a latency tracker. Methods that resolve reports as undefined
+// are recorded under the unknown service and method labels; a nil resolve
+// labels every method with its name.
+func New(cfg config.LatencyConfig, resolve Resolver, logger *slog.Logger) (*Tracker, error) {
+	t := &Tracker{resolve: resolve, logger: logger}
+	if err := t.Update(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Update replaces the slow request threshold and SLOs
+func (t *Tracker) Update(cfg config.LatencyConfig) error {
+	slos := make([]slo, 0, len(cfg.SLOs))
+	for _, s := range cfg.SLOs {
+		if _, err := path.Match(s.Match, ""); err != nil {
+			return fmt.Errorf("invalid latency SLO pattern %q: %w", s.Match, err)
+		}
+		if s.Target <= 0 {
+			return fmt.Errorf("latency SLO %q requires a positive target", s.Match)
+		}
+		if s.Objective <= 0 || s.Objective > 1 {
+			return fmt.Errorf("latency SLO %q objective must be in (0, 1]", s.Match)
+		}
+		slos = append(slos, slo{match: s.Match, target: s.Target, objective: s.Objective})
+	}
+
+	if old := t.settings.Load(); old != nil {
+		for _, s := range old.slos {
+			sloObjective.Delete(s.match)
+			sloTarget.Delete(s.match)
+		}
+	}
+	for _, s := range slos {
+		sloObjective.Set(s.objective, s.match)
+		sloTarget.Set(s.target.Seconds(), s.match)
+	}
+	t.settings.Store(&settings{slowThreshold: cfg.SlowThreshold, slos: slos})
+	return nil
+}
+
+// Observe implements requestinfo.Observer
+func (t *Tracker) Observe(info *requestinfo.Info) {
+	if t == nil || info.Service == "" {
+		return
+	}
+
+	code := info.GRPCCode
+	if code == "" {
+		code = fmt.Sprint(info.Status)
+	}
+	service, method := t.labels(info)
+	requestDuration.Observe(info.Duration.Seconds(), info.Protocol, service, method, code)
+
+	cfg := t.settings.Load()
+	if s := cfg.match(info.Service + "/" + info.Method); s != nil {
+		sloRequests.Inc(s.match, service, method)
+		if succeeded(info) && info.Duration <= s.target {
+			sloGoodRequests.Inc(s.match, service, method)
+		}
+	}
+
+	if cfg.slowThreshold > 0 && info.Duration > cfg.slowThreshold {
+		slowRequests.Inc(info.Protocol, service, method)
+		t.logger.Warn("Slow request",
+			"protocol", info.Protocol,
+			"tenant", info.Tenant,
+			"service", info.Service,
+			"method", info.Method,
+			"path", info.Path,
+			"upstream", info.Upstream,
+			"remote_addr", info.RemoteAddr,
+			"status", info.Status,
+			"grpc_code", info.GRPCCode,
+			"duration", info.Duration,
+			"threshold", cfg.slowThreshold,
+			"error", info.Error,
+		)
+	}
+}
+
+// labels returns the service and method metric labels of a request
+func (t *Tracker) labels(info *requestinfo.Info) (string, string) {
+	if t.resolve != nil && !t.resolve(info.Tenant, info.Service, info.Method) {
+		return labelUnknown, labelUnknown
+	}
+	return info.Service, info.Method
+}
+
+// match returns the first SLO matching the route, or nil
+func (s *settings) match(route string) *slo {
+	for i := range s.slos {
+		if ok, _ := path.Match(s.slos[i].match, route); ok {
+			return &s.slos[i]
+		}
+	}
+	return nil
+}
+
+// succeeded reports whether the request completed without error
+func succeeded(info *requestinfo.Info) bool {
+	if info.GRPCCode != "" {
+		return info.GRPCCode == "OK"
+	}
+	return info.Status < 500
+}
+
+// MethodLatency summarizes observed latency of a single method
+type MethodLatency struct {
+	Protocol string  `json:"protocol"`
+	Service  string  `json:"service"`
+	Method   string  `json:"method"`
+	Count    uint64  `json:"count"`
+	P50      float64 `json:"p50_seconds"`
+	P95      float64 `json:"p95_seconds"`
+	P99      float64 `json:"p99_seconds"`
+}
+
+// Summary returns per-method latency percentiles aggregated over all status codes
+func Summary() []MethodLatency {
+	merged := make(map[[3]string]*metrics.HistogramSnapshot)
+	for _, s := range requestDuration.Snapshot() {
+		key := [3]string{s.Labels["protocol"], s.Labels["service"], s.Labels["method"]}
+		m, ok := merged[key]
+		if !ok {
+			snapshot := s
+			snapshot.Counts = append([]uint64(nil), s.Counts...)
+			merged[key] = &snapshot
+			continue
+		}
+		for i, c := range s.Counts {
+			m.Counts[i] += c
+		}
+		m.Sum += s.Sum
+		m.Count += s.Count
+	}
+
+	summary := make([]MethodLatency, 0, len(merged))
+	for key, s := range merged {
+		summary = append(summary, MethodLatency{
+			Protocol: key[0],
+			Service:  key[1],
+			Method:   key[2],
+			Count:    s.Count,
+			P50:      s.Quantile(0.5),
+			P95:      s.Quantile(0.95),
+			P99:      s.Quantile(0.99),
+		})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Service != summary[j].Service {
+			return summary[i].Service < summary[j].Service
+		}
+		if summary[i].Method != summary[j].Method {
+			return summary[i].Method < summary[j].Method
+		}
+		return summary[i].Protocol < summary[j].Protocol
+	})
+	return summary
+}
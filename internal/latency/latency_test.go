@@ -0,0 +1,28 @@
+package latency
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+func TestLabelsCollapseUnresolvedMethods(t *testing.T) {
+	resolve := func(tenant, service, method string) bool {
+		return service == "order.OrderService" && method == "GetOrder"
+	}
+	tracker, err := New(config.LatencyConfig{}, resolve, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, method := tracker.labels(&requestinfo.Info{Service: "order.OrderService", Method: "GetOrder"})
+	if service != "order.OrderService" || method != "GetOrder" {
+		t.Fatalf("labels of a resolved method = %q, %q", service, method)
+	}
+	service, method = tracker.labels(&requestinfo.Info{Service: "random.Service123", Method: "Method456"})
+	if service != labelUnknown || method != labelUnknown {
+		t.Fatalf("labels of an unresolved method = %q, %q, want %q", service, method, labelUnknown)
+	}
+}
@@ -0,0 +1,35 @@
+package latency
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet latency tracker provider set
+var ProviderSet = wire.NewSet(
+	ProvideTracker,
+)
+
+// ProvideTracker provides the latency tracker, labeling only methods defined
+// in the descriptors of the request's tenant or the shared descriptors
+func ProvideTracker(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher, loader *proto.DescriptorLoader, tenants *proto.Tenants) (*Tracker, error) {
+	resolve := func(tenant, service, method string) bool {
+		if l := tenants.Get(tenant); l != nil {
+			return l.FindMethodDescriptor(service, method) != nil
+		}
+		return loader.FindMethodDescriptor(service, method) != nil
+	}
+	t, err := New(cfg.Latency, resolve, logger.Component(log, "latency"))
+	if err != nil {
+		return nil, err
+	}
+	watcher.OnChange("latency", func(_, next *config.Config) error {
+		return t.Update(next.Latency)
+	})
+	return t, nil
+}
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/errorreport"
+)
+
+// ProviderSet logger provider set
+var ProviderSet = wire.NewSet(
+	ProvideLogger,
+)
+
+// ProvideLogger provides the application logger and installs it as the slog default.
+// Error-level records are also sent to the error reporter when one is configured.
+func ProvideLogger(cfg *config.Config, reporter *errorreport.Reporter) (*slog.Logger, error) {
+	logger, err := New(cfg.Log)
+	if err != nil {
+		return nil, err
+	}
+	logger = slog.New(reporter.Handler(logger.Handler()))
+	slog.SetDefault(logger)
+	return logger, nil
+}
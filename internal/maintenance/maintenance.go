@@ -0,0 +1,369 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// DefaultRetryAfter is the Retry-After of rejected requests when a maintenance
+// window does not set one
+const DefaultRetryAfter = 60 * time.Second
+
+// Mode is a maintenance window of the gateway or of one upstream service
+type Mode struct {
+	Reason     string        `json:"reason,omitempty"`
+	Routes     []string      `json:"routes,omitempty"` // "package.Service/Method" globs, empty rejects every route
+	RetryAfter time.Duration `json:"-"`
+	Since      time.Time     `json:"since"`
+}
+
+// modeJSON is the JSON form of Mode with the Retry-After in seconds
+type modeJSON struct {
+	Reason            string    `json:"reason,omitempty"`
+	Routes            []string  `json:"routes,omitempty"`
+	RetryAfterSeconds int       `json:"retry_after_seconds,omitempty"`
+	Since             time.Time `json:"since"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(modeJSON{Reason: m.Reason, Routes: m.Routes, RetryAfterSeconds: int(m.RetryAfter / time.Second), Since: m.Since})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	var v modeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = Mode{Reason: v.Reason, Routes: v.Routes, RetryAfter: time.Duration(v.RetryAfterSeconds) * time.Second, Since: v.Since}
+	return nil
+}
+
+// Method sources
+const (
+	SourceConfig = "config" // maintenance.disabled_methods in the config, replaced on reload
+	SourceAdmin  = "admin"  // The admin API
+)
+
+// DisabledMethod rejects the requests to one method instead of forwarding
+// them, e.g. during a backend incident
+type DisabledMethod struct {
+	Code    codes.Code `json:"-"` // Unavailable or Unimplemented
+	Message string     `json:"message,omitempty"`
+	Source  string     `json:"source"`
+	Since   time.Time  `json:"since"`
+}
+
+// disabledMethodJSON is the JSON form of DisabledMethod with the code name
+type disabledMethodJSON struct {
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (d DisabledMethod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(disabledMethodJSON{Code: strings.ToUpper(d.Code.String()), Message: d.Message, Source: d.Source, Since: d.Since})
+}
+
+// UnmarshalJSON implements json.Unmarshaler; the code defaults to UNAVAILABLE
+func (d *DisabledMethod) UnmarshalJSON(data []byte) error {
+	var v disabledMethodJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	code, err := ParseDisabledCode(v.Code)
+	if err != nil {
+		return err
+	}
+	*d = DisabledMethod{Code: code, Message: v.Message, Source: v.Source, Since: v.Since}
+	return nil
+}
+
+// ParseDisabledCode parses the code returned for a disabled method:
+// UNAVAILABLE (the default) or UNIMPLEMENTED
+func ParseDisabledCode(name string) (codes.Code, error) {
+	if name == "" {
+		return codes.Unavailable, nil
+	}
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil || (code != codes.Unavailable && code != codes.Unimplemented) {
+		return 0, fmt.Errorf("invalid code %q for a disabled method, expected UNAVAILABLE or UNIMPLEMENTED", name)
+	}
+	return code, nil
+}
+
+// Status is the current maintenance state
+type Status struct {
+	Gateway  *Mode                     `json:"gateway"`  // Nil when the gateway is serving
+	Services map[string]Mode           `json:"services"` // Upstream services under maintenance
+	Methods  map[string]DisabledMethod `json:"methods"`  // Disabled "package.Service/Method" routes
+}
+
+// Manager holds the maintenance state and rejects requests to routes under
+// maintenance. Gateway-wide maintenance also puts the gateway's own instance
+// into maintenance in the registry and fails the readiness check.
+type Manager struct {
+	registry   registry.Registry
+	instanceID string
+	logger     *slog.Logger
+
+	mu        sync.Mutex // Serializes changes
+	status    atomic.Pointer[Status]
+	listeners []func(Status)
+}
+
+// New creates a maintenance manager; reg may be nil when the gateway does not register itself
+func New(reg registry.Registry, instanceID string, logger *slog.Logger) *Manager {
+	m := &Manager{registry: reg, instanceID: instanceID, logger: logger}
+	m.status.Store(&Status{Services: map[string]Mode{}, Methods: map[string]DisabledMethod{}})
+	return m
+}
+
+// OnChange registers fn to be called after every change of the maintenance state
+func (m *Manager) OnChange(fn func(Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Status returns the current maintenance state
+func (m *Manager) Status() Status {
+	return *m.status.Load()
+}
+
+// Enable puts the gateway into maintenance. The registry error, if any, is
+// returned after the mode has taken effect, so requests are rejected even when
+// the registry cannot be updated.
+func (m *Manager) Enable(ctx context.Context, mode Mode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+	mode.Since = time.Now()
+	m.update(func(s *Status) { s.Gateway = &mode })
+	m.logger.Info("Gateway entered maintenance", "reason", mode.Reason, "routes", mode.Routes)
+	return m.setRegistry(ctx, true, mode.Reason)
+}
+
+// Disable resumes serving after gateway maintenance
+func (m *Manager) Disable(ctx context.Context) error {
+	m.update(func(s *Status) { s.Gateway = nil })
+	m.logger.Info("Gateway resumed from maintenance")
+	return m.setRegistry(ctx, false, "")
+}
+
+// EnableService puts one upstream service into maintenance
+func (m *Manager) EnableService(service string, mode Mode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+	mode.Since = time.Now()
+	m.update(func(s *Status) { s.Services[service] = mode })
+	m.logger.Info("Service entered maintenance", "service", service, "reason", mode.Reason, "routes", mode.Routes)
+	return nil
+}
+
+// DisableService resumes an upstream service, reporting whether it was under maintenance
+func (m *Manager) DisableService(service string) bool {
+	if _, ok := m.Status().Services[service]; !ok {
+		return false
+	}
+	m.update(func(s *Status) { delete(s.Services, service) })
+	m.logger.Info("Service resumed from maintenance", "service", service)
+	return true
+}
+
+// DisableMethod rejects the requests to a "package.Service/Method" route
+// until RestoreMethod is called or, for methods disabled in the config, the
+// config is reloaded without it
+func (m *Manager) DisableMethod(route string, disabled DisabledMethod) error {
+	if err := validateMethodRoute(route); err != nil {
+		return err
+	}
+	if disabled.Code != codes.Unavailable && disabled.Code != codes.Unimplemented {
+		return fmt.Errorf("invalid code %s for a disabled method, expected UNAVAILABLE or UNIMPLEMENTED", disabled.Code)
+	}
+	if disabled.Source == "" {
+		disabled.Source = SourceAdmin
+	}
+	disabled.Since = time.Now()
+	m.update(func(s *Status) { s.Methods[route] = disabled })
+	m.logger.Info("Method disabled", "route", route, "code", disabled.Code, "message", disabled.Message, "source", disabled.Source)
+	return nil
+}
+
+// RestoreMethod forwards the requests to a disabled route again, reporting
+// whether it was disabled
+func (m *Manager) RestoreMethod(route string) bool {
+	if _, ok := m.Status().Methods[route]; !ok {
+		return false
+	}
+	m.update(func(s *Status) { delete(s.Methods, route) })
+	m.logger.Info("Method restored", "route", route)
+	return true
+}
+
+// SetConfigMethods replaces the methods disabled by the config. Methods
+// disabled through the admin API are kept; a route in both keeps the one set
+// last.
+func (m *Manager) SetConfigMethods(methods map[string]DisabledMethod) error {
+	for route := range methods {
+		if err := validateMethodRoute(route); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	m.update(func(s *Status) {
+		previous := make(map[string]DisabledMethod)
+		for route, disabled := range s.Methods {
+			if disabled.Source == SourceConfig {
+				previous[route] = disabled
+				delete(s.Methods, route)
+			}
+		}
+		// An unchanged method keeps the time it was first disabled
+		for route, disabled := range methods {
+			disabled.Source = SourceConfig
+			disabled.Since = now
+			if old, ok := previous[route]; ok && old.Code == disabled.Code && old.Message == disabled.Message {
+				disabled.Since = old.Since
+			}
+			s.Methods[route] = disabled
+		}
+	})
+	return nil
+}
+
+// validateMethodRoute checks that a route names one method
+func validateMethodRoute(route string) error {
+	service, method, ok := strings.Cut(route, "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return fmt.Errorf("invalid method %q, expected package.Service/Method", route)
+	}
+	return nil
+}
+
+// Check returns the status error and the Retry-After to send when the route
+// is under maintenance (Unavailable) or disabled (Unavailable or
+// Unimplemented, without Retry-After), or nil
+func (m *Manager) Check(service, method string) (time.Duration, error) {
+	if m == nil {
+		return 0, nil
+	}
+	s := m.status.Load()
+	route := service + "/" + method
+	if s.Gateway != nil && s.Gateway.matches(route) {
+		return s.Gateway.retryAfter(), status.Error(codes.Unavailable, s.Gateway.message("gateway is under maintenance"))
+	}
+	if mode, ok := s.Services[service]; ok && mode.matches(route) {
+		return mode.retryAfter(), status.Error(codes.Unavailable, mode.message(fmt.Sprintf("service %s is under maintenance", service)))
+	}
+	if disabled, ok := s.Methods[route]; ok {
+		msg := disabled.Message
+		if msg == "" {
+			msg = fmt.Sprintf("method %s is disabled", route)
+		}
+		return 0, status.Error(disabled.Code, msg)
+	}
+	return 0, nil
+}
+
+// Ready implements a readiness check that fails during gateway maintenance
+func (m *Manager) Ready(context.Context) error {
+	if mode := m.status.Load().Gateway; mode != nil {
+		return fmt.Errorf("%s", mode.message("gateway is under maintenance"))
+	}
+	return nil
+}
+
+// update applies fn to a copy of the state and notifies the listeners
+func (m *Manager) update(fn func(*Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.status.Load()
+	next := &Status{Gateway: old.Gateway, Services: make(map[string]Mode, len(old.Services)), Methods: make(map[string]DisabledMethod, len(old.Methods))}
+	for name, mode := range old.Services {
+		next.Services[name] = mode
+	}
+	for route, disabled := range old.Methods {
+		next.Methods[route] = disabled
+	}
+	fn(next)
+	m.status.Store(next)
+	for _, fn := range m.listeners {
+		fn(*next)
+	}
+}
+
+// setRegistry updates the maintenance state of the gateway's own instance
+func (m *Manager) setRegistry(ctx context.Context, enabled bool, reason string) error {
+	if m.registry == nil {
+		return nil
+	}
+	maintainer, ok := m.registry.(registry.Maintainer)
+	if !ok {
+		return fmt.Errorf("registry does not support maintenance mode")
+	}
+	if err := maintainer.SetMaintenance(ctx, m.instanceID, enabled, reason); err != nil {
+		m.logger.Warn("Failed to update maintenance state in registry", "id", m.instanceID, "enabled", enabled, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Validate checks the route patterns and Retry-After of the mode
+func (m Mode) Validate() error {
+	for _, pattern := range m.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid route pattern %q: %w", pattern, err)
+		}
+	}
+	if m.RetryAfter < 0 {
+		return fmt.Errorf("retry_after_seconds must not be negative")
+	}
+	return nil
+}
+
+// matches reports whether the mode rejects the route
+func (m *Mode) matches(route string) bool {
+	if len(m.Routes) == 0 {
+		return true
+	}
+	for _, pattern := range m.Routes {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the Retry-After of rejected requests
+func (m *Mode) retryAfter() time.Duration {
+	if m.RetryAfter > 0 {
+		return m.RetryAfter
+	}
+	return DefaultRetryAfter
+}
+
+// message returns the rejection message with the reason, if any
+func (m *Mode) message(msg string) string {
+	if m.Reason != "" {
+		return msg + ": " + m.Reason
+	}
+	return msg
+}
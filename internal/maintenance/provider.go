@@ -0,0 +1,48 @@
+package maintenance
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet maintenance provider set
+var ProviderSet = wire.NewSet(
+	ProvideManager,
+)
+
+// ProvideManager provides the maintenance manager with the methods disabled in
+// the config, reapplied on reload, and adds its readiness check
+func ProvideManager(cfg *config.Config, log *slog.Logger, reg registry.Registry, h *health.Health, watcher *reload.Watcher) (*Manager, error) {
+	m := New(reg, cfg.Registry.ServiceID, logger.Component(log, "maintenance"))
+	if err := m.applyConfig(cfg.Maintenance.DisabledMethods); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("maintenance", func(_, next *config.Config) error {
+		return m.applyConfig(next.Maintenance.DisabledMethods)
+	})
+	h.AddReadinessCheck("maintenance", m.Ready)
+	return m, nil
+}
+
+// applyConfig replaces the methods disabled by the config
+func (m *Manager) applyConfig(cfgs []config.DisabledMethodConfig) error {
+	methods := make(map[string]DisabledMethod, len(cfgs))
+	for i, cfg := range cfgs {
+		if err := validateMethodRoute(cfg.Method); err != nil {
+			return fmt.Errorf("maintenance.disabled_methods[%d]: %w", i, err)
+		}
+		code, err := ParseDisabledCode(cfg.Code)
+		if err != nil {
+			return fmt.Errorf("maintenance.disabled_methods[%d]: %w", i, err)
+		}
+		methods[cfg.Method] = DisabledMethod{Code: code, Message: cfg.Message}
+	}
+	return m.SetConfigMethods(methods)
+}
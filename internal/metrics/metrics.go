@@ -0,0 +1,501 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the default latency histogram buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// collector is a metric family that can write itself in Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metric families and exposes them in Prometheus text format
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the process-wide registry used by the package level constructors
+var Default = NewRegistry()
+
+// register adds a collector, returning the existing one when the name is already registered
+func (r *Registry) register(c collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.collectors[c.name()]; ok {
+		return existing
+	}
+	r.collectors[c.name()] = c
+	return c
+}
+
+// Write writes all metrics in Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry in Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// family holds the shared metadata and label handling of a metric vector
+type family struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// key builds the series key for a set of label values
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString renders label pairs, optionally with an extra pair
+func (f *family) labelString(values []string, extraName, extraValue string) string {
+	if len(f.labels) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(f.labels)+1)
+	for i, l := range f.labels {
+		pairs = append(pairs, l+`="`+escape(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// header writes the HELP and TYPE lines
+func (f *family) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, f.help, f.metricName, typ)
+}
+
+// escape escapes a label value
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// atomicFloat is a float64 updated atomically
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&f.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// series is a labelled value of a counter or gauge
+type series struct {
+	values []string
+	value  atomicFloat
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	family
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+// NewCounterVec registers a counter vector in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec registers a counter vector
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		family: family{metricName: name, help: help, labels: labels},
+		series: make(map[string]*series),
+	}
+	return r.register(c).(*CounterVec)
+}
+
+// Add adds delta to the series identified by values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.get(values).value.add(delta)
+}
+
+// Inc increments the series identified by values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the current value of a series
+func (c *CounterVec) Value(values ...string) float64 {
+	return c.get(values).value.load()
+}
+
+func (c *CounterVec) get(values []string) *series {
+	return getSeries(&c.family, &c.mu, c.series, values)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w, "counter")
+	writeSeries(w, &c.family, &c.mu, c.series)
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels
+type GaugeVec struct {
+	family
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+// NewGaugeVec registers a gauge vector in the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a gauge vector
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		family: family{metricName: name, help: help, labels: labels},
+		series: make(map[string]*series),
+	}
+	return r.register(g).(*GaugeVec)
+}
+
+// Set sets the series identified by values
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.get(values).value.set(v)
+}
+
+// Add adds delta to the series identified by values
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.get(values).value.add(delta)
+}
+
+// Delete removes the series identified by values
+func (g *GaugeVec) Delete(values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.series, g.key(values))
+}
+
+func (g *GaugeVec) get(values []string) *series {
+	return getSeries(&g.family, &g.mu, g.series, values)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.header(w, "gauge")
+	writeSeries(w, &g.family, &g.mu, g.series)
+}
+
+// EmitFunc reports a sample for the series identified by values
+type EmitFunc func(v float64, values ...string)
+
+// FuncVec is a gauge or counter whose samples are collected on each scrape
+type FuncVec struct {
+	family
+	typ     string
+	collect func(emit EmitFunc)
+}
+
+// NewGaugeFunc registers a gauge collected on scrape in the default registry
+func NewGaugeFunc(name, help string, collect func(emit EmitFunc), labels ...string) *FuncVec {
+	return Default.NewFuncVec("gauge", name, help, collect, labels...)
+}
+
+// NewCounterFunc registers a counter collected on scrape in the default registry
+func NewCounterFunc(name, help string, collect func(emit EmitFunc), labels ...string) *FuncVec {
+	return Default.NewFuncVec("counter", name, help, collect, labels...)
+}
+
+// NewFuncVec registers a metric of the given type collected on scrape
+func (r *Registry) NewFuncVec(typ, name, help string, collect func(emit EmitFunc), labels ...string) *FuncVec {
+	f := &FuncVec{
+		family:  family{metricName: name, help: help, labels: labels},
+		typ:     typ,
+		collect: collect,
+	}
+	return r.register(f).(*FuncVec)
+}
+
+func (f *FuncVec) write(w io.Writer) {
+	f.header(w, f.typ)
+	f.collect(func(v float64, values ...string) {
+		f.key(values)
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelString(values, "", ""), formatFloat(v))
+	})
+}
+
+// getSeries returns the series for values, creating it on first use
+func getSeries(f *family, mu *sync.RWMutex, all map[string]*series, values []string) *series {
+	key := f.key(values)
+	mu.RLock()
+	s, ok := all[key]
+	mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok := all[key]; ok {
+		return s
+	}
+	s = &series{values: append([]string(nil), values...)}
+	all[key] = s
+	return s
+}
+
+// writeSeries writes counter or gauge samples sorted by labels
+func writeSeries(w io.Writer, f *family, mu *sync.RWMutex, all map[string]*series) {
+	mu.RLock()
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, all[key])
+	}
+	mu.RUnlock()
+
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelString(s.values, "", ""), formatFloat(s.value.load()))
+	}
+}
+
+// histogramSeries is a labelled histogram
+type histogramSeries struct {
+	values []string
+	mu     sync.Mutex
+	counts []uint64 // Per-bucket (non-cumulative) counts, last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec samples observations into buckets, partitioned by labels
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.RWMutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec registers a histogram vector in the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec registers a histogram vector
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		family:  family{metricName: name, help: help, labels: labels},
+		buckets: sorted,
+		series:  make(map[string]*histogramSeries),
+	}
+	return r.register(h).(*HistogramVec)
+}
+
+// Observe records a value in the series identified by values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	s := h.get(values)
+	idx := sort.SearchFloat64s(h.buckets, v)
+	s.mu.Lock()
+	s.counts[idx]++
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+func (h *HistogramVec) get(values []string) *histogramSeries {
+	key := h.key(values)
+	h.mu.RLock()
+	s, ok := h.series[key]
+	h.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s
+	}
+	s = &histogramSeries{
+		values: append([]string(nil), values...),
+		counts: make([]uint64, len(h.buckets)+1),
+	}
+	h.series[key] = s
+	return s
+}
+
+// HistogramSnapshot is a point-in-time copy of a histogram series
+type HistogramSnapshot struct {
+	Labels  map[string]string
+	Buckets []float64 // Upper bounds, excluding +Inf
+	Counts  []uint64  // Cumulative counts per bucket, last is +Inf
+	Sum     float64
+	Count   uint64
+}
+
+// Snapshot returns copies of all series
+func (h *HistogramVec) Snapshot() []HistogramSnapshot {
+	h.mu.RLock()
+	all := make([]*histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		all = append(all, s)
+	}
+	h.mu.RUnlock()
+
+	snapshots := make([]HistogramSnapshot, 0, len(all))
+	for _, s := range all {
+		labels := make(map[string]string, len(h.labels))
+		for i, l := range h.labels {
+			labels[l] = s.values[i]
+		}
+		s.mu.Lock()
+		cumulative := make([]uint64, len(s.counts))
+		var total uint64
+		for i, c := range s.counts {
+			total += c
+			cumulative[i] = total
+		}
+		snapshots = append(snapshots, HistogramSnapshot{
+			Labels:  labels,
+			Buckets: h.buckets,
+			Counts:  cumulative,
+			Sum:     s.sum,
+			Count:   s.count,
+		})
+		s.mu.Unlock()
+	}
+	return snapshots
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) by linear interpolation within buckets
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(s.Count)
+	for i, c := range s.Counts {
+		if float64(c) < rank {
+			continue
+		}
+		if i == len(s.Buckets) {
+			// Observations above the highest bucket: report its upper bound
+			return s.Buckets[len(s.Buckets)-1]
+		}
+		lower, prev := 0.0, uint64(0)
+		if i > 0 {
+			lower, prev = s.Buckets[i-1], s.Counts[i-1]
+		}
+		inBucket := c - prev
+		if inBucket == 0 {
+			return s.Buckets[i]
+		}
+		return lower + (s.Buckets[i]-lower)*(rank-float64(prev))/float64(inBucket)
+	}
+	return s.Buckets[len(s.Buckets)-1]
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.header(w, "histogram")
+	snapshots := h.Snapshot()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return h.key(labelValues(h.labels, snapshots[i].Labels)) < h.key(labelValues(h.labels, snapshots[j].Labels))
+	})
+	for _, s := range snapshots {
+		values := labelValues(h.labels, s.Labels)
+		for i, upper := range s.Buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(values, "le", formatFloat(upper)), s.Counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(values, "le", "+Inf"), s.Counts[len(s.Counts)-1])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelString(values, "", ""), formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelString(values, "", ""), s.Count)
+	}
+}
+
+// labelValues orders label values by label names
+func labelValues(names []string, labels map[string]string) []string {
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = labels[n]
+	}
+	return values
+}
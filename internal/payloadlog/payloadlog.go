@@ -0,0 +1,143 @@
+package payloadlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// RedactedValue replaces the value of redacted fields
+const RedactedValue = "***"
+
+// Logger logs request and response JSON bodies of selected methods with sensitive fields masked
+type Logger struct {
+	*Redactor
+	methods []string
+	logger  *slog.Logger
+}
+
+// Redactor masks sensitive fields of JSON bodies
+type Redactor struct {
+	paths    [][]string
+	maxBytes int
+}
+
+// NewRedactor creates a redactor for dotted field paths. Output longer than
+// maxBytes is truncated; 0 disables truncation.
+func NewRedactor(paths []string, maxBytes int) *Redactor {
+	redact := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		segments := strings.Split(p, ".")
+		for i, seg := range segments {
+			segments[i] = normalize(seg)
+		}
+		redact = append(redact, segments)
+	}
+	return &Redactor{paths: redact, maxBytes: maxBytes}
+}
+
+// New creates a payload logger
+func New(cfg config.PayloadLogConfig, logger *slog.Logger) (*Logger, error) {
+	for _, m := range cfg.Methods {
+		if _, err := path.Match(m, ""); err != nil {
+			return nil, fmt.Errorf("invalid payload log method pattern %q: %w", m, err)
+		}
+	}
+
+	return &Logger{
+		Redactor: NewRedactor(cfg.Redact, cfg.MaxBytes),
+		methods:  cfg.Methods,
+		logger:   logger,
+	}, nil
+}
+
+// Enabled reports whether payloads of the method should be logged
+func (l *Logger) Enabled(service, method string) bool {
+	if l == nil {
+		return false
+	}
+	route := service + "/" + method
+	for _, m := range l.methods {
+		if ok, _ := path.Match(m, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LogRequest logs a request body
+func (l *Logger) LogRequest(service, method string, body []byte) {
+	l.log("Request payload", service, method, body)
+}
+
+// LogResponse logs a response body
+func (l *Logger) LogResponse(service, method string, body []byte) {
+	l.log("Response payload", service, method, body)
+}
+
+// log redacts and writes a payload if the method is selected
+func (l *Logger) log(msg, service, method string, body []byte) {
+	if !l.Enabled(service, method) {
+		return
+	}
+	l.logger.Info(msg, "service", service, "method", method, "payload", l.Redact(body))
+}
+
+// Redact returns the body with all configured field paths masked.
+// Bodies that are not valid JSON are never logged verbatim.
+func (r *Redactor) Redact(body []byte) string {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Sprintf("<non-JSON payload, %d bytes>", len(body))
+	}
+	for _, p := range r.paths {
+		doc = redactPath(doc, p)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Sprintf("<unencodable payload, %d bytes>", len(body))
+	}
+	if r.maxBytes > 0 && len(data) > r.maxBytes {
+		return string(data[:r.maxBytes]) + "...(truncated)"
+	}
+	return string(data)
+}
+
+// redactPath masks the value at path within doc. A "*" segment matches any field,
+// and arrays are traversed transparently.
+func redactPath(doc any, segments []string) any {
+	switch v := doc.(type) {
+	case []any:
+		for i := range v {
+			v[i] = redactPath(v[i], segments)
+		}
+		return v
+	case map[string]any:
+		if len(segments) == 0 {
+			return v
+		}
+		for key, value := range v {
+			if segments[0] != "*" && normalize(key) != segments[0] {
+				continue
+			}
+			if len(segments) == 1 {
+				v[key] = RedactedValue
+			} else {
+				v[key] = redactPath(value, segments[1:])
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// normalize makes field names comparable across JSON (lowerCamelCase) and proto (snake_case) spellings
+func normalize(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
@@ -0,0 +1,22 @@
+package payloadlog
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet payload logger provider set
+var ProviderSet = wire.NewSet(
+	ProvideLogger,
+)
+
+// ProvideLogger provides the payload logger, or nil when payload logging is disabled
+func ProvideLogger(cfg *config.Config, log *slog.Logger) (*Logger, error) {
+	if !cfg.Log.Payload.Enabled {
+		return nil, nil
+	}
+	return New(cfg.Log.Payload, logger.Component(log, "payload"))
+}
@@ -0,0 +1,179 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/pkg/plugin"
+)
+
+// defaultTimeout bounds a filter call when the plugin has no timeout configured
+const defaultTimeout = time.Second
+
+var pluginErrors = metrics.NewCounterVec(
+	"gateway_plugin_errors_total",
+	"Failed plugin filter calls, by plugin and whether the request was let through",
+	"plugin", "fail_open",
+)
+
+// Plugin is a running plugin process
+type Plugin struct {
+	Name   string
+	Filter plugin.Filter // Applies the configured timeout and fail-open policy
+	client *goplugin.Client
+}
+
+// Exited reports whether the plugin process has exited
+func (p *Plugin) Exited() bool {
+	return p.client.Exited()
+}
+
+// Manager starts the configured plugins and stops them on shutdown
+type Manager struct {
+	plugins []*Plugin
+	logger  *slog.Logger
+}
+
+// Start launches every configured plugin. A plugin that cannot be started
+// stops the ones already running and fails the startup.
+func Start(cfgs []config.PluginConfig, logger *slog.Logger) (*Manager, error) {
+	m := &Manager{logger: logger}
+	names := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || cfg.Path == "" {
+			m.Close()
+			return nil, fmt.Errorf("plugin requires a name and a path")
+		}
+		if names[cfg.Name] {
+			m.Close()
+			return nil, fmt.Errorf("duplicate plugin %q", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		p, err := m.start(cfg)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to start plugin %q: %w", cfg.Name, err)
+		}
+		m.plugins = append(m.plugins, p)
+		logger.Info("Plugin started", "plugin", cfg.Name, "path", cfg.Path)
+	}
+	return m, nil
+}
+
+// start launches a plugin process and dispenses its filter
+func (m *Manager) start(cfg config.PluginConfig) (*Plugin, error) {
+	logger := m.logger.With("plugin", cfg.Name)
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  plugin.Handshake,
+		Plugins:          goplugin.PluginSet{plugin.Name: &plugin.GRPCPlugin{}},
+		Cmd:              exec.Command(cfg.Path, cfg.Args...),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Managed:          true,
+		Logger: hclog.FromStandardLogger(slog.NewLogLogger(logger.Handler(), slog.LevelInfo), &hclog.LoggerOptions{
+			Name:        cfg.Name,
+			Level:       hclog.Info,
+			DisableTime: true,
+		}),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	raw, err := rpcClient.Dispense(plugin.Name)
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	filter, ok := raw.(plugin.Filter)
+	if !ok {
+		client.Kill()
+		return nil, fmt.Errorf("plugin does not serve a filter")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Plugin{
+		Name:   cfg.Name,
+		Filter: &guarded{name: cfg.Name, filter: filter, timeout: timeout, failOpen: cfg.FailOpen, logger: logger},
+		client: client,
+	}, nil
+}
+
+// Plugins returns the running plugins in configuration order
+func (m *Manager) Plugins() []*Plugin {
+	if m == nil {
+		return nil
+	}
+	return m.plugins
+}
+
+// Close stops every plugin process
+func (m *Manager) Close() {
+	if m == nil {
+		return
+	}
+	for _, p := range m.plugins {
+		p.client.Kill()
+	}
+}
+
+// Cleanup stops every plugin process started by this process. It is meant
+// for fatal exits, where the manager may not have been constructed yet.
+func Cleanup() {
+	goplugin.CleanupClients()
+}
+
+// guarded applies a timeout to every filter call and, when the plugin fails
+// open, turns failures into a pass-through result
+type guarded struct {
+	name     string
+	filter   plugin.Filter
+	timeout  time.Duration
+	failOpen bool
+	logger   *slog.Logger
+}
+
+// FilterRequest implements plugin.Filter
+func (g *guarded) FilterRequest(ctx context.Context, req *plugin.Request) (*plugin.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	result, err := g.filter.FilterRequest(ctx, req)
+	return g.result(result, err)
+}
+
+// FilterResponse implements plugin.Filter
+func (g *guarded) FilterResponse(ctx context.Context, resp *plugin.Response) (*plugin.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	result, err := g.filter.FilterResponse(ctx, resp)
+	return g.result(result, err)
+}
+
+// result applies the fail-open policy to a filter call outcome
+func (g *guarded) result(result *plugin.Result, err error) (*plugin.Result, error) {
+	if err == nil {
+		if result == nil {
+			result = &plugin.Result{}
+		}
+		return result, nil
+	}
+	pluginErrors.Inc(g.name, fmt.Sprint(g.failOpen))
+	if g.failOpen {
+		g.logger.Warn("Plugin call failed, letting the request through", "error", err)
+		return &plugin.Result{}, nil
+	}
+	return nil, fmt.Errorf("plugin %s failed: %w", g.name, err)
+}
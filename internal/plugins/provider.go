@@ -0,0 +1,36 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet plugin provider set
+var ProviderSet = wire.NewSet(
+	ProvideManager,
+)
+
+// ProvideManager starts the configured plugins and reports a plugin process
+// that has exited as not ready
+func ProvideManager(cfg *config.Config, log *slog.Logger, h *health.Health) (*Manager, error) {
+	m, err := Start(cfg.Plugins, logger.Component(log, "plugins"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range m.Plugins() {
+		p := p
+		h.AddReadinessCheck("plugin:"+p.Name, func(context.Context) error {
+			if p.Exited() {
+				return fmt.Errorf("plugin process exited")
+			}
+			return nil
+		})
+	}
+	return m, nil
+}
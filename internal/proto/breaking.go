@@ -0,0 +1,203 @@
+package proto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// BreakingChanges compares a protoset that is about to be loaded as source with
+// the descriptors currently served. It reports methods of the source that would
+// be removed or change signature, and fields of their request and response
+// messages (recursively) that would be removed or change type, label or JSON name.
+func (d *DescriptorLoader) BreakingChanges(source string, data []byte) ([]string, error) {
+	fileSet, err := unmarshalProtoset(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protoset data: %w", err)
+	}
+
+	d.mu.RLock()
+	current := d.fileSet.File
+	served := methodDescriptorsOf(d.sources[source])
+	order := d.order
+	if _, ok := d.sources[source]; !ok {
+		order = append(order[:len(order):len(order)], source)
+	}
+	sources := make(map[string][]*descriptorpb.FileDescriptorProto, len(d.sources)+1)
+	for name, files := range d.sources {
+		sources[name] = files
+	}
+	d.mu.RUnlock()
+
+	sources[source] = fileSet.File
+	next := merge(order, sources).File
+
+	c := &compatibility{
+		oldMessages: messagesOf(current),
+		newMessages: messagesOf(next),
+		visited:     make(map[string]bool),
+	}
+	nextMethods := methodDescriptorsOf(next)
+	names := make([]string, 0, len(served))
+	for name := range served {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, method := served[name], nextMethods[name]
+		switch {
+		case method == nil:
+			c.add("method %s removed", name)
+			continue
+		case StreamingType(old) != StreamingType(method):
+			c.add("method %s changed from %s to %s", name, StreamingType(old), StreamingType(method))
+		case old.GetInputType() != method.GetInputType():
+			c.add("method %s request changed from %s to %s", name, strings.TrimPrefix(old.GetInputType(), "."), strings.TrimPrefix(method.GetInputType(), "."))
+		case old.GetOutputType() != method.GetOutputType():
+			c.add("method %s response changed from %s to %s", name, strings.TrimPrefix(old.GetOutputType(), "."), strings.TrimPrefix(method.GetOutputType(), "."))
+		}
+		c.message(old.GetInputType())
+		c.message(old.GetOutputType())
+	}
+	return c.changes, nil
+}
+
+// CheckBreakingChanges runs BreakingChanges according to a breaking_changes
+// mode: "ignore" skips the check, "reject" returns an error when there are
+// breaking changes, anything else (warn) only returns them.
+func (d *DescriptorLoader) CheckBreakingChanges(source string, data []byte, mode string) ([]string, error) {
+	if mode == "ignore" {
+		return nil, nil
+	}
+	changes, err := d.BreakingChanges(source, data)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "reject" && len(changes) > 0 {
+		return changes, fmt.Errorf("refusing protoset with %d breaking changes: %s", len(changes), strings.Join(changes, "; "))
+	}
+	return changes, nil
+}
+
+// compatibility collects breaking changes between two descriptor sets
+type compatibility struct {
+	oldMessages map[string]*descriptorpb.DescriptorProto
+	newMessages map[string]*descriptorpb.DescriptorProto
+	visited     map[string]bool
+	changes     []string
+}
+
+func (c *compatibility) add(format string, args ...any) {
+	c.changes = append(c.changes, fmt.Sprintf(format, args...))
+}
+
+// message compares the fields of a message and of the messages it references
+func (c *compatibility) message(typeName string) {
+	if c.visited[typeName] {
+		return
+	}
+	c.visited[typeName] = true
+
+	old := c.oldMessages[typeName]
+	if old == nil {
+		return
+	}
+	next := c.newMessages[typeName]
+	if next == nil {
+		c.add("message %s removed", strings.TrimPrefix(typeName, "."))
+		return
+	}
+
+	fields := make(map[int32]*descriptorpb.FieldDescriptorProto, len(next.Field))
+	for _, field := range next.Field {
+		fields[field.GetNumber()] = field
+	}
+	for _, oldField := range old.Field {
+		name := fmt.Sprintf("%s.%s (%d)", strings.TrimPrefix(typeName, "."), oldField.GetName(), oldField.GetNumber())
+		field := fields[oldField.GetNumber()]
+		switch {
+		case field == nil:
+			c.add("field %s removed", name)
+			continue
+		case fieldType(oldField) != fieldType(field):
+			c.add("field %s changed type from %s to %s", name, fieldType(oldField), fieldType(field))
+		case oldField.GetLabel() != field.GetLabel():
+			c.add("field %s changed label from %s to %s", name, oldField.GetLabel(), field.GetLabel())
+		case jsonName(oldField) != jsonName(field):
+			c.add("field %s changed JSON name from %s to %s", name, jsonName(oldField), jsonName(field))
+		}
+		if oldField.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			c.message(oldField.GetTypeName())
+		}
+	}
+}
+
+// methodDescriptorsOf maps full method names to their descriptors
+func methodDescriptorsOf(files []*descriptorpb.FileDescriptorProto) map[string]*descriptorpb.MethodDescriptorProto {
+	methods := make(map[string]*descriptorpb.MethodDescriptorProto)
+	for _, file := range files {
+		for _, service := range file.Service {
+			serviceName := qualify(file.GetPackage(), service.GetName())
+			for _, method := range service.Method {
+				methods["/"+serviceName+"/"+method.GetName()] = method
+			}
+		}
+	}
+	return methods
+}
+
+// messagesOf maps fully qualified type names (with leading dot, as used in
+// type_name references) to message descriptors, including nested messages
+func messagesOf(files []*descriptorpb.FileDescriptorProto) map[string]*descriptorpb.DescriptorProto {
+	messages := make(map[string]*descriptorpb.DescriptorProto)
+	var walk func(prefix string, list []*descriptorpb.DescriptorProto)
+	walk = func(prefix string, list []*descriptorpb.DescriptorProto) {
+		for _, msg := range list {
+			name := prefix + "." + msg.GetName()
+			messages[name] = msg
+			walk(name, msg.NestedType)
+		}
+	}
+	for _, file := range files {
+		prefix := ""
+		if file.GetPackage() != "" {
+			prefix = "." + file.GetPackage()
+		}
+		walk(prefix, file.MessageType)
+	}
+	return messages
+}
+
+// fieldType describes the type of a field, naming the referenced message or enum
+func fieldType(field *descriptorpb.FieldDescriptorProto) string {
+	if field.GetTypeName() != "" {
+		return strings.TrimPrefix(field.GetTypeName(), ".")
+	}
+	return field.GetType().String()
+}
+
+// jsonName returns the JSON name used when transcoding a field
+func jsonName(field *descriptorpb.FieldDescriptorProto) string {
+	if field.JsonName != nil {
+		return field.GetJsonName()
+	}
+	// Same default as protoc: drop underscores and upper-case the letter after them
+	name := []byte(field.GetName())
+	out := name[:0]
+	upper := false
+	for _, c := range name {
+		switch {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			out = append(out, c-'a'+'A')
+			upper = false
+		default:
+			out = append(out, c)
+			upper = false
+		}
+	}
+	return string(out)
+}
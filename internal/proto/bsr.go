@@ -0,0 +1,136 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// getImagePath is the Connect endpoint that builds a module into an image
+const getImagePath = "/buf.alpha.registry.v1alpha1.ImageService/GetImage"
+
+// ModuleRef is a Buf Schema Registry module reference, e.g. buf.build/acme/orders:v1.2.0
+type ModuleRef struct {
+	Remote     string // Registry host, e.g. buf.build
+	Owner      string
+	Repository string
+	Reference  string // Tag, commit or branch; empty means the latest commit on main
+}
+
+// ParseModuleRef parses remote/owner/repository[:reference]
+func ParseModuleRef(ref string) (ModuleRef, error) {
+	name, reference := ref, ""
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, reference = ref[:i], ref[i+1:]
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return ModuleRef{}, fmt.Errorf("invalid module reference %q, expected remote/owner/repository[:reference]", ref)
+	}
+	return ModuleRef{Remote: parts[0], Owner: parts[1], Repository: parts[2], Reference: reference}, nil
+}
+
+// String returns the reference in remote/owner/repository[:reference] form
+func (r ModuleRef) String() string {
+	s := r.Remote + "/" + r.Owner + "/" + r.Repository
+	if r.Reference != "" {
+		s += ":" + r.Reference
+	}
+	return s
+}
+
+// BSRClient downloads module images from the Buf Schema Registry
+type BSRClient struct {
+	token      string
+	httpClient *http.Client
+}
+
+// NewBSRClient creates a BSR client, the token falls back to BUF_TOKEN
+func NewBSRClient(cfg config.BSRConfig) *BSRClient {
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("BUF_TOKEN")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &BSRClient{
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// FetchImage builds the referenced module with its dependencies and returns it
+// as a serialized FileDescriptorSet
+func (c *BSRClient) FetchImage(ctx context.Context, ref string) ([]byte, error) {
+	module, err := ParseModuleRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"owner":             module.Owner,
+		"repository":        module.Repository,
+		"reference":         module.Reference,
+		"excludeSourceInfo": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+module.Remote+getImagePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch module %s: %w", module, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module %s: %w", module, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var connectErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &connectErr) == nil && connectErr.Code != "" {
+			return nil, fmt.Errorf("failed to fetch module %s: %s: %s", module, connectErr.Code, connectErr.Message)
+		}
+		return nil, fmt.Errorf("failed to fetch module %s: status code %d", module, resp.StatusCode)
+	}
+
+	// An image is a FileDescriptorSet whose files carry extra Buf metadata
+	var image struct {
+		Image json.RawMessage `json:"image"`
+	}
+	if err := json.Unmarshal(data, &image); err != nil {
+		return nil, fmt.Errorf("invalid image for module %s: %w", module, err)
+	}
+	fileSet := &descriptorpb.FileDescriptorSet{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(image.Image, fileSet); err != nil {
+		return nil, fmt.Errorf("invalid image for module %s: %w", module, err)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(fileSet)
+}
@@ -0,0 +1,96 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// isProtoSource 判断路径是否为 .proto 源文件或源文件目录
+func isProtoSource(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".proto") || isSourceDir(path)
+}
+
+// isSourceDir 判断路径是否为目录
+func isSourceDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// compileProtoSources 编译 .proto 源文件或目录下的所有 .proto 文件，返回包含其全部依赖的文件集
+// 单个文件以其所在目录为导入根目录，目录以自身为导入根目录，importPaths 为额外的导入目录
+func compileProtoSources(path string, importPaths []string) (*descriptorpb.FileDescriptorSet, error) {
+	root, files := filepath.Dir(path), []string{filepath.Base(path)}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		root = path
+		files, err = findProtoFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no .proto files in %s", path)
+		}
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: append([]string{root}, importPaths...),
+		}),
+	}
+	compiled, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile proto sources in %s: %w", path, err)
+	}
+
+	// 依赖在前，保证文件集可按顺序注册
+	fileSet := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fileSet.File = append(fileSet.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range compiled {
+		add(fd)
+	}
+	return fileSet, nil
+}
+
+// findProtoFiles 返回目录下所有 .proto 文件相对该目录的路径
+func findProtoFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".proto") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,146 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Description summarizes the loaded descriptors for operators and API consumers
+type Description struct {
+	Version  string                         `json:"version"` // SHA-256 of the live FileDescriptorSet
+	Files    []string                       `json:"files"`
+	Services []ServiceDescription           `json:"services"`
+	Messages map[string]*MessageDescription `json:"messages"`
+}
+
+// ServiceDescription describes a service and its methods
+type ServiceDescription struct {
+	Name    string              `json:"name"`
+	File    string              `json:"file"`
+	Methods []MethodDescription `json:"methods"`
+}
+
+// MethodDescription describes a method and its streaming type
+type MethodDescription struct {
+	Name            string `json:"name"`
+	FullMethod      string `json:"full_method"`
+	InputType       string `json:"input_type"`
+	OutputType      string `json:"output_type"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+	StreamingType   string `json:"streaming_type"` // unary, client_stream, server_stream, bidi_stream
+}
+
+// MessageDescription describes the schema of a message
+type MessageDescription struct {
+	Fields []FieldDescription `json:"fields"`
+}
+
+// FieldDescription describes a message field
+type FieldDescription struct {
+	Name     string `json:"name"`
+	JSONName string `json:"json_name"`
+	Number   int32  `json:"number"`
+	Type     string `json:"type"`
+	TypeName string `json:"type_name,omitempty"`
+	Repeated bool   `json:"repeated,omitempty"`
+	Oneof    string `json:"oneof,omitempty"`
+}
+
+// StreamingType returns the streaming type name of a method
+func StreamingType(method *descriptorpb.MethodDescriptorProto) string {
+	switch {
+	case method.GetClientStreaming() && method.GetServerStreaming():
+		return "bidi_stream"
+	case method.GetClientStreaming():
+		return "client_stream"
+	case method.GetServerStreaming():
+		return "server_stream"
+	default:
+		return "unary"
+	}
+}
+
+// Describe returns a description of all loaded services, methods and message schemas
+func (d *DescriptorLoader) Describe() *Description {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	desc := &Description{
+		Files:    make([]string, 0, len(d.fileSet.File)),
+		Services: []ServiceDescription{},
+		Messages: make(map[string]*MessageDescription),
+	}
+
+	opts := proto.MarshalOptions{Deterministic: true}
+	if data, err := opts.Marshal(d.fileSet); err == nil {
+		sum := sha256.Sum256(data)
+		desc.Version = hex.EncodeToString(sum[:])
+	}
+
+	for _, file := range d.fileSet.File {
+		desc.Files = append(desc.Files, file.GetName())
+		pkg := file.GetPackage()
+
+		for _, service := range file.Service {
+			fullName := qualify(pkg, service.GetName())
+			sd := ServiceDescription{Name: fullName, File: file.GetName()}
+			for _, method := range service.Method {
+				sd.Methods = append(sd.Methods, MethodDescription{
+					Name:            method.GetName(),
+					FullMethod:      "/" + fullName + "/" + method.GetName(),
+					InputType:       strings.TrimPrefix(method.GetInputType(), "."),
+					OutputType:      strings.TrimPrefix(method.GetOutputType(), "."),
+					ClientStreaming: method.GetClientStreaming(),
+					ServerStreaming: method.GetServerStreaming(),
+					StreamingType:   StreamingType(method),
+				})
+			}
+			desc.Services = append(desc.Services, sd)
+		}
+
+		for _, msg := range file.MessageType {
+			describeMessage(desc.Messages, qualify(pkg, msg.GetName()), msg)
+		}
+	}
+
+	sort.Slice(desc.Services, func(i, j int) bool { return desc.Services[i].Name < desc.Services[j].Name })
+	return desc
+}
+
+// describeMessage adds a message and its nested messages to the schema map
+func describeMessage(messages map[string]*MessageDescription, fullName string, msg *descriptorpb.DescriptorProto) {
+	md := &MessageDescription{Fields: make([]FieldDescription, 0, len(msg.Field))}
+	for _, field := range msg.Field {
+		fd := FieldDescription{
+			Name:     field.GetName(),
+			JSONName: field.GetJsonName(),
+			Number:   field.GetNumber(),
+			Type:     strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_")),
+			TypeName: strings.TrimPrefix(field.GetTypeName(), "."),
+			Repeated: field.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED,
+		}
+		if field.OneofIndex != nil && int(field.GetOneofIndex()) < len(msg.OneofDecl) {
+			fd.Oneof = msg.OneofDecl[field.GetOneofIndex()].GetName()
+		}
+		md.Fields = append(md.Fields, fd)
+	}
+	messages[fullName] = md
+
+	for _, nested := range msg.NestedType {
+		describeMessage(messages, fullName+"."+nested.GetName(), nested)
+	}
+}
+
+// qualify joins a package and a name into a full name
+func qualify(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
@@ -0,0 +1,115 @@
+package proto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// Defaults for protoset downloads
+const (
+	defaultDownloadTimeout = 30 * time.Second
+	defaultRetryBackoff    = time.Second
+)
+
+// NewDownloadClient creates the HTTP client for protoset downloads. Requests
+// go through the configured proxy, or the one from HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY, and trust the CA bundle in addition to the system roots.
+func NewDownloadClient(cfg config.ProtosetDownloadConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download proxy %q: %w", cfg.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CAFile != "" || cfg.CertFile != "" || cfg.KeyFile != "" {
+		tlsConfig := &tls.Config{}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if cfg.CertFile != "" || cfg.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// SetDownloadClient sets the HTTP client used to download protosets by URL
+func (m *HotReloadManager) SetDownloadClient(client *http.Client) {
+	m.httpClient = client
+	for _, tenant := range m.tenants {
+		tenant.SetDownloadClient(client)
+	}
+}
+
+// statusError is a download answered with an unexpected status code
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("download failed with status code %d", e.code)
+}
+
+// retryable reports whether a failed download may succeed when repeated:
+// network errors, rate limiting and server errors are retried
+func retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// downloadWithRetry downloads a protoset, retrying failed attempts with
+// exponential backoff until the retries are used up or the manager stops
+func (m *HotReloadManager) downloadWithRetry(url string) ([]byte, remoteVersion, error) {
+	backoff := m.config.Download.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		data, version, err := m.downloadProtoset(url)
+		if err == nil || attempt >= m.config.Download.Retries || !retryable(err) {
+			return data, version, err
+		}
+		m.logger.Warn("Protoset download failed, retrying", "url", url, "attempt", attempt+1, "backoff", backoff, "error", err)
+		select {
+		case <-m.stopCh:
+			return nil, remoteVersion{}, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,124 @@
+package proto
+
+import (
+	"sort"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+// maxFailureBackoff caps how long polling skips a failing protoset source
+const maxFailureBackoff = 10 * time.Minute
+
+var (
+	protosetHealthy = metrics.NewGaugeVec(
+		"gateway_protoset_healthy",
+		"Whether the last reload of a protoset source succeeded (1) or failed (0).",
+		"tenant", "service",
+	)
+	protosetReloadFailures = metrics.NewCounterVec(
+		"gateway_protoset_reload_failures_total",
+		"Failed protoset reloads; the previous descriptors keep being served.",
+		"tenant", "service",
+	)
+)
+
+// ProtosetStatus is the reload health of a protoset source
+type ProtosetStatus struct {
+	Tenant      string    `json:"tenant,omitempty"`
+	Service     string    `json:"service"`
+	Healthy     bool      `json:"healthy"`
+	Failures    int       `json:"consecutive_failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	NextRetry   time.Time `json:"next_retry,omitzero"` // Polling skips the source until then
+}
+
+// recordResult updates the health of a source after a reload attempt. Each
+// consecutive failure doubles the number of check periods of the source that
+// polling waits before retrying it, up to maxFailureBackoff.
+func (m *HotReloadManager) recordResult(service string, err error) {
+	now := time.Now()
+	m.mu.Lock()
+	status, ok := m.health[service]
+	if !ok {
+		status = &ProtosetStatus{Tenant: m.tenant, Service: service}
+		m.health[service] = status
+	}
+	if err == nil {
+		status.Healthy = true
+		status.Failures = 0
+		status.LastError = ""
+		status.LastSuccess = now
+		status.NextRetry = time.Time{}
+	} else {
+		status.Healthy = false
+		status.Failures++
+		status.LastError = err.Error()
+		status.LastFailure = now
+		var period time.Duration
+		if info, ok := m.protosets[service]; ok {
+			period = m.checkPeriod(info)
+		}
+		status.NextRetry = now.Add(failureBackoff(period, status.Failures))
+	}
+	m.mu.Unlock()
+
+	if err == nil {
+		protosetHealthy.Set(1, m.tenant, service)
+		return
+	}
+	protosetHealthy.Set(0, m.tenant, service)
+	protosetReloadFailures.Inc(m.tenant, service)
+}
+
+// failureBackoff returns how long polling waits after the given number of
+// consecutive failures of a source with the check period
+func failureBackoff(period time.Duration, failures int) time.Duration {
+	if period <= 0 {
+		return 0
+	}
+	backoff := period
+	for i := 1; i < failures && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, max(period, maxFailureBackoff))
+}
+
+// backingOff reports whether polling should skip a failing source for now
+func (m *HotReloadManager) backingOff(service string, now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.health[service]
+	return ok && !status.Healthy && now.Before(status.NextRetry)
+}
+
+// forgetHealth drops the health of an unregistered source, the caller must
+// hold the write lock
+func (m *HotReloadManager) forgetHealth(service string) {
+	delete(m.health, service)
+	protosetHealthy.Delete(m.tenant, service)
+}
+
+// Status returns the reload health of every source that has been reloaded,
+// including those of tenants, sorted by tenant and service
+func (m *HotReloadManager) Status() []ProtosetStatus {
+	m.mu.RLock()
+	statuses := make([]ProtosetStatus, 0, len(m.health))
+	for _, status := range m.health {
+		statuses = append(statuses, *status)
+	}
+	m.mu.RUnlock()
+
+	for _, tenant := range m.tenants {
+		statuses = append(statuses, tenant.Status()...)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Tenant != statuses[j].Tenant {
+			return statuses[i].Tenant < statuses[j].Tenant
+		}
+		return statuses[i].Service < statuses[j].Service
+	})
+	return statuses
+}
@@ -0,0 +1,271 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defaultHistorySize is the number of snapshots kept per source
+const defaultHistorySize = 5
+
+// snapshot is one loaded version of a descriptor source
+type snapshot struct {
+	version string
+	loaded  time.Time
+	reason  string // load or rollback
+	files   []*descriptorpb.FileDescriptorProto
+}
+
+// VersionInfo describes a descriptor snapshot
+type VersionInfo struct {
+	Version  string    `json:"version"`
+	Loaded   time.Time `json:"loaded"`
+	Reason   string    `json:"reason"`
+	Current  bool      `json:"current"`
+	Files    []string  `json:"files"`
+	Services []string  `json:"services"`
+}
+
+// DescriptorDiff lists the services and methods that differ between two snapshots
+type DescriptorDiff struct {
+	Source          string   `json:"source"`
+	From            string   `json:"from"`
+	To              string   `json:"to"`
+	AddedServices   []string `json:"added_services"`
+	RemovedServices []string `json:"removed_services"`
+	AddedMethods    []string `json:"added_methods"`
+	RemovedMethods  []string `json:"removed_methods"`
+	ChangedMethods  []string `json:"changed_methods"` // Input, output or streaming type changed
+}
+
+// SetHistorySize sets how many snapshots are kept per source
+func (d *DescriptorLoader) SetHistorySize(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.historySize = n
+}
+
+// record appends a snapshot of a source's files, the caller must hold the write lock
+func (d *DescriptorLoader) record(source string, files []*descriptorpb.FileDescriptorProto, reason string) {
+	version := versionOf(files)
+	history := d.history[source]
+	if n := len(history); n > 0 && history[n-1].version == version && reason != "rollback" {
+		return
+	}
+
+	history = append(history, &snapshot{version: version, loaded: time.Now(), reason: reason, files: files})
+	size := d.historySize
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	if len(history) > size {
+		history = append([]*snapshot(nil), history[len(history)-size:]...)
+	}
+	d.history[source] = history
+}
+
+// Versions returns the snapshots of every source, newest first
+func (d *DescriptorLoader) Versions() map[string][]VersionInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	versions := make(map[string][]VersionInfo, len(d.history))
+	for source, history := range d.history {
+		infos := make([]VersionInfo, 0, len(history))
+		for i := len(history) - 1; i >= 0; i-- {
+			s := history[i]
+			info := VersionInfo{
+				Version:  s.version,
+				Loaded:   s.loaded,
+				Reason:   s.reason,
+				Current:  i == len(history)-1,
+				Files:    []string{},
+				Services: servicesOf(s.files),
+			}
+			for _, file := range s.files {
+				info.Files = append(info.Files, file.GetName())
+			}
+			infos = append(infos, info)
+		}
+		versions[displaySource(source)] = infos
+	}
+	return versions
+}
+
+// Diff compares two snapshots of a source. An empty to means the current
+// snapshot, an empty from means the one before to.
+func (d *DescriptorLoader) Diff(source, from, to string) (*DescriptorDiff, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	source = internalSource(source)
+	history := d.history[source]
+	if len(history) == 0 {
+		return nil, fmt.Errorf("unknown descriptor source: %s", displaySource(source))
+	}
+
+	toIndex := len(history) - 1
+	if to != "" {
+		if toIndex = findSnapshot(history, to); toIndex < 0 {
+			return nil, fmt.Errorf("unknown version %s for %s", to, displaySource(source))
+		}
+	}
+	var fromSnap *snapshot
+	if from != "" {
+		i := findSnapshot(history, from)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown version %s for %s", from, displaySource(source))
+		}
+		fromSnap = history[i]
+	} else if toIndex > 0 {
+		fromSnap = history[toIndex-1]
+	} else {
+		fromSnap = &snapshot{}
+	}
+	toSnap := history[toIndex]
+
+	diff := &DescriptorDiff{
+		Source:          displaySource(source),
+		From:            fromSnap.version,
+		To:              toSnap.version,
+		AddedServices:   []string{},
+		RemovedServices: []string{},
+		AddedMethods:    []string{},
+		RemovedMethods:  []string{},
+		ChangedMethods:  []string{},
+	}
+	oldServices, newServices := toSet(servicesOf(fromSnap.files)), toSet(servicesOf(toSnap.files))
+	for name := range newServices {
+		if !oldServices[name] {
+			diff.AddedServices = append(diff.AddedServices, name)
+		}
+	}
+	for name := range oldServices {
+		if !newServices[name] {
+			diff.RemovedServices = append(diff.RemovedServices, name)
+		}
+	}
+	oldMethods, newMethods := methodsOf(fromSnap.files), methodsOf(toSnap.files)
+	for name, signature := range newMethods {
+		old, ok := oldMethods[name]
+		switch {
+		case !ok:
+			diff.AddedMethods = append(diff.AddedMethods, name)
+		case old != signature:
+			diff.ChangedMethods = append(diff.ChangedMethods, name)
+		}
+	}
+	for name := range oldMethods {
+		if _, ok := newMethods[name]; !ok {
+			diff.RemovedMethods = append(diff.RemovedMethods, name)
+		}
+	}
+	for _, list := range [][]string{diff.AddedServices, diff.RemovedServices, diff.AddedMethods, diff.RemovedMethods, diff.ChangedMethods} {
+		sort.Strings(list)
+	}
+	return diff, nil
+}
+
+// Rollback makes a previous snapshot of a source current again
+func (d *DescriptorLoader) Rollback(source, version string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	source = internalSource(source)
+	history := d.history[source]
+	i := findSnapshot(history, version)
+	if i < 0 {
+		return fmt.Errorf("unknown version %s for %s", version, displaySource(source))
+	}
+	if i == len(history)-1 {
+		return fmt.Errorf("version %s is already current for %s", version, displaySource(source))
+	}
+
+	files := history[i].files
+	sources := make(map[string][]*descriptorpb.FileDescriptorProto, len(d.sources))
+	for name, f := range d.sources {
+		sources[name] = f
+	}
+	sources[source] = files
+	if err := validate(d.order, sources); err != nil {
+		return fmt.Errorf("version %s of %s: %w", version, displaySource(source), err)
+	}
+	d.sources = sources
+	d.record(source, files, "rollback")
+	d.rebuild()
+	return nil
+}
+
+// findSnapshot returns the index of the newest snapshot with the version, or -1
+func findSnapshot(history []*snapshot, version string) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// versionOf returns a short content hash of a set of files
+func versionOf(files []*descriptorpb.FileDescriptorProto) string {
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// servicesOf returns the sorted full names of the services in files
+func servicesOf(files []*descriptorpb.FileDescriptorProto) []string {
+	services := []string{}
+	for _, file := range files {
+		for _, service := range file.Service {
+			services = append(services, qualify(file.GetPackage(), service.GetName()))
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// methodsOf maps full method names to their signature
+func methodsOf(files []*descriptorpb.FileDescriptorProto) map[string]string {
+	methods := make(map[string]string)
+	for _, file := range files {
+		for _, service := range file.Service {
+			serviceName := qualify(file.GetPackage(), service.GetName())
+			for _, method := range service.Method {
+				methods["/"+serviceName+"/"+method.GetName()] = method.GetInputType() + " -> " + method.GetOutputType() + " " + StreamingType(method)
+			}
+		}
+	}
+	return methods
+}
+
+// toSet converts a list to a set
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+// displaySource names the main protoset "main" in the admin API
+func displaySource(source string) string {
+	if source == mainSource {
+		return "main"
+	}
+	return source
+}
+
+// internalSource maps an admin API source name back to the loader's key
+func internalSource(source string) string {
+	if source == "main" {
+		return mainSource
+	}
+	return source
+}
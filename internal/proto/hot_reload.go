@@ -1,28 +1,47 @@
 package proto
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+
 	"github.com/heytom-labs/heytom-gateway/internal/config"
 )
 
 // HotReloadManager manages hot reload of protosets
 type HotReloadManager struct {
-	loader        *DescriptorLoader
-	config        *config.ProtoHotReloadConfig
-	protosets     map[string]*config.ProtoSetInfo
-	ticker        *time.Ticker
-	stopCh        chan struct{}
-	wg            sync.WaitGroup
-	httpClient    *http.Client
-	msgCacheClear func() // Callback to clear message cache
-	mu            sync.RWMutex
+	loader     *DescriptorLoader
+	config     *config.ProtoHotReloadConfig
+	protosets  map[string]*config.ProtoSetInfo
+	ticker     *time.Ticker
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+	httpClient *http.Client
+	onReload   func() error // Callback to rebuild derived descriptors after a reload
+	bsr        *BSRClient   // Client for protosets pulled from the Buf Schema Registry
+	notifier   *ReloadNotifier
+	fsWatcher  *fsnotify.Watcher
+	debounce   map[string]*time.Timer       // Pending file-triggered reloads by service
+	versions   map[string]remoteVersion     // HTTP validators of downloaded protosets by URL
+	hashes     map[string][sha256.Size]byte // Content hash of the applied protoset by service
+	tenants    map[string]*HotReloadManager // Managers of tenants with their own descriptors
+	tenant     string                       // Tenant whose protosets are reloaded, empty for the shared ones
+	health     map[string]*ProtosetStatus   // Reload health by service
+	due        map[string]time.Time         // Next poll of each protoset by service
+	mu         sync.RWMutex
+	logger     *slog.Logger
 }
 
 // NewHotReloadManager creates a new hot reload manager
@@ -30,6 +49,7 @@ func NewHotReloadManager(
 	loader *DescriptorLoader,
 	cfg *config.ProtoHotReloadConfig,
 	protosets []config.ProtoSetInfo,
+	logger *slog.Logger,
 ) *HotReloadManager {
 	protosetMap := make(map[string]*config.ProtoSetInfo)
 	for i := range protosets {
@@ -40,16 +60,47 @@ func NewHotReloadManager(
 		loader:    loader,
 		config:    cfg,
 		protosets: protosetMap,
+		debounce:  make(map[string]*time.Timer),
+		versions:  make(map[string]remoteVersion),
+		hashes:    make(map[string][sha256.Size]byte),
+		tenants:   make(map[string]*HotReloadManager),
+		health:    make(map[string]*ProtosetStatus),
+		due:       make(map[string]time.Time),
 		stopCh:    make(chan struct{}),
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: defaultDownloadTimeout,
 		},
+		logger: logger,
+	}
+}
+
+// SetBSRClient sets the client used to refresh Buf Schema Registry modules
+func (m *HotReloadManager) SetBSRClient(client *BSRClient) {
+	m.bsr = client
+	for _, tenant := range m.tenants {
+		tenant.SetBSRClient(client)
+	}
+}
+
+// SetReloadFunc sets the callback that rebuilds registries and caches derived
+// from the loaded descriptors after a protoset is updated
+func (m *HotReloadManager) SetReloadFunc(fn func() error) {
+	m.onReload = fn
+	for _, tenant := range m.tenants {
+		tenant.SetReloadFunc(fn)
 	}
 }
 
-// SetMessageCacheClearFunc sets the callback to clear message cache when proto is updated
-func (m *HotReloadManager) SetMessageCacheClearFunc(fn func()) {
-	m.msgCacheClear = fn
+// AddTenant reloads the protosets of a tenant's own descriptor loader with the
+// same settings; it must be called before Start
+func (m *HotReloadManager) AddTenant(tenant string, loader *DescriptorLoader, protosets []config.ProtoSetInfo) {
+	child := NewHotReloadManager(loader, m.config, protosets, m.logger.With("tenant", tenant))
+	child.tenant = tenant
+	child.bsr = m.bsr
+	child.notifier = m.notifier
+	child.httpClient = m.httpClient
+	child.onReload = m.onReload
+	m.tenants[tenant] = child
 }
 
 // Start starts the hot reload process
@@ -58,14 +109,30 @@ func (m *HotReloadManager) Start(ctx context.Context) error {
 		return nil
 	}
 
-	if m.config.CheckPeriod <= 0 {
+	for name, tenant := range m.tenants {
+		if err := tenant.Start(ctx); err != nil {
+			return fmt.Errorf("tenant %s: %w", name, err)
+		}
+	}
+
+	if m.config.WatchFiles {
+		if err := m.startFileWatch(); err != nil {
+			return err
+		}
+	}
+
+	// Polling is optional when reloads are triggered by file changes or webhooks
+	if !m.polling() {
+		if m.config.WatchFiles || m.config.WebhookSecret != "" {
+			return nil
+		}
 		return fmt.Errorf("check period must be greater than 0")
 	}
 
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
-		m.ticker = time.NewTicker(time.Duration(m.config.CheckPeriod) * time.Second)
+		m.ticker = time.NewTicker(scheduleResolution)
 		defer m.ticker.Stop()
 
 		for {
@@ -74,8 +141,8 @@ func (m *HotReloadManager) Start(ctx context.Context) error {
 				return
 			case <-m.stopCh:
 				return
-			case <-m.ticker.C:
-				m.checkAndReload()
+			case now := <-m.ticker.C:
+				m.poll(now)
 			}
 		}
 	}()
@@ -85,12 +152,23 @@ func (m *HotReloadManager) Start(ctx context.Context) error {
 
 // Stop stops the hot reload process
 func (m *HotReloadManager) Stop() {
+	for _, tenant := range m.tenants {
+		tenant.Stop()
+	}
 	close(m.stopCh)
 	m.wg.Wait()
 }
 
 // checkAndReload checks for updates and reloads protosets if necessary
 func (m *HotReloadManager) checkAndReload() {
+	for service, err := range m.ReloadAll() {
+		m.logger.Error("Failed to reload protoset", "service", service, "error", err)
+	}
+}
+
+// ReloadAll reloads every registered protoset and returns the errors by service.
+// Tenant protosets are only reloaded by their own manager.
+func (m *HotReloadManager) ReloadAll() map[string]error {
 	m.mu.RLock()
 	protosets := make([]config.ProtoSetInfo, 0, len(m.protosets))
 	for _, ps := range m.protosets {
@@ -98,53 +176,209 @@ func (m *HotReloadManager) checkAndReload() {
 	}
 	m.mu.RUnlock()
 
+	errs := make(map[string]error)
 	for _, ps := range protosets {
 		if err := m.reloadProtoset(&ps); err != nil {
-			fmt.Printf("Failed to reload protoset for service %s: %v\n", ps.ServiceName, err)
+			errs[ps.ServiceName] = err
 		}
 	}
+	return errs
 }
 
-// reloadProtoset reloads a single protoset
+// TriggerReload reloads the protosets of services (all, including those of
+// tenants, when empty) in the background and logs failures
+func (m *HotReloadManager) TriggerReload(services ...string) {
+	go func() {
+		if len(services) == 0 {
+			m.checkAndReload()
+			for _, tenant := range m.tenants {
+				tenant.checkAndReload()
+			}
+			return
+		}
+		for _, service := range services {
+			if err := m.ReloadServiceProtoset(service); err != nil {
+				m.logger.Error("Failed to reload protoset", "service", service, "error", err)
+			}
+		}
+	}()
+}
+
+// MatchProtosets returns the services whose protoset location (URL, file name
+// or module name) is mentioned in payload, e.g. a webhook sent by an artifact
+// repository when a new protoset is published
+func (m *HotReloadManager) MatchProtosets(payload []byte) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var services []string
+	for service, ps := range m.protosets {
+		var name string
+		switch {
+		case ps.URL != "":
+			name = path.Base(ps.URL)
+			if u, err := url.Parse(ps.URL); err == nil {
+				name = path.Base(u.Path)
+			}
+		case ps.Module != "":
+			name = ps.Module
+			if ref, err := ParseModuleRef(ps.Module); err == nil {
+				name = ref.Owner + "/" + ref.Repository
+			}
+		case ps.Path != "":
+			name = filepath.Base(ps.Path)
+		}
+		if name != "" && name != "." && name != "/" && bytes.Contains(payload, []byte(name)) {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// remoteVersion holds the HTTP validators of a downloaded protoset
+type remoteVersion struct {
+	etag         string
+	lastModified string
+}
+
+// reloadProtoset reloads a single protoset and records the health of its source
 func (m *HotReloadManager) reloadProtoset(info *config.ProtoSetInfo) error {
-	// If URL is provided, download from artifact repository
-	if info.URL != "" {
-		tempFile, err := m.downloadProtoset(info.URL)
+	err := m.applyProtoset(info)
+	m.recordResult(info.ServiceName, err)
+	return err
+}
+
+// applyProtoset fetches and applies a single protoset, skipping it when the
+// content is unchanged. A protoset that cannot be parsed, verified or
+// registered, or from which the derived descriptors cannot be rebuilt, leaves
+// the previous descriptors in place.
+func (m *HotReloadManager) applyProtoset(info *config.ProtoSetInfo) error {
+	var (
+		data    []byte
+		version remoteVersion
+		err     error
+	)
+	switch {
+	case info.URL != "":
+		// Download from artifact repository, nil data means not modified
+		data, version, err = m.downloadWithRetry(info.URL)
 		if err != nil {
 			return fmt.Errorf("failed to download protoset from %s: %w", info.URL, err)
 		}
-		defer os.Remove(tempFile)
-
-		// Load the downloaded file
-		data, err := os.ReadFile(tempFile)
-		if err != nil {
-			return fmt.Errorf("failed to read downloaded protoset: %w", err)
+		if data == nil {
+			m.logger.Debug("Protoset not modified", "service", info.ServiceName, "url", info.URL)
+			return nil
 		}
-
-		if err := m.loader.LoadProtosetData(data); err != nil {
-			return fmt.Errorf("failed to load protoset data: %w", err)
+		if err := m.verifyProtoset(info, data); err != nil {
+			return fmt.Errorf("rejected protoset from %s: %w", info.URL, err)
+		}
+	case info.Module != "":
+		// Pull the module image from the Buf Schema Registry
+		if m.bsr == nil {
+			return fmt.Errorf("no BSR client configured for module %s", info.Module)
 		}
-	} else if info.Path != "" {
+		data, err = m.bsr.FetchImage(context.Background(), info.Module)
+		if err != nil {
+			return err
+		}
+	case info.Path != "":
 		// Load from local file
-		if err := m.loader.LoadProtoset(info.Path); err != nil {
-			return fmt.Errorf("failed to load protoset from %s: %w", info.Path, err)
+		data, err = m.loader.ReadProtoset(info.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read protoset from %s: %w", info.Path, err)
 		}
+	default:
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	m.mu.RLock()
+	applied, ok := m.hashes[info.ServiceName]
+	m.mu.RUnlock()
+	if ok && applied == sum {
+		m.rememberVersion(info.URL, version)
+		m.logger.Debug("Protoset content unchanged", "service", info.ServiceName)
+		return nil
+	}
+
+	breaking, err := m.checkBreakingChanges(info, data)
+	if err != nil {
+		return err
+	}
+
+	source := sourceName(info)
+	previous, existed := m.loader.sourceFiles(source)
+	if err := m.loader.LoadProtosetData(source, data); err != nil {
+		return fmt.Errorf("failed to load protoset data: %w", err)
 	}
 
-	// Clear message cache after loading new protosets
-	if m.msgCacheClear != nil {
-		m.msgCacheClear()
+	// Rebuild message registry after loading new protosets, and put the
+	// previous files back when that fails so the loader matches what is served
+	if m.onReload != nil {
+		if err := m.onReload(); err != nil {
+			if restoreErr := m.loader.restoreSource(source, previous, existed); restoreErr != nil {
+				m.logger.Error("Failed to restore the previous protoset", "service", info.ServiceName, "error", restoreErr)
+			} else if rebuildErr := m.onReload(); rebuildErr != nil {
+				m.logger.Error("Failed to rebuild descriptors after restoring the previous protoset", "service", info.ServiceName, "error", rebuildErr)
+			}
+			return fmt.Errorf("descriptors could not be rebuilt, serving the previous protoset: %w", err)
+		}
 	}
 
-	fmt.Printf("Successfully reloaded protoset for service: %s\n", info.ServiceName)
+	m.mu.Lock()
+	m.hashes[info.ServiceName] = sum
+	m.mu.Unlock()
+	m.rememberVersion(info.URL, version)
+
+	m.reportReload(info, breaking)
 	return nil
 }
 
-// downloadProtoset downloads a protoset file from the artifact repository
-func (m *HotReloadManager) downloadProtoset(url string) (string, error) {
+// checkBreakingChanges diffs a new protoset against the served descriptors and,
+// depending on the breaking_changes setting, logs or refuses removed and changed
+// methods and fields; it returns the changes of an accepted protoset
+func (m *HotReloadManager) checkBreakingChanges(info *config.ProtoSetInfo, data []byte) ([]string, error) {
+	changes, err := m.loader.CheckBreakingChanges(sourceName(info), data, m.config.BreakingChanges)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		m.logger.Warn("Applying protoset with breaking changes", "service", info.ServiceName, "changes", changes)
+	}
+	return changes, nil
+}
+
+// sourceName returns the descriptor source a protoset is loaded as
+func sourceName(info *config.ProtoSetInfo) string {
+	if info.ServiceName != "" {
+		return info.ServiceName
+	}
+	if info.URL != "" {
+		return info.URL
+	}
+	if info.Module != "" {
+		return info.Module
+	}
+	return info.Path
+}
+
+// rememberVersion caches the validators of a successfully applied download
+func (m *HotReloadManager) rememberVersion(url string, version remoteVersion) {
+	if url == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[url] = version
+}
+
+// downloadProtoset downloads a protoset from the artifact repository with a
+// conditional request. It returns nil data when the server answers 304.
+func (m *HotReloadManager) downloadProtoset(url string) ([]byte, remoteVersion, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, remoteVersion{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add auth token if configured
@@ -152,30 +386,38 @@ func (m *HotReloadManager) downloadProtoset(url string) (string, error) {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.config.AuthToken))
 	}
 
+	// Only ask for the protoset if it changed since the last applied download
+	m.mu.RLock()
+	cached := m.versions[url]
+	m.mu.RUnlock()
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+
 	resp, err := m.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download protoset: %w", err)
+		return nil, remoteVersion{}, fmt.Errorf("failed to download protoset: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cached, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download failed with status code %d", resp.StatusCode)
+		return nil, remoteVersion{}, &statusError{code: resp.StatusCode}
 	}
 
-	// Create temporary file
-	tempFile, err := os.CreateTemp("", "protoset-*.pb")
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer tempFile.Close()
-
-	// Download file content
-	if _, err := io.Copy(tempFile, resp.Body); err != nil {
-		os.Remove(tempFile.Name())
-		return "", fmt.Errorf("failed to write temp file: %w", err)
+		return nil, remoteVersion{}, fmt.Errorf("failed to read protoset: %w", err)
 	}
-
-	return tempFile.Name(), nil
+	return data, remoteVersion{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
 }
 
 // ReloadServiceProtoset manually reloads a specific service's protoset
@@ -196,6 +438,9 @@ func (m *HotReloadManager) RegisterProtoset(info config.ProtoSetInfo) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.protosets[info.ServiceName] = &info
+	if info.URL == "" {
+		m.watchPath(info.Path)
+	}
 }
 
 // UnregisterProtoset unregisters a protoset from hot reload
@@ -203,6 +448,8 @@ func (m *HotReloadManager) UnregisterProtoset(serviceName string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.protosets, serviceName)
+	delete(m.due, serviceName)
+	m.forgetHealth(serviceName)
 }
 
 // GetRegisteredProtosets returns all registered protosets
@@ -0,0 +1,83 @@
+package proto
+
+import (
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lookupIndex maps full names to the descriptors of a merged file set so that
+// lookups on the request path do not scan every file. It is built once per
+// file set and never modified.
+type lookupIndex struct {
+	files    map[string]*descriptorpb.FileDescriptorProto
+	services map[string]*descriptorpb.ServiceDescriptorProto
+	methods  map[string]*descriptorpb.MethodDescriptorProto // Keyed by package.Service/Method
+	messages map[string]*descriptorpb.DescriptorProto       // Keyed by package.Message, including nested messages
+	enums    map[string]*descriptorpb.EnumDescriptorProto   // Keyed by package.Enum, including nested enums
+	// Extensions of google.protobuf.MethodOptions keyed by full name, including those declared in messages
+	methodOptions map[string]*descriptorpb.FieldDescriptorProto
+}
+
+// newLookupIndex indexes files; when names collide the first file wins, as the
+// previous linear lookups did
+func newLookupIndex(files []*descriptorpb.FileDescriptorProto) *lookupIndex {
+	idx := &lookupIndex{
+		files:    make(map[string]*descriptorpb.FileDescriptorProto, len(files)),
+		services: make(map[string]*descriptorpb.ServiceDescriptorProto),
+		methods:  make(map[string]*descriptorpb.MethodDescriptorProto),
+		messages: make(map[string]*descriptorpb.DescriptorProto),
+		enums:    make(map[string]*descriptorpb.EnumDescriptorProto),
+
+		methodOptions: make(map[string]*descriptorpb.FieldDescriptorProto),
+	}
+	addExtensions := func(prefix string, list []*descriptorpb.FieldDescriptorProto) {
+		for _, ext := range list {
+			name := qualify(prefix, ext.GetName())
+			if _, ok := idx.methodOptions[name]; !ok && ext.GetExtendee() == ".google.protobuf.MethodOptions" {
+				idx.methodOptions[name] = ext
+			}
+		}
+	}
+	addEnums := func(prefix string, list []*descriptorpb.EnumDescriptorProto) {
+		for _, enum := range list {
+			name := qualify(prefix, enum.GetName())
+			if _, ok := idx.enums[name]; !ok {
+				idx.enums[name] = enum
+			}
+		}
+	}
+	var addMessages func(prefix string, list []*descriptorpb.DescriptorProto)
+	addMessages = func(prefix string, list []*descriptorpb.DescriptorProto) {
+		for _, msg := range list {
+			name := qualify(prefix, msg.GetName())
+			if _, ok := idx.messages[name]; !ok {
+				idx.messages[name] = msg
+			}
+			addExtensions(name, msg.Extension)
+			addEnums(name, msg.EnumType)
+			addMessages(name, msg.NestedType)
+		}
+	}
+
+	for _, file := range files {
+		if _, ok := idx.files[file.GetName()]; !ok {
+			idx.files[file.GetName()] = file
+		}
+		for _, service := range file.Service {
+			serviceName := qualify(file.GetPackage(), service.GetName())
+			if _, ok := idx.services[serviceName]; ok {
+				continue
+			}
+			idx.services[serviceName] = service
+			for _, method := range service.Method {
+				key := serviceName + "/" + method.GetName()
+				if _, ok := idx.methods[key]; !ok {
+					idx.methods[key] = method
+				}
+			}
+		}
+		addExtensions(file.GetPackage(), file.Extension)
+		addEnums(file.GetPackage(), file.EnumType)
+		addMessages(file.GetPackage(), file.MessageType)
+	}
+	return idx
+}
@@ -3,102 +3,299 @@ package proto
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+// mainSource 主 protoset 的来源名
+const mainSource = ""
+
 // DescriptorLoader 用于加载和管理 protobuf 描述符
+// 每个 protoset 来源（主 protoset 或某个服务的 protoset）单独记录其文件，
+// 重新加载某个来源时只替换该来源的文件，并整体替换合并后的文件集
 type DescriptorLoader struct {
 	mu      sync.RWMutex
-	fileSet *descriptorpb.FileDescriptorSet
+	fileSet *descriptorpb.FileDescriptorSet                // 合并后的文件集，只整体替换不原地修改
+	lookup  *lookupIndex                                   // 合并后文件集的按全名索引，随文件集一起替换
+	sources map[string][]*descriptorpb.FileDescriptorProto // 各来源的文件
+	order   []string                                       // 来源加载顺序
+
+	importPaths []string // 编译 .proto 源文件时的额外导入目录
+
+	history     map[string][]*snapshot // 各来源最近加载的版本，用于查看差异与回滚
+	historySize int                    // 每个来源保留的版本数
 }
 
 // NewDescriptorLoader 创建描述符加载器
-func NewDescriptorLoader(protosetPath string) (*DescriptorLoader, error) {
-	data, err := os.ReadFile(protosetPath)
+// protosetPath 可以是 protoset 二进制文件、.proto 源文件或 .proto 源文件目录
+func NewDescriptorLoader(protosetPath string, importPaths ...string) (*DescriptorLoader, error) {
+	d := &DescriptorLoader{
+		sources:     make(map[string][]*descriptorpb.FileDescriptorProto),
+		history:     make(map[string][]*snapshot),
+		importPaths: importPaths,
+	}
+
+	fileSet, err := d.readFileSet(protosetPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read protoset file: %w", err)
+		return nil, err
+	}
+	if err := d.setSource(mainSource, fileSet); err != nil {
+		return nil, err
 	}
+	return d, nil
+}
 
-	fileSet := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(data, fileSet); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal protoset file: %w", err)
+// LoadProtoset 加载 protoset 文件、.proto 源文件或源文件目录作为指定来源，替换该来源之前加载的文件；
+// 替换后的文件无法全部注册时返回错误，已加载的文件保持不变
+func (d *DescriptorLoader) LoadProtoset(source, protosetPath string) error {
+	fileSet, err := d.readFileSet(protosetPath)
+	if err != nil {
+		return err
 	}
 
-	return &DescriptorLoader{
-		fileSet: fileSet,
-	}, nil
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.setSource(source, fileSet)
 }
 
-// LoadProtoset 加载单个 protoset 文件
-func (d *DescriptorLoader) LoadProtoset(protosetPath string) error {
-	data, err := os.ReadFile(protosetPath)
+// LoadProtosetData 加载 protoset 数据（从制品库或其他源）作为指定来源，替换该来源之前加载的文件；
+// 替换后的文件无法全部注册时返回错误，已加载的文件保持不变
+func (d *DescriptorLoader) LoadProtosetData(source string, data []byte) error {
+	fileSet, err := unmarshalProtoset(data)
 	if err != nil {
-		return fmt.Errorf("failed to read protoset file: %w", err)
+		return fmt.Errorf("failed to unmarshal protoset data: %w", err)
 	}
 
-	fileSet := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(data, fileSet); err != nil {
-		return fmt.Errorf("failed to unmarshal protoset file: %w", err)
-	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.setSource(source, fileSet)
+}
 
+// RemoveProtoset 移除指定来源的文件
+func (d *DescriptorLoader) RemoveProtoset(source string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// 合并文件描述符集
-	d.fileSet.File = append(d.fileSet.File, fileSet.File...)
-	return nil
+	if _, ok := d.sources[source]; !ok {
+		return
+	}
+	delete(d.sources, source)
+	delete(d.history, source)
+	for i, name := range d.order {
+		if name == source {
+			d.order = append(d.order[:i:i], d.order[i+1:]...)
+			break
+		}
+	}
+	d.rebuild()
 }
 
-// LoadProtosetData 加载 protoset 数据（从制品库或其他源）
-func (d *DescriptorLoader) LoadProtosetData(data []byte) error {
-	fileSet := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(data, fileSet); err != nil {
-		return fmt.Errorf("failed to unmarshal protoset data: %w", err)
+// sourceFiles 返回来源当前的文件，来源未加载时 ok 为 false
+func (d *DescriptorLoader) sourceFiles(source string) (files []*descriptorpb.FileDescriptorProto, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	files, ok = d.sources[source]
+	return files, ok
+}
+
+// restoreSource 恢复来源之前的文件，existed 为 false 时移除该来源；
+// 用于撤销已加载但派生描述符无法重建的 protoset
+func (d *DescriptorLoader) restoreSource(source string, files []*descriptorpb.FileDescriptorProto, existed bool) error {
+	if !existed {
+		d.RemoveProtoset(source)
+		return nil
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
-
-	// 合并文件描述符集
-	d.fileSet.File = append(d.fileSet.File, fileSet.File...)
+	sources := make(map[string][]*descriptorpb.FileDescriptorProto, len(d.sources))
+	for name, f := range d.sources {
+		sources[name] = f
+	}
+	sources[source] = files
+	if err := validate(d.order, sources); err != nil {
+		return err
+	}
+	d.sources = sources
+	d.record(source, files, "rollback")
+	d.rebuild()
 	return nil
 }
 
-// ReplaceProtoset 替换整个 protoset（用于热更新）
+// ReplaceProtoset 替换整个 protoset（用于热更新），移除所有服务的 protoset
 func (d *DescriptorLoader) ReplaceProtoset(protosetPath string) error {
-	data, err := os.ReadFile(protosetPath)
+	data, err := d.ReadProtoset(protosetPath)
 	if err != nil {
-		return fmt.Errorf("failed to read protoset file: %w", err)
+		return err
 	}
+	return d.ReplaceProtosetData(data)
+}
 
-	fileSet := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(data, fileSet); err != nil {
-		return fmt.Errorf("failed to unmarshal protoset file: %w", err)
+// ReplaceProtosetData 替换整个 protoset 数据（用于热更新），移除所有服务的 protoset
+func (d *DescriptorLoader) ReplaceProtosetData(data []byte) error {
+	fileSet, err := unmarshalProtoset(data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal protoset data: %w", err)
+	}
+
+	if err := validate([]string{mainSource}, map[string][]*descriptorpb.FileDescriptorProto{mainSource: fileSet.File}); err != nil {
+		return err
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	// 替换整个文件集
-	d.fileSet = fileSet
+	d.sources = make(map[string][]*descriptorpb.FileDescriptorProto)
+	d.history = make(map[string][]*snapshot)
+	d.order = nil
+	return d.setSource(mainSource, fileSet)
+}
+
+// Sources 返回各来源包含的文件名
+func (d *DescriptorLoader) Sources() map[string][]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	sources := make(map[string][]string, len(d.sources))
+	for source, files := range d.sources {
+		names := make([]string, 0, len(files))
+		for _, file := range files {
+			names = append(names, file.GetName())
+		}
+		sources[displaySource(source)] = names
+	}
+	return sources
+}
+
+// setSource 替换来源的文件并重建合并后的文件集，调用方需持有写锁。
+// 替换后的文件无法全部注册时返回错误且不做修改，避免代理只能使用部分消息
+func (d *DescriptorLoader) setSource(source string, fileSet *descriptorpb.FileDescriptorSet) error {
+	order := d.order
+	if _, ok := d.sources[source]; !ok {
+		order = append(order[:len(order):len(order)], source)
+	}
+	sources := make(map[string][]*descriptorpb.FileDescriptorProto, len(d.sources)+1)
+	for name, files := range d.sources {
+		sources[name] = files
+	}
+	sources[source] = fileSet.File
+	if err := validate(order, sources); err != nil {
+		return err
+	}
+
+	d.order = order
+	d.sources = sources
+	d.record(source, fileSet.File, "load")
+	d.rebuild()
 	return nil
 }
 
-// ReplaceProtosetData 替换整个 protoset 数据（用于热更新）
-func (d *DescriptorLoader) ReplaceProtosetData(data []byte) error {
+// validate 检查各来源合并后的文件能否全部注册：依赖都已加载，且没有重复定义的全名
+func validate(order []string, sources map[string][]*descriptorpb.FileDescriptorProto) error {
+	if _, err := protodesc.NewFiles(merge(order, sources)); err != nil {
+		return fmt.Errorf("protoset cannot be registered with the loaded descriptors: %w", err)
+	}
+	return nil
+}
+
+// rebuild 重新合并所有来源的文件，调用方需持有写锁
+func (d *DescriptorLoader) rebuild() {
+	d.fileSet = merge(d.order, d.sources)
+	d.lookup = newLookupIndex(d.fileSet.File)
+}
+
+// merge 合并各来源的文件：服务的 protoset 优先于主 protoset，后加载的来源优先于先加载的，
+// 同名文件只保留优先级最高的一份，避免旧定义遮蔽新定义
+func merge(order []string, sources map[string][]*descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorSet {
+	merged := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	add := func(files []*descriptorpb.FileDescriptorProto) {
+		for _, file := range files {
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			merged.File = append(merged.File, file)
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		if order[i] != mainSource {
+			add(sources[order[i]])
+		}
+	}
+	add(sources[mainSource])
+	return merged
+}
+
+// ReadProtoset 读取 protoset 文件，.proto 源文件或目录会先编译，返回序列化的 FileDescriptorSet
+func (d *DescriptorLoader) ReadProtoset(path string) ([]byte, error) {
+	if !isProtoSource(path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read protoset file: %w", err)
+		}
+		return data, nil
+	}
+
+	fileSet, err := compileProtoSources(path, d.importPaths)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(fileSet)
+}
+
+// readFileSet 读取并解析 protoset 文件，.proto 源文件或目录会先编译
+func (d *DescriptorLoader) readFileSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	if isProtoSource(path) {
+		return compileProtoSources(path, d.importPaths)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protoset file: %w", err)
+	}
+	fileSet, err := unmarshalProtoset(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protoset file: %w", err)
+	}
+	return fileSet, nil
+}
+
+// unmarshalProtoset 解析 protoset 数据
+func unmarshalProtoset(data []byte) (*descriptorpb.FileDescriptorSet, error) {
 	fileSet := &descriptorpb.FileDescriptorSet{}
 	if err := proto.Unmarshal(data, fileSet); err != nil {
-		return fmt.Errorf("failed to unmarshal protoset data: %w", err)
+		return nil, err
 	}
+	return fileSet, nil
+}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	// 替换整个文件集
-	d.fileSet = fileSet
+// ValidateProtoset 校验上传的 protoset：必须能解析、包含全部依赖（protoc --include_imports
+// 或 buf build 的输出）并且定义了指定的服务
+func ValidateProtoset(service string, data []byte) error {
+	fileSet, err := unmarshalProtoset(data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal protoset data: %w", err)
+	}
+	files, err := protodesc.NewFiles(fileSet)
+	if err != nil {
+		return fmt.Errorf("invalid protoset: %w", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return fmt.Errorf("protoset does not define service %s", service)
+	}
+	if _, ok := desc.(protoreflect.ServiceDescriptor); !ok {
+		return fmt.Errorf("%s is not a service", service)
+	}
 	return nil
 }
 
@@ -106,12 +303,7 @@ func (d *DescriptorLoader) ReplaceProtosetData(data []byte) error {
 func (d *DescriptorLoader) GetFileDescriptor(name string) *descriptorpb.FileDescriptorProto {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	for _, file := range d.fileSet.File {
-		if file.GetName() == name {
-			return file
-		}
-	}
-	return nil
+	return d.lookup.files[name]
 }
 
 // FindServiceDescriptor 查找服务描述符
@@ -119,76 +311,129 @@ func (d *DescriptorLoader) GetFileDescriptor(name string) *descriptorpb.FileDesc
 func (d *DescriptorLoader) FindServiceDescriptor(fullName string) *descriptorpb.ServiceDescriptorProto {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	for _, file := range d.fileSet.File {
-		// 构建完整的服务名 = 包名 + 服务名
-		for _, service := range file.Service {
-			fullServiceName := file.GetPackage() + "." + service.GetName()
-			if fullServiceName == fullName {
-				return service
-			}
-		}
+	return d.lookup.services[fullName]
+}
+
+// ServiceNames 返回已加载的全部服务的完整名称，按名称排序
+func (d *DescriptorLoader) ServiceNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	names := make([]string, 0, len(d.lookup.services))
+	for name := range d.lookup.services {
+		names = append(names, name)
 	}
-	return nil
+	sort.Strings(names)
+	return names
+}
+
+// MethodNames 返回已加载的全部方法，格式为 package.Service/Method，按名称排序
+func (d *DescriptorLoader) MethodNames() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	names := make([]string, 0, len(d.lookup.methods))
+	for name := range d.lookup.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // FindMethodDescriptor 查找方法描述符
 // serviceName 格式: package.ServiceName
 // methodName 格式: MethodName
 func (d *DescriptorLoader) FindMethodDescriptor(serviceName, methodName string) *descriptorpb.MethodDescriptorProto {
-	service := d.FindServiceDescriptor(serviceName)
-	if service == nil {
-		return nil
-	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lookup.methods[serviceName+"/"+methodName]
+}
 
-	for _, method := range service.Method {
-		if method.GetName() == methodName {
-			return method
-		}
-	}
-	return nil
+// MethodOptionType 返回扩展 google.protobuf.MethodOptions 的自定义选项的类型，选项未在已加载的 protoset 中定义时 ok 为 false
+func (d *DescriptorLoader) MethodOptionType(extension string) (typ descriptorpb.FieldDescriptorProto_Type, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ext, ok := d.lookup.methodOptions[extension]
+	return ext.GetType(), ok
 }
 
-// FindMessageDescriptor 查找消息描述符
-// fullName 格式: package.MessageName 或 package.OuterMessage.InnerMessage
-func (d *DescriptorLoader) FindMessageDescriptor(fullName string) *descriptorpb.DescriptorProto {
+// MethodOption 返回方法上 bool 类型自定义选项的值，extension 为扩展 google.protobuf.MethodOptions 的字段全名，
+// 如 acme.api.exposed。选项未在已加载的 protoset 中定义、不是 bool 类型或方法未设置时返回 false
+func (d *DescriptorLoader) MethodOption(serviceName, methodName, extension string) bool {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	for _, file := range d.fileSet.File {
-		msg := d.findMessageInFile(file, fullName, file.GetPackage())
-		if msg != nil {
-			return msg
-		}
+	ext := d.lookup.methodOptions[extension]
+	if ext.GetType() != descriptorpb.FieldDescriptorProto_TYPE_BOOL {
+		return false
 	}
-	return nil
+	v, ok := d.methodOptionVarint(serviceName, methodName, ext)
+	return ok && v != 0
 }
 
-// findMessageInFile 在文件中查找消息描述符
-func (d *DescriptorLoader) findMessageInFile(file *descriptorpb.FileDescriptorProto, fullName, pkgPrefix string) *descriptorpb.DescriptorProto {
-	for _, msg := range file.MessageType {
-		fullMsgName := pkgPrefix + "." + msg.GetName()
-		if fullMsgName == fullName {
-			return msg
-		}
-		// 检查嵌套消息
-		if nested := d.findNestedMessage(msg, fullName, fullMsgName); nested != nil {
-			return nested
+// MethodEnumOption 返回方法上枚举类型自定义选项的值名，如 (gateway.visibility) = INTERNAL 返回 INTERNAL；
+// 选项未在已加载的 protoset 中定义、不是枚举类型或方法未设置时返回空字符串
+func (d *DescriptorLoader) MethodEnumOption(serviceName, methodName, extension string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ext := d.lookup.methodOptions[extension]
+	if ext.GetType() != descriptorpb.FieldDescriptorProto_TYPE_ENUM {
+		return ""
+	}
+	v, ok := d.methodOptionVarint(serviceName, methodName, ext)
+	if !ok {
+		return ""
+	}
+	for _, value := range d.lookup.enums[strings.TrimPrefix(ext.GetTypeName(), ".")].GetValue() {
+		if value.GetNumber() == int32(v) {
+			return value.GetName()
 		}
 	}
-	return nil
+	return ""
 }
 
-// findNestedMessage 查找嵌套消息
-func (d *DescriptorLoader) findNestedMessage(msg *descriptorpb.DescriptorProto, fullName, prefix string) *descriptorpb.DescriptorProto {
-	for _, nested := range msg.NestedType {
-		fullNestedName := prefix + "." + nested.GetName()
-		if fullNestedName == fullName {
-			return nested
+// methodOptionVarint 读取方法选项中扩展字段的 varint 值，调用方需持有读锁。
+// protoset 中的自定义选项未在全局注册表中注册，解码后保留为未知字段；同一字段出现多次时以最后一次为准
+func (d *DescriptorLoader) methodOptionVarint(serviceName, methodName string, ext *descriptorpb.FieldDescriptorProto) (uint64, bool) {
+	method := d.lookup.methods[serviceName+"/"+methodName]
+	if method.GetOptions() == nil || ext == nil {
+		return 0, false
+	}
+	var value uint64
+	found := false
+	unknown := method.GetOptions().ProtoReflect().GetUnknown()
+	for len(unknown) > 0 {
+		number, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return 0, false
 		}
-		if found := d.findNestedMessage(nested, fullName, fullNestedName); found != nil {
-			return found
+		unknown = unknown[n:]
+		if number == protowire.Number(ext.GetNumber()) && typ == protowire.VarintType {
+			v, m := protowire.ConsumeVarint(unknown)
+			if m < 0 {
+				return 0, false
+			}
+			value, found = v, true
+		}
+		n = protowire.ConsumeFieldValue(number, typ, unknown)
+		if n < 0 {
+			return 0, false
 		}
+		unknown = unknown[n:]
 	}
-	return nil
+	return value, found
+}
+
+// FindMessageDescriptor 查找消息描述符
+// fullName 格式: package.MessageName 或 package.OuterMessage.InnerMessage
+func (d *DescriptorLoader) FindMessageDescriptor(fullName string) *descriptorpb.DescriptorProto {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lookup.messages[fullName]
+}
+
+// FileCount 返回已加载的文件描述符数量
+func (d *DescriptorLoader) FileCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.fileSet.File)
 }
 
 // GetFileDescriptorSet 获取完整的 FileDescriptorSet
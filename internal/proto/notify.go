@@ -0,0 +1,172 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// defaultNotifyTimeout bounds a reload notification when no timeout is configured
+const defaultNotifyTimeout = 5 * time.Second
+
+// ReloadEvent describes an applied protoset reload: the services and methods
+// that changed compared to the previously served snapshot of the source
+type ReloadEvent struct {
+	Tenant   string `json:"tenant,omitempty"`
+	Service  string `json:"service"`
+	Location string `json:"location"` // URL, module or path the protoset was loaded from
+	DescriptorDiff
+	BreakingChanges []string  `json:"breaking_changes,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// ReloadNotifier posts reload events to a webhook, e.g. a Slack incoming webhook
+type ReloadNotifier struct {
+	url    string
+	slack  bool
+	client *http.Client
+}
+
+// NewReloadNotifier creates a notifier, or returns nil when no URL is configured
+func NewReloadNotifier(cfg config.ReloadNotifyConfig) (*ReloadNotifier, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid reload notification URL %q", cfg.URL)
+	}
+	n := &ReloadNotifier{url: cfg.URL}
+	switch cfg.Format {
+	case "", "json":
+	case "slack":
+		n.slack = true
+	default:
+		return nil, fmt.Errorf("unknown reload notification format %q, expected json or slack", cfg.Format)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	n.client = &http.Client{Timeout: timeout}
+	return n, nil
+}
+
+// SetNotifier sets the notifier told about applied reloads
+func (m *HotReloadManager) SetNotifier(notifier *ReloadNotifier) {
+	m.notifier = notifier
+	for _, tenant := range m.tenants {
+		tenant.SetNotifier(notifier)
+	}
+}
+
+// Notify posts an event; any status other than 2xx is an error
+func (n *ReloadNotifier) Notify(ctx context.Context, event *ReloadEvent) error {
+	var payload any = event
+	if n.slack {
+		payload = map[string]string{"text": event.text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("reload notification failed with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// text renders the event as a chat message
+func (e *ReloadEvent) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Protoset %s", e.Service)
+	if e.Tenant != "" {
+		fmt.Fprintf(&b, " (tenant %s)", e.Tenant)
+	}
+	fmt.Fprintf(&b, " reloaded from %s: %s -> %s", e.Location, orNone(e.From), e.To)
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Added services", e.AddedServices},
+		{"Removed services", e.RemovedServices},
+		{"Added methods", e.AddedMethods},
+		{"Removed methods", e.RemovedMethods},
+		{"Changed methods", e.ChangedMethods},
+		{"Breaking changes", e.BreakingChanges},
+	} {
+		if len(section.items) > 0 {
+			fmt.Fprintf(&b, "\n%s:\n• %s", section.title, strings.Join(section.items, "\n• "))
+		}
+	}
+	return b.String()
+}
+
+// orNone names a missing previous version
+func orNone(version string) string {
+	if version == "" {
+		return "none"
+	}
+	return version
+}
+
+// reportReload logs the descriptor changes of an applied reload and posts
+// them to the notifier in the background
+func (m *HotReloadManager) reportReload(info *config.ProtoSetInfo, breaking []string) {
+	event := &ReloadEvent{
+		Tenant:          m.tenant,
+		Service:         info.ServiceName,
+		Location:        protosetLocation(info),
+		BreakingChanges: breaking,
+		Time:            time.Now(),
+	}
+	if diff, err := m.loader.Diff(sourceName(info), "", ""); err == nil {
+		event.DescriptorDiff = *diff
+	}
+	m.logger.Info("Successfully reloaded protoset",
+		"service", info.ServiceName,
+		"from", event.From,
+		"to", event.To,
+		"added_services", event.AddedServices,
+		"removed_services", event.RemovedServices,
+		"added_methods", event.AddedMethods,
+		"removed_methods", event.RemovedMethods,
+		"changed_methods", event.ChangedMethods,
+	)
+
+	if m.notifier == nil {
+		return
+	}
+	go func() {
+		if err := m.notifier.Notify(context.Background(), event); err != nil {
+			m.logger.Warn("Failed to send reload notification", "service", info.ServiceName, "error", err)
+		}
+	}()
+}
+
+// protosetLocation returns where a protoset is loaded from
+func protosetLocation(info *config.ProtoSetInfo) string {
+	switch {
+	case info.URL != "":
+		return info.URL
+	case info.Module != "":
+		return info.Module
+	}
+	return info.Path
+}
@@ -1,20 +1,162 @@
 package proto
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
 	"github.com/google/wire"
 	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
 )
 
 // ProviderSet gRPC服务器Provider集合
 var ProviderSet = wire.NewSet(
+	ProvideDescriptorLoader,
+	ProvideTenants,
 	ProvideHotReloadManager,
 )
 
-// ProvideServer 提供gRPC服务器实例
-func ProvideHotReloadManager(loader *DescriptorLoader,
-	cfg *config.ProtoHotReloadConfig,
-	protosets []config.ProtoSetInfo,
-) *HotReloadManager {
-	srv := NewHotReloadManager(loader, cfg, protosets)
-	return srv
+// ProvideDescriptorLoader 提供描述符加载器，加载主 protoset 及各服务的 protoset
+func ProvideDescriptorLoader(cfg *config.Config) (*DescriptorLoader, error) {
+	if !cfg.Registry.Enabled {
+		return nil, nil
+	}
+	return newLoader(&cfg.Proto, cfg.Proto.ProtoSetPath, cfg.Proto.ProtoSets)
+}
+
+// ProvideTenants 提供各租户的描述符加载器，未配置租户时返回 nil
+func ProvideTenants(cfg *config.Config) (*Tenants, error) {
+	if !cfg.Registry.Enabled {
+		return nil, nil
+	}
+	return newTenants(cfg)
+}
+
+// newTenants 加载各租户的描述符，未配置租户时返回 nil
+func newTenants(cfg *config.Config) (*Tenants, error) {
+	protos := cfg.TenantProtos()
+	if len(protos) == 0 {
+		return nil, nil
+	}
+
+	tenants := &Tenants{loaders: make(map[string]*DescriptorLoader, len(protos))}
+	for name, tenant := range protos {
+		path := tenant.ProtoSetPath
+		if path == "" {
+			path = cfg.Proto.ProtoSetPath
+		}
+		loader, err := newLoader(&cfg.Proto, path, tenant.ProtoSets)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", name, err)
+		}
+		tenants.loaders[name] = loader
+	}
+	return tenants, nil
+}
+
+// LoadAll 加载配置的全部描述符，包括运行时才由热更新下载的远程 protoset，
+// 不论是否启用注册中心；用于启动前校验配置
+func LoadAll(cfg *config.Config, log *slog.Logger) (*DescriptorLoader, *Tenants, error) {
+	loader, err := newLoader(&cfg.Proto, cfg.Proto.ProtoSetPath, cfg.Proto.ProtoSets)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenants, err := newTenants(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := NewDownloadClient(cfg.Proto.HotReload.Download)
+	if err != nil {
+		return nil, nil, err
+	}
+	mgr := NewHotReloadManager(loader, &cfg.Proto.HotReload, cfg.Proto.ProtoSets, log)
+	mgr.SetBSRClient(NewBSRClient(cfg.Proto.BSR))
+	mgr.SetDownloadClient(client)
+	protos := cfg.TenantProtos()
+	for _, name := range tenants.Names() {
+		mgr.AddTenant(name, tenants.Get(name), protos[name].ProtoSets)
+	}
+
+	errs := reloadErrors("", mgr.ReloadAll())
+	for _, name := range tenants.Names() {
+		errs = append(errs, reloadErrors("tenant "+name+": ", mgr.tenants[name].ReloadAll())...)
+	}
+	return loader, tenants, errors.Join(errs...)
+}
+
+// reloadErrors 按服务名排序 ReloadAll 返回的错误
+func reloadErrors(prefix string, errs map[string]error) []error {
+	services := make([]string, 0, len(errs))
+	for service := range errs {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	list := make([]error, 0, len(services))
+	for _, service := range services {
+		list = append(list, fmt.Errorf("%sprotoset %s: %w", prefix, service, errs[service]))
+	}
+	return list
+}
+
+// newLoader 加载主 protoset 及各服务的 protoset
+func newLoader(cfg *config.ProtoConfig, protosetPath string, protosets []config.ProtoSetInfo) (*DescriptorLoader, error) {
+	// Load protoset
+	loader, err := NewDescriptorLoader(protosetPath, cfg.ImportPaths...)
+	if err != nil {
+		return nil, err
+	}
+	loader.SetHistorySize(cfg.HistorySize)
+
+	// Load additional protosets if configured
+	var bsr *BSRClient
+	for i := range protosets {
+		ps := &protosets[i]
+		switch {
+		case ps.Module != "":
+			if bsr == nil {
+				bsr = NewBSRClient(cfg.BSR)
+			}
+			data, err := bsr.FetchImage(context.Background(), ps.Module)
+			if err != nil {
+				return nil, err
+			}
+			if err := loader.LoadProtosetData(sourceName(ps), data); err != nil {
+				return nil, err
+			}
+		case ps.Path != "":
+			if err := loader.LoadProtoset(sourceName(ps), ps.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return loader, nil
+}
+
+// ProvideHotReloadManager 提供 protoset 热更新管理器，未启用热更新或未加载描述符时返回 nil
+func ProvideHotReloadManager(cfg *config.Config, loader *DescriptorLoader, tenants *Tenants, log *slog.Logger) (*HotReloadManager, error) {
+	if !cfg.Proto.HotReload.Enabled || loader == nil {
+		return nil, nil
+	}
+	client, err := NewDownloadClient(cfg.Proto.HotReload.Download)
+	if err != nil {
+		return nil, err
+	}
+	notifier, err := NewReloadNotifier(cfg.Proto.HotReload.Notify)
+	if err != nil {
+		return nil, err
+	}
+	mgr := NewHotReloadManager(loader, &cfg.Proto.HotReload, cfg.Proto.ProtoSets, logger.Component(log, "hot_reload"))
+	mgr.SetBSRClient(NewBSRClient(cfg.Proto.BSR))
+	mgr.SetDownloadClient(client)
+	mgr.SetNotifier(notifier)
+	protos := cfg.TenantProtos()
+	for _, name := range tenants.Names() {
+		mgr.AddTenant(name, tenants.Get(name), protos[name].ProtoSets)
+	}
+	return mgr, nil
 }
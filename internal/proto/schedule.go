@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// scheduleResolution is how often the poller looks for protosets that are due
+const scheduleResolution = time.Second
+
+// checkPeriod returns the poll period of a protoset: its own check_period, or
+// the global one
+func (m *HotReloadManager) checkPeriod(info *config.ProtoSetInfo) time.Duration {
+	period := m.config.CheckPeriod
+	if info.CheckPeriod > 0 {
+		period = info.CheckPeriod
+	}
+	return time.Duration(period) * time.Second
+}
+
+// polling reports whether any protoset is reloaded periodically
+func (m *HotReloadManager) polling() bool {
+	if m.config.CheckPeriod > 0 {
+		return true
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, ps := range m.protosets {
+		if ps.CheckPeriod > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nextCheck returns when a protoset is checked next: one period from now,
+// moved either way by a random amount of up to the configured jitter
+func (m *HotReloadManager) nextCheck(now time.Time, period time.Duration) time.Time {
+	if jitter := min(max(m.config.Jitter, 0), 1); jitter > 0 {
+		period += time.Duration((rand.Float64()*2 - 1) * jitter * float64(period))
+	}
+	return now.Add(period)
+}
+
+// poll reloads the protosets whose check is due, skipping sources that are
+// backing off after failed reloads. A protoset is first checked one period
+// after it is seen, like with a ticker.
+func (m *HotReloadManager) poll(now time.Time) {
+	for _, ps := range m.GetRegisteredProtosets() {
+		period := m.checkPeriod(&ps)
+		if period <= 0 {
+			continue
+		}
+		m.mu.Lock()
+		due, ok := m.due[ps.ServiceName]
+		if !ok || !now.Before(due) {
+			m.due[ps.ServiceName] = m.nextCheck(now, period)
+		}
+		m.mu.Unlock()
+		if !ok || now.Before(due) {
+			continue
+		}
+
+		if m.backingOff(ps.ServiceName, now) {
+			m.logger.Debug("Skipping failing protoset until its next retry", "service", ps.ServiceName)
+			continue
+		}
+		if err := m.reloadProtoset(&ps); err != nil {
+			m.logger.Error("Failed to reload protoset", "service", ps.ServiceName, "error", err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package proto
+
+import "sort"
+
+// Tenants holds the descriptor loaders of tenants with their own schema
+type Tenants struct {
+	loaders map[string]*DescriptorLoader
+}
+
+// Get returns the descriptor loader of a tenant, or nil when the tenant uses
+// the shared descriptors
+func (t *Tenants) Get(tenant string) *DescriptorLoader {
+	if t == nil || tenant == "" {
+		return nil
+	}
+	return t.loaders[tenant]
+}
+
+// Names returns the sorted names of tenants with their own schema
+func (t *Tenants) Names() []string {
+	if t == nil {
+		return nil
+	}
+	names := make([]string, 0, len(t.loaders))
+	for name := range t.loaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
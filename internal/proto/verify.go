@@ -0,0 +1,136 @@
+package proto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// maxSidecarBytes bounds the size of checksum and signature files
+const maxSidecarBytes = 64 << 10
+
+// verifyProtoset checks the checksum and signature configured for a downloaded protoset
+func (m *HotReloadManager) verifyProtoset(info *config.ProtoSetInfo, data []byte) error {
+	sum := sha256.Sum256(data)
+
+	expected := info.SHA256
+	if info.ChecksumURL != "" {
+		sidecar, err := m.fetch(info.ChecksumURL)
+		if err != nil {
+			return fmt.Errorf("failed to fetch checksum: %w", err)
+		}
+		// sha256sum format: "<hex>  <file name>"
+		fields := strings.Fields(string(sidecar))
+		if len(fields) == 0 {
+			return errors.New("empty checksum file")
+		}
+		if expected != "" && !strings.EqualFold(expected, fields[0]) {
+			return errors.New("configured checksum does not match checksum file")
+		}
+		expected = fields[0]
+	}
+	if expected != "" {
+		want, err := hex.DecodeString(strings.TrimSpace(expected))
+		if err != nil || len(want) != sha256.Size {
+			return fmt.Errorf("invalid sha256 checksum %q", expected)
+		}
+		if subtle.ConstantTimeCompare(want, sum[:]) != 1 {
+			return fmt.Errorf("checksum mismatch: got %x", sum)
+		}
+	}
+
+	if info.SignatureURL == "" && info.PublicKey == "" {
+		return nil
+	}
+	if info.SignatureURL == "" || info.PublicKey == "" {
+		return errors.New("signature verification requires both signature_url and public_key")
+	}
+	encoded, err := m.fetch(info.SignatureURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	key, err := loadPublicKey(info.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(key, data, sum[:], signature); err != nil {
+		return err
+	}
+	m.logger.Debug("Protoset signature verified", "service", info.ServiceName)
+	return nil
+}
+
+// fetch downloads a small sidecar file from the artifact repository
+func (m *HotReloadManager) fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.config.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.config.AuthToken))
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSidecarBytes))
+}
+
+// loadPublicKey reads a PEM encoded PKIX public key, the format written by cosign generate-key-pair
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// verifySignature verifies a signature over data whose SHA-256 digest is given
+func verifySignature(key crypto.PublicKey, data, digest, signature []byte) error {
+	var ok bool
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, digest, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, data, signature)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !ok {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package proto
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultDebounce = 200 * time.Millisecond
+
+// startFileWatch watches the directories of local protosets and reloads a
+// protoset shortly after its file changes. Directories are watched instead of
+// files so that atomic replacements (write to temp file, then rename) are seen.
+func (m *HotReloadManager) startFileWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	m.mu.Lock()
+	m.fsWatcher = watcher
+	dirs := make(map[string]bool)
+	for _, ps := range m.protosets {
+		if ps.URL == "" && ps.Path != "" {
+			for _, dir := range watchDirs(ps.Path) {
+				dirs[dir] = true
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer watcher.Close()
+		for {
+			select {
+			case <-m.stopCh:
+				m.stopDebounce()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) != 0 {
+					m.fileChanged(filepath.Clean(event.Name))
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				m.logger.Warn("Protoset file watcher error", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// watchPath adds the directory of a newly registered local protoset to the file watcher
+func (m *HotReloadManager) watchPath(path string) {
+	if m.fsWatcher == nil || path == "" {
+		return
+	}
+	for _, dir := range watchDirs(path) {
+		if err := m.fsWatcher.Add(dir); err != nil {
+			m.logger.Warn("Failed to watch protoset directory", "dir", dir, "error", err)
+		}
+	}
+}
+
+// watchDirs returns the directories to watch for a local protoset: the parent
+// directory of a file, or a proto source directory and all its subdirectories
+func watchDirs(path string) []string {
+	path = filepath.Clean(path)
+	if !isSourceDir(path) {
+		return []string{filepath.Dir(path)}
+	}
+	var dirs []string
+	filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// matchesProtoset reports whether a changed file belongs to a local protoset.
+// A .proto source also depends on the other .proto files next to it.
+func matchesProtoset(protosetPath, changed string) bool {
+	protosetPath = filepath.Clean(protosetPath)
+	if changed == protosetPath {
+		return true
+	}
+	if !strings.EqualFold(filepath.Ext(changed), ".proto") {
+		return false
+	}
+	if isSourceDir(protosetPath) {
+		return strings.HasPrefix(changed, protosetPath+string(filepath.Separator))
+	}
+	return strings.EqualFold(filepath.Ext(protosetPath), ".proto") && filepath.Dir(changed) == filepath.Dir(protosetPath)
+}
+
+// fileChanged schedules a reload of the protosets stored at path. Repeated
+// events within the debounce window collapse into a single reload, so a
+// truncate-and-write or a temp-file rename is only loaded once it is complete.
+func (m *HotReloadManager) fileChanged(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, ps := range m.protosets {
+		if ps.URL != "" || !matchesProtoset(ps.Path, path) {
+			continue
+		}
+		if timer, ok := m.debounce[name]; ok {
+			timer.Reset(m.debounceDelay())
+			continue
+		}
+		service := name
+		m.debounce[service] = time.AfterFunc(m.debounceDelay(), func() {
+			m.mu.Lock()
+			delete(m.debounce, service)
+			m.mu.Unlock()
+
+			m.logger.Debug("Protoset file changed", "service", service, "path", path)
+			if err := m.ReloadServiceProtoset(service); err != nil {
+				m.logger.Error("Failed to reload protoset", "service", service, "error", err)
+			}
+		})
+	}
+}
+
+// debounceDelay returns the configured debounce window
+func (m *HotReloadManager) debounceDelay() time.Duration {
+	if m.config.DebounceMS > 0 {
+		return time.Duration(m.config.DebounceMS) * time.Millisecond
+	}
+	return defaultDebounce
+}
+
+// stopDebounce cancels pending reloads
+func (m *HotReloadManager) stopDebounce() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, timer := range m.debounce {
+		timer.Stop()
+		delete(m.debounce, name)
+	}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const (
+	// AttemptMetadata is the upstream attempt number (starting at 1), sent as
+	// gRPC metadata or HTTP header to services that retry
+	AttemptMetadata = "x-attempt"
+	// PreviousCodeMetadata is the gRPC code that failed the previous attempt,
+	// sent on retries
+	PreviousCodeMetadata = "x-attempt-previous-code"
+	// AttemptsHeader is the response header with the number of upstream
+	// attempts made for a service that retries
+	AttemptsHeader = "X-Upstream-Attempts"
+)
+
+// attemptsKey 上下文中上游尝试次数的键
+type attemptsKey struct{}
+
+// WithAttempts returns a context that counts the upstream attempts of a
+// retrying service, read back with Attempts once the call returns
+func WithAttempts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, new(atomic.Int32))
+}
+
+// Attempts returns the number of upstream attempts counted in ctx; it is 0
+// when the service does not retry or no attempt was made
+func Attempts(ctx context.Context) int {
+	if counter, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+		return int(counter.Load())
+	}
+	return 0
+}
+
+// recordAttempt 记录第 attempt 次尝试：写入请求信息供访问日志使用，服务配置了重试时计入上下文
+func recordAttempt(ctx context.Context, policy *ServicePolicy, attempt int) {
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.Attempts = attempt
+	}
+	if policy.Attempts() <= 1 {
+		return
+	}
+	if counter, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+		counter.Store(int32(attempt))
+	}
+}
+
+// withAttemptMetadata 服务配置了重试时，在上游调用的元数据中加入尝试序号与上一次失败的状态码
+func withAttemptMetadata(ctx context.Context, policy *ServicePolicy, attempt int, lastErr error) context.Context {
+	if policy.Attempts() <= 1 {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(AttemptMetadata, strconv.Itoa(attempt))
+	if lastErr != nil {
+		md.Set(PreviousCodeMetadata, status.Code(lastErr).String())
+	} else {
+		md.Delete(PreviousCodeMetadata)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// setAttemptHeaders 服务配置了重试时，在转发到 HTTP 上游的请求头中加入尝试序号与上一次失败的状态码
+func setAttemptHeaders(header http.Header, policy *ServicePolicy, attempt int, lastErr error) {
+	if policy.Attempts() <= 1 {
+		return
+	}
+	header.Set(AttemptMetadata, strconv.Itoa(attempt))
+	if lastErr != nil {
+		header.Set(PreviousCodeMetadata, status.Code(lastErr).String())
+	} else {
+		header.Del(PreviousCodeMetadata)
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/proto" // Register the proto codec used as fallback
+)
+
+// Frame 一条未解码的 gRPC 消息，透明代理时原样转发
+type Frame struct {
+	Payload []byte
+}
+
+// rawCodec 透传编解码器：Frame 按原始字节收发不重新编码，其他消息交给标准 proto 编解码器
+type rawCodec struct {
+	fallback encoding.Codec
+}
+
+// Codec 返回透传编解码器，用于网关 gRPC 服务端（grpc.ForceServerCodec）与代理的上游流（grpc.ForceCodec）。
+// 名称为 "proto"，content-type 保持 application/grpc+proto
+func Codec() encoding.Codec {
+	return rawCodec{fallback: encoding.GetCodec("proto")}
+}
+
+// Marshal 实现 encoding.Codec
+func (c rawCodec) Marshal(v any) ([]byte, error) {
+	if frame, ok := v.(*Frame); ok {
+		return frame.Payload, nil
+	}
+	return c.fallback.Marshal(v)
+}
+
+// Unmarshal 实现 encoding.Codec，复制数据以免引用 gRPC 的接收缓冲区
+func (c rawCodec) Unmarshal(data []byte, v any) error {
+	if frame, ok := v.(*Frame); ok {
+		frame.Payload = append(frame.Payload[:0], data...)
+		return nil
+	}
+	return c.fallback.Unmarshal(data, v)
+}
+
+// Name 实现 encoding.Codec
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/stats"
+
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// defaultSweepInterval 后台清理连接的默认周期
+const defaultSweepInterval = 30 * time.Second
+
+// touch 记录连接的使用时间
+func (pc *pooledConn) touch() {
+	pc.used.Store(time.Now().UnixNano())
+}
+
+// idle 返回连接没有进行中的调用且未被使用的时长，有进行中的调用时返回 0
+func (pc *pooledConn) idle(now time.Time) time.Duration {
+	if pc.active.Load() > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, pc.used.Load()))
+}
+
+// TagRPC 实现 stats.Handler
+func (pc *pooledConn) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC 实现 stats.Handler，统计连接上进行中的调用
+func (pc *pooledConn) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s.(type) {
+	case *stats.Begin:
+		pc.active.Add(1)
+		pc.touch()
+	case *stats.End:
+		pc.active.Add(-1)
+		pc.touch()
+	}
+}
+
+// TagConn 实现 stats.Handler
+func (pc *pooledConn) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn 实现 stats.Handler
+func (pc *pooledConn) HandleConn(context.Context, stats.ConnStats) {}
+
+// retire 将连接移出连接池：新请求不再使用该连接，进行中的调用继续完成，
+// 之后的清理在连接没有进行中的调用（或超过 drain_timeout）时将其关闭。
+// 移出的连接至少经过一个清理周期才关闭，使刚从连接池取得该连接的调用仍能开始；调用方需持有写锁
+func (p *ConnectionPool) retire(pc *pooledConn) {
+	pc.retired = time.Now()
+	p.retired = append(p.retired, pc)
+	p.startSweeper()
+}
+
+// startSweeper 启动后台清理，只启动一次
+func (p *ConnectionPool) startSweeper() {
+	p.sweeper.Do(func() {
+		go p.sweepLoop()
+	})
+}
+
+// sweepLoop 周期性地清理连接，直到连接池关闭
+func (p *ConnectionPool) sweepLoop() {
+	ticker := time.NewTicker(p.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.sweep(time.Now())
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// sweep 关闭已移出且没有进行中调用的连接，关闭空闲超时的连接，并将超过最大存活时间的连接移出连接池
+func (p *ConnectionPool) sweep(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 先处理上一次移出的连接，使移出的连接至少经过一个清理周期才关闭
+	retired := p.retired[:0]
+	for _, pc := range p.retired {
+		active := pc.active.Load()
+		if active > 0 {
+			if p.drainTimeout <= 0 || now.Sub(pc.retired) < p.drainTimeout {
+				retired = append(retired, pc)
+				continue
+			}
+			p.logger.Warn("Closing draining connection with in-flight calls after drain timeout",
+				"target", pc.target, "index", pc.index, "active", active)
+		}
+		pc.conn.Close()
+	}
+	p.retired = retired
+
+	for key, group := range p.connections {
+		empty := true
+		for i, pc := range group.conns {
+			if pc == nil {
+				continue
+			}
+			switch {
+			case p.idleTimeout > 0 && pc.idle(now) >= p.idleTimeout:
+				p.logger.Debug("Closing idle connection", "target", pc.target, "index", pc.index, "idle", pc.idle(now))
+				pc.conn.Close()
+				group.conns[i] = nil
+				connectionsEvicted.Inc(pc.target, "idle")
+			case p.maxAge > 0 && now.Sub(pc.created) >= p.maxAge:
+				p.logger.Debug("Retiring connection past max age", "target", pc.target, "index", pc.index, "age", now.Sub(pc.created))
+				p.retire(pc)
+				group.conns[i] = nil
+				connectionsEvicted.Inc(pc.target, "max_age")
+			default:
+				empty = false
+			}
+		}
+		if empty {
+			delete(p.connections, key)
+		}
+	}
+}
+
+// WatchService 监听服务的实例变化，实例从注册中心注销或权重被设置为 0 后将到该实例的连接移出连接池，
+// 预先建立连接的服务新增实例时建立到新实例的连接。每个服务只监听一次，可在每次转发请求时调用
+func (p *ConnectionPool) WatchService(reg registry.Registry, service string) {
+	if reg == nil {
+		return
+	}
+
+	p.mu.RLock()
+	watched := p.watched[service]
+	p.mu.RUnlock()
+	if watched {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watched[service] {
+		return
+	}
+	p.watched[service] = true
+	go p.watchService(reg, service)
+}
+
+// watchService 处理服务的实例变化事件，直到连接池关闭
+func (p *ConnectionPool) watchService(reg registry.Registry, service string) {
+	watcher, err := reg.Watch(p.ctx, service)
+	if err != nil {
+		p.logger.Warn("Failed to watch service instances, deregistered instances are only evicted when idle",
+			"service", service, "error", err)
+		return
+	}
+	defer watcher.Stop()
+
+	var known map[string]bool
+	for {
+		instances, err := watcher.Next()
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			p.logger.Debug("Service watch error", "service", service, "error", err)
+			continue
+		}
+
+		current := make(map[string]bool, len(instances))
+		for _, instance := range routable(instances) {
+			current[fmt.Sprintf("%s:%d", instance.Address, instance.Port)] = true
+		}
+		for target := range known {
+			if !current[target] {
+				p.logger.Info("Upstream instance removed or draining, draining its connections", "service", service, "target", target)
+				if n := p.RemoveConnection(target); n > 0 {
+					connectionsEvicted.Add(float64(n), target, "deregistered")
+				}
+			}
+		}
+		known = current
+		p.connectInstances(service, instances)
+	}
+}
@@ -1,38 +1,184 @@
 package proxy
 
 import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+var (
+	dialFailures = metrics.NewCounterVec(
+		"gateway_upstream_dial_failures_total",
+		"Failed attempts to dial an upstream target",
+		"target",
+	)
+	connectionsReplaced = metrics.NewCounterVec(
+		"gateway_upstream_connections_replaced_total",
+		"Stale upstream connections replaced, by the state they were in",
+		"target", "state",
+	)
+	connectionsEvicted = metrics.NewCounterVec(
+		"gateway_upstream_connections_evicted_total",
+		"Upstream connections removed from the pool, by reason (idle, max_age, deregistered)",
+		"target", "reason",
+	)
 )
 
+// pooledConn 连接池中的连接及其统计信息
+type pooledConn struct {
+	target  string
+	tls     bool
+	index   int
+	conn    *grpc.ClientConn
+	created time.Time
+	reuses  atomic.Uint64
+	active  atomic.Int64 // 进行中的调用数
+	used    atomic.Int64 // 最近一次使用的时间（UnixNano）
+	retired time.Time    // 移出连接池的时间，零值表示仍在连接池中
+}
+
+// targetConns 同一目标（及传输凭证）的一组连接，按轮询方式选择
+type targetConns struct {
+	conns []*pooledConn // 长度为每个目标的连接数，尚未创建的连接为 nil
+	next  atomic.Uint64
+}
+
+// pick 轮询选择下一个连接的位置
+func (t *targetConns) pick() int {
+	return int((t.next.Add(1) - 1) % uint64(len(t.conns)))
+}
+
+// ConnectionStats 连接状态快照
+type ConnectionStats struct {
+	Target       string    `json:"target"`
+	Index        int       `json:"index"`
+	TLS          bool      `json:"tls"`
+	State        string    `json:"state"`
+	Created      time.Time `json:"created"`
+	AgeSeconds   float64   `json:"age_seconds"`
+	Reuses       uint64    `json:"reuses"`
+	Active       int64     `json:"active"`
+	Draining     bool      `json:"draining"`
+	DialFailures uint64    `json:"dial_failures"`
+	Replaced     uint64    `json:"replaced"`
+}
+
 // ConnectionPool 连接池
 type ConnectionPool struct {
-	connections map[string]*grpc.ClientConn
-	mu          sync.RWMutex
+	connections   map[string]*targetConns
+	dialFailures  map[string]uint64
+	replaced      map[string]uint64
+	size          int  // 每个目标的连接数
+	warmUp        bool // 首次访问目标时建立全部连接
+	idleTimeout   time.Duration
+	maxAge        time.Duration
+	drainTimeout  time.Duration
+	sweeper       sync.Once
+	sweepInterval time.Duration
+	retired       []*pooledConn                // 已移出连接池、等待调用结束后关闭的连接
+	watched       map[string]bool              // 已监听实例变化的服务
+	preconnect    map[string]preconnectService // 预先建立连接的服务
+	mu            sync.RWMutex
+	logger        *slog.Logger
+
+	ctx    context.Context // 连接池关闭时取消，结束清理与监听
+	cancel context.CancelFunc
 }
 
 // NewConnectionPool 创建连接池
-func NewConnectionPool() *ConnectionPool {
+func NewConnectionPool(logger *slog.Logger) *ConnectionPool {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ConnectionPool{
-		connections: make(map[string]*grpc.ClientConn),
+		connections:   make(map[string]*targetConns),
+		dialFailures:  make(map[string]uint64),
+		replaced:      make(map[string]uint64),
+		watched:       make(map[string]bool),
+		preconnect:    make(map[string]preconnectService),
+		size:          1,
+		sweepInterval: defaultSweepInterval,
+		logger:        logger,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// SetConfig 设置每个目标的连接数、预热策略与连接的回收策略（用于依赖注入，需在获取连接之前调用）。
+// 配置了空闲超时或最大存活时间时启动后台清理
+func (p *ConnectionPool) SetConfig(cfg config.ConnectionPoolConfig) {
+	p.size = max(cfg.ConnectionsPerTarget, 1)
+	p.warmUp = cfg.WarmUp
+	p.idleTimeout = cfg.IdleTimeout
+	p.maxAge = cfg.MaxAge
+	p.drainTimeout = cfg.DrainTimeout
+	if cfg.SweepInterval > 0 {
+		p.sweepInterval = cfg.SweepInterval
+	}
+	if p.idleTimeout > 0 || p.maxAge > 0 {
+		p.startSweeper()
 	}
 }
 
-// GetConnection 获取或创建连接
-func (p *ConnectionPool) GetConnection(target string) (*grpc.ClientConn, error) {
+// connKey 返回目标在连接池中的键与连接使用的传输凭证，creds 为 nil 时使用明文连接
+func connKey(target string, creds *Credentials) (string, credentials.TransportCredentials) {
+	if creds == nil {
+		return target, insecure.NewCredentials()
+	}
+	return creds.Key + "@" + target, creds.TransportCredentials
+}
+
+// newTargetConns 创建目标的空连接组
+func (p *ConnectionPool) newTargetConns() *targetConns {
+	group := &targetConns{conns: make([]*pooledConn, p.size)}
+	group.next.Store(1)
+	return group
+}
+
+// GetConnection 获取或创建连接，creds 为 nil 时使用明文连接。
+// 每个目标最多有 connections_per_target 个连接，按轮询方式选择，尚未建立的连接在被选中时创建
+func (p *ConnectionPool) GetConnection(target string, creds *Credentials) (*grpc.ClientConn, error) {
+	conn, _, err := p.getConnection(target, creds)
+	return conn, err
+}
+
+// connection 获取或创建连接，并记录调用是否复用了连接池中已有的连接
+func (p *ConnectionPool) connection(ctx context.Context, target string, creds *Credentials) (*grpc.ClientConn, error) {
+	conn, reused, err := p.getConnection(target, creds)
+	if err != nil {
+		return nil, err
+	}
+	recordConnReuse(ctx, reused)
+	return conn, nil
+}
+
+// getConnection 获取或创建连接，reused 报告返回的是否为已有的可用连接
+func (p *ConnectionPool) getConnection(target string, creds *Credentials) (conn *grpc.ClientConn, reused bool, err error) {
+	key, transport := connKey(target, creds)
+
 	// 先尝试读取已有连接
+	index := 0
 	p.mu.RLock()
-	if conn, ok := p.connections[target]; ok {
+	if group, ok := p.connections[key]; ok {
+		index = group.pick()
 		// 检查连接状态
-		state := conn.GetState()
-		if state != connectivity.Shutdown && state != connectivity.TransientFailure {
+		if pc := group.conns[index]; pc != nil && usable(pc.conn.GetState()) {
+			// 持有读锁时更新使用时间，避免清理在返回前将连接判定为空闲
+			pc.touch()
 			p.mu.RUnlock()
-			return conn, nil
+			pc.reuses.Add(1)
+			return pc.conn, true, nil
 		}
 	}
 	p.mu.RUnlock()
@@ -41,20 +187,65 @@ func (p *ConnectionPool) GetConnection(target string) (*grpc.ClientConn, error)
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	group, ok := p.connections[key]
+	if !ok {
+		group = p.newTargetConns()
+		p.connections[key] = group
+		if p.warmUp {
+			p.warm(group, target, creds != nil, transport)
+		}
+	}
+
 	// 双重检查
-	if conn, ok := p.connections[target]; ok {
-		state := conn.GetState()
-		if state != connectivity.Shutdown && state != connectivity.TransientFailure {
-			return conn, nil
+	if pc := group.conns[index]; pc != nil {
+		state := pc.conn.GetState()
+		if usable(state) {
+			pc.touch()
+			pc.reuses.Add(1)
+			return pc.conn, true, nil
 		}
 		// 关闭旧连接
-		conn.Close()
-		delete(p.connections, target)
+		p.logger.Info("Replacing stale connection",
+			"target", target,
+			"index", index,
+			"state", state.String(),
+			"age", time.Since(pc.created),
+			"reuses", pc.reuses.Load(),
+		)
+		pc.conn.Close()
+		group.conns[index] = nil
+		p.replaced[target]++
+		connectionsReplaced.Inc(target, state.String())
 	}
 
-	// 创建新连接
+	pc, err := p.dial(target, index, creds != nil, transport)
+	if err != nil {
+		return nil, false, err
+	}
+	group.conns[index] = pc
+	return pc.conn, false, nil
+}
+
+// warm 建立目标的全部连接并立即开始连接，而不是等到第一次调用；拨号失败的连接在被选中时重试
+func (p *ConnectionPool) warm(group *targetConns, target string, tls bool, transport credentials.TransportCredentials) {
+	for i := range group.conns {
+		pc, err := p.dial(target, i, tls, transport)
+		if err != nil {
+			continue
+		}
+		pc.conn.Connect()
+		group.conns[i] = pc
+	}
+}
+
+// dial 创建到目标的连接，调用方需持有写锁
+func (p *ConnectionPool) dial(target string, index int, tls bool, transport credentials.TransportCredentials) (*pooledConn, error) {
+	pc := &pooledConn{target: target, tls: tls, index: index, created: time.Now()}
+	pc.touch()
 	conn, err := grpc.Dial(target,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(transport),
+		// 统计进行中的调用，清理时不关闭仍有调用的连接
+		grpc.WithStatsHandler(pc),
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
 			Time:                10 * time.Second,
 			Timeout:             3 * time.Second,
@@ -62,31 +253,177 @@ func (p *ConnectionPool) GetConnection(target string) (*grpc.ClientConn, error)
 		}),
 	)
 	if err != nil {
+		p.dialFailures[target]++
+		dialFailures.Inc(target)
+		p.logger.Warn("Failed to dial upstream", "target", target, "error", err)
 		return nil, err
 	}
-
-	p.connections[target] = conn
-	return conn, nil
+	pc.conn = conn
+	return pc, nil
 }
 
-// Close 关闭所有连接
+// Close 关闭所有连接，并停止后台清理与实例监听
 func (p *ConnectionPool) Close() {
+	p.cancel()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for target, conn := range p.connections {
-		conn.Close()
-		delete(p.connections, target)
+	for key, group := range p.connections {
+		group.close()
+		delete(p.connections, key)
 	}
+	for _, pc := range p.retired {
+		pc.conn.Close()
+	}
+	p.retired = nil
 }
 
-// RemoveConnection 移除指定连接
-func (p *ConnectionPool) RemoveConnection(target string) {
+// RemoveConnection 将指定目标的所有连接移出连接池，连接在进行中的调用结束后关闭；返回移出的连接数
+func (p *ConnectionPool) RemoveConnection(target string) int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if conn, ok := p.connections[target]; ok {
-		conn.Close()
-		delete(p.connections, target)
+	removed := 0
+	for key, group := range p.connections {
+		if group.target() != target {
+			continue
+		}
+		for i, pc := range group.conns {
+			if pc != nil {
+				p.retire(pc)
+				group.conns[i] = nil
+				removed++
+			}
+		}
+		delete(p.connections, key)
+	}
+	return removed
+}
+
+// target 返回连接组的目标地址
+func (t *targetConns) target() string {
+	for _, pc := range t.conns {
+		if pc != nil {
+			return pc.target
+		}
+	}
+	return ""
+}
+
+// close 关闭组内已建立的连接
+func (t *targetConns) close() {
+	for i, pc := range t.conns {
+		if pc != nil {
+			pc.conn.Close()
+			t.conns[i] = nil
+		}
+	}
+}
+
+// Stats 返回连接池中所有目标的状态快照，包括已无连接但有拨号失败记录的目标
+func (p *ConnectionPool) Stats() []ConnectionStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	stats := make([]ConnectionStats, 0, len(p.connections))
+	seen := make(map[string]bool, len(p.connections))
+	add := func(pc *pooledConn) {
+		target := pc.target
+		seen[target] = true
+		stats = append(stats, ConnectionStats{
+			Target:       target,
+			Index:        pc.index,
+			TLS:          pc.tls,
+			State:        pc.conn.GetState().String(),
+			Created:      pc.created,
+			AgeSeconds:   now.Sub(pc.created).Seconds(),
+			Reuses:       pc.reuses.Load(),
+			Active:       pc.active.Load(),
+			Draining:     !pc.retired.IsZero(),
+			DialFailures: p.dialFailures[target],
+			Replaced:     p.replaced[target],
+		})
+	}
+	for _, group := range p.connections {
+		for _, pc := range group.conns {
+			if pc != nil {
+				add(pc)
+			}
+		}
+	}
+	for _, pc := range p.retired {
+		add(pc)
 	}
+	for target, failures := range p.dialFailures {
+		if !seen[target] {
+			stats = append(stats, ConnectionStats{
+				Target:       target,
+				State:        "NONE",
+				DialFailures: failures,
+				Replaced:     p.replaced[target],
+			})
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Target != stats[j].Target {
+			return stats[i].Target < stats[j].Target
+		}
+		if stats[i].Draining != stats[j].Draining {
+			return !stats[i].Draining
+		}
+		return stats[i].Index < stats[j].Index
+	})
+	return stats
+}
+
+// RegisterMetrics 注册按抓取时采集的连接池指标，同一目标的多个连接合并为一个序列
+func (p *ConnectionPool) RegisterMetrics() {
+	metrics.NewGaugeFunc("gateway_upstream_connections",
+		"Pooled upstream connections by target and connectivity state",
+		func(emit metrics.EmitFunc) {
+			counts := make(map[[3]string]float64)
+			for _, s := range p.Stats() {
+				if s.State != "NONE" {
+					counts[[3]string{s.Target, strconv.FormatBool(s.TLS), s.State}]++
+				}
+			}
+			for labels, n := range counts {
+				emit(n, labels[:]...)
+			}
+		}, "target", "tls", "state")
+	metrics.NewGaugeFunc("gateway_upstream_connection_age_seconds",
+		"Age of the oldest pooled connection to each upstream target",
+		func(emit metrics.EmitFunc) {
+			ages := make(map[[2]string]float64)
+			for _, s := range p.Stats() {
+				if s.State != "NONE" {
+					labels := [2]string{s.Target, strconv.FormatBool(s.TLS)}
+					ages[labels] = max(ages[labels], s.AgeSeconds)
+				}
+			}
+			for labels, age := range ages {
+				emit(age, labels[:]...)
+			}
+		}, "target", "tls")
+	metrics.NewCounterFunc("gateway_upstream_connection_reuses_total",
+		"Requests served by an existing pooled connection",
+		func(emit metrics.EmitFunc) {
+			reuses := make(map[[2]string]float64)
+			for _, s := range p.Stats() {
+				if s.State != "NONE" {
+					reuses[[2]string{s.Target, strconv.FormatBool(s.TLS)}] += float64(s.Reuses)
+				}
+			}
+			for labels, n := range reuses {
+				emit(n, labels[:]...)
+			}
+		}, "target", "tls")
+}
+
+// usable 判断连接是否可继续复用
+func usable(state connectivity.State) bool {
+	return state != connectivity.Shutdown && state != connectivity.TransientFailure
 }
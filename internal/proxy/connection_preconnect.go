@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// preconnectService 预先建立连接的服务：到权重最高的前 count 个实例保持已建立的连接
+type preconnectService struct {
+	creds *Credentials
+	tags  []string // 只预先连接带有这些标签的实例
+	count int
+}
+
+// Preconnect 预先建立到服务权重最高的前 count 个实例的连接并立即开始连接，使第一个请求不必等待建立连接与 TLS 握手。
+// 之后监听服务的实例变化，新增的实例同样预先建立连接。count 不大于 0 或未启用注册中心时不做任何事
+func (p *ConnectionPool) Preconnect(ctx context.Context, reg registry.Registry, service string, creds *Credentials, tags []string, count int) error {
+	if reg == nil || count <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.preconnect[service] = preconnectService{creds: creds, tags: tags, count: count}
+	p.mu.Unlock()
+
+	// 先开始监听，使发现之后新增的实例同样被预先连接
+	p.WatchService(reg, service)
+	instances, err := reg.Discover(ctx, service)
+	if err != nil {
+		return err
+	}
+	p.connectInstances(service, instances)
+	return nil
+}
+
+// connectInstances 为预先建立连接的服务建立到前 count 个带有必需标签的可路由实例的连接，已在连接池中的实例保持不变
+func (p *ConnectionPool) connectInstances(service string, instances []*registry.ServiceInstance) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pre, ok := p.preconnect[service]
+	if !ok {
+		return
+	}
+
+	candidates := tagged(routable(instances), pre.tags)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return getWeight(candidates[i]) > getWeight(candidates[j])
+	})
+	for _, instance := range candidates[:min(pre.count, len(candidates))] {
+		target := fmt.Sprintf("%s:%d", instance.Address, instance.Port)
+		key, transport := connKey(target, pre.creds)
+		if _, ok := p.connections[key]; ok {
+			continue
+		}
+		p.logger.Debug("Pre-connecting to upstream instance", "service", service, "target", target)
+		group := p.newTargetConns()
+		p.connections[key] = group
+		p.warm(group, target, pre.creds != nil, transport)
+	}
+}
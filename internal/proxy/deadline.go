@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+var expiredDeadlines = metrics.NewCounterVec(
+	"gateway_deadline_exceeded_total",
+	"gRPC calls answered by the gateway with DEADLINE_EXCEEDED because the deadline passed before the call was forwarded.",
+	"service",
+)
+
+// checkDeadline 调用的截止时间（调用方的 grpc-timeout，不超过服务的 timeout）已过或调用已取消时，
+// 由网关返回 DEADLINE_EXCEEDED 或 CANCELED，不再转发到上游
+func checkDeadline(ctx context.Context, service string) error {
+	return deadlineError(ctx, service, nil)
+}
+
+// deadlineError 转发之前的步骤（发现实例、等待并发名额、建立连接）期间截止时间已过或调用已取消时，
+// 将步骤的错误（如 UNAVAILABLE）替换为 DEADLINE_EXCEEDED 或 CANCELED，否则原样返回 err
+func deadlineError(ctx context.Context, service string, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return err
+	}
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		expiredDeadlines.Inc(service)
+		return status.Errorf(codes.DeadlineExceeded, "deadline exceeded before the call was forwarded to %s", service)
+	}
+	return status.FromContextError(ctxErr).Err()
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptorIndex 由某一版本的 FileDescriptorSet 构建的只读索引，热更新时整体替换
+type descriptorIndex struct {
+	files    *protoregistry.Files
+	messages map[string]protoreflect.MessageDescriptor // 按完整名称索引的消息（含嵌套消息）
+	pools    map[string]*sync.Pool                     // 按完整名称复用的动态消息，随索引一起替换
+	types    *dynamicpb.Types                          // 索引中的消息与扩展类型，用于解析 Any
+}
+
+// buildDescriptorIndex 注册文件集中的所有文件并索引消息
+// 文件可以以任意顺序出现，依赖会在多轮注册中解析；与已注册文件冲突或依赖缺失的文件会被跳过并返回错误，
+// 排在前面的文件优先注册
+func buildDescriptorIndex(fileSet *descriptorpb.FileDescriptorSet) (*descriptorIndex, error) {
+	index := &descriptorIndex{
+		files:    &protoregistry.Files{},
+		messages: make(map[string]protoreflect.MessageDescriptor),
+		pools:    make(map[string]*sync.Pool),
+	}
+
+	pending := fileSet.GetFile()
+	failures := make(map[string]error)
+	for len(pending) > 0 {
+		var retry []*descriptorpb.FileDescriptorProto
+		for _, fileProto := range pending {
+			fd, err := protodesc.NewFile(fileProto, index.files)
+			if err != nil {
+				// 依赖可能尚未注册，下一轮重试
+				failures[fileProto.GetName()] = fmt.Errorf("failed to create file descriptor: %w", err)
+				retry = append(retry, fileProto)
+				continue
+			}
+			if err := index.files.RegisterFile(fd); err != nil {
+				failures[fileProto.GetName()] = fmt.Errorf("failed to register file: %w", err)
+				continue
+			}
+			delete(failures, fileProto.GetName())
+			index.addMessages(fd.Messages())
+		}
+		if len(retry) == len(pending) {
+			break
+		}
+		pending = retry
+	}
+
+	index.types = dynamicpb.NewTypes(index.files)
+
+	var errs []error
+	for name, err := range failures {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return index, errors.Join(errs...)
+}
+
+// addMessages 递归索引消息及其嵌套消息
+func (i *descriptorIndex) addMessages(msgs protoreflect.MessageDescriptors) {
+	for j := 0; j < msgs.Len(); j++ {
+		msg := msgs.Get(j)
+		i.messages[string(msg.FullName())] = msg
+		i.pools[string(msg.FullName())] = &sync.Pool{New: func() any { return dynamicpb.NewMessage(msg) }}
+		i.addMessages(msg.Messages())
+	}
+}
+
+// message 查找消息描述符，兼容描述符中带前导点的类型名（如 .order.CreateOrderRequest）
+func (i *descriptorIndex) message(fullName string) protoreflect.MessageDescriptor {
+	return i.messages[strings.TrimPrefix(fullName, ".")]
+}
+
+// FindMessageByName 实现 protoregistry.MessageTypeResolver，用于编解码 google.protobuf.Any：
+// 先查找索引中的消息，再查找编译进网关的类型
+func (i *descriptorIndex) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	mt, err := i.types.FindMessageByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindMessageByName(name)
+	}
+	return mt, err
+}
+
+// FindMessageByURL 实现 protoregistry.MessageTypeResolver
+func (i *descriptorIndex) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	mt, err := i.types.FindMessageByURL(url)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindMessageByURL(url)
+	}
+	return mt, err
+}
+
+// FindExtensionByName 实现 protoregistry.ExtensionTypeResolver
+func (i *descriptorIndex) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	xt, err := i.types.FindExtensionByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindExtensionByName(name)
+	}
+	return xt, err
+}
+
+// FindExtensionByNumber 实现 protoregistry.ExtensionTypeResolver
+func (i *descriptorIndex) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	xt, err := i.types.FindExtensionByNumber(message, field)
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+	}
+	return xt, err
+}
@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// responseFieldsKey 上下文中选择的响应字段的键
+type responseFieldsKey struct{}
+
+// fieldTreeKey 上下文中按响应类型解析后的字段树的键
+type fieldTreeKey struct{}
+
+// WithResponseFields 限定 JSON 响应只包含选择的字段，字段路径以点分隔（FieldMask 语义：
+// 选择一个消息字段时包含其全部子字段），字段名可以是 protobuf 字段名或 JSON 名。空列表不限定
+func WithResponseFields(ctx context.Context, paths []string) context.Context {
+	if len(paths) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, responseFieldsKey{}, paths)
+}
+
+// fieldTree 解析后的字段路径，值为 nil 表示包含该字段的全部内容
+type fieldTree map[protoreflect.Name]fieldTree
+
+// withFieldTree 按响应类型解析请求选择的字段，存入上下文供写出响应时裁剪；
+// 字段路径不存在时返回 InvalidArgument
+func withFieldTree(ctx context.Context, desc protoreflect.MessageDescriptor) (context.Context, error) {
+	paths, _ := ctx.Value(responseFieldsKey{}).([]string)
+	if len(paths) == 0 || desc == nil {
+		return ctx, nil
+	}
+	tree, err := parseFieldPaths(desc, paths)
+	if err != nil {
+		return ctx, status.Errorf(codes.InvalidArgument, "invalid response fields: %v", err)
+	}
+	return context.WithValue(ctx, fieldTreeKey{}, tree), nil
+}
+
+// parseFieldPaths 按消息描述符解析以点分隔的字段路径
+func parseFieldPaths(desc protoreflect.MessageDescriptor, paths []string) (fieldTree, error) {
+	tree := make(fieldTree)
+	for _, path := range paths {
+		node, msg := tree, desc
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			if msg == nil {
+				return nil, fmt.Errorf("%s: %s is not a message field", path, strings.Join(parts[:i], "."))
+			}
+			field := findFieldDescriptor(msg, part)
+			if field == nil {
+				return nil, fmt.Errorf("%s: no field %s in %s", path, part, msg.FullName())
+			}
+			last := i == len(parts)-1
+			child, seen := node[field.Name()]
+			switch {
+			case seen && child == nil:
+				// 已选择整个字段，更深的路径不再限定
+			case last:
+				node[field.Name()] = nil
+			default:
+				if child == nil {
+					child = make(fieldTree)
+					node[field.Name()] = child
+				}
+			}
+			if last || (seen && child == nil) {
+				break
+			}
+			node = child
+			msg = fieldMessage(field)
+		}
+	}
+	return tree, nil
+}
+
+// findFieldDescriptor 按 protobuf 字段名或 JSON 名查找字段
+func findFieldDescriptor(desc protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if field := desc.Fields().ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return desc.Fields().ByJSONName(name)
+}
+
+// fieldMessage 返回字段（包括重复字段与 map 的值）的消息类型，非消息字段返回 nil
+func fieldMessage(field protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if field.IsMap() {
+		field = field.MapValue()
+	}
+	return field.Message()
+}
+
+// prune 清除消息中未选择的字段
+func (t fieldTree) prune(m protoreflect.Message) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, field)
+		return true
+	})
+	for _, field := range fields {
+		child, ok := t[field.Name()]
+		switch {
+		case !ok:
+			m.Clear(field)
+		case child == nil:
+		case field.IsList():
+			list := m.Mutable(field).List()
+			for i := 0; i < list.Len(); i++ {
+				child.prune(list.Get(i).Message())
+			}
+		case field.IsMap():
+			m.Mutable(field).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				child.prune(v.Message())
+				return true
+			})
+		default:
+			child.prune(m.Mutable(field).Message())
+		}
+	}
+}
+
+// writeResponse 按请求选择的字段裁剪响应消息后编码为 JSON 写入 w
+func (p *HTTPProxy) writeResponse(ctx context.Context, w ResponseWriter, index *descriptorIndex, msg proto.Message) error {
+	if tree, ok := ctx.Value(fieldTreeKey{}).(fieldTree); ok {
+		tree.prune(msg.ProtoReflect())
+	}
+	return p.format.writeJSON(w, index, msg)
+}
+
+// fieldMaskName FieldMask 的消息类型
+const fieldMaskName = "google.protobuf.FieldMask"
+
+// maskFields 返回消息中非重复的 FieldMask 字段
+func maskFields(desc protoreflect.MessageDescriptor) []protoreflect.FieldDescriptor {
+	var masks []protoreflect.FieldDescriptor
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Message() != nil && field.Message().FullName() == fieldMaskName && !field.IsList() && !field.IsMap() {
+			masks = append(masks, field)
+		}
+	}
+	return masks
+}
+
+// maskTarget 返回 FieldMask 路径所针对的消息：请求中除 FieldMask 外只有一个消息字段时
+// 为该字段的类型（如更新请求中的资源），否则为请求消息本身
+func maskTarget(desc protoreflect.MessageDescriptor) protoreflect.MessageDescriptor {
+	var target protoreflect.MessageDescriptor
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Message() == nil || field.IsList() || field.IsMap() || field.Message().FullName() == fieldMaskName {
+			continue
+		}
+		if target != nil {
+			return desc
+		}
+		target = field.Message()
+	}
+	if target == nil {
+		return desc
+	}
+	return target
+}
+
+// validateFieldMasks 按描述符校验请求消息中 FieldMask 字段的路径
+func validateFieldMasks(msg proto.Message) error {
+	m := msg.ProtoReflect()
+	for _, field := range maskFields(m.Descriptor()) {
+		if !m.Has(field) {
+			continue
+		}
+		mask := m.Get(field).Message()
+		list := mask.Get(mask.Descriptor().Fields().ByName("paths")).List()
+		paths := make([]string, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			paths = append(paths, list.Get(i).String())
+		}
+		if _, err := parseFieldPaths(maskTarget(m.Descriptor()), paths); err != nil {
+			return fmt.Errorf("%s: %w", field.Name(), err)
+		}
+	}
+	return nil
+}
+
+// FillFieldMasks sets the FieldMask fields of a unary method's JSON request
+// that the body leaves unset from param, which is looked up by the protobuf
+// and then the JSON name of the field and returns comma-separated paths in
+// snake_case or lowerCamelCase. Other requests are returned unchanged.
+func (p *HTTPProxy) FillFieldMasks(tenant, serviceName, methodName string, jsonBody []byte, param func(name string) string) ([]byte, error) {
+	descriptors := p.schemaFor(tenant)
+	methodDesc := descriptors.loader.FindMethodDescriptor(serviceName, methodName)
+	if methodDesc == nil || methodDesc.GetClientStreaming() {
+		return jsonBody, nil
+	}
+	desc := descriptors.index.Load().message(methodDesc.GetInputType())
+	if desc == nil {
+		return jsonBody, nil
+	}
+
+	var body map[string]json.RawMessage
+	for _, field := range maskFields(desc) {
+		value := param(string(field.Name()))
+		if value == "" {
+			value = param(field.JSONName())
+		}
+		if value == "" {
+			continue
+		}
+		if body == nil {
+			body = make(map[string]json.RawMessage)
+			if len(bytes.TrimSpace(jsonBody)) > 0 {
+				if err := json.Unmarshal(jsonBody, &body); err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, "request body must be a JSON object: %v", err)
+				}
+			}
+		}
+		if _, ok := body[string(field.Name())]; ok {
+			continue
+		}
+		if _, ok := body[field.JSONName()]; ok {
+			continue
+		}
+		paths := strings.Split(value, ",")
+		for i, path := range paths {
+			paths[i] = camelCasePath(strings.TrimSpace(path))
+		}
+		encoded, err := json.Marshal(strings.Join(paths, ","))
+		if err != nil {
+			return nil, err
+		}
+		body[field.JSONName()] = encoded
+	}
+	if body == nil {
+		return jsonBody, nil
+	}
+	return json.Marshal(body)
+}
+
+// camelCasePath 将 snake_case 的字段路径转换为 FieldMask 的 JSON 形式（lowerCamelCase）
+func camelCasePath(path string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range path {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -4,171 +4,277 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"strings"
-	"sync"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	protopkg "github.com/heytom-labs/heytom-gateway/internal/proto"
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
 )
 
 // GRPCProxy gRPC代理
 type GRPCProxy struct {
 	registry    registry.Registry
 	connPool    *ConnectionPool
-	loadBalance LoadBalancer
+	policies    *ServicePolicies
+	protoLoader *protopkg.DescriptorLoader // 用于判断方法的流式类型，可为 nil
+	transports  transports                 // 到 Twirp 上游的连接
+	logger      *slog.Logger
 }
 
 // NewGRPCProxy 创建gRPC代理
-func NewGRPCProxy(reg registry.Registry) *GRPCProxy {
+func NewGRPCProxy(reg registry.Registry, pool *ConnectionPool, policies *ServicePolicies, logger *slog.Logger) *GRPCProxy {
 	return &GRPCProxy{
-		registry:    reg,
-		connPool:    NewConnectionPool(),
-		loadBalance: NewRoundRobinLoadBalancer(),
+		registry: reg,
+		connPool: pool,
+		policies: policies,
+		logger:   logger,
 	}
 }
 
+// SetDescriptorLoader 设置描述符加载器，用于按方法的流式类型创建上游流
+func (p *GRPCProxy) SetDescriptorLoader(loader *protopkg.DescriptorLoader) {
+	p.protoLoader = loader
+}
+
+// streamDesc 按描述符中方法的流式类型构建上游流描述，描述符中没有的方法按双向流转发
+func (p *GRPCProxy) streamDesc(serviceName, methodName string) *grpc.StreamDesc {
+	desc := &grpc.StreamDesc{
+		StreamName:    methodName,
+		ServerStreams: true,
+		ClientStreams: true,
+	}
+	if p.protoLoader == nil {
+		return desc
+	}
+	if method := p.protoLoader.FindMethodDescriptor(serviceName, methodName); method != nil {
+		desc.ServerStreams = method.GetServerStreaming()
+		desc.ClientStreams = method.GetClientStreaming()
+	}
+	return desc
+}
+
 // ProxyStream 代理流式请求
-func (p *GRPCProxy) ProxyStream(ctx context.Context, serviceName, fullMethod string, stream grpc.ServerStream) error {
+func (p *GRPCProxy) ProxyStream(ctx context.Context, serviceName, methodName string, stream grpc.ServerStream) error {
+	// 应用服务策略：限流、超时与并发限制（流式调用的超时覆盖整个流，并发名额在流结束时归还）。
+	// 调用方通过 grpc-timeout 设置的截止时间不超过服务的 timeout；截止时间在转发之前已过时由网关返回 DEADLINE_EXCEEDED
+	policy := p.policies.Get(serviceName)
+	if err := policy.Allow(); err != nil {
+		return err
+	}
+	ctx, cancel := policy.WithTimeout(ctx)
+	defer cancel()
+	if err := checkDeadline(ctx, serviceName); err != nil {
+		return err
+	}
+	release, err := policy.Acquire(ctx)
+	if err != nil {
+		return deadlineError(ctx, serviceName, err)
+	}
+	defer release()
+
 	// 1. 从注册中心发现服务实例
 	instances, err := p.registry.Discover(ctx, serviceName)
 	if err != nil {
-		return status.Errorf(codes.Unavailable, "failed to discover service %s: %v", serviceName, err)
+		return deadlineError(ctx, serviceName, status.Errorf(codes.Unavailable, "failed to discover service %s: %v", serviceName, err))
 	}
 
+	// 只使用租户命名空间内带有必需标签的实例；权重为 0 的实例正在下线，不再接收新请求
+	instances = policy.Eligible(inNamespace(ctx, instances))
 	if len(instances) == 0 {
-		return status.Errorf(codes.Unavailable, "no available instances for service: %s", serviceName)
+		return noInstances(serviceName, policy.Config.RequiredTags)
 	}
 
 	// 2. 负载均衡选择实例
-	instance := p.loadBalance.Select(instances)
+	instance := policy.balancer.Select(instances)
 	if instance == nil {
 		return status.Errorf(codes.Unavailable, "failed to select instance for service: %s", serviceName)
 	}
 
+	fullMethod := "/" + serviceName + "/" + methodName
 	target := fmt.Sprintf("%s:%d", instance.Address, instance.Port)
-	log.Printf("Proxying request to service: %s, method: %s, target: %s", serviceName, fullMethod, target)
+	p.logger.Debug("Proxying gRPC request", "service", serviceName, "method", fullMethod, "target", target)
+	recordInstance(ctx, instance, target)
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.Attempts = 1
+	}
 
-	// 3. 获取或创建到后端服务的连接
-	conn, err := p.connPool.GetConnection(target)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "failed to connect to backend %s: %v", target, err)
+	if policy.Twirp() {
+		return p.proxyTwirp(ctx, policy, baseURL(policy.creds, target), serviceName, methodName, stream)
 	}
 
-	methodNams := strings.Split(fullMethod, "/")
+	// 3. 获取或创建到后端服务的连接（注销实例的连接由服务的实例监听移出连接池）
+	p.connPool.WatchService(p.registry, serviceName)
+	conn, err := p.connPool.connection(ctx, target, policy.creds)
+	if err != nil {
+		return deadlineError(ctx, serviceName, status.Errorf(codes.Unavailable, "failed to connect to backend %s: %v", target, err))
+	}
+	if err := checkDeadline(ctx, serviceName); err != nil {
+		return err
+	}
 
-	// 5. 创建客户端流
-	clientCtx := metadata.NewOutgoingContext(ctx, metadata.MD{})
-	clientStream, err := conn.NewStream(clientCtx, &grpc.StreamDesc{
-		StreamName:    methodNams[1],
-		ServerStreams: true,
-		ClientStreams: true,
-	}, fullMethod)
+	// 4. 按方法的流式类型创建客户端流，转发调用方的元数据；
+	// ctx 派生自调用方的流上下文，调用方的截止时间随之传递到上游
+	clientCtx, cancelStream := context.WithCancel(metadata.NewOutgoingContext(ctx, outgoingMetadata(ctx)))
+	defer cancelStream()
+	opts := append(policy.CallOptions(), grpc.ForceCodec(Codec()))
+	clientStream, err := conn.NewStream(clientCtx, p.streamDesc(serviceName, methodName), fullMethod, opts...)
 	if err != nil {
-		return status.Errorf(codes.Internal, "failed to create client stream: %v", err)
+		return err
 	}
 
-	// 6. 双向转发流数据
+	// 5. 双向转发流数据
 	return p.forwardStream(stream, clientStream)
 }
 
-// forwardStream 双向转发流数据
-func (p *GRPCProxy) forwardStream(serverStream grpc.ServerStream, clientStream grpc.ClientStream) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, 2)
+// proxyTwirp 将一元调用转发到 Twirp 上游：消息按原始 protobuf 字节收发，元数据作为请求头转发
+func (p *GRPCProxy) proxyTwirp(ctx context.Context, policy *ServicePolicy, url, serviceName, methodName string, stream grpc.ServerStream) error {
+	// Twirp 只支持一元方法；描述符中没有的方法按一元转发
+	if p.protoLoader != nil {
+		if method := p.protoLoader.FindMethodDescriptor(serviceName, methodName); method != nil && (method.GetClientStreaming() || method.GetServerStreaming()) {
+			return status.Errorf(codes.Unimplemented, "streaming method /%s/%s is not supported by Twirp backends", serviceName, methodName)
+		}
+	}
+
+	request := &Frame{}
+	if err := stream.RecvMsg(request); err != nil {
+		if err == io.EOF {
+			return status.Errorf(codes.InvalidArgument, "missing request message")
+		}
+		return err
+	}
+	response, err := twirp.Invoke(ctx, p.transports.get(policy.creds), url, serviceName, methodName, outgoingMetadata(ctx), request.Payload)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(&Frame{Payload: response})
+}
+
+// hopByHopMetadata 只在单跳连接上有意义、不转发到上游的元数据
+var hopByHopMetadata = map[string]bool{
+	"connection":        true,
+	"content-type":      true,
+	"host":              true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"te":                true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+	"user-agent":        true,
+}
+
+// outgoingMetadata 合并调用方的元数据（去掉伪头、grpc- 保留头与逐跳头）与网关添加的元数据。
+// 网关添加的键（授权返回的头部、路由规则、插件与身份元数据等）替换调用方的同名元数据，调用方无法伪造这些值
+func outgoingMetadata(ctx context.Context) metadata.MD {
+	md := metadata.MD{}
+	if incoming, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range incoming {
+			if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || hopByHopMetadata[key] {
+				continue
+			}
+			md[key] = append([]string(nil), values...)
+		}
+	}
+	if outgoing, ok := metadata.FromOutgoingContext(ctx); ok {
+		for key, values := range outgoing {
+			md[key] = append([]string(nil), values...)
+		}
+	}
+	return md
+}
+
+// SetOutgoingMetadata 设置转发到上游的元数据，替换上下文中已有的同名元数据（如外部授权返回的头部，
+// 调用方或之前的中间件设置的同名值不会与其一同转发）
+func SetOutgoingMetadata(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for key, value := range headers {
+		md.Set(key, value)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
 
-	// 服务端 -> 客户端
-	wg.Add(1)
+// forwardStream 双向转发流数据，并将上游的头部、尾部元数据与最终状态返回给调用方
+func (p *GRPCProxy) forwardStream(serverStream grpc.ServerStream, clientStream grpc.ClientStream) error {
+	// 调用方 -> 上游
+	sendErr := make(chan error, 1)
 	go func() {
-		defer wg.Done()
 		for {
-			// 从服务端接收消息
-			msg := &DynamicMessage{}
+			msg := &Frame{}
 			if err := serverStream.RecvMsg(msg); err != nil {
 				if err == io.EOF {
+					// 调用方发送完毕，结束上游的发送方向
 					clientStream.CloseSend()
+					sendErr <- nil
 					return
 				}
-				errChan <- fmt.Errorf("server recv error: %w", err)
+				sendErr <- err
 				return
 			}
-
-			// 发送到客户端
 			if err := clientStream.SendMsg(msg); err != nil {
-				errChan <- fmt.Errorf("client send error: %w", err)
+				// io.EOF 表示上游已结束流，实际状态由接收方向返回
+				if err == io.EOF {
+					sendErr <- nil
+					return
+				}
+				sendErr <- err
 				return
 			}
 		}
 	}()
 
-	// 客户端 -> 服务端
-	wg.Add(1)
+	// 上游 -> 调用方
+	recvErr := make(chan error, 1)
 	go func() {
-		defer wg.Done()
-		for {
-			// 从客户端接收消息
-			msg := &DynamicMessage{}
-			if err := clientStream.RecvMsg(msg); err != nil {
+		for i := 0; ; i++ {
+			msg := &Frame{}
+			err := clientStream.RecvMsg(msg)
+			if i == 0 {
+				// 头部元数据在第一条消息（或流结束）之前到达
+				if header, herr := clientStream.Header(); herr == nil && len(header) > 0 {
+					if err := serverStream.SendHeader(header); err != nil {
+						recvErr <- err
+						return
+					}
+				}
+			}
+			if err != nil {
+				serverStream.SetTrailer(clientStream.Trailer())
 				if err == io.EOF {
+					recvErr <- nil
 					return
 				}
-				errChan <- fmt.Errorf("client recv error: %w", err)
+				// 上游返回的状态原样返回给调用方
+				recvErr <- err
 				return
 			}
-
-			// 发送到服务端
 			if err := serverStream.SendMsg(msg); err != nil {
-				errChan <- fmt.Errorf("server send error: %w", err)
+				recvErr <- err
 				return
 			}
 		}
 	}()
 
-	// 等待转发完成或出错
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	// 返回第一个错误
-	for err := range errChan {
-		if err != nil {
+	for {
+		select {
+		case err := <-sendErr:
+			if err != nil {
+				// 调用方出错或取消，上游流随 ProxyStream 返回时取消
+				return status.Errorf(codes.Canceled, "caller stream failed: %v", err)
+			}
+			// 调用方发送完毕，继续等待上游的响应
+			sendErr = nil
+		case err := <-recvErr:
 			return err
 		}
 	}
-
-	return nil
-}
-
-// DynamicMessage 动态消息类型，用于转发任意protobuf消息
-type DynamicMessage struct {
-	data []byte
-}
-
-// Reset 实现 proto.Message 接口
-func (m *DynamicMessage) Reset() {
-	m.data = nil
-}
-
-// String 实现 proto.Message 接口
-func (m *DynamicMessage) String() string {
-	return string(m.data)
-}
-
-// ProtoMessage 实现 proto.Message 接口
-func (m *DynamicMessage) ProtoMessage() {}
-
-// Marshal 序列化
-func (m *DynamicMessage) Marshal() ([]byte, error) {
-	return m.data, nil
-}
-
-// Unmarshal 反序列化
-func (m *DynamicMessage) Unmarshal(data []byte) error {
-	m.data = data
-	return nil
 }
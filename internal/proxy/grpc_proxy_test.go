@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestOutgoingMetadataReplacesCallerValues(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-user-id", "forged",
+		"x-request-id", "r-1",
+		":authority", "gateway",
+		"user-agent", "client",
+	))
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-user-id", "42")
+
+	md := outgoingMetadata(ctx)
+	if got := md.Get("x-user-id"); !slices.Equal(got, []string{"42"}) {
+		t.Errorf("x-user-id = %q, want the gateway's value only", got)
+	}
+	if got := md.Get("x-request-id"); !slices.Equal(got, []string{"r-1"}) {
+		t.Errorf("x-request-id = %q, want the caller's value", got)
+	}
+	for _, key := range []string{":authority", "user-agent"} {
+		if _, ok := md[key]; ok {
+			t.Errorf("%s is forwarded", key)
+		}
+	}
+}
+
+func TestOutgoingMetadataKeepsMultipleGatewayValues(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-role", "forged"))
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-role", "reader", "x-role", "writer")
+
+	if got := outgoingMetadata(ctx).Get("x-role"); !slices.Equal(got, []string{"reader", "writer"}) {
+		t.Errorf("x-role = %q, want the gateway's values", got)
+	}
+}
+
+func TestSetOutgoingMetadataOverridesPresetValues(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "forged"))
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-user-id", "plugin", "x-trace", "t-1")
+	ctx = SetOutgoingMetadata(ctx, map[string]string{"X-User-Id": "42"})
+
+	md := outgoingMetadata(ctx)
+	if got := md.Get("x-user-id"); !slices.Equal(got, []string{"42"}) {
+		t.Errorf("x-user-id = %q, want the authorization value only", got)
+	}
+	if got := md.Get("x-trace"); !slices.Equal(got, []string{"t-1"}) {
+		t.Errorf("x-trace = %q, want the metadata set before", got)
+	}
+}
@@ -1,202 +1,579 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"sync"
+	"io"
+	"log/slog"
+	"sync/atomic"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
-	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
-	"google.golang.org/protobuf/types/dynamicpb"
 
+	"github.com/heytom-labs/heytom-gateway/internal/config"
 	protopkg "github.com/heytom-labs/heytom-gateway/internal/proto"
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
 )
 
 // HTTPProxy HTTP to gRPC proxy
 type HTTPProxy struct {
-	protoLoader  *protopkg.DescriptorLoader
-	registry     registry.Registry
-	connPool     *ConnectionPool
-	loadBalance  LoadBalancer
-	fileResolver *protoregistry.Files
-	msgCache     map[string]proto.Message // Message cache
-	msgCacheMu   sync.RWMutex             // Message cache lock
+	protoLoader *protopkg.DescriptorLoader
+	registry    registry.Registry
+	connPool    *ConnectionPool
+	policies    *ServicePolicies
+	schema      *schema            // Shared descriptors
+	tenants     map[string]*schema // Descriptors of tenants with their own schema
+	transports  transports         // Connections to Twirp backends
+	format      *jsonFormat        // JSON representation of requests and responses
+	logger      *slog.Logger
+}
+
+// schema 一组描述符及其消息注册表
+type schema struct {
+	loader *protopkg.DescriptorLoader
+	index  atomic.Pointer[descriptorIndex] // Descriptors of the current protoset version
+}
+
+// newSchema 注册加载器中所有 protobuf 文件描述符
+func newSchema(loader *protopkg.DescriptorLoader) (*schema, error) {
+	index, err := buildDescriptorIndex(loader.GetFileDescriptorSet())
+	if err != nil {
+		return nil, err
+	}
+	s := &schema{loader: loader}
+	s.index.Store(index)
+	return s, nil
+}
+
+// rebuild 重建消息注册表并原子替换；有文件无法注册时保留当前的注册表并返回错误
+func (s *schema) rebuild() error {
+	index, err := buildDescriptorIndex(s.loader.GetFileDescriptorSet())
+	if err != nil {
+		return err
+	}
+	s.index.Store(index)
+	return nil
 }
 
 // NewHTTPProxy 创建 HTTP 代理
-func NewHTTPProxy(protoLoader *protopkg.DescriptorLoader, reg registry.Registry) (*HTTPProxy, error) {
-	// 初始化文件注册表
-	fileResolver := &protoregistry.Files{}
+func NewHTTPProxy(protoLoader *protopkg.DescriptorLoader, reg registry.Registry, pool *ConnectionPool, policies *ServicePolicies, logger *slog.Logger) (*HTTPProxy, error) {
+	shared, err := newSchema(protoLoader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPProxy{
+		protoLoader: protoLoader,
+		registry:    reg,
+		connPool:    pool,
+		policies:    policies,
+		schema:      shared,
+		tenants:     make(map[string]*schema),
+		format:      defaultJSONFormat,
+		logger:      logger,
+	}, nil
+}
 
-	// 注册所有 protobuf 文件描述符
-	for _, fileProto := range protoLoader.GetFileDescriptorSet().File {
-		fd, err := protodesc.NewFile(fileProto, fileResolver)
+// SetTenants 设置各租户的描述符，请求按租户解析方法与消息，未配置的租户使用共享描述符
+func (p *HTTPProxy) SetTenants(tenants *protopkg.Tenants) error {
+	for _, name := range tenants.Names() {
+		s, err := newSchema(tenants.Get(name))
 		if err != nil {
-			return nil, fmt.Errorf("failed to create file descriptor: %w", err)
-		}
-		if err := fileResolver.RegisterFile(fd); err != nil {
-			return nil, fmt.Errorf("failed to register file: %w", err)
+			return fmt.Errorf("tenant %s: %w", name, err)
 		}
+		p.tenants[name] = s
 	}
+	return nil
+}
 
-	return &HTTPProxy{
-		protoLoader:  protoLoader,
-		registry:     reg,
-		connPool:     NewConnectionPool(),
-		loadBalance:  NewRoundRobinLoadBalancer(),
-		fileResolver: fileResolver,
-		msgCache:     make(map[string]proto.Message),
-	}, nil
+// SetJSONFormat 设置 JSON 请求与响应中时间戳、时长、64 位整数等类型的表示
+func (p *HTTPProxy) SetJSONFormat(cfg config.JSONConfig) error {
+	format, err := newJSONFormat(cfg)
+	if err != nil {
+		return err
+	}
+	p.format = format
+	return nil
+}
+
+// schemaFor 返回租户使用的描述符
+func (p *HTTPProxy) schemaFor(tenant string) *schema {
+	if s, ok := p.tenants[tenant]; ok {
+		return s
+	}
+	return p.schema
+}
+
+// Loader 返回租户使用的描述符加载器，未配置的租户使用共享描述符
+func (p *HTTPProxy) Loader(tenant string) *protopkg.DescriptorLoader {
+	return p.schemaFor(tenant).loader
+}
+
+// ProxyHTTPRequest 代理 HTTP 请求到 gRPC，方法与消息按租户的描述符解析
+func (p *HTTPProxy) ProxyHTTPRequest(ctx context.Context, tenant, serviceName, methodName string, jsonBody []byte) ([]byte, error) {
+	var out bufferWriter
+	if err := p.ProxyHTTPResponse(ctx, tenant, serviceName, methodName, jsonBody, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
 
-// ProxyHTTPRequest 代理 HTTP 请求到 gRPC
-func (p *HTTPProxy) ProxyHTTPRequest(ctx context.Context, serviceName, methodName string, jsonBody []byte) ([]byte, error) {
+// ProxyHTTPResponse 与 ProxyHTTPRequest 相同，但 JSON 响应写入 w 而不是作为结果返回：
+// 服务端流式方法的响应消息收到后立即编码写出，不必等待流结束。
+// 出错时 w 中可能已写出部分响应，w 无法撤回已写出的内容时不再重试
+func (p *HTTPProxy) ProxyHTTPResponse(ctx context.Context, tenant, serviceName, methodName string, jsonBody []byte, w ResponseWriter) error {
 	// 1. 查找方法描述符
-	methodDesc := p.protoLoader.FindMethodDescriptor(serviceName, methodName)
+	descriptors := p.schemaFor(tenant)
+	index := descriptors.index.Load()
+	methodDesc := descriptors.loader.FindMethodDescriptor(serviceName, methodName)
 	if methodDesc == nil {
-		return nil, status.Errorf(codes.NotFound, "method not found: %s/%s", serviceName, methodName)
+		return status.Errorf(codes.NotFound, "method not found: %s/%s", serviceName, methodName)
 	}
 
 	// 2. 获取输入消息的完整名称
 	inputType := methodDesc.GetInputType()
 	if inputType == "" {
-		return nil, status.Errorf(codes.Internal, "method input type not specified")
+		return status.Errorf(codes.Internal, "method input type not specified")
 	}
 
-	// 3. 从 JSON 创建请求消息
-	requestMsg, err := p.jsonToProtobuf(jsonBody, inputType)
+	// 3. 解析请求选择的响应字段
+	ctx, err := withFieldTree(ctx, index.message(methodDesc.GetOutputType()))
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "failed to unmarshal request: %v", err)
+		return err
 	}
 
-	// 4. 从注册中心发现服务实例
+	// 4. 从 JSON 创建请求消息，客户端流式方法的请求体为消息数组
+	requests, err := p.parseRequests(index, jsonBody, inputType, methodDesc.GetClientStreaming(), p.format.lenient(serviceName, methodName))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to unmarshal request: %v", err)
+	}
+	defer index.releaseMessages(requests...)
+	for _, request := range requests {
+		if err := validateFieldMasks(request); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid field mask: %v", err)
+		}
+	}
+
+	// 5. 按方法的流式类型调用 gRPC 方法
+	fullMethod := "/" + serviceName + "/" + methodName
+	return p.withPolicy(ctx, serviceName, methodName, w, func(ctx context.Context, policy *ServicePolicy) error {
+		return p.invokeInstance(ctx, policy, index, serviceName, fullMethod, requests, methodDesc, w)
+	})
+}
+
+// ProxyProtobuf 代理 protobuf 编码的一元请求：请求体原样转发到上游，上游响应不经解码原样返回，
+// 不构建动态消息。方法按租户的描述符查找，流式方法不支持 protobuf 请求体
+func (p *HTTPProxy) ProxyProtobuf(ctx context.Context, tenant, serviceName, methodName string, payload []byte) ([]byte, error) {
+	methodDesc := p.schemaFor(tenant).loader.FindMethodDescriptor(serviceName, methodName)
+	if methodDesc == nil {
+		return nil, status.Errorf(codes.NotFound, "method not found: %s/%s", serviceName, methodName)
+	}
+	if methodDesc.GetClientStreaming() || methodDesc.GetServerStreaming() {
+		return nil, status.Errorf(codes.Unimplemented, "streaming method %s/%s does not support protobuf bodies", serviceName, methodName)
+	}
+
+	var response []byte
+	err := p.withPolicy(ctx, serviceName, methodName, nil, func(ctx context.Context, policy *ServicePolicy) (err error) {
+		response, err = p.invokeRaw(ctx, policy, serviceName, methodName, payload)
+		return err
+	})
+	return response, err
+}
+
+// withPolicy 应用服务策略：限流、超时与并发限制，并按重试策略调用 invoke，重试期间占用同一个并发名额。
+// invoke 向 w 写出了响应时，重试前丢弃已写出的内容，内容已发送给客户端时不再重试。
+// 服务配置了重试时，每次尝试的序号与上一次失败的状态码随元数据发送给上游
+func (p *HTTPProxy) withPolicy(ctx context.Context, serviceName, methodName string, w ResponseWriter, invoke func(ctx context.Context, policy *ServicePolicy) error) error {
+	policy := p.policies.Get(serviceName)
+	if err := policy.Allow(); err != nil {
+		return err
+	}
+	ctx, cancel := policy.WithTimeout(ctx)
+	defer cancel()
+	release, err := policy.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.Attempts(); attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, policy.Backoff(attempt-1)); err != nil {
+				break
+			}
+			p.logger.Debug("Retrying HTTP request", "service", serviceName, "method", methodName, "attempt", attempt, "error", lastErr)
+		}
+
+		recordAttempt(ctx, policy, attempt)
+		err := invoke(withAttemptMetadata(ctx, policy, attempt, lastErr), policy)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !policy.Retryable(err) || (w != nil && !w.Reset()) {
+			break
+		}
+	}
+	return lastErr
+}
+
+// selectInstance 从注册中心发现服务实例并按负载均衡策略选择一个，返回其地址
+func (p *HTTPProxy) selectInstance(ctx context.Context, policy *ServicePolicy, serviceName, fullMethod string) (string, error) {
 	instances, err := p.registry.Discover(ctx, serviceName)
 	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "failed to discover service %s: %v", serviceName, err)
+		return "", status.Errorf(codes.Unavailable, "failed to discover service %s: %v", serviceName, err)
 	}
 
+	// 只使用租户命名空间内带有必需标签的实例；权重为 0 的实例正在下线，不再接收新请求
+	instances = policy.Eligible(inNamespace(ctx, instances))
 	if len(instances) == 0 {
-		return nil, status.Errorf(codes.Unavailable, "no available instances for service: %s", serviceName)
+		return "", noInstances(serviceName, policy.Config.RequiredTags)
 	}
 
-	// 5. 负载均衡选择实例
-	instance := p.loadBalance.Select(instances)
+	instance := policy.balancer.Select(instances)
 	if instance == nil {
-		return nil, status.Errorf(codes.Unavailable, "failed to select instance for service: %s", serviceName)
+		return "", status.Errorf(codes.Unavailable, "failed to select instance for service: %s", serviceName)
 	}
 
 	target := fmt.Sprintf("%s:%d", instance.Address, instance.Port)
-	log.Printf("Proxying HTTP request to service: %s, method: %s, target: %s", serviceName, methodName, target)
+	p.logger.Debug("Proxying HTTP request", "method", fullMethod, "target", target)
+	recordInstance(ctx, instance, target)
+	return target, nil
+}
 
-	// 6. 获取或创建连接
-	conn, err := p.connPool.GetConnection(target)
+// invokeInstance 选择一个服务实例并调用
+func (p *HTTPProxy) invokeInstance(ctx context.Context, policy *ServicePolicy, index *descriptorIndex, serviceName, fullMethod string, requests []proto.Message, methodDesc *descriptorpb.MethodDescriptorProto, w ResponseWriter) error {
+	target, err := p.selectInstance(ctx, policy, serviceName, fullMethod)
 	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "failed to connect to backend %s: %v", target, err)
+		return err
+	}
+
+	if policy.Twirp() {
+		if methodDesc.GetClientStreaming() || methodDesc.GetServerStreaming() {
+			return status.Errorf(codes.Unimplemented, "streaming method %s is not supported by Twirp backends", fullMethod)
+		}
+		return p.invokeTwirp(ctx, policy, index, baseURL(policy.creds, target), serviceName, requests[0], methodDesc, w)
+	}
+
+	// 获取或创建连接（注销实例的连接由服务的实例监听移出连接池）
+	p.connPool.WatchService(p.registry, serviceName)
+	conn, err := p.connPool.connection(ctx, target, policy.creds)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to connect to backend %s: %v", target, err)
 	}
 
-	// 7. 调用 gRPC 方法（一元 RPC）
+	if methodDesc.GetClientStreaming() || methodDesc.GetServerStreaming() {
+		return p.invokeStream(ctx, conn, index, fullMethod, requests, methodDesc, w, policy.CallOptions()...)
+	}
+	return p.invokeUnary(ctx, conn, index, fullMethod, requests[0], methodDesc, w, policy.CallOptions()...)
+}
+
+// invokeRaw 选择一个服务实例，以透传编解码器发送未解码的请求消息并返回未解码的响应消息
+func (p *HTTPProxy) invokeRaw(ctx context.Context, policy *ServicePolicy, serviceName, methodName string, payload []byte) ([]byte, error) {
 	fullMethod := "/" + serviceName + "/" + methodName
-	return p.invokeUnary(ctx, conn, fullMethod, requestMsg, methodDesc)
+	target, err := p.selectInstance(ctx, policy, serviceName, fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if policy.Twirp() {
+		return twirp.Invoke(ctx, p.transports.get(policy.creds), baseURL(policy.creds, target), serviceName, methodName, md, payload)
+	}
+
+	p.connPool.WatchService(p.registry, serviceName)
+	conn, err := p.connPool.connection(ctx, target, policy.creds)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to connect to backend %s: %v", target, err)
+	}
+
+	response := &Frame{}
+	clientCtx := metadata.NewOutgoingContext(ctx, md.Copy())
+	opts := append(policy.CallOptions(), grpc.ForceCodec(Codec()))
+	if err := conn.Invoke(clientCtx, fullMethod, &Frame{Payload: payload}, response, opts...); err != nil {
+		return nil, err
+	}
+	return response.Payload, nil
 }
 
-// invokeUnary 调用一元 RPC
-func (p *HTTPProxy) invokeUnary(ctx context.Context, conn *grpc.ClientConn, fullMethod string, requestMsg proto.Message, methodDesc *descriptorpb.MethodDescriptorProto) ([]byte, error) {
+// invokeUnary 调用一元 RPC，响应编码为 JSON 写入 w
+func (p *HTTPProxy) invokeUnary(ctx context.Context, conn *grpc.ClientConn, index *descriptorIndex, fullMethod string, requestMsg proto.Message, methodDesc *descriptorpb.MethodDescriptorProto, w ResponseWriter, opts ...grpc.CallOption) error {
 	outputType := methodDesc.GetOutputType()
 	if outputType == "" {
-		return nil, status.Errorf(codes.Internal, "method output type not specified")
+		return status.Errorf(codes.Internal, "method output type not specified")
 	}
 
 	// 创建响应消息
-	responseMsg, err := p.createDynamicMessage(outputType)
+	responseMsg, err := p.createDynamicMessage(index, outputType)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create response message: %v", err)
+		return status.Errorf(codes.Internal, "failed to create response message: %v", err)
 	}
+	defer index.releaseMessages(responseMsg)
 
 	// 执行 RPC
-	clientCtx := metadata.NewOutgoingContext(ctx, metadata.MD{})
-	err = conn.Invoke(clientCtx, fullMethod, requestMsg, responseMsg)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	clientCtx := metadata.NewOutgoingContext(ctx, md.Copy())
+	err = conn.Invoke(clientCtx, fullMethod, requestMsg, responseMsg, opts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// 将响应转换为 JSON
-	return protojson.Marshal(responseMsg)
+	return p.writeResponse(ctx, w, index, responseMsg)
+}
+
+// invokeTwirp 以 protobuf 编码调用 Twirp 上游的一元方法
+func (p *HTTPProxy) invokeTwirp(ctx context.Context, policy *ServicePolicy, index *descriptorIndex, url, serviceName string, requestMsg proto.Message, methodDesc *descriptorpb.MethodDescriptorProto, w ResponseWriter) error {
+	responseMsg, err := p.createDynamicMessage(index, methodDesc.GetOutputType())
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create response message: %v", err)
+	}
+	defer index.releaseMessages(responseMsg)
+	payload, err := proto.Marshal(requestMsg)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode request: %v", err)
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	data, err := twirp.Invoke(ctx, p.transports.get(policy.creds), url, serviceName, methodDesc.GetName(), md, payload)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(data, responseMsg); err != nil {
+		return status.Errorf(codes.Internal, "failed to decode Twirp response: %v", err)
+	}
+	return p.writeResponse(ctx, w, index, responseMsg)
+}
+
+// invokeStream 调用流式 RPC：发送全部请求消息后接收所有响应，
+// 服务端流式方法的响应为 JSON 数组，每条响应消息收到后立即写入 w 并 Flush；客户端流式方法的响应为单个 JSON 对象
+func (p *HTTPProxy) invokeStream(ctx context.Context, conn *grpc.ClientConn, index *descriptorIndex, fullMethod string, requests []proto.Message, methodDesc *descriptorpb.MethodDescriptorProto, w ResponseWriter, opts ...grpc.CallOption) error {
+	outputType := methodDesc.GetOutputType()
+	if outputType == "" {
+		return status.Errorf(codes.Internal, "method output type not specified")
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	clientCtx := metadata.NewOutgoingContext(ctx, md.Copy())
+	stream, err := conn.NewStream(clientCtx, &grpc.StreamDesc{
+		StreamName:    methodDesc.GetName(),
+		ServerStreams: methodDesc.GetServerStreaming(),
+		ClientStreams: methodDesc.GetClientStreaming(),
+	}, fullMethod, opts...)
+	if err != nil {
+		return err
+	}
+
+	// 发送请求消息，io.EOF 表示服务端已结束流，实际状态由 RecvMsg 返回
+	for _, requestMsg := range requests {
+		if err := stream.SendMsg(requestMsg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	// 接收响应消息，服务端流式方法的响应依次编码为 JSON 数组的元素
+	received := 0
+	for {
+		responseMsg, err := p.createDynamicMessage(index, outputType)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to create response message: %v", err)
+		}
+		if err := stream.RecvMsg(responseMsg); err != nil {
+			index.releaseMessages(responseMsg)
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if !methodDesc.GetServerStreaming() {
+			defer index.releaseMessages(responseMsg)
+			return p.writeResponse(ctx, w, index, responseMsg)
+		}
+		separator := []byte{','}
+		if received == 0 {
+			separator[0] = '['
+		}
+		received++
+		if _, err := w.Write(separator); err != nil {
+			index.releaseMessages(responseMsg)
+			return err
+		}
+		err = p.writeResponse(ctx, w, index, responseMsg)
+		index.releaseMessages(responseMsg)
+		if err != nil {
+			return err
+		}
+		w.Flush()
+	}
+	if received == 0 {
+		_, err = w.Write([]byte("[]"))
+		return err
+	}
+	_, err = w.Write([]byte{']'})
+	return err
+}
+
+// parseRequests 解析请求消息；客户端流式方法的请求体可以是消息数组（每个元素为一条消息）或单个消息。
+// lenient 时先按描述符改写不规范的请求
+func (p *HTTPProxy) parseRequests(index *descriptorIndex, jsonBody []byte, messageType string, clientStreaming, lenient bool) ([]proto.Message, error) {
+	parse := func(data []byte) (proto.Message, error) {
+		if lenient && index.message(messageType) != nil && len(bytes.TrimSpace(data)) > 0 {
+			relaxed, err := relax(index.message(messageType), data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+			}
+			data = relaxed
+		}
+		return p.jsonToProtobuf(index, data, messageType)
+	}
+	trimmed := bytes.TrimSpace(jsonBody)
+	if !clientStreaming || len(trimmed) == 0 || trimmed[0] != '[' {
+		msg, err := parse(jsonBody)
+		if err != nil {
+			return nil, err
+		}
+		return []proto.Message{msg}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON array: %w", err)
+	}
+	requests := make([]proto.Message, 0, len(items))
+	for i, item := range items {
+		msg, err := parse(item)
+		if err != nil {
+			index.releaseMessages(requests...)
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		requests = append(requests, msg)
+	}
+	return requests, nil
 }
 
 // jsonToProtobuf 将 JSON 转换为 Protobuf 消息
-func (p *HTTPProxy) jsonToProtobuf(jsonData []byte, messageType string) (proto.Message, error) {
-	msg, err := p.createDynamicMessage(messageType)
+func (p *HTTPProxy) jsonToProtobuf(index *descriptorIndex, jsonData []byte, messageType string) (proto.Message, error) {
+	msg, err := p.createDynamicMessage(index, messageType)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := protojson.Unmarshal(jsonData, msg); err != nil {
+	if err := p.format.unmarshal(jsonData, index, msg); err != nil {
+		index.releaseMessages(msg)
 		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
 
 	return msg, nil
 }
 
-// createDynamicMessage creates dynamic message from message type name
-func (p *HTTPProxy) createDynamicMessage(messageType string) (proto.Message, error) {
-	// Check cache
-	p.msgCacheMu.RLock()
-	if cached, ok := p.msgCache[messageType]; ok {
-		p.msgCacheMu.RUnlock()
-		// Return a new instance
-		return proto.Clone(cached), nil
+// createDynamicMessage takes an empty dynamic message of the type from the
+// index's pool; callers release it with index.releaseMessages once done
+func (p *HTTPProxy) createDynamicMessage(index *descriptorIndex, messageType string) (proto.Message, error) {
+	msg := index.newMessage(messageType)
+	if msg == nil {
+		return nil, fmt.Errorf("message descriptor not found: %s", messageType)
 	}
-	p.msgCacheMu.RUnlock()
+	return msg, nil
+}
 
-	// Find full MessageDescriptor from registered files
-	msgFullDesc := p.findFullMessageDescriptor(messageType)
-	if msgFullDesc == nil {
-		return nil, fmt.Errorf("message descriptor not found: %s", messageType)
+// EncodeMessage validates a JSON body against a message type of the tenant's
+// descriptors and returns it encoded as protobuf (for publishing to a message queue)
+func (p *HTTPProxy) EncodeMessage(tenant, messageType string, jsonBody []byte) ([]byte, error) {
+	index := p.schemaFor(tenant).index.Load()
+	if index.message(messageType) == nil {
+		return nil, status.Errorf(codes.NotFound, "message type not found: %s", messageType)
+	}
+	msg, err := p.jsonToProtobuf(index, jsonBody, messageType)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid message: %v", err)
+	}
+	defer index.releaseMessages(msg)
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode message: %v", err)
 	}
+	return data, nil
+}
 
-	// Create dynamic message
-	msg := dynamicpb.NewMessage(msgFullDesc)
-	p.msgCacheMu.Lock()
-	p.msgCache[messageType] = msg
-	p.msgCacheMu.Unlock()
+// DecodeRequest converts a protobuf-encoded request of a unary method into
+// JSON, for clients sending protobuf bodies that middleware must inspect
+func (p *HTTPProxy) DecodeRequest(tenant, serviceName, methodName string, data []byte) ([]byte, error) {
+	return p.convert(tenant, serviceName, methodName, data, true)
+}
 
-	return msg, nil
+// EncodeResponse converts the JSON response of a unary method into protobuf,
+// for clients sending protobuf bodies that middleware must inspect
+func (p *HTTPProxy) EncodeResponse(tenant, serviceName, methodName string, jsonBody []byte) ([]byte, error) {
+	return p.convert(tenant, serviceName, methodName, jsonBody, false)
 }
 
-// findFullMessageDescriptor finds the full message descriptor from the registry
-func (p *HTTPProxy) findFullMessageDescriptor(fullName string) protoreflect.MessageDescriptor {
-	// Iterate through all file descriptors to find the matching message
-	for _, fileProto := range p.protoLoader.GetFileDescriptorSet().File {
-		fd, err := protodesc.NewFile(fileProto, p.fileResolver)
+// convert converts the request (protobuf to JSON) or the response (JSON to
+// protobuf) of a unary method using the tenant's descriptors
+func (p *HTTPProxy) convert(tenant, serviceName, methodName string, data []byte, request bool) ([]byte, error) {
+	descriptors := p.schemaFor(tenant)
+	methodDesc := descriptors.loader.FindMethodDescriptor(serviceName, methodName)
+	if methodDesc == nil {
+		return nil, status.Errorf(codes.NotFound, "method not found: %s/%s", serviceName, methodName)
+	}
+	if methodDesc.GetClientStreaming() || methodDesc.GetServerStreaming() {
+		return nil, status.Errorf(codes.Unimplemented, "streaming method %s/%s does not support protobuf bodies", serviceName, methodName)
+	}
+
+	index := descriptors.index.Load()
+	if request {
+		msg, err := p.createDynamicMessage(index, methodDesc.GetInputType())
 		if err != nil {
-			continue
+			return nil, status.Errorf(codes.Internal, "failed to create request message: %v", err)
 		}
-
-		// Search in messages
-		msgs := fd.Messages()
-		for i := 0; i < msgs.Len(); i++ {
-			msg := msgs.Get(i)
-			if string(msg.FullName()) == fullName {
-				return msg // Return the message descriptor directly
-			}
+		defer index.releaseMessages(msg)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to unmarshal request: %v", err)
 		}
+		return p.format.marshalJSON(index, msg)
+	}
+	msg, err := p.jsonToProtobuf(index, data, methodDesc.GetOutputType())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid response: %v", err)
+	}
+	defer index.releaseMessages(msg)
+	return proto.Marshal(msg)
+}
+
+// CheckDescriptors reports an error when no protobuf descriptors are loaded
+func (p *HTTPProxy) CheckDescriptors() error {
+	if p.protoLoader.FileCount() == 0 {
+		return fmt.Errorf("no protoset descriptors loaded")
 	}
 	return nil
 }
 
-// ClearMessageCache clears the message cache (for hot reload)
-func (p *HTTPProxy) ClearMessageCache() {
-	p.msgCacheMu.Lock()
-	defer p.msgCacheMu.Unlock()
-	p.msgCache = make(map[string]proto.Message)
+// RebuildDescriptors rebuilds the message registries of the shared and tenant
+// descriptors from the currently loaded protosets and swaps them in atomically
+// (for hot reload). In-flight requests keep using the descriptors they started
+// with. A registry in which some files fail to register is not swapped in: the
+// previous one keeps serving and the failure is returned. The loader already
+// refuses such protosets, so this only guards against inconsistent descriptors.
+func (p *HTTPProxy) RebuildDescriptors() error {
+	errs := []error{p.schema.rebuild()}
+	for name, s := range p.tenants {
+		if err := s.rebuild(); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
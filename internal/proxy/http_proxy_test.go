@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// benchmarkRequest is a JSON body of bench.CreateOrderRequest
+var benchmarkRequest = []byte(`{
+	"customerId": "c-1024",
+	"note": "leave at the door",
+	"items": [
+		{"sku": "sku-1", "quantity": "2"},
+		{"sku": "sku-2", "quantity": "1"},
+		{"sku": "sku-3", "quantity": "5"}
+	]
+}`)
+
+// benchmarkIndex builds the descriptor index of a small order API
+func benchmarkIndex(b *testing.B) *descriptorIndex {
+	b.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("bench/order.proto"),
+		Package: proto.String("bench"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("quantity", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional, ""),
+				},
+			},
+			{
+				Name: proto.String("CreateOrderRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("customer_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("note", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional, ""),
+					field("items", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, ".bench.Item"),
+				},
+			},
+		},
+	}
+	index, err := buildDescriptorIndex(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return index
+}
+
+// BenchmarkJSONToProtobuf converts a JSON body through the descriptor index,
+// taking the dynamic message from the per-type pool as proxied requests do
+func BenchmarkJSONToProtobuf(b *testing.B) {
+	index := benchmarkIndex(b)
+	p := &HTTPProxy{format: defaultJSONFormat}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg, err := p.jsonToProtobuf(index, benchmarkRequest, ".bench.CreateOrderRequest")
+		if err != nil {
+			b.Fatal(err)
+		}
+		index.releaseMessages(msg)
+	}
+}
+
+// BenchmarkJSONToProtobufNewMessage creates a fresh dynamicpb message from the
+// indexed descriptor for every request, without pooling
+func BenchmarkJSONToProtobufNewMessage(b *testing.B) {
+	desc := benchmarkIndex(b).message("bench.CreateOrderRequest")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := dynamicpb.NewMessage(desc)
+		if err := protojson.Unmarshal(benchmarkRequest, msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONToProtobufClone is the approach replaced by the descriptor
+// index: a cached message instance cloned for every request
+func BenchmarkJSONToProtobufClone(b *testing.B) {
+	cached := dynamicpb.NewMessage(benchmarkIndex(b).message("bench.CreateOrderRequest"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := proto.Clone(cached)
+		if err := protojson.Unmarshal(benchmarkRequest, msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// jsonFormat JSON 请求与响应中 protobuf 类型的表示。
+// 时间戳、时长与 64 位整数使用非标准表示时，在 protojson 的标准映射之上按描述符转换
+type jsonFormat struct {
+	marshal      protojson.MarshalOptions
+	unixMillis   bool // Timestamp 为毫秒时间戳
+	millis       bool // Duration 为毫秒数
+	int64Numbers bool // 64 位整数为 JSON 数值
+
+	lenientMethods []string // 宽松解析请求的方法通配符
+}
+
+// defaultJSONFormat protojson 的标准映射
+var defaultJSONFormat = &jsonFormat{}
+
+// newJSONFormat 按配置创建 JSON 表示
+func newJSONFormat(cfg config.JSONConfig) (*jsonFormat, error) {
+	f := &jsonFormat{marshal: protojson.MarshalOptions{
+		UseProtoNames:   cfg.UseProtoNames,
+		EmitUnpopulated: cfg.EmitUnpopulated,
+		UseEnumNumbers:  cfg.EnumNumbers,
+	}}
+	switch cfg.Timestamp {
+	case "", "rfc3339":
+	case "unix_millis":
+		f.unixMillis = true
+	default:
+		return nil, fmt.Errorf("unknown JSON timestamp format %q, expected rfc3339 or unix_millis", cfg.Timestamp)
+	}
+	switch cfg.Duration {
+	case "", "string":
+	case "millis":
+		f.millis = true
+	default:
+		return nil, fmt.Errorf("unknown JSON duration format %q, expected string or millis", cfg.Duration)
+	}
+	switch cfg.Int64 {
+	case "", "string":
+	case "number":
+		f.int64Numbers = true
+	default:
+		return nil, fmt.Errorf("unknown JSON int64 format %q, expected string or number", cfg.Int64)
+	}
+	for _, pattern := range cfg.Lenient {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid lenient JSON pattern %q: %w", pattern, err)
+		}
+	}
+	f.lenientMethods = cfg.Lenient
+	return f, nil
+}
+
+// converts 报告响应是否需要在标准映射之上转换
+func (f *jsonFormat) converts() bool {
+	return f.unixMillis || f.millis || f.int64Numbers
+}
+
+// marshalAppend 将消息编码为 JSON 追加到 buf，Any 中的类型按索引解析
+func (f *jsonFormat) marshalAppend(buf []byte, index *descriptorIndex, msg proto.Message) ([]byte, error) {
+	opts := f.marshal
+	opts.Resolver = index
+	data, err := opts.MarshalAppend(buf, msg)
+	if err != nil || !f.converts() {
+		return data, err
+	}
+	value, err := decodeJSON(data[len(buf):])
+	if err != nil {
+		return data, err
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(f.convertMessage(msg.ProtoReflect().Descriptor(), value, true)); err != nil {
+		return data, err
+	}
+	return append(data[:len(buf)], bytes.TrimSuffix(out.Bytes(), []byte{'\n'})...), nil
+}
+
+// unmarshal 将 JSON 解码到消息中，时间戳与时长的数值表示先转换为标准映射，Any 中的类型按索引解析
+func (f *jsonFormat) unmarshal(data []byte, index *descriptorIndex, msg proto.Message) error {
+	if f.unixMillis || f.millis {
+		value, err := decodeJSON(data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(f.convertMessage(msg.ProtoReflect().Descriptor(), value, false)); err != nil {
+			return err
+		}
+	}
+	return protojson.UnmarshalOptions{Resolver: index}.Unmarshal(data, msg)
+}
+
+// decodeJSON 解码 JSON，数值保持原样以免丢失 64 位整数的精度
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// convertMessage 按消息描述符转换 JSON 对象中的字段，out 为 true 时由标准映射转换为配置的表示，否则相反
+func (f *jsonFormat) convertMessage(desc protoreflect.MessageDescriptor, value any, out bool) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	for name, v := range object {
+		field := findFieldDescriptor(desc, name)
+		if field == nil {
+			continue
+		}
+		switch {
+		case field.IsList():
+			if items, ok := v.([]any); ok {
+				for i := range items {
+					items[i] = f.convertValue(field, items[i], out)
+				}
+			}
+		case field.IsMap():
+			if entries, ok := v.(map[string]any); ok {
+				for key := range entries {
+					entries[key] = f.convertValue(field.MapValue(), entries[key], out)
+				}
+			}
+		default:
+			object[name] = f.convertValue(field, v, out)
+		}
+	}
+	return object
+}
+
+// convertValue 转换单个字段值
+func (f *jsonFormat) convertValue(field protoreflect.FieldDescriptor, value any, out bool) any {
+	if msg := field.Message(); msg != nil {
+		switch msg.FullName() {
+		case "google.protobuf.Timestamp":
+			if f.unixMillis {
+				return convertTimestamp(value, out)
+			}
+		case "google.protobuf.Duration":
+			if f.millis {
+				return convertDuration(value, out)
+			}
+		case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+			if f.int64Numbers && out {
+				return int64Number(value)
+			}
+		case "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue", "google.protobuf.Any",
+			"google.protobuf.FieldMask", "google.protobuf.Empty":
+		default:
+			return f.convertMessage(msg, value, out)
+		}
+		return value
+	}
+	switch field.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if f.int64Numbers && out {
+			return int64Number(value)
+		}
+	}
+	return value
+}
+
+// int64Number 将字符串形式的 64 位整数转换为 JSON 数值
+func int64Number(value any) any {
+	if s, ok := value.(string); ok {
+		return json.Number(s)
+	}
+	return value
+}
+
+// convertTimestamp 在 RFC 3339 字符串与毫秒时间戳之间转换，无法转换的值保持原样
+func convertTimestamp(value any, out bool) any {
+	if out {
+		s, ok := value.(string)
+		if !ok {
+			return value
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return value
+		}
+		return t.UnixMilli()
+	}
+	n, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	millis, err := n.Int64()
+	if err != nil {
+		return value
+	}
+	return time.UnixMilli(millis).UTC().Format(time.RFC3339Nano)
+}
+
+// convertDuration 在时长字符串（如 "1.5s"）与毫秒数之间转换，无法转换的值保持原样
+func convertDuration(value any, out bool) any {
+	if out {
+		s, ok := value.(string)
+		if !ok {
+			return value
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return value
+		}
+		return d.Milliseconds()
+	}
+	n, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	millis, err := n.Int64()
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat((time.Duration(millis)*time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+}
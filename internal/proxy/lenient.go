@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// lenient 报告方法的请求是否宽松解析
+func (f *jsonFormat) lenient(serviceName, methodName string) bool {
+	route := serviceName + "/" + methodName
+	for _, pattern := range f.lenientMethods {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// relax 按消息描述符将不规范的 JSON 请求改写为 protojson 接受的形式：
+// 删除未知字段，枚举名称不区分大小写，数值、布尔与字符串字段接受彼此的常见写法。无法改写的值保持原样，
+// 由 protojson 报告错误
+func relax(desc protoreflect.MessageDescriptor, data []byte) ([]byte, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(relaxMessage(desc, value))
+}
+
+// relaxMessage 改写 JSON 对象中的字段
+func relaxMessage(desc protoreflect.MessageDescriptor, value any) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	for name, v := range object {
+		field := findFieldDescriptor(desc, name)
+		if field == nil {
+			delete(object, name)
+			continue
+		}
+		switch {
+		case field.IsList():
+			if items, ok := v.([]any); ok {
+				for i := range items {
+					items[i] = relaxValue(field, items[i])
+				}
+			}
+		case field.IsMap():
+			if entries, ok := v.(map[string]any); ok {
+				for key := range entries {
+					entries[key] = relaxValue(field.MapValue(), entries[key])
+				}
+			}
+		default:
+			object[name] = relaxValue(field, v)
+		}
+	}
+	return object
+}
+
+// relaxValue 改写单个字段值；包装类型按其 value 字段改写，其他知名类型保持原样
+func relaxValue(field protoreflect.FieldDescriptor, value any) any {
+	if msg := field.Message(); msg != nil {
+		switch msg.FullName() {
+		case "google.protobuf.DoubleValue", "google.protobuf.FloatValue", "google.protobuf.Int64Value",
+			"google.protobuf.UInt64Value", "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+			"google.protobuf.BoolValue", "google.protobuf.StringValue":
+			return relaxScalar(msg.Fields().ByName("value"), value)
+		case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.Struct", "google.protobuf.Value",
+			"google.protobuf.ListValue", "google.protobuf.Any", "google.protobuf.FieldMask", "google.protobuf.Empty",
+			"google.protobuf.BytesValue":
+			return value
+		}
+		return relaxMessage(msg, value)
+	}
+	return relaxScalar(field, value)
+}
+
+// relaxScalar 改写标量字段值
+func relaxScalar(field protoreflect.FieldDescriptor, value any) any {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		s, ok := value.(string)
+		if !ok {
+			return value
+		}
+		s = strings.TrimSpace(s)
+		values := field.Enum().Values()
+		if v := values.ByName(protoreflect.Name(s)); v != nil {
+			return s
+		}
+		for i := 0; i < values.Len(); i++ {
+			if strings.EqualFold(string(values.Get(i).Name()), s) {
+				return string(values.Get(i).Name())
+			}
+		}
+		if _, err := strconv.ParseInt(s, 10, 32); err == nil {
+			return json.Number(s)
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if n, ok := numeric(value); ok {
+			if _, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return json.Number(n)
+			}
+			if _, err := strconv.ParseUint(n, 10, 64); err == nil {
+				return json.Number(n)
+			}
+			if f, err := strconv.ParseFloat(n, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				return json.Number(strconv.FormatFloat(f, 'f', 0, 64))
+			}
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if n, ok := numeric(value); ok {
+			if _, err := strconv.ParseFloat(n, 64); err == nil {
+				return json.Number(n)
+			}
+		}
+	case protoreflect.BoolKind:
+		switch v := value.(type) {
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		case json.Number:
+			if b, err := strconv.ParseBool(v.String()); err == nil {
+				return b
+			}
+		}
+	case protoreflect.StringKind:
+		switch v := value.(type) {
+		case json.Number:
+			return v.String()
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return value
+}
+
+// numeric 返回 JSON 数值或数值字符串去掉空白后的文本
+func numeric(value any) (string, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), true
+	case string:
+		return strings.TrimSpace(v), true
+	}
+	return "", false
+}
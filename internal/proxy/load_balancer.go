@@ -1,10 +1,16 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"slices"
+	"strings"
 	"sync/atomic"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
 )
 
@@ -110,3 +116,97 @@ func getWeight(instance *registry.ServiceInstance) int {
 
 	return 1
 }
+
+// Draining 判断实例是否正在下线：元数据中的权重被设置为 0 的实例不再接收新请求
+func Draining(instance *registry.ServiceInstance) bool {
+	weightStr, ok := instance.Metadata["weight"]
+	if !ok {
+		return false
+	}
+	var weight int
+	_, err := fmt.Sscanf(weightStr, "%d", &weight)
+	return err == nil && weight == 0
+}
+
+// tagged 只保留带有全部 tags 的实例，用于排除注册在同一注册中心中的非生产实例；tags 为空时不过滤
+func tagged(instances []*registry.ServiceInstance, tags []string) []*registry.ServiceInstance {
+	if len(tags) == 0 {
+		return instances
+	}
+	result := make([]*registry.ServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if hasTags(instance, tags) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+// hasTags 判断实例是否带有全部 tags
+func hasTags(instance *registry.ServiceInstance, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(instance.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// noInstances 返回服务没有可用实例的错误，配置了必需标签时在消息中注明
+func noInstances(service string, tags []string) error {
+	if len(tags) > 0 {
+		return status.Errorf(codes.Unavailable, "no available instances with tags %s for service: %s", strings.Join(tags, ","), service)
+	}
+	return status.Errorf(codes.Unavailable, "no available instances for service: %s", service)
+}
+
+// routable 过滤掉正在下线的实例
+func routable(instances []*registry.ServiceInstance) []*registry.ServiceInstance {
+	result := make([]*registry.ServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if !Draining(instance) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+// namespaceKey 上下文中后端命名空间的键
+type namespaceKey struct{}
+
+// WithNamespace 限定请求只转发到元数据 namespace 与之相同的实例（用于租户的后端隔离），空字符串不限定
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	if namespace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// inNamespace 过滤出属于请求命名空间的实例，请求未限定命名空间时返回全部实例
+func inNamespace(ctx context.Context, instances []*registry.ServiceInstance) []*registry.ServiceInstance {
+	namespace, _ := ctx.Value(namespaceKey{}).(string)
+	if namespace == "" {
+		return instances
+	}
+	result := make([]*registry.ServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Metadata["namespace"] == namespace {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+// NewLoadBalancer 根据算法名称创建负载均衡器，默认为轮询
+func NewLoadBalancer(name string) (LoadBalancer, error) {
+	switch name {
+	case "", "round_robin":
+		return NewRoundRobinLoadBalancer(), nil
+	case "random":
+		return NewRandomLoadBalancer(), nil
+	case "weighted":
+		return NewWeightedLoadBalancer(), nil
+	default:
+		return nil, fmt.Errorf("unsupported load balancer: %s", name)
+	}
+}
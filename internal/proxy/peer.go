@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const (
+	// InstanceHeader is the debug response header with the registry ID of the
+	// instance that served the request
+	InstanceHeader = "X-Upstream-Instance"
+	// AddressHeader is the debug response header with the address of that instance
+	AddressHeader = "X-Upstream-Address"
+	// ConnReusedHeader is the debug response header reporting whether the
+	// call used an already open connection
+	ConnReusedHeader = "X-Upstream-Conn-Reused"
+)
+
+// peerKey 上下文中上游实例信息的键
+type peerKey struct{}
+
+// upstreamPeer 上游实例信息，重试时为最后一次尝试的实例
+type upstreamPeer struct {
+	mu       sync.Mutex
+	instance string
+	address  string
+	reused   *bool // 连接是否复用未知时为 nil
+}
+
+// WithPeer returns a context that tracks the upstream instance of the call
+// for the debug response headers set by SetUpstreamHeaders
+func WithPeer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerKey{}, new(upstreamPeer))
+}
+
+// SetUpstreamHeaders sets the attempts response header when attempts were
+// counted, and the upstream instance headers when the context tracks the peer
+func SetUpstreamHeaders(w http.ResponseWriter, ctx context.Context) {
+	setUpstreamHeaders(w.Header(), ctx)
+}
+
+// setUpstreamHeaders 在响应头中写入上游尝试次数与上游实例信息
+func setUpstreamHeaders(header http.Header, ctx context.Context) {
+	if n := Attempts(ctx); n > 0 {
+		header.Set(AttemptsHeader, strconv.Itoa(n))
+	}
+	peer, ok := ctx.Value(peerKey{}).(*upstreamPeer)
+	if !ok {
+		return
+	}
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	if peer.address == "" {
+		return
+	}
+	if peer.instance != "" {
+		header.Set(InstanceHeader, peer.instance)
+	}
+	header.Set(AddressHeader, peer.address)
+	if peer.reused != nil {
+		header.Set(ConnReusedHeader, strconv.FormatBool(*peer.reused))
+	}
+}
+
+// recordInstance 记录选中的上游实例：写入请求信息供访问日志使用，并计入上下文
+func recordInstance(ctx context.Context, instance *registry.ServiceInstance, target string) {
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.Upstream = target
+		entry.Instance = instance.ID
+		entry.ConnReused = false
+	}
+	if peer, ok := ctx.Value(peerKey{}).(*upstreamPeer); ok {
+		peer.mu.Lock()
+		peer.instance, peer.address, peer.reused = instance.ID, target, nil
+		peer.mu.Unlock()
+	}
+}
+
+// recordConnReuse 记录对选中实例的调用是否复用了已建立的连接
+func recordConnReuse(ctx context.Context, reused bool) {
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.ConnReused = reused
+	}
+	if peer, ok := ctx.Value(peerKey{}).(*upstreamPeer); ok {
+		peer.mu.Lock()
+		peer.reused = &reused
+		peer.mu.Unlock()
+	}
+}
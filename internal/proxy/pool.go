@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxPooledBuffer 超过该大小的缓冲区不放回池中，避免偶发的大响应长期占用内存
+const maxPooledBuffer = 1 << 20
+
+// bufferPool 复用 JSON 编码的输出缓冲区
+var bufferPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// getBuffer 从池中取出一个空缓冲区
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putBuffer 将缓冲区放回池中
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// marshalJSON 将消息编码为 JSON：先编码到池中的缓冲区，再复制为大小恰好的结果，
+// 省去 protojson.Marshal 逐步扩容产生的中间分配
+func (f *jsonFormat) marshalJSON(index *descriptorIndex, msg proto.Message) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	data, err := f.marshalAppend(*buf, index, msg)
+	*buf = data
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(data), nil
+}
+
+// writeJSON 将消息编码为 JSON 写入 w，编码使用池中的缓冲区
+func (f *jsonFormat) writeJSON(w io.Writer, index *descriptorIndex, msg proto.Message) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	data, err := f.marshalAppend(*buf, index, msg)
+	*buf = data
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// newMessage 从消息的池中取出一个空的动态消息，用完后通过 releaseMessages 放回
+func (i *descriptorIndex) newMessage(fullName string) *dynamicpb.Message {
+	pool := i.pools[strings.TrimPrefix(fullName, ".")]
+	if pool == nil {
+		return nil
+	}
+	return pool.Get().(*dynamicpb.Message)
+}
+
+// releaseMessages 清空动态消息并放回所属消息的池中。放回后的消息不能再被引用
+func (i *descriptorIndex) releaseMessages(msgs ...proto.Message) {
+	for _, m := range msgs {
+		msg, ok := m.(*dynamicpb.Message)
+		if !ok || msg == nil {
+			continue
+		}
+		pool := i.pools[string(msg.Descriptor().FullName())]
+		if pool == nil {
+			continue
+		}
+		clearMessage(msg)
+		pool.Put(msg)
+	}
+}
+
+// clearMessage 清空消息的全部字段。与 Reset 不同，不重新分配字段表，保留其已分配的空间供下次使用
+func clearMessage(msg *dynamicpb.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		msg.Clear(fd)
+		return true
+	})
+	msg.SetUnknown(nil)
+}
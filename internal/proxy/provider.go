@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet 代理组件Provider集合
+var ProviderSet = wire.NewSet(
+	ProvideConnectionPool,
+	ProvideServicePolicies,
+)
+
+// preconnectTimeout 启动时预先建立连接前发现服务实例的超时
+const preconnectTimeout = 10 * time.Second
+
+// ProvideConnectionPool 提供HTTP与gRPC代理共享的上游连接池，配置了 preconnect 时在后台为 services 中的服务预先建立连接
+func ProvideConnectionPool(cfg *config.Config, log *slog.Logger, reg registry.Registry, policies *ServicePolicies) *ConnectionPool {
+	pool := NewConnectionPool(logger.Component(log, "connection_pool"))
+	pool.SetConfig(cfg.Pool)
+	pool.RegisterMetrics()
+
+	if cfg.Pool.Preconnect > 0 && reg != nil {
+		for service := range cfg.Services {
+			policy := policies.Get(service)
+			if policy.Twirp() {
+				continue
+			}
+			go func(service string, policy *ServicePolicy) {
+				ctx, cancel := context.WithTimeout(pool.ctx, preconnectTimeout)
+				defer cancel()
+				if err := pool.Preconnect(ctx, reg, service, policy.creds, policy.Config.RequiredTags, cfg.Pool.Preconnect); err != nil {
+					pool.logger.Warn("Failed to pre-connect to service instances", "service", service, "error", err)
+				}
+			}(service, policy)
+		}
+	}
+	return pool
+}
+
+// ProvideServicePolicies 提供按服务合并后的上游调用策略，配置变更时热更新
+func ProvideServicePolicies(cfg *config.Config, watcher *reload.Watcher) (*ServicePolicies, error) {
+	policies, err := NewServicePolicies(cfg)
+	if err != nil {
+		return nil, err
+	}
+	apply := func(_, next *config.Config) error {
+		return policies.Update(next)
+	}
+	watcher.OnChange("upstream", apply)
+	watcher.OnChange("services", apply)
+	return policies, nil
+}
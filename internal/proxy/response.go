@@ -0,0 +1,26 @@
+package proxy
+
+import "bytes"
+
+// ResponseWriter 接收 HTTP 代理生成的 JSON 响应
+type ResponseWriter interface {
+	Write(p []byte) (int, error)
+	// Flush 将已写出的内容发送给客户端，服务端流式方法每写出一条响应消息调用一次
+	Flush()
+	// Reset 丢弃已写出的内容以便重试；内容已发送给客户端、无法撤回时返回 false
+	Reset() bool
+}
+
+// bufferWriter 在内存中缓冲完整响应的 ResponseWriter
+type bufferWriter struct {
+	bytes.Buffer
+}
+
+// Flush 实现 ResponseWriter，响应在返回前不会发送
+func (b *bufferWriter) Flush() {}
+
+// Reset 实现 ResponseWriter
+func (b *bufferWriter) Reset() bool {
+	b.Buffer.Reset()
+	return true
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/statusmap"
+)
+
+// RESTProxy 将 HTTP 请求反向代理到注册中心中的普通 HTTP 服务，与 gRPC 代理共享服务策略：
+// 负载均衡、限流、超时、重试与 TLS 均按服务的上游配置生效
+type RESTProxy struct {
+	registry   registry.Registry
+	policies   *ServicePolicies
+	logger     *slog.Logger
+	transports transports
+}
+
+// restTarget 上下文中转发目标的键
+type restTarget struct{}
+
+// restRequest 一次转发的服务与策略
+type restRequest struct {
+	service string
+	policy  *ServicePolicy
+}
+
+// NewRESTProxy 创建普通 HTTP 服务的反向代理
+func NewRESTProxy(reg registry.Registry, policies *ServicePolicies, logger *slog.Logger) *RESTProxy {
+	return &RESTProxy{
+		registry: reg,
+		policies: policies,
+		logger:   logger,
+	}
+}
+
+// Forward 将请求转发到服务的一个实例，path 为转发到上游的路径。
+// 服务配置了重试时请求体被缓存，以便在其他实例上重放
+func (p *RESTProxy) Forward(w http.ResponseWriter, r *http.Request, service, path string) {
+	policy := p.policies.Get(service)
+	if err := policy.Allow(); err != nil {
+		p.writeError(w, err)
+		return
+	}
+	ctx, cancel := policy.WithTimeout(r.Context())
+	defer cancel()
+	release, err := policy.Acquire(ctx)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	defer release()
+
+	if policy.Attempts() > 1 && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Failed to read request body: %v", err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	scheme := "http"
+	if policy.creds != nil {
+		scheme = "https"
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = scheme
+			pr.Out.URL.Path = path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = "" // 使用选中实例的地址
+			pr.SetXForwarded()
+		},
+		Transport: p,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			p.logger.Warn("HTTP backend call failed", "service", service, "path", path, "error", err)
+			SetUpstreamHeaders(w, r.Context())
+			p.writeError(w, err)
+		},
+	}
+	ctx = context.WithValue(WithAttempts(ctx), restTarget{}, &restRequest{service: service, policy: policy})
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RoundTrip 按负载均衡选择实例发送请求。连接失败或响应状态码对应的 gRPC 状态码
+// 在服务的可重试状态码中时，换一个实例重试；请求体未缓存时不重试
+func (p *RESTProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.Context().Value(restTarget{}).(*restRequest)
+	policy := target.policy
+	transport := p.transports.get(policy.creds)
+	replayable := req.GetBody != nil || req.Body == nil || req.Body == http.NoBody
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.Attempts(); attempt++ {
+		if attempt > 1 {
+			if !replayable || !policy.Retryable(lastErr) {
+				break
+			}
+			if err := sleep(req.Context(), policy.Backoff(attempt-1)); err != nil {
+				break
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+			p.logger.Debug("Retrying HTTP backend request", "service", target.service, "attempt", attempt, "error", lastErr)
+		}
+
+		instance, err := p.selectInstance(req.Context(), target.service, policy)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		host := fmt.Sprintf("%s:%d", instance.Address, instance.Port)
+		recordInstance(req.Context(), instance, host)
+		// 记录是否复用了传输中已建立的连接
+		out := req.Clone(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				recordConnReuse(req.Context(), info.Reused)
+			},
+		}))
+		out.URL.Host = host
+		recordAttempt(req.Context(), policy, attempt)
+		setAttemptHeaders(out.Header, policy, attempt, lastErr)
+
+		resp, err := transport.RoundTrip(out)
+		if err != nil {
+			lastErr = status.Errorf(codes.Unavailable, "failed to call backend %s: %v", out.URL.Host, err)
+			if errors.Is(err, context.DeadlineExceeded) {
+				lastErr = status.Errorf(codes.DeadlineExceeded, "backend %s timed out", out.URL.Host)
+			}
+			continue
+		}
+		code := restCode(resp.StatusCode)
+		lastErr = status.Errorf(code, "backend %s returned %s", out.URL.Host, resp.Status)
+		if code == codes.OK || attempt == policy.Attempts() || !replayable || !policy.Retryable(lastErr) {
+			setUpstreamHeaders(resp.Header, req.Context())
+			return resp, nil
+		}
+		// 可重试的响应在下一次尝试前丢弃
+		resp.Body.Close()
+	}
+	return nil, lastErr
+}
+
+// selectInstance 发现服务实例并按负载均衡选择一个
+func (p *RESTProxy) selectInstance(ctx context.Context, service string, policy *ServicePolicy) (*registry.ServiceInstance, error) {
+	instances, err := p.registry.Discover(ctx, service)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to discover service %s: %v", service, err)
+	}
+	instances = policy.Eligible(inNamespace(ctx, instances))
+	if len(instances) == 0 {
+		return nil, noInstances(service, policy.Config.RequiredTags)
+	}
+	instance := policy.balancer.Select(instances)
+	if instance == nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to select instance for service: %s", service)
+	}
+	return instance, nil
+}
+
+// writeError 按 gRPC 状态码写出错误响应
+func (p *RESTProxy) writeError(w http.ResponseWriter, err error) {
+	code := status.Code(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	} else if code == codes.Unknown {
+		code = codes.Unavailable
+	}
+	w.WriteHeader(statusmap.HTTPStatus(code))
+	fmt.Fprintf(w, "Backend call failed: %s", status.Convert(err).Message())
+}
+
+// restCode 将上游的 HTTP 状态码映射为判断重试使用的 gRPC 状态码
+func restCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.OK
+	}
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/ratelimit"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+)
+
+// 上游协议
+const (
+	ProtocolGRPC  = "grpc"
+	ProtocolTwirp = "twirp"
+)
+
+// ServicePolicy 单个上游服务的运行时调用策略
+type ServicePolicy struct {
+	Config   config.UpstreamConfig
+	balancer LoadBalancer
+	limiter  *ratelimit.Limiter
+	inflight *concurrency.Limiter
+	creds    *Credentials
+	retry    map[codes.Code]bool
+}
+
+// Credentials 连接上游使用的传输凭证，Key 用于区分连接池中的连接
+type Credentials struct {
+	Key string
+	credentials.TransportCredentials
+	tls *tls.Config // 代理普通 HTTP 服务时使用
+}
+
+// ServicePolicies 按服务名管理调用策略，支持运行时更新
+type ServicePolicies struct {
+	mu       sync.RWMutex
+	cfg      *config.Config
+	policies map[string]*ServicePolicy
+}
+
+// NewServicePolicies 创建服务策略集合
+func NewServicePolicies(cfg *config.Config) (*ServicePolicies, error) {
+	p := &ServicePolicies{}
+	if err := p.Update(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update 使用新配置替换所有服务策略，配置无效时保留原策略。有效配置未变的服务保留原策略，
+// 其负载均衡、限流与并发限制的状态不因重新加载而重置；只重建配置变化的服务的策略
+func (p *ServicePolicies) Update(cfg *config.Config) error {
+	// 预先校验全局配置；各服务的策略在校验时创建，直接使用
+	if _, err := newServicePolicy("", cfg.Upstream); err != nil {
+		return fmt.Errorf("invalid upstream config: %w", err)
+	}
+	p.mu.RLock()
+	current := p.policies
+	p.mu.RUnlock()
+
+	policies := make(map[string]*ServicePolicy, len(cfg.Services))
+	for name := range cfg.Services {
+		profile := cfg.ServiceProfile(name)
+		if policy, ok := current[name]; ok && reflect.DeepEqual(policy.Config, profile) {
+			policies[name] = policy
+			continue
+		}
+		policy, err := newServicePolicy(name, profile)
+		if err != nil {
+			return fmt.Errorf("invalid config for service %s: %w", name, err)
+		}
+		policies[name] = policy
+	}
+	// 首次访问时按全局配置创建的策略同样在配置未变时保留
+	for name, policy := range current {
+		if _, ok := policies[name]; !ok && reflect.DeepEqual(policy.Config, cfg.ServiceProfile(name)) {
+			policies[name] = policy
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	p.policies = policies
+	return nil
+}
+
+// Get 返回服务的调用策略，首次访问时根据配置创建；p 为 nil 时返回默认策略
+func (p *ServicePolicies) Get(service string) *ServicePolicy {
+	if p == nil {
+		policy, _ := newServicePolicy(service, config.UpstreamConfig{})
+		return policy
+	}
+
+	p.mu.RLock()
+	policy, ok := p.policies[service]
+	p.mu.RUnlock()
+	if ok {
+		return policy
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if policy, ok := p.policies[service]; ok {
+		return policy
+	}
+	// Update 已校验过配置，这里不会出错
+	policy, _ = newServicePolicy(service, p.cfg.ServiceProfile(service))
+	p.policies[service] = policy
+	return policy
+}
+
+// Eligible 返回可以选择的实例：不在下线中且带有全部必需标签
+func (p *ServicePolicy) Eligible(instances []*registry.ServiceInstance) []*registry.ServiceInstance {
+	return tagged(routable(instances), p.Config.RequiredTags)
+}
+
+// newServicePolicy 根据服务的有效配置创建服务策略
+func newServicePolicy(service string, cfg config.UpstreamConfig) (*ServicePolicy, error) {
+	balancer, err := NewLoadBalancer(cfg.LoadBalancer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Protocol {
+	case "", ProtocolGRPC, ProtocolTwirp:
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
+	}
+
+	creds, err := newCredentials(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	retryable := cfg.Retry.RetryableCodes
+	if len(retryable) == 0 {
+		retryable = []string{"UNAVAILABLE"}
+	}
+	retry := make(map[codes.Code]bool, len(retryable))
+	for _, name := range retryable {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return nil, fmt.Errorf("invalid retryable code %q", name)
+		}
+		retry[code] = true
+	}
+
+	return &ServicePolicy{
+		Config:   cfg,
+		balancer: balancer,
+		limiter:  ratelimit.New(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst),
+		inflight: concurrency.New(service, cfg.Concurrency.MaxInFlight, cfg.Concurrency.QueueSize, cfg.Concurrency.QueueTimeout),
+		creds:    creds,
+		retry:    retry,
+	}, nil
+}
+
+// newCredentials 创建到上游的 TLS 凭证，未启用时返回 nil
+func newCredentials(cfg config.UpstreamTLSConfig) (*Credentials, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	key := fmt.Sprintf("tls:%s:%s:%s:%s:%t", cfg.CAFile, cfg.CertFile, cfg.KeyFile, cfg.ServerName, cfg.InsecureSkipVerify)
+	return &Credentials{Key: key, TransportCredentials: credentials.NewTLS(tlsConfig), tls: tlsConfig}, nil
+}
+
+// Allow 检查服务限流
+func (s *ServicePolicy) Allow() error {
+	if !s.limiter.Allow() {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// Acquire 占用一个到服务的并发调用名额，名额已满时排队等待；队列已满或等待超时返回 ResourceExhausted。
+// 调用结束后必须调用 release 归还名额。配置重新加载后新调用使用新的限制，进行中的调用仍归还到原来的名额
+func (s *ServicePolicy) Acquire(ctx context.Context) (release func(), err error) {
+	return s.inflight.Acquire(ctx)
+}
+
+// WithTimeout 为调用设置服务超时
+func (s *ServicePolicy) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Config.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.Config.Timeout)
+}
+
+// Twirp 上游是否使用 Twirp 协议
+func (s *ServicePolicy) Twirp() bool {
+	return s.Config.Protocol == ProtocolTwirp
+}
+
+// CallOptions 返回调用上游时使用的 gRPC 调用选项
+func (s *ServicePolicy) CallOptions() []grpc.CallOption {
+	if s.Config.MaxMessageSize <= 0 {
+		return nil
+	}
+	return []grpc.CallOption{
+		grpc.MaxCallRecvMsgSize(s.Config.MaxMessageSize),
+		grpc.MaxCallSendMsgSize(s.Config.MaxMessageSize),
+	}
+}
+
+// Attempts 返回最大尝试次数
+func (s *ServicePolicy) Attempts() int {
+	if s.Config.Retry.MaxAttempts < 1 {
+		return 1
+	}
+	return s.Config.Retry.MaxAttempts
+}
+
+// Retryable 判断错误是否可以重试
+func (s *ServicePolicy) Retryable(err error) bool {
+	return s.retry[status.Code(err)]
+}
+
+// Backoff 返回第 attempt 次重试前的等待时间（指数退避并加入随机抖动）
+func (s *ServicePolicy) Backoff(attempt int) time.Duration {
+	backoff := s.Config.Retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if s.Config.Retry.MaxBackoff > 0 && backoff > s.Config.Retry.MaxBackoff {
+			backoff = s.Config.Retry.MaxBackoff
+			break
+		}
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// sleep 等待重试间隔，上下文取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
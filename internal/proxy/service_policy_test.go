@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+func TestUpdateKeepsUnchangedServicePolicies(t *testing.T) {
+	cfg := &config.Config{Services: map[string]config.ServiceConfig{
+		"order.OrderService": {Timeout: time.Second},
+		"user.UserService":   {Timeout: time.Second},
+	}}
+	p, err := NewServicePolicies(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := p.Get("order.OrderService")
+	user := p.Get("user.UserService")
+	stock := p.Get("stock.StockService") // Not configured, created on first use
+
+	next := &config.Config{Services: map[string]config.ServiceConfig{
+		"order.OrderService": {Timeout: time.Second},
+		"user.UserService":   {Timeout: 2 * time.Second},
+	}}
+	if err := p.Update(next); err != nil {
+		t.Fatal(err)
+	}
+	if p.Get("order.OrderService") != order {
+		t.Error("policy of an unchanged service rebuilt")
+	}
+	if p.Get("stock.StockService") != stock {
+		t.Error("policy of an unconfigured service rebuilt")
+	}
+	if got := p.Get("user.UserService"); got == user || got.Config.Timeout != 2*time.Second {
+		t.Errorf("policy of a changed service not rebuilt, timeout %v", got.Config.Timeout)
+	}
+
+	invalid := &config.Config{Services: map[string]config.ServiceConfig{"order.OrderService": {LoadBalancer: "fastest"}}}
+	if err := p.Update(invalid); err == nil {
+		t.Fatal("invalid service config accepted")
+	}
+	if p.Get("order.OrderService") != order {
+		t.Error("policies replaced by an invalid config")
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+)
+
+// transports 按 TLS 凭证区分的 HTTP 连接池，用于代理普通 HTTP 服务与 Twirp 上游
+type transports struct {
+	mu   sync.Mutex
+	pool map[string]*http.Transport
+}
+
+// get 返回凭证对应的 HTTP 连接池，首次使用时创建
+func (t *transports) get(creds *Credentials) *http.Transport {
+	key := ""
+	if creds != nil {
+		key = creds.Key
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if transport, ok := t.pool[key]; ok {
+		return transport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if creds != nil {
+		transport.TLSClientConfig = creds.tls.Clone()
+	}
+	if t.pool == nil {
+		t.pool = make(map[string]*http.Transport)
+	}
+	t.pool[key] = transport
+	return transport
+}
+
+// baseURL 返回 HTTP 上游实例的地址，启用 TLS 时使用 https
+func baseURL(creds *Credentials, target string) string {
+	if creds != nil {
+		return "https://" + target
+	}
+	return "http://" + target
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EncodeXML converts the JSON response of a unary method into XML, for
+// clients that accept application/xml. The document element is named after
+// the output message and each populated field is an element named after the
+// field (the JSON name, or the protobuf name with use_proto_names): repeated
+// fields repeat the element, map entries carry the key in a key attribute and
+// well-known types contain the text of their JSON representation.
+func (p *HTTPProxy) EncodeXML(tenant, serviceName, methodName string, jsonBody []byte) ([]byte, error) {
+	descriptors := p.schemaFor(tenant)
+	methodDesc := descriptors.loader.FindMethodDescriptor(serviceName, methodName)
+	if methodDesc == nil {
+		return nil, status.Errorf(codes.NotFound, "method not found: %s/%s", serviceName, methodName)
+	}
+	if methodDesc.GetClientStreaming() || methodDesc.GetServerStreaming() {
+		return nil, status.Errorf(codes.Unimplemented, "streaming method %s/%s does not support XML responses", serviceName, methodName)
+	}
+
+	index := descriptors.index.Load()
+	msg, err := p.jsonToProtobuf(index, jsonBody, methodDesc.GetOutputType())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid response: %v", err)
+	}
+	defer index.releaseMessages(msg)
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := &xmlEncoder{buf: &buf, format: p.format, index: index}
+	m := msg.ProtoReflect()
+	if err := e.message(string(m.Descriptor().Name()), "", m); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode XML response: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// xmlEncoder 按描述符将消息编码为 XML
+type xmlEncoder struct {
+	buf    *bytes.Buffer
+	format *jsonFormat
+	index  *descriptorIndex
+}
+
+// message 写出消息元素，key 非空时作为 map 条目的 key 属性
+func (e *xmlEncoder) message(name, key string, m protoreflect.Message) error {
+	e.open(name, key)
+	if wellKnown(m.Descriptor()) {
+		data, err := e.format.marshalJSON(e.index, m.Interface())
+		if err != nil {
+			return err
+		}
+		// 字符串形式的 JSON 值（时间戳、时长等）去掉引号
+		if s, err := strconv.Unquote(string(data)); err == nil {
+			data = []byte(s)
+		}
+		xml.EscapeText(e.buf, data)
+		e.close(name)
+		return nil
+	}
+
+	var err error
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len() && err == nil; i++ {
+		field := fields.Get(i)
+		if !m.Has(field) {
+			continue
+		}
+		fieldName := field.JSONName()
+		if e.format.marshal.UseProtoNames {
+			fieldName = string(field.Name())
+		}
+		value := m.Get(field)
+		switch {
+		case field.IsList():
+			list := value.List()
+			for j := 0; j < list.Len() && err == nil; j++ {
+				err = e.value(fieldName, "", field, list.Get(j))
+			}
+		case field.IsMap():
+			value.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				err = e.value(fieldName, k.String(), field.MapValue(), v)
+				return err == nil
+			})
+		default:
+			err = e.value(fieldName, "", field, value)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	e.close(name)
+	return nil
+}
+
+// value 写出字段值元素
+func (e *xmlEncoder) value(name, key string, field protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	var text string
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return e.message(name, key, v.Message())
+	case protoreflect.EnumKind:
+		text = strconv.FormatInt(int64(v.Enum()), 10)
+		if ev := field.Enum().Values().ByNumber(v.Enum()); ev != nil && !e.format.marshal.UseEnumNumbers {
+			text = string(ev.Name())
+		}
+	case protoreflect.BytesKind:
+		text = base64.StdEncoding.EncodeToString(v.Bytes())
+	default:
+		text = v.String()
+	}
+	e.open(name, key)
+	xml.EscapeText(e.buf, []byte(text))
+	e.close(name)
+	return nil
+}
+
+// open 写出开始标签
+func (e *xmlEncoder) open(name, key string) {
+	e.buf.WriteByte('<')
+	e.buf.WriteString(name)
+	if key != "" {
+		e.buf.WriteString(` key="`)
+		xml.EscapeText(e.buf, []byte(key))
+		e.buf.WriteByte('"')
+	}
+	e.buf.WriteByte('>')
+}
+
+// close 写出结束标签
+func (e *xmlEncoder) close(name string) {
+	e.buf.WriteString("</")
+	e.buf.WriteString(name)
+	e.buf.WriteByte('>')
+}
+
+// wellKnown 报告消息是否为有特殊 JSON 表示的知名类型
+func wellKnown(desc protoreflect.MessageDescriptor) bool {
+	switch desc.FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.Struct", "google.protobuf.Value",
+		"google.protobuf.ListValue", "google.protobuf.Any", "google.protobuf.FieldMask", "google.protobuf.Empty",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue", "google.protobuf.Int64Value",
+		"google.protobuf.UInt64Value", "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package publish
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// kafkaPublisher publishes to Kafka. The writer connects lazily and routes
+// messages with a key to a partition by hash.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafka creates a Kafka publisher for the bootstrap brokers
+func newKafka(cfg config.BrokerConfig) *kafkaPublisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Addresses...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+// Publish implements Publisher
+func (p *kafkaPublisher) Publish(ctx context.Context, msg *Message) error {
+	m := kafka.Message{Topic: msg.Topic, Value: msg.Payload}
+	if msg.Key != "" {
+		m.Key = []byte(msg.Key)
+	}
+	for key, value := range msg.Headers {
+		m.Headers = append(m.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return p.writer.WriteMessages(ctx, m)
+}
+
+// Close implements Publisher
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
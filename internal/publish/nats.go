@@ -0,0 +1,54 @@
+package publish
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// natsPublisher publishes to NATS subjects
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+// newNATS connects to the NATS servers
+func newNATS(cfg config.BrokerConfig) (*natsPublisher, error) {
+	var opts []nats.Option
+	if cfg.Timeout > 0 {
+		opts = append(opts, nats.Timeout(cfg.Timeout))
+	}
+	conn, err := nats.Connect(strings.Join(cfg.Addresses, ","), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn}, nil
+}
+
+// Publish implements Publisher. The message is flushed to the server before
+// returning; the key is sent as the Nats-Msg-Id header for deduplication.
+func (p *natsPublisher) Publish(ctx context.Context, msg *Message) error {
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Payload
+	for key, value := range msg.Headers {
+		m.Header.Set(key, value)
+	}
+	if msg.Key != "" {
+		m.Header.Set(nats.MsgIdHdr, msg.Key)
+	}
+	if err := p.conn.PublishMsg(m); err != nil {
+		return err
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close implements Publisher
+func (p *natsPublisher) Close() error {
+	err := p.conn.Drain()
+	if err == nats.ErrConnectionClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package publish
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet message queue provider set
+var ProviderSet = wire.NewSet(
+	ProvideManager,
+)
+
+// ProvideManager connects the brokers that route rules publish to
+func ProvideManager(cfg *config.Config, log *slog.Logger) (*Manager, error) {
+	return Start(cfg.Brokers, logger.Component(log, "publish"))
+}
@@ -0,0 +1,128 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+// defaultTimeout bounds a publish when the broker has no timeout configured
+const defaultTimeout = 5 * time.Second
+
+var published = metrics.NewCounterVec(
+	"gateway_publish_total",
+	"Messages published by route rules, by broker, topic and result",
+	"broker", "topic", "result",
+)
+
+// Message is a message published to a broker
+type Message struct {
+	Topic   string
+	Key     string // Empty for no key
+	Headers map[string]string
+	Payload []byte
+}
+
+// Publisher sends messages to one broker
+type Publisher interface {
+	// Publish sends msg and returns once the broker has accepted it
+	Publish(ctx context.Context, msg *Message) error
+	// Close flushes pending messages and closes the connection
+	Close() error
+}
+
+// broker is a connected broker with its publish timeout
+type broker struct {
+	publisher Publisher
+	timeout   time.Duration
+}
+
+// Manager connects the configured brokers and publishes to them by name
+type Manager struct {
+	brokers map[string]*broker
+	logger  *slog.Logger
+}
+
+// Start connects every configured broker. A broker that cannot be connected
+// closes the ones already connected and fails the startup.
+func Start(cfgs map[string]config.BrokerConfig, logger *slog.Logger) (*Manager, error) {
+	m := &Manager{brokers: make(map[string]*broker, len(cfgs)), logger: logger}
+	names := make([]string, 0, len(cfgs))
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg := cfgs[name]
+		p, err := connect(cfg)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to connect broker %q: %w", name, err)
+		}
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		m.brokers[name] = &broker{publisher: p, timeout: timeout}
+		logger.Info("Broker connected", "broker", name, "type", cfg.Type, "addresses", cfg.Addresses)
+	}
+	return m, nil
+}
+
+// connect creates the publisher for a broker type
+func connect(cfg config.BrokerConfig) (Publisher, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, fmt.Errorf("broker requires addresses")
+	}
+	switch cfg.Type {
+	case "kafka":
+		return newKafka(cfg), nil
+	case "nats":
+		return newNATS(cfg)
+	case "rabbitmq":
+		return newRabbitMQ(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported broker type %q", cfg.Type)
+	}
+}
+
+// Publish sends msg to the named broker within the broker's timeout
+func (m *Manager) Publish(ctx context.Context, name string, msg *Message) error {
+	var b *broker
+	if m != nil {
+		b = m.brokers[name]
+	}
+	if b == nil {
+		return fmt.Errorf("unknown broker %q", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	if err := b.publisher.Publish(ctx, msg); err != nil {
+		published.Inc(name, msg.Topic, "error")
+		return err
+	}
+	published.Inc(name, msg.Topic, "ok")
+	return nil
+}
+
+// Close flushes and disconnects every broker
+func (m *Manager) Close() error {
+	if m == nil {
+		return nil
+	}
+	var errs []error
+	for name, b := range m.brokers {
+		if err := b.publisher.Close(); err != nil {
+			m.logger.Warn("Failed to close broker", "broker", name, "error", err)
+			errs = append(errs, fmt.Errorf("broker %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
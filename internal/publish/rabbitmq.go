@@ -0,0 +1,74 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// rabbitMQPublisher publishes to a RabbitMQ exchange with publisher
+// confirms. A channel is not safe for concurrent publishing, so publishes
+// are serialized.
+type rabbitMQPublisher struct {
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	exchange string
+}
+
+// newRabbitMQ connects to the first AMQP URL and opens a confirming channel
+func newRabbitMQ(cfg config.BrokerConfig) (*rabbitMQPublisher, error) {
+	conn, err := amqp.Dial(cfg.Addresses[0])
+	if err != nil {
+		return nil, err
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &rabbitMQPublisher{conn: conn, channel: channel, exchange: cfg.Exchange}, nil
+}
+
+// Publish implements Publisher, using the topic as the routing key and the
+// key as the message id
+func (p *rabbitMQPublisher) Publish(ctx context.Context, msg *Message) error {
+	headers := make(amqp.Table, len(msg.Headers))
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	confirm, err := p.channel.PublishWithDeferredConfirmWithContext(ctx, p.exchange, msg.Topic, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/protobuf",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.Key,
+		Body:         msg.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("message was not acknowledged by the broker")
+	}
+	return nil
+}
+
+// Close implements Publisher
+func (p *rabbitMQPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,123 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/errorreport"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+var panicsRecovered = metrics.NewCounterVec(
+	"gateway_panics_recovered_total",
+	"Panics recovered while handling a request, by listener protocol",
+	"protocol",
+)
+
+// headerRecorder remembers whether the response header has been written
+type headerRecorder struct {
+	http.ResponseWriter
+	written bool
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *headerRecorder) WriteHeader(status int) {
+	r.written = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (r *headerRecorder) Write(b []byte) (int, error) {
+	r.written = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (r *headerRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.written = true
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (r *headerRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware converts a panic in next into a 500 response. When the response
+// has already started the connection is aborted instead, so the client does
+// not mistake a truncated body for a complete one.
+func Middleware(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &headerRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			ctx := errorreport.NewContext(r.Context(), r.Method, r.URL.String(), r.RemoteAddr, r.Header)
+			report(ctx, logger, "http", r.URL.Path, v)
+			if rec.written {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(rec, "internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// UnaryServerInterceptor converts a panic in a unary handler into an Internal error
+func UnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				report(grpcContext(ctx, info.FullMethod), logger, "grpc", info.FullMethod, v)
+				err = status.Errorf(codes.Internal, "internal error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor converts a panic in a stream handler into an Internal error
+func StreamServerInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				report(grpcContext(ss.Context(), info.FullMethod), logger, "grpc", info.FullMethod, v)
+				err = status.Errorf(codes.Internal, "internal error")
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// grpcContext returns a context carrying the call reported with the panic
+func grpcContext(ctx context.Context, fullMethod string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return errorreport.NewContext(ctx, "POST", fullMethod, remoteAddr, md)
+}
+
+// report logs the panic with its stack trace and increments the panic counter.
+// The log record is reported with the request in ctx when error reporting is configured.
+func report(ctx context.Context, logger *slog.Logger, protocol, operation string, v any) {
+	panicsRecovered.Inc(protocol)
+	logger.ErrorContext(ctx, "Recovered from panic", "protocol", protocol, "operation", operation, "panic", v, "stack", string(debug.Stack()))
+}
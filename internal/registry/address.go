@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// AdvertiseAddress 返回注册到注册中心的地址：host 非空且不为 auto 时原样返回，
+// 否则从网卡地址中自动检测，跳过回环与链路本地地址
+func AdvertiseAddress(host string, cfg config.AdvertiseConfig) (string, error) {
+	if host != "" && host != "auto" {
+		return host, nil
+	}
+	networks := make([]*net.IPNet, 0, len(cfg.CIDRs))
+	for _, cidr := range cfg.CIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return "", fmt.Errorf("invalid server.advertise.cidrs %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	candidates, err := interfaceAddresses(cfg.Interface, cfg.IPv6)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		if cfg.Interface != "" {
+			return "", fmt.Errorf("no usable address on interface %s, set server.host", cfg.Interface)
+		}
+		return "", fmt.Errorf("no usable network address found, set server.host")
+	}
+	return selectAddress(candidates, networks).String(), nil
+}
+
+// selectAddress 选择第一个网段中的第一个地址；不在任何网段中时优先 IPv4 地址
+func selectAddress(candidates []net.IP, networks []*net.IPNet) net.IP {
+	for _, network := range networks {
+		for _, ip := range candidates {
+			if network.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	for _, ip := range candidates {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return candidates[0]
+}
+
+// interfaceAddresses 按网卡顺序返回已启用网卡上可用的地址，name 非空时只使用该网卡
+func interfaceAddresses(name string, ipv6 bool) ([]net.IP, error) {
+	var ifaces []net.Interface
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server.advertise.interface: %w", err)
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+		}
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP
+			if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || (ip.To4() == nil && !ipv6) {
+				continue
+			}
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
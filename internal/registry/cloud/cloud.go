@@ -0,0 +1,191 @@
+package cloud
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+const (
+	defaultTimeout    = 2 * time.Second
+	defaultLabelsFile = "/etc/podinfo/labels"
+)
+
+// 元数据服务的地址，测试时可以替换
+var (
+	awsEndpoint = "http://169.254.169.254"
+	gcpEndpoint = "http://metadata.google.internal"
+)
+
+// Metadata 实例元数据，未知的字段为空
+type Metadata struct {
+	Address string            // 实例的内网地址
+	Zone    string            // 可用区
+	Region  string            // 区域
+	Labels  map[string]string // 实例标签（AWS 实例标签、Kubernetes Pod 标签与 Pod 信息）
+}
+
+// Lookup 按配置的提供方查询实例元数据；未配置提供方时返回 nil
+func Lookup(ctx context.Context, cfg config.CloudMetadataConfig) (*Metadata, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "aws":
+		return lookupAWS(ctx)
+	case "gcp":
+		return lookupGCP(ctx)
+	case "kubernetes":
+		labelsFile := cfg.LabelsFile
+		if labelsFile == "" {
+			labelsFile = defaultLabelsFile
+		}
+		return lookupKubernetes(labelsFile)
+	default:
+		return nil, fmt.Errorf("unsupported cloud metadata provider: %s", cfg.Provider)
+	}
+}
+
+// lookupAWS 通过 IMDSv2 查询 EC2 实例元数据。实例标签仅在实例开启了元数据中的标签时可用
+func lookupAWS(ctx context.Context) (*Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get EC2 metadata token: %w", err)
+	}
+	get := func(path string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, awsEndpoint+"/latest/meta-data/"+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		return fetch(req)
+	}
+
+	md := &Metadata{Labels: make(map[string]string)}
+	for _, field := range []struct {
+		path string
+		dst  *string
+	}{
+		{"local-ipv4", &md.Address},
+		{"placement/availability-zone", &md.Zone},
+		{"placement/region", &md.Region},
+	} {
+		if *field.dst, err = get(field.path); err != nil {
+			return nil, fmt.Errorf("failed to get EC2 metadata %s: %w", field.path, err)
+		}
+	}
+	if keys, err := get("tags/instance"); err == nil {
+		for _, key := range strings.Fields(keys) {
+			if value, err := get("tags/instance/" + key); err == nil {
+				md.Labels[key] = value
+			}
+		}
+	}
+	return md, nil
+}
+
+// lookupGCP 查询 Compute Engine 实例元数据，区域由可用区得出
+func lookupGCP(ctx context.Context) (*Metadata, error) {
+	get := func(path string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpEndpoint+"/computeMetadata/v1/instance/"+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		return fetch(req)
+	}
+
+	address, err := get("network-interfaces/0/ip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCE metadata ip: %w", err)
+	}
+	zone, err := get("zone")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCE metadata zone: %w", err)
+	}
+	// 可用区的格式为 projects/<项目编号>/zones/<可用区>
+	zone = zone[strings.LastIndexByte(zone, '/')+1:]
+	md := &Metadata{Address: address, Zone: zone, Labels: make(map[string]string)}
+	if i := strings.LastIndexByte(zone, '-'); i > 0 {
+		md.Region = zone[:i]
+	}
+	return md, nil
+}
+
+// lookupKubernetes 读取 Downward API 通过环境变量（POD_IP、POD_NAME、POD_NAMESPACE、NODE_NAME）
+// 与标签文件暴露的 Pod 信息；可用区与区域来自 Pod 的 topology.kubernetes.io 标签
+func lookupKubernetes(labelsFile string) (*Metadata, error) {
+	md := &Metadata{Address: os.Getenv("POD_IP"), Labels: make(map[string]string)}
+	if md.Address == "" {
+		return nil, fmt.Errorf("POD_IP is not set, expose status.podIP through the downward API")
+	}
+	for env, label := range map[string]string{"POD_NAME": "pod", "POD_NAMESPACE": "namespace", "NODE_NAME": "node"} {
+		if value := os.Getenv(env); value != "" {
+			md.Labels[label] = value
+		}
+	}
+
+	f, err := os.Open(labelsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return md, nil
+		}
+		return nil, fmt.Errorf("failed to read pod labels: %w", err)
+	}
+	defer f.Close()
+	// 每行的格式为 key="value"，值按 Go 字符串字面量转义
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, quoted, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			value = quoted
+		}
+		md.Labels[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pod labels: %w", err)
+	}
+	md.Zone = md.Labels["topology.kubernetes.io/zone"]
+	md.Region = md.Labels["topology.kubernetes.io/region"]
+	return md, nil
+}
+
+// fetch 发送请求并返回响应内容
+func fetch(req *http.Request) (string, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata service returned %s", resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
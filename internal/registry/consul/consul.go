@@ -74,7 +74,7 @@ func (r *Registry) Register(ctx context.Context, instance *registry.ServiceInsta
 	// 如果有HTTP端口，使用HTTP健康检查
 	if instance.Metadata != nil && instance.Metadata["http_port"] != "" {
 		httpPort := instance.Metadata["http_port"]
-		check.HTTP = fmt.Sprintf("http://%s:%s/health", instance.Address, httpPort)
+		check.HTTP = fmt.Sprintf("http://%s:%s/healthz", instance.Address, httpPort)
 		check.Interval = "10s"
 		check.TTL = ""
 	}
@@ -113,7 +113,7 @@ func (r *Registry) Deregister(ctx context.Context, instanceID string) error {
 
 // Discover 发现服务实例列表
 func (r *Registry) Discover(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
-	services, _, err := r.client.Health().Service(serviceName, "", true, nil)
+	services, _, err := r.client.Health().Service(serviceName, "", true, (&api.QueryOptions{}).WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover service: %w", err)
 	}
@@ -134,6 +134,46 @@ func (r *Registry) Discover(ctx context.Context, serviceName string) ([]*registr
 	return instances, nil
 }
 
+// DiscoverAll 实现 registry.InstanceLister：返回服务的健康实例与未通过健康检查的实例
+func (r *Registry) DiscoverAll(ctx context.Context, serviceName string) (healthy, unhealthy []*registry.ServiceInstance, err error) {
+	services, _, err := r.client.Health().Service(serviceName, "", false, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover service: %w", err)
+	}
+
+	for _, service := range services {
+		instance := &registry.ServiceInstance{
+			ID:       service.Service.ID,
+			Name:     service.Service.Service,
+			Address:  service.Service.Address,
+			Port:     service.Service.Port,
+			Tags:     service.Service.Tags,
+			Metadata: service.Service.Meta,
+		}
+		if service.Checks.AggregatedStatus() == api.HealthPassing {
+			healthy = append(healthy, instance)
+		} else {
+			unhealthy = append(unhealthy, instance)
+		}
+	}
+	return healthy, unhealthy, nil
+}
+
+// SetMaintenance 实现 registry.Maintainer：使用 Consul 的服务维护模式，维护中的实例健康检查为 critical
+func (r *Registry) SetMaintenance(ctx context.Context, instanceID string, enabled bool, reason string) error {
+	opts := (&api.QueryOptions{}).WithContext(ctx)
+	if enabled {
+		if err := r.client.Agent().EnableServiceMaintenanceOpts(instanceID, reason, opts); err != nil {
+			return fmt.Errorf("failed to enable maintenance: %w", err)
+		}
+		return nil
+	}
+	if err := r.client.Agent().DisableServiceMaintenanceOpts(instanceID, opts); err != nil {
+		return fmt.Errorf("failed to disable maintenance: %w", err)
+	}
+	return nil
+}
+
 // Watch 监听服务变化
 func (r *Registry) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
 	return newWatcher(ctx, r.client, serviceName)
@@ -15,6 +15,7 @@ func NewConsulRegistry(cfg *config.Config) (registry.Registry, error) {
 	return NewRegistry(&Config{
 		Address:            cfg.Registry.Address,
 		Scheme:             "http",
+		Token:              cfg.Registry.Token,
 		HealthCheckTimeout: cfg.Registry.HealthCheckTimeout,
 		HealthCheckTTL:     cfg.Registry.HealthCheckTTL,
 	})
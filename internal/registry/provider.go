@@ -9,6 +9,7 @@ import (
 
 // ProviderSet 注册中心Provider集合
 var ProviderSet = wire.NewSet(
+	ProvideRecorder,
 	ProvideRegistry,
 )
 
@@ -23,8 +24,8 @@ func RegisterFactory(registryType string, factory RegistryFactory) {
 	registryFactories[registryType] = factory
 }
 
-// ProvideRegistry 提供注册中心实例
-func ProvideRegistry(cfg *config.Config) (Registry, error) {
+// ProvideRecorder 提供记录服务发现结果的注册中心，未启用注册中心时返回 nil
+func ProvideRecorder(cfg *config.Config) (*Recorder, error) {
 	if !cfg.Registry.Enabled {
 		return nil, nil
 	}
@@ -34,5 +35,17 @@ func ProvideRegistry(cfg *config.Config) (Registry, error) {
 		return nil, fmt.Errorf("unsupported registry type: %s", cfg.Registry.Type)
 	}
 
-	return factory(cfg)
+	reg, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(reg), nil
+}
+
+// ProvideRegistry 提供注册中心实例，所有服务发现经由 Recorder 记录
+func ProvideRegistry(recorder *Recorder) Registry {
+	if recorder == nil {
+		return nil
+	}
+	return recorder
 }
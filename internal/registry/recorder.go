@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InstanceLister 可选接口：注册中心能够同时列出未通过健康检查的实例时实现
+type InstanceLister interface {
+	// DiscoverAll 返回服务的健康实例与未通过健康检查的实例
+	DiscoverAll(ctx context.Context, serviceName string) (healthy, unhealthy []*ServiceInstance, err error)
+}
+
+// Refresh 一次服务发现的结果
+type Refresh struct {
+	Time      time.Time `json:"time"`
+	Instances int       `json:"instances"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Recorder 记录每个服务最近一次服务发现结果的注册中心装饰器
+type Recorder struct {
+	Registry
+	mu        sync.RWMutex
+	refreshes map[string]Refresh
+}
+
+// NewRecorder 包装注册中心，记录经由它的服务发现
+func NewRecorder(reg Registry) *Recorder {
+	return &Recorder{
+		Registry:  reg,
+		refreshes: make(map[string]Refresh),
+	}
+}
+
+// Discover 发现服务实例列表并记录结果
+func (r *Recorder) Discover(ctx context.Context, serviceName string) ([]*ServiceInstance, error) {
+	instances, err := r.Registry.Discover(ctx, serviceName)
+	refresh := Refresh{Time: time.Now(), Instances: len(instances)}
+	if err != nil {
+		refresh.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.refreshes[serviceName] = refresh
+	r.mu.Unlock()
+	return instances, err
+}
+
+// DiscoverAll 实现 InstanceLister，注册中心不支持时返回错误；结果不计入服务发现记录
+func (r *Recorder) DiscoverAll(ctx context.Context, serviceName string) (healthy, unhealthy []*ServiceInstance, err error) {
+	lister, ok := r.Registry.(InstanceLister)
+	if !ok {
+		return nil, nil, fmt.Errorf("registry does not list unhealthy instances")
+	}
+	return lister.DiscoverAll(ctx, serviceName)
+}
+
+// SetMaintenance 实现 Maintainer，注册中心不支持时返回错误
+func (r *Recorder) SetMaintenance(ctx context.Context, instanceID string, enabled bool, reason string) error {
+	maintainer, ok := r.Registry.(Maintainer)
+	if !ok {
+		return fmt.Errorf("registry does not support maintenance mode")
+	}
+	return maintainer.SetMaintenance(ctx, instanceID, enabled, reason)
+}
+
+// LastRefresh 返回服务最近一次服务发现的结果
+func (r *Recorder) LastRefresh(serviceName string) (Refresh, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	refresh, ok := r.refreshes[serviceName]
+	return refresh, ok
+}
+
+// Services 返回发现过的服务名，按名称排序
+func (r *Recorder) Services() []string {
+	r.mu.RLock()
+	services := make([]string, 0, len(r.refreshes))
+	for name := range r.refreshes {
+		services = append(services, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(services)
+	return services
+}
@@ -39,3 +39,9 @@ type Watcher interface {
 	// Stop 停止监听
 	Stop() error
 }
+
+// Maintainer 可选接口：注册中心支持将实例置于维护状态时实现，维护中的实例不再被服务发现返回
+type Maintainer interface {
+	// SetMaintenance 开启或关闭实例的维护状态
+	SetMaintenance(ctx context.Context, instanceID string, enabled bool, reason string) error
+}
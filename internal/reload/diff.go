@@ -0,0 +1,58 @@
+package reload
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the dotted JSON paths of all leaf fields that differ between a and b.
+// Slices and maps are compared as a whole.
+func Diff(a, b any) []string {
+	var changed []string
+	diffValue(reflect.ValueOf(a), reflect.ValueOf(b), "", &changed)
+	return changed
+}
+
+func diffValue(a, b reflect.Value, prefix string, changed *[]string) {
+	if a.Kind() == reflect.Pointer {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*changed = append(*changed, prefix)
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changed = append(*changed, prefix)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		diffValue(a.Field(i), b.Field(i), name, changed)
+	}
+}
+
+// jsonName returns the JSON name of a struct field
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
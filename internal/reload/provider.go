@@ -0,0 +1,27 @@
+package reload
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet config reload provider set
+var ProviderSet = wire.NewSet(
+	ProvideWatcher,
+)
+
+// ProvideWatcher provides the config watcher, or nil when config reload is disabled
+func ProvideWatcher(cfg *config.Config, opts *config.Options, log *slog.Logger) *Watcher {
+	if !cfg.Reload.Enabled {
+		return nil
+	}
+
+	w := NewWatcher(cfg, opts, logger.Component(log, "config_reload"))
+	w.OnChange("log.level", func(_, next *config.Config) error {
+		return logger.SetLevel(next.Log.Level)
+	})
+	return w
+}
@@ -0,0 +1,223 @@
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+const defaultInterval = 5 * time.Second
+
+// ApplyFunc applies a changed config section to a running component
+type ApplyFunc func(old, new *config.Config) error
+
+// handler applies changes under a config section
+type handler struct {
+	section string
+	apply   ApplyFunc
+}
+
+// Report describes the outcome of a reload
+type Report struct {
+	Time            time.Time         `json:"time"`
+	Applied         []string          `json:"applied"`
+	RestartRequired []string          `json:"restart_required"`
+	Failed          map[string]string `json:"failed,omitempty"`
+}
+
+// Watcher polls the config file, its includes and environment overlay, and
+// applies safe changes without a restart
+type Watcher struct {
+	opts     *config.Options
+	path     string
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu       sync.Mutex
+	current  *config.Config
+	checksum [sha256.Size]byte
+	handlers []handler
+	last     *Report
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewWatcher creates a config watcher for the running config
+func NewWatcher(cfg *config.Config, opts *config.Options, logger *slog.Logger) *Watcher {
+	interval := cfg.Reload.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	w := &Watcher{
+		opts:     opts,
+		path:     config.ResolvePath(opts),
+		interval: interval,
+		logger:   logger,
+		current:  cfg,
+		stopCh:   make(chan struct{}),
+	}
+	if sum, err := fingerprint(cfg.Sources); err == nil {
+		w.checksum = sum
+	}
+	return w
+}
+
+// OnChange registers fn to apply changes under a dotted config section such as
+// "log.level" or "access_log". Fields without a handler require a restart.
+func (w *Watcher) OnChange(section string, fn ApplyFunc) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, handler{section: section, apply: fn})
+}
+
+// Current returns the most recently applied config
+func (w *Watcher) Current() *config.Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// LastReport returns the report of the most recent reload, or nil
+func (w *Watcher) LastReport() *Report {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Start polls the config file until ctx is done or Stop is called
+func (w *Watcher) Start(ctx context.Context) {
+	w.logger.Info("Watching config file", "path", w.path, "sources", w.Current().Sources, "interval", w.interval)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				if changed, err := w.modified(); err != nil {
+					w.logger.Warn("Failed to read config file", "path", w.path, "error", err)
+				} else if changed {
+					if _, err := w.Reload(); err != nil {
+						w.logger.Error("Config reload failed", "path", w.path, "error", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops polling
+func (w *Watcher) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// modified reports whether any source file changed since the last reload
+func (w *Watcher) modified() (bool, error) {
+	w.mu.Lock()
+	sources := w.current.Sources
+	w.mu.Unlock()
+
+	sum, err := fingerprint(sources)
+	if err != nil {
+		return false, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return sum != w.checksum, nil
+}
+
+// fingerprint hashes the content of all config source files
+func fingerprint(paths []string) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", path, len(data))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// Reload loads the config files and applies every changed section that has a handler
+func (w *Watcher) Reload() (*Report, error) {
+	next, err := config.Reload(w.opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	sum, err := fingerprint(next.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checksum = sum
+
+	report := &Report{Time: time.Now(), Applied: []string{}, RestartRequired: []string{}}
+	changed := Diff(w.current, next)
+	handled := make(map[string]bool, len(changed))
+	for _, h := range w.handlers {
+		var fields []string
+		for _, field := range changed {
+			if covers(h.section, field) {
+				fields = append(fields, field)
+				handled[field] = true
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if err := h.apply(w.current, next); err != nil {
+			if report.Failed == nil {
+				report.Failed = make(map[string]string)
+			}
+			for _, f := range fields {
+				report.Failed[f] = err.Error()
+			}
+			continue
+		}
+		report.Applied = append(report.Applied, fields...)
+	}
+	for _, field := range changed {
+		if !handled[field] {
+			report.RestartRequired = append(report.RestartRequired, field)
+		}
+	}
+
+	w.current = next
+	w.last = report
+	w.logger.Info("Config reloaded",
+		"path", w.path,
+		"applied", report.Applied,
+		"restart_required", report.RestartRequired,
+		"failed", report.Failed,
+	)
+	return report, nil
+}
+
+// covers reports whether a handler section includes a changed field
+func covers(section, field string) bool {
+	return field == section || strings.HasPrefix(field, section+".")
+}
@@ -0,0 +1,144 @@
+package requestinfo
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/statusmap"
+)
+
+// responseRecorder captures the status code and body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware tracks every request handled by next and notifies observers on completion.
+// Handlers enrich the request info through FromContext.
+func Middleware(next http.Handler, observers ...Observer) http.Handler {
+	if len(observers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &Info{
+			Time:       time.Now(),
+			Protocol:   "http",
+			RemoteAddr: r.RemoteAddr,
+			HTTPMethod: r.Method,
+			Path:       r.URL.Path,
+			UserAgent:  r.UserAgent(),
+			BytesIn:    r.ContentLength,
+			Metadata:   r.Header,
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		// Deferred so that responses aborted with http.ErrAbortHandler after
+		// being partly sent are reported as well
+		defer func() {
+			info.Duration = time.Since(info.Time)
+			info.Status = rec.status
+			if info.Status == 0 {
+				info.Status = http.StatusOK
+			}
+			info.BytesOut = rec.bytes
+			notify(observers, info)
+		}()
+
+		next.ServeHTTP(rec, r.WithContext(WithInfo(r.Context(), info)))
+	})
+}
+
+// serverStream overrides the context of a grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamHandler tracks every stream handled by handler and notifies observers on completion
+func StreamHandler(handler grpc.StreamHandler, observers ...Observer) grpc.StreamHandler {
+	if len(observers) == 0 {
+		return handler
+	}
+	return func(srv any, stream grpc.ServerStream) error {
+		ctx := stream.Context()
+		info := &Info{
+			Time:     time.Now(),
+			Protocol: "grpc",
+		}
+		if fullMethod, ok := grpc.MethodFromServerStream(stream); ok {
+			info.Path = fullMethod
+			service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+			info.Service, info.Method = service, method
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			info.RemoteAddr = p.Addr.String()
+		}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			info.Metadata = md
+			if ua := md.Get("user-agent"); len(ua) > 0 {
+				info.UserAgent = ua[0]
+			}
+		}
+
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: WithInfo(ctx, info)})
+
+		info.Duration = time.Since(info.Time)
+		st := status.Convert(err)
+		info.GRPCCode = st.Code().String()
+		info.Status = statusmap.HTTPStatus(st.Code())
+		if err != nil {
+			info.Error = st.Message()
+		}
+		notify(observers, info)
+		return err
+	}
+}
+
+// notify passes the completed request to all observers
+func notify(observers []Observer, info *Info) {
+	for _, o := range observers {
+		o.Observe(info)
+	}
+}
@@ -0,0 +1,75 @@
+package requestinfo
+
+import (
+	"context"
+	"time"
+)
+
+// Info describes a single proxied request. It is created when a request enters
+// the gateway, enriched by handlers and proxies, and passed to observers on completion.
+type Info struct {
+	Time       time.Time
+	Protocol   string // http or grpc
+	RemoteAddr string
+	HTTPMethod string
+	Path       string
+	Tenant     string
+	Service    string
+	Method     string
+	Upstream   string // Selected backend address
+	Instance   string // Registry ID of the selected backend instance
+	ConnReused bool   // The upstream call used an already open connection
+	Attempts   int    // Upstream attempts, including retries
+	Status     int    // HTTP status code
+	GRPCCode   string // gRPC status code
+	BytesIn    int64
+	BytesOut   int64
+	Duration   time.Duration
+	UserAgent  string
+	Error      string
+
+	// W3C trace context of the gateway's span, set when tracing is enabled
+	TraceID      string
+	SpanID       string
+	ParentSpanID string // Span of the caller, empty when the request started the trace
+	TraceSampled bool
+
+	// Request headers or gRPC metadata, shared with the request and not to be modified
+	Metadata map[string][]string
+
+	// Raw bodies of unary HTTP requests, only retained for observers that inspect payloads
+	RequestBody  []byte
+	ResponseBody []byte
+
+	// First raw request message of gRPC calls and the number of request
+	// messages received, only retained while traffic is captured; also the
+	// protobuf body of HTTP requests forwarded without decoding
+	RequestMessage  []byte
+	RequestMessages int
+}
+
+// Observer is notified when a request completes
+type Observer interface {
+	Observe(info *Info)
+}
+
+// ObserverFunc adapts a function to Observer
+type ObserverFunc func(info *Info)
+
+// Observe implements Observer
+func (f ObserverFunc) Observe(info *Info) {
+	f(info)
+}
+
+type infoKey struct{}
+
+// WithInfo attaches request info to the context so downstream components can enrich it
+func WithInfo(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// FromContext returns the request info attached to the context, or nil
+func FromContext(ctx context.Context) *Info {
+	info, _ := ctx.Value(infoKey{}).(*Info)
+	return info
+}
@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet route rule provider set
+var ProviderSet = wire.NewSet(
+	ProvideEngine,
+)
+
+// ProvideEngine provides the route rule engine with the configured rules,
+// recompiling them when the routes section is reloaded
+func ProvideEngine(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher) (*Engine, error) {
+	engine, err := New(logger.Component(log, "routes"))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBrokers(cfg.Routes, cfg.Brokers); err != nil {
+		return nil, err
+	}
+	if err := engine.Load(cfg.Routes); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("routes", func(_, next *config.Config) error {
+		// Brokers are connected at startup, so reloaded rules may only use those
+		if err := checkBrokers(next.Routes, cfg.Brokers); err != nil {
+			return err
+		}
+		return engine.Load(next.Routes)
+	})
+	return engine, nil
+}
+
+// checkBrokers reports rules that publish to a broker that is not configured
+func checkBrokers(rules []config.RouteConfig, brokers map[string]config.BrokerConfig) error {
+	for i, rule := range rules {
+		if rule.Publish == nil || rule.Publish.Broker == "" {
+			continue
+		}
+		if _, ok := brokers[rule.Publish.Broker]; !ok {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("routes[%d]", i)
+			}
+			return fmt.Errorf("route %s: unknown broker %q", name, rule.Publish.Broker)
+		}
+	}
+	return nil
+}
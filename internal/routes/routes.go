@@ -0,0 +1,402 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// Input is the request the rules are evaluated against
+type Input struct {
+	Tenant     string
+	Service    string
+	Method     string
+	Headers    map[string]string // Lower-case header names
+	RemoteAddr string
+	Claims     map[string]any
+	Body       []byte // JSON request body
+}
+
+// Outcome is the combined effect of the rules that applied to a request
+type Outcome struct {
+	Denied  bool
+	Status  int    // HTTP status for a denial
+	Reason  string // Name of the denying rule
+	Headers map[string]string
+	Body    []byte   // Rewritten request body, nil when unchanged
+	Hooks   []Hook   // Webhooks of the rules that applied, in rule order
+	Publish *Publish // Set when a rule publishes the request instead of proxying it
+}
+
+// Publish is the message queue target of a route rule
+type Publish struct {
+	Route string // Name of the route rule
+	config.PublishConfig
+	Key string // Evaluated message key
+}
+
+// Hook is a webhook of a route rule
+type Hook struct {
+	Route string // Name of the route rule
+	config.WebhookConfig
+}
+
+// field is a compiled set_fields entry
+type field struct {
+	path []string
+	prog cel.Program
+}
+
+// rule is a compiled route rule
+type rule struct {
+	name    string
+	match   string
+	when    cel.Program // nil always applies
+	deny    bool
+	status  int
+	headers map[string]cel.Program
+	fields  []field
+	hooks   []Hook
+	publish *config.PublishConfig
+	key     cel.Program // nil without a key expression
+}
+
+// Engine evaluates route rules. Expressions are compiled once when the rules
+// are loaded and reused across reloads while their source is unchanged.
+type Engine struct {
+	env    *cel.Env
+	rules  atomic.Pointer[[]*rule]
+	mu     sync.Mutex // Serializes Load
+	cache  map[string]cel.Program
+	claims map[string]bool // Cached expressions that read claims
+	logger *slog.Logger
+
+	usesClaims atomic.Bool // Some loaded expression reads claims
+}
+
+// New creates an engine with no rules. Expressions see the variables
+// request (tenant, service, method, headers, remote_addr), claims and body.
+func New(logger *slog.Logger) (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("body", cel.DynType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create expression environment: %w", err)
+	}
+	e := &Engine{env: env, cache: make(map[string]cel.Program), claims: make(map[string]bool), logger: logger}
+	e.rules.Store(&[]*rule{})
+	return e, nil
+}
+
+// Load compiles cfgs and replaces the current rules. On error the current
+// rules are kept.
+func (e *Engine) Load(cfgs []config.RouteConfig) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cache := make(map[string]cel.Program)
+	claims := make(map[string]bool)
+	compile := func(expr string) (cel.Program, error) {
+		if prog, ok := cache[expr]; ok {
+			return prog, nil
+		}
+		prog, ok := e.cache[expr]
+		readsClaims := e.claims[expr]
+		if !ok {
+			ast, issues := e.env.Compile(expr)
+			if issues != nil && issues.Err() != nil {
+				return nil, issues.Err()
+			}
+			var err error
+			if prog, err = e.env.Program(ast, cel.EvalOptions(cel.OptOptimize)); err != nil {
+				return nil, err
+			}
+			readsClaims = referencesClaims(ast)
+		}
+		cache[expr] = prog
+		if readsClaims {
+			claims[expr] = true
+		}
+		return prog, nil
+	}
+
+	rules := make([]*rule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		r := &rule{
+			name:    cfg.Name,
+			match:   cfg.Match,
+			deny:    cfg.Deny,
+			status:  cfg.Status,
+			headers: make(map[string]cel.Program, len(cfg.SetHeaders)),
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("routes[%d]", i)
+		}
+		if _, err := path.Match(r.match, ""); err != nil {
+			return fmt.Errorf("route %s: invalid match %q: %w", r.name, r.match, err)
+		}
+		if cfg.When != "" {
+			prog, err := compile(cfg.When)
+			if err != nil {
+				return fmt.Errorf("route %s: invalid condition: %w", r.name, err)
+			}
+			r.when = prog
+		}
+		for name, expr := range cfg.SetHeaders {
+			prog, err := compile(expr)
+			if err != nil {
+				return fmt.Errorf("route %s: invalid expression for header %s: %w", r.name, name, err)
+			}
+			r.headers[strings.ToLower(name)] = prog
+		}
+		paths := make([]string, 0, len(cfg.SetFields))
+		for p := range cfg.SetFields {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			prog, err := compile(cfg.SetFields[p])
+			if err != nil {
+				return fmt.Errorf("route %s: invalid expression for field %s: %w", r.name, p, err)
+			}
+			r.fields = append(r.fields, field{path: strings.Split(p, "."), prog: prog})
+		}
+		for _, hook := range cfg.Webhooks {
+			if hook.URL == "" {
+				return fmt.Errorf("route %s: webhook requires a url", r.name)
+			}
+			switch hook.Phase {
+			case "":
+				hook.Phase = "before"
+			case "before", "after":
+			default:
+				return fmt.Errorf("route %s: unsupported webhook phase %q", r.name, hook.Phase)
+			}
+			r.hooks = append(r.hooks, Hook{Route: r.name, WebhookConfig: hook})
+		}
+		if p := cfg.Publish; p != nil {
+			if p.Broker == "" || p.Topic == "" || p.MessageType == "" {
+				return fmt.Errorf("route %s: publish requires broker, topic and message_type", r.name)
+			}
+			r.publish = p
+			if p.Key != "" {
+				prog, err := compile(p.Key)
+				if err != nil {
+					return fmt.Errorf("route %s: invalid expression for publish key: %w", r.name, err)
+				}
+				r.key = prog
+			}
+		}
+		rules = append(rules, r)
+	}
+
+	e.cache = cache
+	e.claims = claims
+	e.rules.Store(&rules)
+	e.usesClaims.Store(len(claims) > 0)
+	return nil
+}
+
+// UsesClaims reports whether an expression of the loaded rules reads claims
+func (e *Engine) UsesClaims() bool {
+	return e != nil && e.usesClaims.Load()
+}
+
+// referencesClaims reports whether a compiled expression reads the claims variable
+func referencesClaims(ast *cel.Ast) bool {
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return false
+	}
+	for _, ref := range checked.GetReferenceMap() {
+		if ref.GetName() == "claims" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the match glob of any rule covers
+// "package.Service/Method", i.e. whether Evaluate may need the request body
+func (e *Engine) Matches(service, method string) bool {
+	if e == nil {
+		return false
+	}
+	route := service + "/" + method
+	for _, r := range *e.rules.Load() {
+		if r.match == "" {
+			return true
+		}
+		if ok, _ := path.Match(r.match, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies the rules in order. A rule applies when its match glob
+// covers "package.Service/Method" and its condition is true; a condition that
+// fails to evaluate, for example on a missing map key, does not apply. The
+// first denying rule stops the evaluation; the first publishing rule sets the
+// publish target.
+func (e *Engine) Evaluate(in *Input) (*Outcome, error) {
+	rules := *e.rules.Load()
+	out := &Outcome{}
+	if len(rules) == 0 {
+		return out, nil
+	}
+
+	route := in.Service + "/" + in.Method
+	var body any
+	bodyParsed, bodyChanged := false, false
+	parseBody := func() any {
+		if !bodyParsed {
+			bodyParsed = true
+			if err := json.Unmarshal(in.Body, &body); err != nil {
+				body = nil
+			}
+		}
+		return body
+	}
+	vars := map[string]any{
+		"request": map[string]any{
+			"tenant":      in.Tenant,
+			"service":     in.Service,
+			"method":      in.Method,
+			"headers":     in.Headers,
+			"remote_addr": in.RemoteAddr,
+		},
+		"claims": claims(in.Claims),
+		"body":   parseBody,
+	}
+
+	for _, r := range rules {
+		if r.match != "" {
+			if ok, _ := path.Match(r.match, route); !ok {
+				continue
+			}
+		}
+		if r.when != nil {
+			val, _, err := r.when.Eval(vars)
+			if err != nil {
+				e.logger.Debug("Route condition could not be evaluated", "route", r.name, "error", err)
+				continue
+			}
+			if val != types.True {
+				continue
+			}
+		}
+
+		if r.deny {
+			out.Denied = true
+			out.Status = r.status
+			out.Reason = r.name
+			return out, nil
+		}
+		for name, prog := range r.headers {
+			val, _, err := prog.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: header %s: %w", r.name, name, err)
+			}
+			if out.Headers == nil {
+				out.Headers = make(map[string]string)
+			}
+			out.Headers[name] = headerValue(val)
+		}
+		for _, f := range r.fields {
+			val, _, err := f.prog.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: field %s: %w", r.name, strings.Join(f.path, "."), err)
+			}
+			native, err := jsonValue(val)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: field %s: %w", r.name, strings.Join(f.path, "."), err)
+			}
+			object, ok := parseBody().(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("route %s: request body is not a JSON object", r.name)
+			}
+			setField(object, f.path, native)
+			bodyChanged = true
+		}
+		out.Hooks = append(out.Hooks, r.hooks...)
+		if r.publish != nil && out.Publish == nil {
+			out.Publish = &Publish{Route: r.name, PublishConfig: *r.publish}
+			if r.key != nil {
+				val, _, err := r.key.Eval(vars)
+				if err != nil {
+					return nil, fmt.Errorf("route %s: publish key: %w", r.name, err)
+				}
+				out.Publish.Key = headerValue(val)
+			}
+		}
+	}
+
+	if bodyChanged {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal rewritten body: %w", err)
+		}
+		out.Body = data
+	}
+	return out, nil
+}
+
+// claims returns an empty map for requests without claims so expressions can
+// test them with the in operator
+func claims(c map[string]any) map[string]any {
+	if c == nil {
+		return map[string]any{}
+	}
+	return c
+}
+
+// headerValue formats an expression result as a header value
+func headerValue(val ref.Val) string {
+	if s, ok := val.Value().(string); ok {
+		return s
+	}
+	if native, err := jsonValue(val); err == nil {
+		if data, err := json.Marshal(native); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(val.Value())
+}
+
+// jsonValue converts an expression result into a value encodable as JSON
+func jsonValue(val ref.Val) (any, error) {
+	native, err := val.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, err
+	}
+	return native.(*structpb.Value).AsInterface(), nil
+}
+
+// setField sets a dotted path in a JSON object, creating intermediate objects
+func setField(object map[string]any, path []string, value any) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			object[key] = next
+		}
+		object = next
+	}
+	object[path[len(path)-1]] = value
+}
@@ -0,0 +1,32 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvProvider resolves ${env:VAR} references from environment variables
+type EnvProvider struct{}
+
+// Resolve returns the value of the environment variable ref, which must be set
+func (EnvProvider) Resolve(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// FileProvider resolves ${file:/path} references from files such as mounted secrets
+type FileProvider struct{}
+
+// Resolve returns the content of the file at ref without its trailing newline
+func (FileProvider) Resolve(_ context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// Provider resolves secret references for a single scheme
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// referencePattern matches ${scheme:reference} placeholders
+var referencePattern = regexp.MustCompile(`\$\{([a-z]+):([^}]+)\}`)
+
+// Resolver replaces ${scheme:reference} placeholders in strings using registered providers
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a secret resolver
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register registers a provider for a scheme, e.g. "vault"
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.providers[scheme] = provider
+}
+
+// ResolveString replaces all placeholders in s
+func (r *Resolver) ResolveString(ctx context.Context, s string) (string, error) {
+	var resolveErr error
+	result := referencePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if resolveErr != nil {
+			return match
+		}
+		groups := referencePattern.FindStringSubmatch(match)
+		provider, ok := r.providers[groups[1]]
+		if !ok {
+			// Unknown schemes are left untouched
+			return match
+		}
+		value, err := provider.Resolve(ctx, groups[2])
+		if err != nil {
+			resolveErr = fmt.Errorf("failed to resolve %s: %w", match, err)
+			return match
+		}
+		return value
+	})
+	return result, resolveErr
+}
+
+// ResolveStruct resolves placeholders in every string reachable from v, which must be a pointer
+func (r *Resolver) ResolveStruct(ctx context.Context, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("resolve target must be a non-nil pointer")
+	}
+	return r.resolveValue(ctx, rv.Elem(), "")
+}
+
+// resolveValue walks a value recursively and resolves settable strings
+func (r *Resolver) resolveValue(ctx context.Context, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.resolveValue(ctx, v.Elem(), path)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := r.resolveValue(ctx, v.Field(i), path+"."+t.Field(i).Name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			for _, key := range v.MapKeys() {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				elem.Set(v.MapIndex(key))
+				if err := r.resolveValue(ctx, elem, fmt.Sprintf("%s[%v]", path, key)); err != nil {
+					return err
+				}
+				v.SetMapIndex(key, elem)
+			}
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			resolved, err := r.ResolveString(ctx, v.MapIndex(key).String())
+			if err != nil {
+				return fmt.Errorf("%s[%v]: %w", path, key, err)
+			}
+			v.SetMapIndex(key, reflect.ValueOf(resolved).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		resolved, err := r.ResolveString(ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(resolved)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultOptions HashiCorp Vault client options
+type VaultOptions struct {
+	Address       string        // Vault address, e.g. https://vault:8200
+	Token         string        // Vault token (falls back to VAULT_TOKEN)
+	TokenFile     string        // File containing the Vault token
+	Namespace     string        // Vault Enterprise namespace
+	KVVersion     int           // KV secrets engine version: 1 or 2
+	Timeout       time.Duration // HTTP request timeout
+	RenewInterval time.Duration // Token renewal interval (0 derives it from the token TTL)
+}
+
+// VaultClient reads secrets from HashiCorp Vault over its HTTP API
+type VaultClient struct {
+	opts       VaultOptions
+	httpClient *http.Client
+	mu         sync.RWMutex
+	token      string
+}
+
+// NewVaultClient creates a Vault client
+func NewVaultClient(opts VaultOptions) (*VaultClient, error) {
+	if opts.Address == "" {
+		opts.Address = os.Getenv("VAULT_ADDR")
+	}
+	if opts.Address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+	if opts.KVVersion == 0 {
+		opts.KVVersion = 2
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	token := opts.Token
+	if token == "" && opts.TokenFile != "" {
+		data, err := os.ReadFile(opts.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault token is required")
+	}
+
+	return &VaultClient{
+		opts:       opts,
+		httpClient: &http.Client{Timeout: opts.Timeout},
+		token:      token,
+	}, nil
+}
+
+// Resolve reads a secret reference in the form "path#key".
+// For KV v2 the path is given without the "data/" segment, e.g. "secret/gateway#auth_token".
+func (c *VaultClient) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q, expected path#key", ref)
+	}
+
+	apiPath := strings.Trim(path, "/")
+	if c.opts.KVVersion == 2 {
+		mount, rest, _ := strings.Cut(apiPath, "/")
+		apiPath = mount + "/data/" + rest
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/"+apiPath, nil, &resp); err != nil {
+		return "", err
+	}
+
+	data := resp.Data
+	if c.opts.KVVersion == 2 {
+		var inner struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &inner); err != nil {
+			return "", fmt.Errorf("failed to decode vault secret %s: %w", path, err)
+		}
+		data = inner.Data
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret %s: %w", path, err)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in vault secret %s", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// StartRenewal renews the client token in the background until ctx is done
+func (c *VaultClient) StartRenewal(ctx context.Context) {
+	go func() {
+		for {
+			interval := c.opts.RenewInterval
+			if interval <= 0 {
+				ttl, renewable, err := c.lookupSelf(ctx)
+				switch {
+				case err != nil:
+					slog.Warn("Failed to look up vault token", "error", err)
+					interval = time.Minute
+				case !renewable || ttl <= 0:
+					// Root and non-renewable tokens never need renewal
+					return
+				default:
+					interval = ttl / 2
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+
+			if err := c.renewSelf(ctx); err != nil {
+				slog.Warn("Failed to renew vault token", "error", err)
+			}
+		}
+	}()
+}
+
+// lookupSelf returns the TTL and renewability of the client token
+func (c *VaultClient) lookupSelf(ctx context.Context) (time.Duration, bool, error) {
+	var resp struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &resp); err != nil {
+		return 0, false, err
+	}
+	return time.Duration(resp.Data.TTL) * time.Second, resp.Data.Renewable, nil
+}
+
+// renewSelf renews the client token
+func (c *VaultClient) renewSelf(ctx context.Context) error {
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", []byte("{}"), &resp); err != nil {
+		return err
+	}
+	if resp.Auth.ClientToken != "" {
+		c.mu.Lock()
+		c.token = resp.Auth.ClientToken
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// do performs a Vault API request and decodes the JSON response
+func (c *VaultClient) do(ctx context.Context, method, path string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.opts.Address, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+
+	c.mu.RLock()
+	req.Header.Set("X-Vault-Token", c.token)
+	c.mu.RUnlock()
+	if c.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.opts.Namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault request %s failed with status code %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+// SetCapture 设置流量采集（用于依赖注入）：采集时保留转发调用的第一条请求消息供记录
+func (s *Server) SetCapture(rec *capture.Recorder) {
+	s.capture = rec
+	if rec != nil {
+		s.AddObserver(rec)
+	}
+}
+
+// captureStream 记录收到的第一条请求消息与消息数
+type captureStream struct {
+	grpc.ServerStream
+	info *requestinfo.Info
+}
+
+// RecvMsg 实现 grpc.ServerStream
+func (s *captureStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+	s.info.RequestMessages++
+	if frame, ok := m.(*proxy.Frame); ok && s.info.RequestMessages == 1 {
+		// 代理会复用 Frame 接收后续消息，需要复制
+		s.info.RequestMessage = append([]byte(nil), frame.Payload...)
+	}
+	return nil
+}
+
+// captureMessages 在采集时包装流以记录请求消息
+func (s *Server) captureMessages(handler grpc.StreamHandler) grpc.StreamHandler {
+	if !s.capture.Capturing() {
+		return handler
+	}
+	return func(srv any, ss grpc.ServerStream) error {
+		info := requestinfo.FromContext(ss.Context())
+		if info == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &captureStream{ServerStream: ss, info: info})
+	}
+}
@@ -0,0 +1,26 @@
+package grpc
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+)
+
+// SetConcurrencyLimiter 设置转发调用共享的并发限制（依赖注入），为 nil 时不限制
+func (s *Server) SetConcurrencyLimiter(limiter *concurrency.Limiter) {
+	s.concurrency = limiter
+}
+
+// limitStream 为转发的调用占用并发名额直到调用结束，没有空闲名额且队列已满或等待超时时返回 ResourceExhausted；
+// 健康检查等网关自身的服务不受限制
+func (s *Server) limitStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !s.proxied(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	release, err := s.concurrency.Acquire(ss.Context())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
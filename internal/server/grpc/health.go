@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// defaultHealthPeriod 上游服务健康状态的默认刷新周期
+const defaultHealthPeriod = 10 * time.Second
+
+// SetServiceHealth 设置需要在健康检查服务中报告状态的上游服务（用于依赖注入）。
+// services 在每次刷新时调用，以便热更新后新增的服务也能被报告；timeout 限制每次服务发现的耗时
+func (s *Server) SetServiceHealth(services func() []string, period, timeout time.Duration) {
+	if period <= 0 {
+		period = defaultHealthPeriod
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	s.healthServices = services
+	s.healthPeriod = period
+	s.healthTimeout = timeout
+}
+
+// watchServiceHealth 周期性地刷新上游服务的健康状态，直到服务器停止
+func (s *Server) watchServiceHealth() {
+	if s.healthServices == nil || s.registry == nil {
+		return
+	}
+
+	ticker := time.NewTicker(s.healthPeriod)
+	defer ticker.Stop()
+
+	reported := make(map[string]bool)
+	for {
+		reported = s.updateServiceHealth(reported)
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// updateServiceHealth 根据注册中心中是否有可用实例设置每个上游服务的状态，
+// 不再需要报告的服务被设置为 SERVICE_UNKNOWN；返回本次报告的服务
+func (s *Server) updateServiceHealth(previous map[string]bool) map[string]bool {
+	current := make(map[string]bool)
+	for _, service := range s.healthServices() {
+		if current[service] {
+			continue
+		}
+		current[service] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.healthTimeout)
+		instances, err := s.registry.Discover(ctx, service)
+		cancel()
+
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if err != nil || len(instances) == 0 {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+			s.logger.Debug("Upstream service has no healthy instances", "service", service, "error", err)
+		}
+		s.healthServer.SetServingStatus(service, status)
+	}
+
+	for service := range previous {
+		if !current[service] {
+			s.healthServer.SetServingStatus(service, grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN)
+		}
+	}
+	return current
+}
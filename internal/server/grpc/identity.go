@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+)
+
+// SetIdentity 设置可信身份元数据的处理（依赖注入）
+func (s *Server) SetIdentity(trust *identity.Trust) {
+	s.identity = trust
+}
+
+// identityStream 移除转发调用中的身份元数据与统一的身份元数据；调用来自可信的对端时，身份元数据转换为统一的身份元数据
+// 转发到上游，身份字段作为认证声明供之后的拦截器使用。l 为空时为 grpc_port 上的主服务器
+func (s *Server) identityStream(l *listener.Listener) grpc.StreamServerInterceptor {
+	var name string
+	if l != nil {
+		name = l.Name
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !s.proxied(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx := ss.Context()
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		var remoteAddr string
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remoteAddr = p.Addr.String()
+		}
+		id := s.identity.FromMetadata(md, remoteAddr, name)
+		ctx = metadata.NewIncomingContext(ctx, md)
+		if id != nil {
+			ctx = claims.NewContext(ctx, id.Claims())
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
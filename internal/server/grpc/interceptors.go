@@ -0,0 +1,326 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/ratelimit"
+	"github.com/heytom-labs/heytom-gateway/internal/recovery"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+)
+
+var (
+	grpcHandled = metrics.NewCounterVec(
+		"gateway_grpc_server_handled_total",
+		"Calls completed on the gateway's gRPC listener",
+		"service", "method", "code",
+	)
+	grpcHandlingSeconds = metrics.NewHistogramVec(
+		"gateway_grpc_server_handling_seconds",
+		"Duration of calls on the gateway's gRPC listener in seconds",
+		metrics.DefaultBuckets,
+		"service", "method",
+	)
+)
+
+// 拦截器名称
+const (
+	InterceptorRecovery  = "recovery"
+	InterceptorLogging   = "logging"
+	InterceptorMetrics   = "metrics"
+	InterceptorRateLimit = "rate_limit"
+	InterceptorAuth      = "auth"
+	InterceptorTenant    = "tenant"
+)
+
+// defaultInterceptors 未配置拦截器时使用的拦截器链
+var defaultInterceptors = []string{InterceptorRecovery, InterceptorAuth}
+
+// interceptor 同时作用于一元调用与流式调用的拦截器。限流与外部授权只作用于转发的调用，
+// 而转发的调用都是流式调用，因此它们没有一元拦截器
+type interceptor struct {
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+}
+
+// validateInterceptors 检查拦截器名称，拒绝未知或重复的拦截器
+func validateInterceptors(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		switch name {
+		case InterceptorRecovery, InterceptorLogging, InterceptorMetrics, InterceptorRateLimit, InterceptorAuth, InterceptorTenant:
+		default:
+			return fmt.Errorf("unknown gRPC interceptor %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate gRPC interceptor %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// chain 按配置构建监听器 l 的拦截器链，l 为空时为 grpc_port 上的主服务器。观察者（访问日志、延迟统计等）始终位于最外层，
+// 使被拦截器拒绝的请求同样被记录；身份元数据的处理紧随观察者，之后开始网关的 span，未开放方法的拒绝与全局并发限制（配置时）紧随观察者；未列出 recovery 时 recovery 位于观察者之后的最外层，
+// 配置了多租户而未列出 tenant 时，tenant 位于 recovery 之后，租户取自认证声明且启用了外部授权时则紧随 auth，使用授权返回的声明；
+// 配置了外部授权而未列出 auth 时，auth 追加在最内层
+func (s *Server) chain(l *listener.Listener) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	names := s.interceptors
+	if names == nil {
+		names = defaultInterceptors
+	}
+	if s.authz != nil && !contains(names, InterceptorAuth) {
+		names = append(append([]string(nil), names...), InterceptorAuth)
+	}
+	if s.tenants != nil && !contains(names, InterceptorTenant) {
+		names = insertTenant(names, s.tenants.Claim() != "" && s.authz != nil)
+	}
+	if !contains(names, InterceptorRecovery) {
+		names = append([]string{InterceptorRecovery}, names...)
+	}
+
+	var unary []grpc.UnaryServerInterceptor
+	stream := []grpc.StreamServerInterceptor{s.observeStream}
+	if s.identity != nil {
+		stream = append(stream, s.identityStream(l))
+	}
+	if s.tracer != nil {
+		stream = append(stream, s.traceStream)
+	}
+	if s.exposure != nil {
+		stream = append(stream, s.exposeMethods(l))
+	}
+	if s.concurrency != nil {
+		stream = append(stream, s.limitStream)
+	}
+	for _, name := range names {
+		var i interceptor
+		switch name {
+		case InterceptorRecovery:
+			i = interceptor{unary: recovery.UnaryServerInterceptor(s.logger), stream: recovery.StreamServerInterceptor(s.logger)}
+		case InterceptorLogging:
+			i = interceptor{unary: s.logUnary, stream: s.logStream}
+		case InterceptorMetrics:
+			i = interceptor{unary: metricsUnary, stream: metricsStream}
+		case InterceptorRateLimit:
+			limiter := ratelimit.New(s.rateLimit.RequestsPerSecond, s.rateLimit.Burst)
+			i = interceptor{stream: s.rateLimitStream(limiter)}
+		case InterceptorAuth:
+			i = interceptor{stream: s.authStream}
+		case InterceptorTenant:
+			i = interceptor{stream: s.tenantStream}
+		}
+		if i.unary != nil {
+			unary = append(unary, i.unary)
+		}
+		stream = append(stream, i.stream)
+	}
+	return unary, stream
+}
+
+// insertTenant 将 tenant 拦截器插入名称列表：afterAuth 时紧随 auth，否则位于最前
+func insertTenant(names []string, afterAuth bool) []string {
+	at := 0
+	if afterAuth {
+		for i, name := range names {
+			if name == InterceptorAuth {
+				at = i + 1
+			}
+		}
+	}
+	out := make([]string, 0, len(names)+1)
+	out = append(out, names[:at]...)
+	out = append(out, InterceptorTenant)
+	return append(out, names[at:]...)
+}
+
+// contains 判断名称是否在列表中
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// proxied 判断调用是否由网关转发，而不是由网关自身注册的服务（如健康检查）处理
+func (s *Server) proxied(fullMethod string) bool {
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	local := s.localServices.Load()
+	return local == nil || !(*local)[service]
+}
+
+// refreshLocalServices 重新计算在 grpc_port 的服务器上注册的服务名，避免每次调用时由 GetServiceInfo 重新构建
+func (s *Server) refreshLocalServices() {
+	info := s.grpcServer.GetServiceInfo()
+	local := make(map[string]bool, len(info))
+	for name := range info {
+		local[name] = true
+	}
+	s.localServices.Store(&local)
+}
+
+// observeStream 将转发的调用通知给观察者
+func (s *Server) observeStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if len(s.observers) == 0 || !s.proxied(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	return requestinfo.StreamHandler(s.captureMessages(handler), s.observers...)(srv, ss)
+}
+
+// logUnary 记录每次一元调用的结果
+func (s *Server) logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// logStream 记录每次流式调用的结果
+func (s *Server) logStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	s.logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// logCall 输出调用日志，失败的调用以 Warn 级别输出
+func (s *Server) logCall(ctx context.Context, fullMethod string, start time.Time, err error) {
+	attrs := []any{"method", fullMethod, "code", status.Code(err).String(), "duration", time.Since(start)}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attrs = append(attrs, "peer", p.Addr.String())
+	}
+	if err != nil {
+		s.logger.Warn("gRPC call failed", append(attrs, "error", status.Convert(err).Message())...)
+		return
+	}
+	s.logger.Info("gRPC call", attrs...)
+}
+
+// metricsUnary 统计一元调用的次数与耗时
+func metricsUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+// metricsStream 统计流式调用的次数与耗时
+func metricsStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, start, err)
+	return err
+}
+
+// observe 记录调用的结果与耗时
+func observe(fullMethod string, start time.Time, err error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	grpcHandled.Inc(service, method, status.Code(err).String())
+	grpcHandlingSeconds.Observe(time.Since(start).Seconds(), service, method)
+}
+
+// rateLimitStream 超过全局限流的转发调用返回 ResourceExhausted，健康检查等网关自身的服务不受限流
+func (s *Server) rateLimitStream(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if s.proxied(info.FullMethod) && !limiter.Allow() {
+			return status.Errorf(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// tenantStream 按元数据或认证声明中的租户准入转发的调用，并将租户、租户的元数据转发到上游。
+// 调用方的 API Key 不转发到上游，调用只转发到租户命名空间内的实例
+func (s *Server) tenantStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if s.tenants == nil || !s.proxied(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	ctx := ss.Context()
+	tenant, err := s.tenants.Resolve(ctx, s.tenants.FromIncoming(ctx))
+	if err != nil {
+		return err
+	}
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.Tenant = tenant
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var apiKey string
+	if values := md.Get(tenancy.APIKeyHeader); len(values) > 0 {
+		apiKey = values[0]
+	}
+	if err := s.tenants.Admit(tenant, apiKey); err != nil {
+		return err
+	}
+
+	// 租户元数据由 Metadata 统一写入，避免与调用方的元数据重复
+	md = md.Copy()
+	delete(md, tenancy.APIKeyHeader)
+	delete(md, s.tenants.MetadataKey())
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx = metadata.AppendToOutgoingContext(ctx, s.tenants.Metadata(tenant)...)
+	ctx = proxy.WithNamespace(ctx, s.tenants.Namespace(tenant))
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// authStream 对转发的调用进行外部授权，授权返回的头部作为元数据转发到上游，返回的声明供之后的拦截器使用；
+// 授权服务不可用且未开启 fail_open 时返回 Unavailable
+func (s *Server) authStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if s.authz == nil || !s.proxied(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	ctx := ss.Context()
+	service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+	md, _ := metadata.FromIncomingContext(ctx)
+	req := &authz.Request{
+		Protocol: "grpc",
+		Service:  service,
+		Method:   method,
+		Headers:  s.authz.HeadersFromMetadata(md),
+		Claims:   claims.FromContext(ctx),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		req.RemoteAddr = p.Addr.String()
+	}
+	decision, err := s.authz.Authorize(ctx, req)
+	if err != nil {
+		if denied, ok := authz.IsDenied(err); ok {
+			return status.Error(denied.GRPCCode(), denied.Error())
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	// 授权返回的头部替换调用方的同名元数据，调用方无法伪造授权服务确认的身份
+	ctx = proxy.SetOutgoingMetadata(ctx, decision.Headers)
+	if decision.Claims != nil {
+		ctx = claims.NewContext(ctx, decision.Claims)
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// serverStream 替换上下文的服务端流
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 返回替换后的上下文
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+)
+
+// endpoint grpc_port 之外的监听器及其 gRPC 服务器
+type endpoint struct {
+	listener *listener.Listener
+	lis      net.Listener
+	server   *grpc.Server
+}
+
+// SetListeners 设置 grpc_port 之外的 gRPC 监听器（用于依赖注入，需在Initialize之前调用），各自配置 TLS 与开放的路由
+func (s *Server) SetListeners(cfgs []config.ListenerConfig) error {
+	listeners, err := listener.FromConfig(cfgs, listener.ProtocolGRPC)
+	if err != nil {
+		return err
+	}
+	s.endpoints = nil
+	for _, l := range listeners {
+		s.endpoints = append(s.endpoints, &endpoint{listener: l})
+	}
+	return nil
+}
+
+// listenEndpoints 绑定额外的监听器
+func (s *Server) listenEndpoints() error {
+	for _, e := range s.endpoints {
+		lis, err := s.handover.Listen(e.listener.Address)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", e.listener.Name, err)
+		}
+		e.lis = lis
+		if err := e.listener.WatchCerts(s.logger); err != nil {
+			return fmt.Errorf("listener %s: %w", e.listener.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetExposure 设置对外开放方法的策略（依赖注入）
+func (s *Server) SetExposure(policy *exposure.Policy) {
+	s.exposure = policy
+}
+
+// exposeMethods 拒绝未开放的转发调用，返回 UNIMPLEMENTED，与网关未加载该方法时相同；方法选项按调用租户的描述符读取，
+// 标记为内部的方法只在内网监听器上开放。l 为空时为 grpc_port 上的主服务器
+func (s *Server) exposeMethods(l *listener.Listener) grpc.StreamServerInterceptor {
+	internal := l != nil && l.Internal
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if s.proxied(info.FullMethod) {
+			service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+			if !s.exposure.Exposes(s.loaderFor(ss.Context()), service, method, internal) {
+				return status.Errorf(codes.Unimplemented, "unknown service %s", service)
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// exposeStream 拒绝监听器与 TLS 服务器名称匹配的 SNI 条目未开放的转发调用，返回 UNIMPLEMENTED；
+// 网关自身注册的服务（如健康检查）不受限制。SNI 条目的租户与后端命名空间用于之后的租户准入与转发
+func (s *Server) exposeStream(l *listener.Listener) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		sni := l.MatchSNI(serverName(ss.Context()))
+		if s.proxied(info.FullMethod) {
+			service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+			if !l.AllowsRoute(service, method) || !sni.AllowsRoute(service, method) {
+				return status.Errorf(codes.Unimplemented, "unknown service %s", service)
+			}
+		}
+		if sni != nil {
+			ctx := tenancy.WithBoundTenant(ss.Context(), sni.Tenant)
+			ctx = proxy.WithNamespace(ctx, sni.Namespace)
+			ss = &serverStream{ServerStream: ss, ctx: ctx}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// serverName 返回 TLS 连接上客户端请求的服务器名称（SNI），不是 TLS 连接时返回空字符串
+func serverName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	return info.State.ServerName
+}
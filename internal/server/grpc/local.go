@@ -0,0 +1,92 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// localService 在网关进程内实现的 gRPC 服务
+type localService struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// RegisterService 注册在网关进程内实现的服务（实现 grpc.ServiceRegistrar，需在 Listen 之前调用），
+// 在所有监听器上提供。服务默认优先于转发：其方法由网关处理，未实现的方法仍然转发到上游；
+// 列在 prefer_upstream 中的服务只在注册中心中没有可用实例时由网关处理
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	if impl != nil {
+		ht := reflect.TypeOf(desc.HandlerType).Elem()
+		if !reflect.TypeOf(impl).Implements(ht) {
+			panic(fmt.Sprintf("grpc: service %s: handler of type %v does not satisfy %v", desc.ServiceName, reflect.TypeOf(impl), ht))
+		}
+	}
+	if _, ok := s.local[desc.ServiceName]; ok {
+		panic(fmt.Sprintf("grpc: service %s is already registered", desc.ServiceName))
+	}
+	if s.local == nil {
+		s.local = make(map[string]*localService)
+	}
+	s.local[desc.ServiceName] = &localService{desc: desc, impl: impl}
+}
+
+// SetPreferUpstream 设置优先转发到上游的本地服务（用于依赖注入）
+func (s *Server) SetPreferUpstream(services []string) {
+	s.preferUpstream = make(map[string]bool, len(services))
+	for _, service := range services {
+		s.preferUpstream[service] = true
+	}
+}
+
+// registerLocal 在 gRPC 服务器上注册优先由网关处理的本地服务；优先转发的服务由 handleUnknownService 按实例情况处理
+func (s *Server) registerLocal(srv *grpc.Server) {
+	for name, svc := range s.local {
+		if !s.preferUpstream[name] {
+			srv.RegisterService(svc.desc, svc.impl)
+		}
+	}
+}
+
+// fallback 返回应由网关处理的优先转发的本地服务：服务在注册中心中没有可路由的实例时返回该服务，否则返回 nil
+func (s *Server) fallback(ctx context.Context, serviceName string) *localService {
+	svc, ok := s.local[serviceName]
+	if !ok || !s.preferUpstream[serviceName] {
+		return nil
+	}
+	if s.registry == nil {
+		return svc
+	}
+	instances, err := s.registry.Discover(ctx, serviceName)
+	if err != nil {
+		s.logger.Warn("Failed to discover upstream of local service, handling locally", "service", serviceName, "error", err)
+		return svc
+	}
+	if len(s.policies.Get(serviceName).Eligible(instances)) > 0 {
+		return nil
+	}
+	return svc
+}
+
+// serve 在网关进程内处理对本地服务的调用
+func (svc *localService) serve(methodName string, stream grpc.ServerStream) error {
+	for _, m := range svc.desc.Methods {
+		if m.MethodName == methodName {
+			resp, err := m.Handler(svc.impl, stream.Context(), stream.RecvMsg, nil)
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(resp)
+		}
+	}
+	for _, sd := range svc.desc.Streams {
+		if sd.StreamName == methodName {
+			return sd.Handler(svc.impl, stream)
+		}
+	}
+	return status.Errorf(codes.Unimplemented, "unknown method %s for service %s", methodName, svc.desc.ServiceName)
+}
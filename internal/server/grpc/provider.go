@@ -1,9 +1,27 @@
 package grpc
 
 import (
+	"log/slog"
+
 	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/accesslog"
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
 	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/latency"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/tap"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+	"github.com/heytom-labs/heytom-gateway/internal/upstreams"
 )
 
 // ProviderSet gRPC服务器Provider集合
@@ -12,8 +30,61 @@ var ProviderSet = wire.NewSet(
 )
 
 // ProvideServer 提供gRPC服务器实例
-func ProvideServer(cfg *config.Config, reg registry.Registry) *Server {
+func ProvideServer(cfg *config.Config, log *slog.Logger, reg registry.Registry, loader *proto.DescriptorLoader, tenantLoaders *proto.Tenants, pool *proxy.ConnectionPool, policies *proxy.ServicePolicies, authzClient *authz.Client, accessLog *accesslog.Logger, tracker *latency.Tracker, upstreamTracker *upstreams.Tracker, hub *tap.Hub, tenants *tenancy.Manager, maintenanceManager *maintenance.Manager, ho *handover.Handover, recorder *capture.Recorder, limiter *concurrency.Limiter, policy *exposure.Policy, trust *identity.Trust, tracer *tracing.Tracer) (*Server, error) {
 	srv := New(cfg.Server.GRPCPort)
+	srv.SetLogger(logger.Component(log, "grpc_server"))
+	srv.SetConnectionPool(pool)
+	srv.SetServicePolicies(policies)
+	srv.SetDescriptorLoader(loader)
+	srv.SetTenantLoaders(tenantLoaders)
 	srv.SetRegistry(reg)
-	return srv
+	srv.SetAuthorizer(authzClient)
+	srv.SetTenants(tenants)
+	srv.SetMaintenance(maintenanceManager)
+	srv.SetHandover(ho)
+	srv.SetConcurrencyLimiter(limiter)
+	srv.SetExposure(policy)
+	srv.SetIdentity(trust)
+	srv.SetTracer(tracer)
+	if err := srv.SetListeners(cfg.Server.Listeners); err != nil {
+		return nil, err
+	}
+	if err := srv.SetInterceptors(cfg.Server.GRPC); err != nil {
+		return nil, err
+	}
+	srv.SetChannelz(cfg.Server.GRPC.Channelz)
+	srv.SetPreferUpstream(cfg.Server.GRPC.PreferUpstream)
+	srv.SetServiceHealth(func() []string {
+		return healthServices(cfg, loader)
+	}, cfg.Health.ServicePeriod, cfg.Health.CheckTimeout)
+	if accessLog != nil {
+		srv.AddObserver(accessLog)
+	}
+	if tracker != nil {
+		srv.AddObserver(tracker)
+	}
+	if hub != nil {
+		srv.AddObserver(hub)
+	}
+	if tenants != nil {
+		srv.AddObserver(tenants)
+	}
+	srv.AddObserver(upstreamTracker)
+	if tracer != nil {
+		srv.AddObserver(tracer)
+	}
+	srv.SetCapture(recorder)
+	return srv, nil
+}
+
+// healthServices 返回在健康检查服务中报告状态的上游服务：描述符中的服务、配置了上游策略的服务与关键服务
+func healthServices(cfg *config.Config, loader *proto.DescriptorLoader) []string {
+	var services []string
+	if loader != nil {
+		services = loader.ServiceNames()
+	}
+	for service := range cfg.Services {
+		services = append(services, service)
+	}
+	return append(services, cfg.Health.CriticalServices...)
 }
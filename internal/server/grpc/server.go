@@ -1,77 +1,266 @@
 package grpc
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	protopkg "github.com/heytom-labs/heytom-gateway/internal/proto"
 	"github.com/heytom-labs/heytom-gateway/internal/proxy"
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
 )
 
 // Server gRPC服务器结构体
 type Server struct {
-	grpcServer *grpc.Server
-	address    string
-	proxy      *proxy.GRPCProxy
+	grpcServer  *grpc.Server
+	address     string
+	listener    net.Listener
+	proxy       *proxy.GRPCProxy
+	connPool    *proxy.ConnectionPool
+	policies    *proxy.ServicePolicies
+	loader      *protopkg.DescriptorLoader
+	schemas     *protopkg.Tenants // 自带描述符的租户，为空时全部使用共享描述符
+	authz       *authz.Client
+	tenants     *tenancy.Manager
+	maintenance *maintenance.Manager
+	handover    *handover.Handover
+	endpoints   []*endpoint // grpc_port 之外的监听器
+	capture     *capture.Recorder
+	concurrency *concurrency.Limiter // 转发调用共享的并发限制
+	exposure    *exposure.Policy     // 对外开放的方法，为空时开放全部方法
+	identity    *identity.Trust      // 可信的身份元数据
+	tracer      *tracing.Tracer      // W3C 追踪上下文的传播与 span 导出
+	logger      *slog.Logger
+	observers   []requestinfo.Observer
+
+	registry       registry.Registry
+	healthServer   *health.Server
+	healthServices func() []string // 在健康检查服务中报告状态的上游服务
+	healthPeriod   time.Duration
+	healthTimeout  time.Duration
+	done           chan struct{} // 服务器停止时关闭
+
+	interceptors []string               // 拦截器链，nil 时使用默认拦截器
+	rateLimit    config.RateLimitConfig // rate_limit 拦截器的全局限流
+	channelz     bool                   // 是否注册 channelz 服务
+
+	local          map[string]*localService        // 在网关进程内实现的服务，按服务全名
+	preferUpstream map[string]bool                 // 有可用上游实例时优先转发的本地服务
+	localServices  atomic.Pointer[map[string]bool] // 在 grpc_port 的服务器上注册的服务名，注册服务后刷新
 }
 
 // New 创建gRPC服务器实例
 func New(address string) *Server {
 	return &Server{
 		address: address,
+		logger:  slog.Default(),
 	}
 }
 
+// SetLogger 设置日志记录器（用于依赖注入）
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SetConnectionPool 设置上游连接池（用于依赖注入，需在SetRegistry之前调用）
+func (s *Server) SetConnectionPool(pool *proxy.ConnectionPool) {
+	s.connPool = pool
+}
+
+// SetServicePolicies 设置上游服务调用策略（用于依赖注入，需在SetRegistry之前调用）
+func (s *Server) SetServicePolicies(policies *proxy.ServicePolicies) {
+	s.policies = policies
+}
+
+// SetDescriptorLoader 设置描述符加载器，用于按方法的流式类型转发（用于依赖注入，需在SetRegistry之前调用）
+func (s *Server) SetDescriptorLoader(loader *protopkg.DescriptorLoader) {
+	s.loader = loader
+}
+
+// SetHandover 设置监听套接字交接（用于依赖注入）：热重启时继承旧进程的监听器
+func (s *Server) SetHandover(h *handover.Handover) {
+	s.handover = h
+}
+
 // SetRegistry 设置注册中心（用于依赖注入）
 func (s *Server) SetRegistry(reg registry.Registry) {
+	s.registry = reg
 	if reg != nil {
-		s.proxy = proxy.NewGRPCProxy(reg)
+		pool := s.connPool
+		if pool == nil {
+			pool = proxy.NewConnectionPool(s.logger)
+		}
+		s.proxy = proxy.NewGRPCProxy(reg, pool, s.policies, s.logger)
+		s.proxy.SetDescriptorLoader(s.loader)
 	}
 }
 
+// SetAuthorizer 设置外部授权客户端（用于依赖注入）
+func (s *Server) SetAuthorizer(client *authz.Client) {
+	s.authz = client
+}
+
+// SetTenantLoaders 设置各租户的描述符（用于依赖注入），未配置的租户使用共享描述符
+func (s *Server) SetTenantLoaders(tenants *protopkg.Tenants) {
+	s.schemas = tenants
+}
+
+// loaderFor 返回调用所属租户的描述符；租户未解析或未配置自己的描述符时使用共享描述符
+func (s *Server) loaderFor(ctx context.Context) *protopkg.DescriptorLoader {
+	if s.tenants != nil {
+		tenant, err := s.tenants.Resolve(ctx, s.tenants.FromIncoming(ctx))
+		if loader := s.schemas.Get(tenant); err == nil && loader != nil {
+			return loader
+		}
+	}
+	return s.loader
+}
+
+// SetTenants 设置租户管理器（用于依赖注入）
+func (s *Server) SetTenants(tenants *tenancy.Manager) {
+	s.tenants = tenants
+}
+
+// SetMaintenance 设置维护模式管理器（用于依赖注入）：维护中的路由返回 Unavailable，停用的方法返回配置的状态码，
+// 网关整体维护时健康检查服务中网关自身的状态为 NOT_SERVING
+func (s *Server) SetMaintenance(m *maintenance.Manager) {
+	s.maintenance = m
+	if m == nil {
+		return
+	}
+	m.OnChange(func(st maintenance.Status) {
+		if s.healthServer == nil {
+			return
+		}
+		serving := grpc_health_v1.HealthCheckResponse_SERVING
+		if st.Gateway != nil {
+			serving = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		s.healthServer.SetServingStatus("", serving)
+	})
+}
+
+// AddObserver 添加请求完成观察者，如访问日志、延迟统计（用于依赖注入）
+func (s *Server) AddObserver(observer requestinfo.Observer) {
+	s.observers = append(s.observers, observer)
+}
+
+// SetInterceptors 设置拦截器链与全局限流（用于依赖注入）
+func (s *Server) SetInterceptors(cfg config.GRPCServerConfig) error {
+	if err := validateInterceptors(cfg.Interceptors); err != nil {
+		return err
+	}
+	s.interceptors = cfg.Interceptors
+	s.rateLimit = cfg.RateLimit
+	return nil
+}
+
+// SetChannelz 设置是否注册 channelz 服务（用于依赖注入）
+func (s *Server) SetChannelz(enabled bool) {
+	s.channelz = enabled
+}
+
 // Initialize 初始化gRPC服务器
 func (s *Server) Initialize() {
-	// 创建gRPC服务器实例，设置未知服务处理器
-	s.grpcServer = grpc.NewServer(
+	// 健康检查服务在所有监听器上共享，"" 表示网关自身，各上游服务的状态由 watchServiceHealth 维护
+	s.healthServer = health.NewServer()
+	s.healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	s.done = make(chan struct{})
+
+	s.grpcServer = s.newGRPCServer(nil)
+	for _, e := range s.endpoints {
+		e.server = s.newGRPCServer(e.listener)
+	}
+	s.refreshLocalServices()
+}
+
+// newGRPCServer 创建一个监听器的gRPC服务器，设置拦截器链与未知服务处理器；l 为空时为 grpc_port 上的主服务器
+func (s *Server) newGRPCServer(l *listener.Listener) *grpc.Server {
+	unary, stream := s.chain(l)
+	if l != nil {
+		stream = append([]grpc.StreamServerInterceptor{s.exposeStream(l)}, stream...)
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 		grpc.UnknownServiceHandler(s.handleUnknownService),
-	)
+		// 透明代理的消息按原始字节转发，不重新编码
+		grpc.ForceServerCodec(proxy.Codec()),
+	}
+	if l != nil && l.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(l.TLS)))
+	}
+	srv := grpc.NewServer(opts...)
+	grpc_health_v1.RegisterHealthServer(srv, s.healthServer)
+	s.registerLocal(srv)
 
-	// 注册健康检查服务
-	healthServer := health.NewServer()
-	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
-	grpc_health_v1.RegisterHealthServer(s.grpcServer, healthServer)
+	// 注册 channelz 服务，可查看网关的监听套接字与连接池中上游连接的子通道状态、调用计数
+	if s.channelz {
+		channelz.RegisterChannelzServiceToServer(srv)
+	}
+	return srv
 }
 
 // handleUnknownService 处理未知服务的请求（动态转发）
 func (s *Server) handleUnknownService(srv any, stream grpc.ServerStream) error {
 	// 1. 解析服务名和方法名
 	serviceName, methodName, err := ParseServiceAndMethod(stream)
-
-	fmt.Printf("parse serviceName:%s,methodName:%s", serviceName, methodName)
 	if err != nil {
 		return fmt.Errorf("parse service method error: %w", err)
 	}
 
-	// 2. 检查是否配置了代理
+	// 2. 拒绝维护中的路由与停用的方法，维护中的路由的 retry-after 尾部元数据为建议的重试间隔（秒）
+	s.logger.Debug("Handling unknown service request", "service", serviceName, "method", methodName)
+	if retryAfter, err := s.maintenance.Check(serviceName, methodName); err != nil {
+		if retryAfter > 0 {
+			stream.SetTrailer(metadata.Pairs("retry-after", strconv.Itoa(int(retryAfter.Seconds()))))
+		}
+		return err
+	}
+
+	// 3. 优先转发的本地服务在没有可用上游实例时由网关处理
+	if svc := s.fallback(stream.Context(), serviceName); svc != nil {
+		return svc.serve(methodName, stream)
+	}
+
+	// 4. 检查是否配置了代理
 	if s.proxy == nil {
 		return fmt.Errorf("proxy not configured, cannot forward request to service: %s", serviceName)
 	}
 
-	// 3. 使用代理转发请求
-	ctx := stream.Context()
-	return s.proxy.ProxyStream(ctx, serviceName, methodName, stream)
+	// 5. 使用代理转发请求（外部授权已由 auth 拦截器完成，授权返回的头部在上下文的元数据中）
+	return s.proxy.ProxyStream(stream.Context(), serviceName, methodName, stream)
 }
 
 // ParseServiceAndMethod 从流中解析服务名和方法名
 func ParseServiceAndMethod(stream grpc.ServerStream) (serviceName, methodName string, err error) {
 	// 获取完整方法名，格式: /package.Service/Method
 	fullMethod, ok := grpc.MethodFromServerStream(stream)
-	fmt.Println(fullMethod)
 	if !ok {
 		return "", "", fmt.Errorf("failed to get method from stream")
 	}
@@ -93,30 +282,97 @@ func ParseServiceAndMethod(stream grpc.ServerStream) (serviceName, methodName st
 	return serviceName, methodName, nil
 }
 
-// Start 启动gRPC服务器
-func (s *Server) Start() error {
+// Listen 绑定监听端口，端口不可用时立即返回错误
+func (s *Server) Listen() error {
 	// 如果还没有初始化，先初始化
 	if s.grpcServer == nil {
 		s.Initialize()
 	}
 
-	lis, err := net.Listen("tcp", s.address)
+	lis, err := s.handover.Listen(s.address)
 	if err != nil {
 		return err
 	}
+	s.listener = lis
+	return s.listenEndpoints()
+}
+
+// Addr 返回 Listen 绑定的地址（端口为 0 时为实际分配的端口），尚未监听时返回 nil
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
 
-	return s.grpcServer.Serve(lis)
+// Serve 在 Listen 绑定的端口上处理请求，直到服务器停止；任一监听器失败时返回其错误
+func (s *Server) Serve() error {
+	// 通过 GetGRPCServer 注册的服务在 Initialize 之后注册
+	s.refreshLocalServices()
+	go s.watchServiceHealth()
+	errs := make(chan error, len(s.endpoints)+1)
+	for _, e := range s.endpoints {
+		s.logger.Info("gRPC listener starting", "name", e.listener.Name, "address", e.listener.Address, "tls", e.listener.TLS != nil)
+		go func(e *endpoint) {
+			errs <- e.server.Serve(e.lis)
+		}(e)
+	}
+	go func() {
+		errs <- s.grpcServer.Serve(s.listener)
+	}()
+	return <-errs
+}
+
+// Start 启动gRPC服务器
+func (s *Server) Start() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
 }
 
-// Stop 停止gRPC服务器
-func (s *Server) Stop() {
-	if s.grpcServer != nil {
-		s.grpcServer.GracefulStop()
+// Stop 优雅停止gRPC服务器：先将健康检查标记为 NOT_SERVING，再在所有监听器上停止接受新调用并等待进行中的调用与流结束；
+// ctx 结束时仍未完成的调用被强制关闭，并返回 ctx 的错误
+func (s *Server) Stop(ctx context.Context) error {
+	if s.grpcServer == nil {
+		return nil
+	}
+
+	close(s.done)
+	s.healthServer.Shutdown()
+
+	servers := []*grpc.Server{s.grpcServer}
+	for _, e := range s.endpoints {
+		servers = append(servers, e.server)
+		e.listener.Close()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, srv := range servers {
+			wg.Add(1)
+			go func(srv *grpc.Server) {
+				defer wg.Done()
+				srv.GracefulStop()
+			}(srv)
+		}
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		for _, srv := range servers {
+			srv.Stop()
+		}
+		<-stopped
+		return ctx.Err()
 	}
 }
 
 // GetGRPCServer 获取底层gRPC服务器实例
-// 用于注册其他服务
+// 用于注册其他服务，注册的服务只在 grpc_port 上提供
 func (s *Server) GetGRPCServer() *grpc.Server {
 	if s.grpcServer == nil {
 		s.Initialize()
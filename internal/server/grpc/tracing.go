@@ -0,0 +1,27 @@
+package grpc
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+)
+
+// SetTracer 设置追踪上下文的传播与 span 导出（用于依赖注入）
+func (s *Server) SetTracer(tracer *tracing.Tracer) {
+	s.tracer = tracer
+}
+
+// traceStream 开始转发调用的网关 span：延续调用携带的追踪或开始新的追踪并决定是否采样，
+// 以网关 span 的 traceparent 替换转发到上游的元数据中调用方的值
+func (s *Server) traceStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !s.proxied(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx := ss.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	s.tracer.FromMetadata(md, requestinfo.FromContext(ctx))
+	return handler(srv, &serverStream{ServerStream: ss, ctx: metadata.NewIncomingContext(ctx, md)})
+}
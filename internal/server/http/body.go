@@ -0,0 +1,31 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBody 超过该大小的读取缓冲区不放回池中，避免偶发的大请求长期占用内存
+const maxPooledBody = 1 << 20
+
+// bodyPool 复用读取请求体的缓冲区
+var bodyPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readBody 读取请求体：先读入池中的缓冲区，再复制为大小恰好的结果，省去 io.ReadAll 逐步扩容产生的中间分配。
+// 请求体在请求结束后仍被观察者引用（如流量采集），因此返回副本而不是池中的缓冲区
+func readBody(r io.Reader) ([]byte, error) {
+	buf := bodyPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBody {
+			bodyPool.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	body := make([]byte, buf.Len())
+	copy(body, buf.Bytes())
+	return body, nil
+}
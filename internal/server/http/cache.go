@@ -0,0 +1,32 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/cache"
+)
+
+// SetCache 设置响应缓存（依赖注入）
+func (s *Server) SetCache(c *cache.Cache) {
+	s.cache = c
+}
+
+// cacheKey 返回可缓存的请求的键，与合并相同的请求使用相同的规则区分调用方；方法未配置缓存时返回空字符串
+func (s *Server) cacheKey(r *http.Request, httpReq *HTTPRequest) string {
+	if !s.cache.Cached(httpReq.ServiceName + "/" + httpReq.MethodName) {
+		return ""
+	}
+	return requestKey(r, httpReq, s.cache.Vary())
+}
+
+// callCached 调用 call 获取完整响应；key 非空时先查找缓存，未命中时由一个请求调用上游并缓存成功的响应，
+// 相同的请求等待它的结果。X-Cache 响应头返回缓存的结果
+func (s *Server) callCached(ctx context.Context, w http.ResponseWriter, key string, httpReq *HTTPRequest, call func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if key == "" {
+		return call(ctx)
+	}
+	response, result, err := s.cache.Do(ctx, key, httpReq.ServiceName, httpReq.MethodName, call)
+	w.Header().Set("X-Cache", result)
+	return response, err
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+)
+
+var collapsedRequests = metrics.NewCounterVec(
+	"gateway_collapsed_requests_total",
+	"HTTP requests served by an upstream call shared with identical in-flight requests.",
+	"service", "method",
+)
+
+// collapsePolicy 合并进行中的相同请求的配置
+type collapsePolicy struct {
+	methods    []string // 合并的方法通配符
+	idempotent bool     // 同时合并 GET 请求与声明为无副作用或幂等的方法
+	vary       []string // 同样需要相同的请求头
+}
+
+// SetCollapse 设置合并进行中的相同请求的方法，可在运行时替换
+func (s *Server) SetCollapse(cfg config.CollapseConfig) error {
+	for _, pattern := range cfg.Methods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid collapse pattern %q: %w", pattern, err)
+		}
+	}
+	vary := cfg.Vary
+	if len(vary) == 0 {
+		vary = []string{"Authorization", "Cookie"}
+	}
+	s.collapse.Store(&collapsePolicy{methods: cfg.Methods, idempotent: cfg.Idempotent, vary: vary})
+	return nil
+}
+
+// collapseKey 返回可合并的请求的键，请求不可合并时返回空字符串
+func (s *Server) collapseKey(r *http.Request, httpReq *HTTPRequest) string {
+	policy := s.collapse.Load()
+	if policy == nil || !s.collapsible(r, httpReq, policy) {
+		return ""
+	}
+	return requestKey(r, httpReq, policy.vary)
+}
+
+// requestKey 返回共享上游响应的请求的键：租户、方法、请求体、响应字段、vary 请求头、网关转发到上游的元数据
+// （身份、授权返回的头部等）与认证声明都相同的请求键相同，身份不同的调用方不会共享响应。
+// 无法确定调用方身份时返回空字符串
+func requestKey(r *http.Request, httpReq *HTTPRequest, vary []string) string {
+	h := sha256.New()
+	for _, v := range []string{httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, strconv.FormatBool(httpReq.Passthrough), strings.Join(httpReq.Fields, ",")} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	for _, name := range vary {
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+		h.Write([]byte{0})
+	}
+	md, _ := metadata.FromOutgoingContext(r.Context())
+	for _, key := range slices.Sorted(maps.Keys(md)) {
+		if key == tracing.Header {
+			// 每个请求的 traceparent 都不同，不参与判断；上游只看到领头请求的 traceparent
+			continue
+		}
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(md[key], ",")))
+		h.Write([]byte{0})
+	}
+	if c := claims.FromContext(r.Context()); c != nil {
+		principal, err := json.Marshal(c)
+		if err != nil {
+			// 无法确定调用方身份时不共享响应
+			return ""
+		}
+		h.Write(principal)
+	}
+	h.Write([]byte{0})
+	h.Write(httpReq.Body)
+	return string(h.Sum(nil))
+}
+
+// collapsible 报告请求的方法是否配置为合并
+func (s *Server) collapsible(r *http.Request, httpReq *HTTPRequest, policy *collapsePolicy) bool {
+	route := httpReq.ServiceName + "/" + httpReq.MethodName
+	for _, pattern := range policy.methods {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	if !policy.idempotent {
+		return false
+	}
+	if r.Method == http.MethodGet {
+		return true
+	}
+	method := s.httpProxy.Loader(httpReq.Tenant).FindMethodDescriptor(httpReq.ServiceName, httpReq.MethodName)
+	switch method.GetOptions().GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS, descriptorpb.MethodOptions_IDEMPOTENT:
+		return true
+	}
+	return false
+}
+
+// callCollapsed 调用 call 获取完整响应；key 非空时与进行中的相同请求共享一次上游调用。
+// 共享的调用不随发起它的请求取消，每个请求仍在自己的上下文结束时提前返回
+func (s *Server) callCollapsed(ctx context.Context, key string, httpReq *HTTPRequest, call func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if key == "" {
+		return call(ctx)
+	}
+	ch := s.inflight.DoChan(key, func() (any, error) {
+		return call(context.WithoutCancel(ctx))
+	})
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case result := <-ch:
+		if result.Shared {
+			collapsedRequests.Inc(httpReq.ServiceName, httpReq.MethodName)
+		}
+		response, _ := result.Val.([]byte)
+		return response, result.Err
+	}
+}
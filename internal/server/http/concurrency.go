@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+)
+
+// SetConcurrencyLimiter 设置转发请求共享的并发限制（依赖注入），为 nil 时不限制
+func (s *Server) SetConcurrencyLimiter(limiter *concurrency.Limiter) {
+	s.concurrency = limiter
+}
+
+// limitConcurrency 在读取请求体之前占用并发名额，使排队与被拒绝的请求不占用请求体缓冲；
+// 没有空闲名额且队列已满或等待超时时返回 429，Twirp 请求返回 resource_exhausted 错误
+func (s *Server) limitConcurrency(next http.Handler) http.Handler {
+	if s.concurrency == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := s.concurrency.Acquire(r.Context())
+		if err != nil {
+			if strings.HasPrefix(r.URL.Path, twirp.PathPrefix) {
+				twirp.FromStatus(err).Write(w)
+				return
+			}
+			s.writeStatusError(w, nil, err, "Request rejected")
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/statusmap"
+)
+
+// SetErrors 设置错误响应的格式，可在运行时替换
+func (s *Server) SetErrors(cfg config.ErrorsConfig) error {
+	if err := validateErrorFormat("errors", &cfg.ErrorFormatConfig); err != nil {
+		return err
+	}
+	for i := range cfg.Routes {
+		name := fmt.Sprintf("errors.routes[%d]", i)
+		if _, err := path.Match(cfg.Routes[i].Match, ""); err != nil {
+			return fmt.Errorf("invalid %s.match %q: %w", name, cfg.Routes[i].Match, err)
+		}
+		if err := validateErrorFormat(name, &cfg.Routes[i].ErrorFormatConfig); err != nil {
+			return err
+		}
+	}
+	s.errors.Store(&cfg)
+	return nil
+}
+
+// validateErrorFormat 检查错误格式的取值
+func validateErrorFormat(name string, format *config.ErrorFormatConfig) error {
+	switch format.Format {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown %s.format %q, expected text or json", name, format.Format)
+}
+
+// errorEnvelope 返回请求适用的 JSON 错误格式：第一个匹配方法的 routes 规则，否则为全局格式；
+// 错误以纯文本返回时为 nil。httpReq 为 nil（尚未解析出方法）时使用全局格式
+func (s *Server) errorEnvelope(httpReq *HTTPRequest) *config.ErrorFormatConfig {
+	cfg := s.errors.Load()
+	if cfg == nil {
+		return nil
+	}
+	format := &cfg.ErrorFormatConfig
+	if httpReq != nil {
+		route := httpReq.ServiceName + "/" + httpReq.MethodName
+		for i := range cfg.Routes {
+			if ok, _ := path.Match(cfg.Routes[i].Match, route); ok {
+				format = &cfg.Routes[i].ErrorFormatConfig
+				break
+			}
+		}
+	}
+	if format.Format != "json" {
+		return nil
+	}
+	return format
+}
+
+// writeError 写出网关产生的错误，gRPC 状态码由 HTTP 状态码得出
+func (s *Server) writeError(w http.ResponseWriter, httpReq *HTTPRequest, httpStatus int, message string) {
+	if format := s.errorEnvelope(httpReq); format != nil {
+		writeEnvelope(w, format, httpStatus, statusmap.Code(httpStatus), message)
+		return
+	}
+	w.WriteHeader(httpStatus)
+	fmt.Fprint(w, message)
+}
+
+// writeStatusError 写出网关产生的 gRPC 状态错误，消息为 prefix 加上错误的消息，HTTP 状态码按 gRPC 状态码映射
+func (s *Server) writeStatusError(w http.ResponseWriter, httpReq *HTTPRequest, err error, prefix string) {
+	st := status.Convert(err)
+	message := prefix + ": " + st.Message()
+	if format := s.errorEnvelope(httpReq); format != nil {
+		writeEnvelope(w, format, statusmap.HTTPStatus(st.Code()), st.Code(), message)
+		return
+	}
+	w.WriteHeader(statusmap.HTTPStatus(st.Code()))
+	fmt.Fprint(w, message)
+}
+
+// writeEnvelope 按格式写出 JSON 错误：静态字段之后是 HTTP 状态码、gRPC 状态名与消息，配置了 wrap 时嵌套在该字段下
+func writeEnvelope(w http.ResponseWriter, format *config.ErrorFormatConfig, httpStatus int, c codes.Code, message string) {
+	fields := make(map[string]any, len(format.Extra)+3)
+	for name, value := range format.Extra {
+		fields[name] = value
+	}
+	setErrorField(fields, format.CodeField, "code", httpStatus)
+	setErrorField(fields, format.StatusField, "status", code.Code(c).String())
+	setErrorField(fields, format.MessageField, "message", message)
+
+	var body any = fields
+	if format.Wrap != "" {
+		body = map[string]any{format.Wrap: fields}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		w.WriteHeader(httpStatus)
+		fmt.Fprint(w, message)
+		return
+	}
+	writeJSONBody(w, httpStatus, data)
+}
+
+// setErrorField 设置错误的字段，name 为空时使用默认名称，为 "-" 时不设置
+func setErrorField(fields map[string]any, name, defaultName string, value any) {
+	switch name {
+	case "-":
+		return
+	case "":
+		name = defaultName
+	}
+	fields[name] = value
+}
+
+// upstreamMessage 返回 JSON 错误中上游错误的消息：未开启 upstream_messages 时为 HTTP 状态的描述，不向客户端暴露上游的细节
+func upstreamMessage(format *config.ErrorFormatConfig, st *status.Status) string {
+	if format.UpstreamMessages {
+		return st.Message()
+	}
+	if text := http.StatusText(statusmap.HTTPStatus(st.Code())); text != "" {
+		return text
+	}
+	return st.Code().String()
+}
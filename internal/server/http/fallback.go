@@ -0,0 +1,82 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// SetFallback 设置未知路径与方法的处理，可在运行时替换
+func (s *Server) SetFallback(cfg config.FallbackConfig) error {
+	for name, body := range map[string]json.RawMessage{"not_found_body": cfg.NotFoundBody, "method_not_allowed_body": cfg.MethodNotAllowedBody} {
+		if len(body) > 0 && !json.Valid(body) {
+			return fmt.Errorf("fallback.%s is not valid JSON", name)
+		}
+	}
+	s.fallback.Store(&cfg)
+	return nil
+}
+
+// fallbackConfig 返回当前的未知路径与方法的处理配置
+func (s *Server) fallbackConfig() *config.FallbackConfig {
+	if cfg := s.fallback.Load(); cfg != nil {
+		return cfg
+	}
+	return &config.FallbackConfig{}
+}
+
+// forwardFallback 将请求转发到 fallback.service，未配置时返回 false。body 为已读取的请求体
+func (s *Server) forwardFallback(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	service := s.fallbackConfig().Service
+	if service == "" {
+		return false
+	}
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	s.handleHTTPRoute(w, r, &config.HTTPRouteConfig{Name: "fallback", Prefix: "/", Service: service})
+	return true
+}
+
+// unknownMethod 报告方法是否不在租户的描述符中
+func (s *Server) unknownMethod(httpReq *HTTPRequest) bool {
+	return s.httpProxy.Loader(httpReq.Tenant).FindMethodDescriptor(httpReq.ServiceName, httpReq.MethodName) == nil
+}
+
+// writeNotFound 配置了 fallback.not_found_body 时以该 JSON 响应体返回 404，否则返回 false
+func (s *Server) writeNotFound(w http.ResponseWriter) bool {
+	body := s.fallbackConfig().NotFoundBody
+	if len(body) == 0 {
+		return false
+	}
+	writeJSONBody(w, http.StatusNotFound, body)
+	return true
+}
+
+// writeMethodNotAllowed 返回 405，配置了 fallback.method_not_allowed_body 时使用该 JSON 响应体
+func (s *Server) writeMethodNotAllowed(w http.ResponseWriter) {
+	w.Header().Set("Allow", http.MethodPost)
+	if body := s.fallbackConfig().MethodNotAllowedBody; len(body) > 0 {
+		writeJSONBody(w, http.StatusMethodNotAllowed, body)
+		return
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	fmt.Fprintf(w, "Only POST method is allowed")
+}
+
+// writeJSONBody 写出 JSON 响应体
+func writeJSONBody(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// rpcPath 报告路径是否在 /rpc/ 下
+func rpcPath(path string) bool {
+	return strings.HasPrefix(path, "/rpc/")
+}
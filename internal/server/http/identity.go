@@ -0,0 +1,34 @@
+package http
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+)
+
+// SetIdentity 设置可信身份请求头的处理（依赖注入）
+func (s *Server) SetIdentity(trust *identity.Trust) {
+	s.identity = trust
+}
+
+// trustIdentity 移除请求中的身份请求头与统一的身份请求头；请求来自可信的对端时，身份请求头转换为统一的身份请求头
+// （转发到普通 HTTP 服务）与转发到 gRPC 上游的元数据，身份字段作为认证声明供之后的中间件与路由规则使用
+func (s *Server) trustIdentity(r *http.Request) *http.Request {
+	if s.identity == nil {
+		return r
+	}
+	var name string
+	if l, _ := r.Context().Value(listenerKey{}).(*listener.Listener); l != nil {
+		name = l.Name
+	}
+	id := s.identity.FromHTTP(r.Header, r.RemoteAddr, name)
+	if id == nil {
+		return r
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), id.Metadata...)
+	return r.WithContext(claims.NewContext(ctx, id.Claims()))
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// 未配置时的连接超时与请求头大小限制
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+)
+
+// connLimits 连接的超时与请求头大小限制
+type connLimits struct {
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+}
+
+// defaultConnLimits 未配置时的限制，写出响应不限时
+var defaultConnLimits = connLimits{
+	readHeaderTimeout: defaultReadHeaderTimeout,
+	readTimeout:       defaultReadTimeout,
+	idleTimeout:       defaultIdleTimeout,
+	maxHeaderBytes:    defaultMaxHeaderBytes,
+}
+
+// SetConnLimits 设置连接的超时与请求头大小限制（依赖注入），未配置的项使用默认值。
+// 作用于主监听器与 server.listeners 中的 HTTP 监听器
+func (s *Server) SetConnLimits(cfg config.HTTPServerConfig) {
+	limits := defaultConnLimits
+	if cfg.ReadHeaderTimeout > 0 {
+		limits.readHeaderTimeout = cfg.ReadHeaderTimeout
+	}
+	if cfg.ReadTimeout > 0 {
+		limits.readTimeout = cfg.ReadTimeout
+	}
+	if cfg.WriteTimeout > 0 {
+		limits.writeTimeout = cfg.WriteTimeout
+	}
+	if cfg.IdleTimeout > 0 {
+		limits.idleTimeout = cfg.IdleTimeout
+	}
+	if cfg.MaxHeaderBytes > 0 {
+		limits.maxHeaderBytes = cfg.MaxHeaderBytes
+	}
+	s.limits = limits
+	s.limits.apply(s.httpServer)
+}
+
+// apply 将限制设置到 HTTP 服务器
+func (l connLimits) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = l.readHeaderTimeout
+	srv.ReadTimeout = l.readTimeout
+	srv.WriteTimeout = l.writeTimeout
+	srv.IdleTimeout = l.idleTimeout
+	srv.MaxHeaderBytes = l.maxHeaderBytes
+}
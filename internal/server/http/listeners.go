@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/server/listener"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// endpoint http_port 之外的监听器及其 HTTP 服务器
+type endpoint struct {
+	listener *listener.Listener
+	lis      net.Listener
+	server   *http.Server
+}
+
+type listenerKey struct{}
+
+// sniKey 上下文中请求的 TLS 服务器名称匹配的 SNI 条目的键
+type sniKey struct{}
+
+// SetListeners 设置 http_port 之外的 HTTP 监听器（依赖注入），各自配置 TLS 与开放的路由
+func (s *Server) SetListeners(cfgs []config.ListenerConfig) error {
+	listeners, err := listener.FromConfig(cfgs, listener.ProtocolHTTP)
+	if err != nil {
+		return err
+	}
+	s.endpoints = nil
+	for _, l := range listeners {
+		s.endpoints = append(s.endpoints, &endpoint{listener: l})
+	}
+	return nil
+}
+
+// listenEndpoints 绑定额外的监听器，请求按监听器开放的路径过滤后交给与主监听器相同的处理器
+func (s *Server) listenEndpoints(handler http.Handler) error {
+	for _, e := range s.endpoints {
+		lis, err := s.handover.Listen(e.listener.Address)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", e.listener.Name, err)
+		}
+		e.lis = lis
+		if err := e.listener.WatchCerts(s.logger); err != nil {
+			return fmt.Errorf("listener %s: %w", e.listener.Name, err)
+		}
+		e.server = &http.Server{
+			Handler:   exposePaths(e.listener, handler),
+			TLSConfig: e.listener.TLS,
+		}
+		s.limits.apply(e.server)
+	}
+	return nil
+}
+
+// serve 在额外的监听器上处理请求，直到服务器停止
+func (e *endpoint) serve() error {
+	if e.listener.TLS != nil {
+		// 证书已在 TLSConfig 中
+		return e.server.ServeTLS(e.lis, "", "")
+	}
+	return e.server.Serve(e.lis)
+}
+
+// exposePaths 拒绝监听器未开放的路径，并将监听器与 TLS 服务器名称匹配的 SNI 条目存入上下文供 exposeRoutes 使用；
+// SNI 条目的租户与后端命名空间用于之后的租户准入与转发
+func exposePaths(l *listener.Listener, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.AllowsPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), listenerKey{}, l)
+		if r.TLS != nil {
+			if sni := l.MatchSNI(r.TLS.ServerName); sni != nil {
+				ctx = context.WithValue(ctx, sniKey{}, sni)
+				ctx = tenancy.WithBoundTenant(ctx, sni.Tenant)
+				ctx = proxy.WithNamespace(ctx, sni.Namespace)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SetExposure 设置对外开放方法的策略（依赖注入）
+func (s *Server) SetExposure(policy *exposure.Policy) {
+	s.exposure = policy
+}
+
+// exposeRoutes 拒绝未开放的方法与请求所在监听器未开放的路由，返回 404；位于所有中间件之外。
+// 方法选项按请求租户的描述符读取，标记为内部的方法只在内网监听器上开放
+func (s *Server) exposeRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, _ := r.Context().Value(listenerKey{}).(*listener.Listener)
+		httpReq := middleware.RequestFromContext(r.Context())
+		internal := l != nil && l.Internal
+		if httpReq != nil && !s.exposure.Exposes(s.httpProxy.Loader(httpReq.Tenant), httpReq.ServiceName, httpReq.MethodName, internal) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Route %s/%s is not exposed", httpReq.ServiceName, httpReq.MethodName)
+			return
+		}
+		if l != nil && httpReq != nil && !l.AllowsRoute(httpReq.ServiceName, httpReq.MethodName) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Route %s/%s is not exposed on this listener", httpReq.ServiceName, httpReq.MethodName)
+			return
+		}
+		if sni, _ := r.Context().Value(sniKey{}).(*listener.SNI); httpReq != nil && !sni.AllowsRoute(httpReq.ServiceName, httpReq.MethodName) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Route %s/%s is not exposed on this server name", httpReq.ServiceName, httpReq.MethodName)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// SetMaintenance 设置维护模式管理器（依赖注入）
+func (s *Server) SetMaintenance(m *maintenance.Manager) {
+	s.maintenance = m
+}
+
+// checkMaintenance 拒绝处于维护中的路由，返回 503 与 Retry-After；停用的方法返回 503 或 501，不带 Retry-After。位于所有中间件之外
+func (s *Server) checkMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpReq := middleware.RequestFromContext(r.Context())
+		if httpReq == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		retryAfter, err := s.maintenance.Check(httpReq.ServiceName, httpReq.MethodName)
+		if err != nil {
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			}
+			prefix := "Service unavailable"
+			if status.Code(err) == codes.Unimplemented {
+				prefix = "Method not implemented"
+			}
+			s.writeStatusError(w, httpReq, err, prefix)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
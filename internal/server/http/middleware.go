@@ -0,0 +1,317 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/ratelimit"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// 内置中间件名称
+const (
+	MiddlewareAuth      = "auth"
+	MiddlewareRateLimit = "rate_limit"
+	MiddlewareRoutes    = "routes"
+	MiddlewareTenant    = "tenant"
+)
+
+// defaultMiddleware 未配置中间件顺序时使用的内置中间件
+var defaultMiddleware = []string{MiddlewareAuth, MiddlewareRateLimit, MiddlewareRoutes}
+
+// Use 注册自定义中间件（需在 Listen 之前调用），与通过 middleware.Register 注册的中间件相同。
+// 配置了 server.http.middleware 时按配置的顺序执行，否则追加在内置中间件之后
+func (s *Server) Use(m middleware.Middleware) {
+	s.custom = append(s.custom, m)
+}
+
+// customMiddleware 返回通过 middleware.Register 与 Use 注册的自定义中间件
+func (s *Server) customMiddleware() []middleware.Middleware {
+	return append(middleware.Registered(), s.custom...)
+}
+
+// SetRoutes 设置路由规则（依赖注入）
+func (s *Server) SetRoutes(engine *routes.Engine) {
+	s.routes = engine
+}
+
+// SetTenants 设置租户管理器（依赖注入）
+func (s *Server) SetTenants(tenants *tenancy.Manager) {
+	s.tenants = tenants
+}
+
+// SetMiddleware 设置中间件的顺序与全局限流（用于依赖注入）
+func (s *Server) SetMiddleware(cfg config.HTTPServerConfig) {
+	s.middleware = cfg.Middleware
+	s.rateLimit = cfg.RateLimit
+}
+
+// chain 按配置的顺序用中间件包装 handler。配置了外部授权而未列出 auth 时，auth 追加在最内层；
+// 路由规则同理，使热更新后新增的规则也能生效。配置了多租户而未列出 tenant 时，tenant 位于最外层，
+// 使未准入的请求不占用全局限流与授权服务；租户取自认证声明且启用了外部授权时，tenant 紧随 auth，使用授权返回的声明
+func (s *Server) chain(handler http.Handler) (http.Handler, error) {
+	available := map[string]middleware.Middleware{
+		MiddlewareAuth:      middleware.New(MiddlewareAuth, s.authorize),
+		MiddlewareRateLimit: middleware.New(MiddlewareRateLimit, s.limitRate(ratelimit.New(s.rateLimit.RequestsPerSecond, s.rateLimit.Burst))),
+		MiddlewareRoutes:    middleware.New(MiddlewareRoutes, s.route),
+		MiddlewareTenant:    middleware.New(MiddlewareTenant, s.admitTenant),
+	}
+	custom := s.customMiddleware()
+	s.hasCustom = len(custom) > 0
+	names := s.middleware
+	if names == nil {
+		names = append([]string(nil), defaultMiddleware...)
+		for _, m := range custom {
+			names = append(names, m.Name())
+		}
+	}
+	for _, m := range custom {
+		if _, ok := available[m.Name()]; ok {
+			return nil, fmt.Errorf("duplicate HTTP middleware %q", m.Name())
+		}
+		available[m.Name()] = m
+	}
+	if s.authz != nil && !contains(names, MiddlewareAuth) {
+		names = append(names, MiddlewareAuth)
+	}
+	if s.routes != nil && !contains(names, MiddlewareRoutes) {
+		names = append(names, MiddlewareRoutes)
+	}
+	if s.tenants != nil && !contains(names, MiddlewareTenant) {
+		names = insertTenant(names, s.tenants.Claim() != "" && s.authz != nil)
+	}
+
+	used := make(map[string]bool, len(names))
+	chain := make([]middleware.Middleware, 0, len(names))
+	for _, name := range names {
+		m, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown HTTP middleware %q", name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("duplicate HTTP middleware %q", name)
+		}
+		used[name] = true
+		chain = append(chain, m)
+	}
+	if s.routes.UsesClaims() && !claimsBefore(names, MiddlewareRoutes, s.authz != nil, custom) {
+		s.logger.Warn("Route rules read claims, but no auth or custom middleware runs before routes to provide them; claims will be empty")
+	}
+	for _, m := range custom {
+		if !used[m.Name()] {
+			s.logger.Warn("HTTP middleware is registered but not listed in server.http.middleware, skipping", "middleware", m.Name())
+		}
+	}
+
+	// 由内向外包装，使列表中的第一个中间件最先执行。反向代理到普通 HTTP 服务的请求没有
+	// 解析后的请求体，只经过授权与全局限流
+	rest := http.Handler(http.HandlerFunc(s.serveREST))
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i].Wrap(handler)
+		if name := chain[i].Name(); name == MiddlewareAuth || name == MiddlewareRateLimit {
+			rest = chain[i].Wrap(rest)
+		}
+	}
+	s.restHandler = s.checkMaintenance(rest)
+	return s.exposeRoutes(s.checkMaintenance(handler)), nil
+}
+
+// claimsBefore 判断 names 中 target 之前是否有可能设置认证声明的中间件：启用外部授权时的 auth 或自定义中间件
+func claimsBefore(names []string, target string, authorizer bool, custom []middleware.Middleware) bool {
+	for _, name := range names {
+		if name == target {
+			return false
+		}
+		if name == MiddlewareAuth && authorizer {
+			return true
+		}
+		for _, m := range custom {
+			if m.Name() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insertTenant 将 tenant 中间件插入名称列表：afterAuth 时紧随 auth，否则位于最前
+func insertTenant(names []string, afterAuth bool) []string {
+	at := 0
+	if afterAuth {
+		for i, name := range names {
+			if name == MiddlewareAuth {
+				at = i + 1
+			}
+		}
+	}
+	out := make([]string, 0, len(names)+1)
+	out = append(out, names[:at]...)
+	out = append(out, MiddlewareTenant)
+	return append(out, names[at:]...)
+}
+
+// contains 判断名称是否在列表中
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// admitTenant 确定请求的租户（路径中的租户或认证声明中的租户），按租户的 API Key 与限流准入请求，并将租户、租户的元数据转发到上游，
+// 请求只转发到租户命名空间内的实例
+func (s *Server) admitTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpReq := middleware.RequestFromContext(r.Context())
+		if s.tenants == nil || httpReq == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenant, err := s.tenants.Resolve(r.Context(), httpReq.Tenant)
+		if err == nil {
+			err = s.tenants.Admit(tenant, r.Header.Get(tenancy.APIKeyHeader))
+		}
+		if err != nil {
+			s.writeStatusError(w, httpReq, err, "Tenant rejected")
+			return
+		}
+		// 由认证声明得到的租户同样用于后续中间件与描述符的选择
+		httpReq.Tenant = tenant
+		if entry := requestinfo.FromContext(r.Context()); entry != nil {
+			entry.Tenant = tenant
+		}
+		ctx := metadata.AppendToOutgoingContext(r.Context(), s.tenants.Metadata(httpReq.Tenant)...)
+		ctx = proxy.WithNamespace(ctx, s.tenants.Namespace(httpReq.Tenant))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorize 外部授权检查，授权返回的头部作为元数据转发到上游，返回的声明供之后的中间件使用；
+// 授权服务不可用且未开启 fail_open 时返回 503，不向客户端暴露失败原因
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpReq := middleware.RequestFromContext(r.Context())
+		if s.authz == nil || httpReq == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		decision, err := s.authz.Authorize(ctx, &authz.Request{
+			Protocol:   "http",
+			Service:    httpReq.ServiceName,
+			Method:     httpReq.MethodName,
+			Tenant:     httpReq.Tenant,
+			Headers:    s.authz.HeadersFromHTTP(r.Header),
+			Claims:     claims.FromContext(ctx),
+			RemoteAddr: r.RemoteAddr,
+		})
+		if err != nil {
+			if denied, ok := authz.IsDenied(err); ok {
+				s.writeError(w, httpReq, denied.HTTPStatus(), fmt.Sprintf("Unauthorized request: %v", err))
+				return
+			}
+			s.writeError(w, httpReq, http.StatusServiceUnavailable, "Authorization service unavailable")
+			return
+		}
+		// 授权返回的头部替换调用方的同名请求头与元数据，调用方无法伪造授权服务确认的身份；
+		// 请求头转发到普通 HTTP 服务，元数据转发到 gRPC 上游
+		ctx = proxy.SetOutgoingMetadata(ctx, decision.Headers)
+		if decision.Claims != nil {
+			ctx = claims.NewContext(ctx, decision.Claims)
+		}
+		r = r.WithContext(ctx)
+		if len(decision.Headers) > 0 {
+			r.Header = r.Header.Clone()
+			for key, value := range decision.Headers {
+				r.Header.Set(key, value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitRate 超过全局限流的请求返回 429
+func (s *Server) limitRate(limiter *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Allow() {
+				s.writeError(w, middleware.RequestFromContext(r.Context()), http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// route 按路由规则拒绝或改写请求并调用规则的 webhook：改写后的请求体替换原请求体，设置的头部作为元数据转发到上游；
+// 规则配置了 publish 时请求发布到消息队列，不再经过之后的中间件与上游
+func (s *Server) route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpReq := middleware.RequestFromContext(r.Context())
+		if s.routes == nil || httpReq == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headers := make(map[string]string, len(r.Header))
+		for key, values := range r.Header {
+			headers[strings.ToLower(key)] = strings.Join(values, ", ")
+		}
+		ctx := r.Context()
+		outcome, err := s.routes.Evaluate(&routes.Input{
+			Tenant:     httpReq.Tenant,
+			Service:    httpReq.ServiceName,
+			Method:     httpReq.MethodName,
+			Headers:    headers,
+			RemoteAddr: r.RemoteAddr,
+			Claims:     claims.FromContext(ctx),
+			Body:       httpReq.Body,
+		})
+		if err != nil {
+			s.logger.Warn("Route evaluation failed", "service", httpReq.ServiceName, "method", httpReq.MethodName, "error", err)
+			s.writeError(w, httpReq, http.StatusInternalServerError, fmt.Sprintf("Route evaluation failed: %v", err))
+			return
+		}
+		if outcome.Denied {
+			status := outcome.Status
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			s.writeError(w, httpReq, status, "Denied by route "+outcome.Reason)
+			return
+		}
+
+		if outcome.Body != nil {
+			httpReq.Body = outcome.Body
+			if entry := requestinfo.FromContext(ctx); entry != nil {
+				entry.RequestBody = outcome.Body
+			}
+		}
+		for key, value := range outcome.Headers {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+		}
+		handler := next
+		if outcome.Publish != nil {
+			handler = s.publish(outcome.Publish)
+		}
+		if len(outcome.Hooks) > 0 {
+			s.serveWithHooks(w, r.WithContext(ctx), handler, httpReq, headers, outcome.Hooks)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
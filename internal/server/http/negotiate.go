@@ -0,0 +1,80 @@
+package http
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContentTypeJSON JSON 响应的 Content-Type，未指定 Accept 的 JSON 请求的默认响应
+	ContentTypeJSON = "application/json"
+	// ContentTypeXML XML 响应的 Content-Type，由响应消息的描述符生成
+	ContentTypeXML = "application/xml"
+)
+
+// acceptable 响应可以使用的媒体类型
+var acceptable = map[string]string{
+	ContentTypeJSON:        ContentTypeJSON,
+	ContentTypeXProtobuf:   ContentTypeXProtobuf,
+	"application/protobuf": ContentTypeXProtobuf,
+	ContentTypeXML:         ContentTypeXML,
+	"text/xml":             ContentTypeXML,
+}
+
+// negotiate 按 Accept 请求头选择响应的媒体类型：按 q 值由高到低取第一个支持的类型，
+// 未指定 Accept 或接受任意类型时与请求体的编码相同。没有可接受的类型时返回 false
+func negotiate(r *http.Request, protobuf bool) (string, bool) {
+	fallback := responseType(protobuf)
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return fallback, true
+	}
+
+	type choice struct {
+		mediaType string
+		q         float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			choices = append(choices, choice{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, c := range choices {
+		switch {
+		case c.mediaType == "*/*" || c.mediaType == "application/*":
+			return fallback, true
+		case acceptable[c.mediaType] != "":
+			return acceptable[c.mediaType], true
+		}
+	}
+	return "", false
+}
+
+// responseType 返回与请求体编码相同的响应媒体类型
+func responseType(protobuf bool) string {
+	if protobuf {
+		return ContentTypeXProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// writeNotAcceptable 没有可接受的响应类型时返回 406
+func (s *Server) writeNotAcceptable(w http.ResponseWriter, httpReq *HTTPRequest) {
+	s.writeError(w, httpReq, http.StatusNotAcceptable, fmt.Sprintf("Not acceptable: responses are available as %s, %s or %s", ContentTypeJSON, ContentTypeXProtobuf, ContentTypeXML))
+}
@@ -0,0 +1,342 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// pathRoute 编译后的自定义路径路由
+type pathRoute struct {
+	config.PathRouteConfig
+	service string
+	method  string
+	regex   *regexp.Regexp // 为空时按前缀匹配
+}
+
+// SetPathRoutes 设置按自定义路径调用 gRPC 方法的路由，可在运行时替换。
+// 路由按配置顺序匹配，第一个匹配的路由生效
+func (s *Server) SetPathRoutes(routes []config.PathRouteConfig) error {
+	compiled := make([]pathRoute, 0, len(routes))
+	for i, route := range routes {
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("path_routes[%d]", i)
+		}
+		service, method, ok := strings.Cut(route.Target, "/")
+		if !ok || service == "" || method == "" {
+			return fmt.Errorf("path route %s: target must be package.Service/Method, got %q", route.Name, route.Target)
+		}
+		pr := pathRoute{PathRouteConfig: route, service: service, method: method}
+		switch {
+		case route.Regex != "" && route.Prefix != "":
+			return fmt.Errorf("path route %s: prefix and regex are mutually exclusive", route.Name)
+		case route.Regex != "":
+			re, err := regexp.Compile("^(?:" + route.Regex + ")$")
+			if err != nil {
+				return fmt.Errorf("path route %s: %w", route.Name, err)
+			}
+			pr.regex = re
+		case strings.HasPrefix(route.Prefix, "/"):
+			if reservedPath(route.Prefix) {
+				return fmt.Errorf("path route %s: prefix %s is reserved for gRPC and Twirp routes", route.Name, route.Prefix)
+			}
+		default:
+			return fmt.Errorf("path route %s requires a prefix starting with / or a regex", route.Name)
+		}
+		pr.Method = strings.ToUpper(route.Method)
+		switch route.Head {
+		case "", headCall, headOK:
+		default:
+			return fmt.Errorf("path route %s: head must be %q or %q, got %q", route.Name, headCall, headOK, route.Head)
+		}
+		compiled = append(compiled, pr)
+	}
+	s.pathRoutes.Store(&compiled)
+	return nil
+}
+
+// path_routes[].head 的取值
+const (
+	headCall = "call" // 调用方法，只返回响应头
+	headOK   = "ok"   // 不调用方法，直接返回 200
+)
+
+// routeMethods 为匹配任意方法的路由在 OPTIONS 响应中列出的方法
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// reservedPath 报告路径是否在 /rpc/ 或 Twirp 路由下
+func reservedPath(path string) bool {
+	return path == "/rpc" || strings.HasPrefix(path, "/rpc/") || strings.HasPrefix(path, twirp.PathPrefix)
+}
+
+// matchPathRoute 返回请求匹配的自定义路径路由与捕获的分组，没有匹配时返回 nil
+func (s *Server) matchPathRoute(r *http.Request) (*pathRoute, map[string]string) {
+	routes := s.pathRoutes.Load()
+	if routes == nil || reservedPath(r.URL.Path) {
+		return nil, nil
+	}
+	for i := range *routes {
+		route := &(*routes)[i]
+		if !route.allows(r.Method) {
+			continue
+		}
+		if route.regex == nil {
+			if strings.HasPrefix(r.URL.Path, route.Prefix) {
+				return route, map[string]string{"path": strings.TrimPrefix(r.URL.Path, route.Prefix)}
+			}
+			continue
+		}
+		match := route.regex.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for j, name := range route.regex.SubexpNames() {
+			if j > 0 {
+				groups[strconv.Itoa(j)] = match[j]
+				if name != "" {
+					groups[name] = match[j]
+				}
+			}
+		}
+		return route, groups
+	}
+	return nil, nil
+}
+
+// allows 报告路由是否处理该 HTTP 方法的请求：GET 路由同时处理 HEAD；
+// OPTIONS 请求只由明确指定了 OPTIONS 的路由处理，其他情况由网关按路径上的路由应答
+func (route *pathRoute) allows(method string) bool {
+	switch {
+	case route.Method == method:
+		return true
+	case method == http.MethodOptions:
+		return false
+	case route.Method == "":
+		return true
+	default:
+		return method == http.MethodHead && route.Method == http.MethodGet
+	}
+}
+
+// matchesPath 报告路由的路径是否匹配，不考虑 HTTP 方法
+func (route *pathRoute) matchesPath(path string) bool {
+	if route.regex == nil {
+		return strings.HasPrefix(path, route.Prefix)
+	}
+	return route.regex.MatchString(path)
+}
+
+// pathRouteMethods 返回路径上的自定义路径路由允许的 HTTP 方法，没有路由匹配该路径时返回 nil
+func (s *Server) pathRouteMethods(path string) []string {
+	routes := s.pathRoutes.Load()
+	if routes == nil || reservedPath(path) {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for i := range *routes {
+		route := &(*routes)[i]
+		if !route.matchesPath(path) {
+			continue
+		}
+		if route.Method == "" {
+			return routeMethods
+		}
+		allowed[route.Method] = true
+		if route.Method == http.MethodGet {
+			allowed[http.MethodHead] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	allowed[http.MethodOptions] = true
+	methods := make([]string, 0, len(allowed))
+	for _, method := range routeMethods {
+		if allowed[method] {
+			methods = append(methods, method)
+			delete(allowed, method)
+		}
+	}
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods[len(methods)-len(allowed):])
+	return methods
+}
+
+// handlePathOptions 以路径上的自定义路径路由允许的方法应答 OPTIONS 请求，没有路由匹配该路径时返回 false
+func (s *Server) handlePathOptions(w http.ResponseWriter, r *http.Request) bool {
+	methods := s.pathRouteMethods(r.URL.Path)
+	if methods == nil {
+		return false
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// fields 返回捕获分组对应的请求字段：fields 中列出的分组设置到对应字段，
+// 其他命名分组设置到同名字段
+func (route *pathRoute) fields(groups map[string]string) map[string]string {
+	fields := make(map[string]string)
+	if route.regex != nil {
+		for _, name := range route.regex.SubexpNames() {
+			if _, mapped := route.Fields[name]; name != "" && !mapped {
+				fields[name] = groups[name]
+			}
+		}
+	}
+	for group, field := range route.Fields {
+		if value, ok := groups[group]; ok {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// handlePathRoute 将匹配自定义路径路由的请求转换为 gRPC 方法的 JSON 请求，之后与 /rpc 请求相同
+// GET 路由处理的 HEAD 请求同样调用方法，响应体由 net/http 丢弃；head 为 ok 时不调用方法直接返回 200
+func (s *Server) handlePathRoute(w http.ResponseWriter, r *http.Request, route *pathRoute, groups map[string]string) {
+	if r.Method == http.MethodHead && route.Method != http.MethodHead && route.Head == headOK {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	tenantKey := tenancy.DefaultMetadataKey
+	if s.tenants != nil {
+		tenantKey = s.tenants.MetadataKey()
+	}
+	httpReq := &HTTPRequest{Tenant: r.Header.Get(tenantKey), ServiceName: route.service, MethodName: route.method, Fields: responseFields(r)}
+	if s.httpProxy == nil {
+		s.writeError(w, httpReq, http.StatusInternalServerError, "HTTP proxy not configured")
+		return
+	}
+	body, err := readBody(r.Body)
+	if err != nil {
+		s.writeError(w, httpReq, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	if err := s.validateRequest(r, httpReq.ServiceName, httpReq.MethodName, body); err != nil {
+		s.writeError(w, httpReq, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	accept, ok := negotiate(r, false)
+	if !ok {
+		s.writeNotAcceptable(w, httpReq)
+		return
+	}
+	httpReq.Accept = accept
+	httpReq.Body, err = setFields(body, route.fields(groups), s.inputMessage(httpReq))
+	if err != nil {
+		s.writeError(w, httpReq, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	if err := s.fillFieldMasks(r, httpReq); err != nil {
+		s.writeStatusError(w, httpReq, err, "Invalid request")
+		return
+	}
+
+	if entry := requestinfo.FromContext(r.Context()); entry != nil {
+		entry.Tenant = httpReq.Tenant
+		entry.Service = httpReq.ServiceName
+		entry.Method = httpReq.MethodName
+		entry.RequestBody = httpReq.Body
+	}
+	s.handler.ServeHTTP(w, r.WithContext(middleware.NewContext(r.Context(), httpReq)))
+}
+
+// inputMessage 返回方法的输入类型，用于确定捕获值的 JSON 类型；方法未加载时返回 nil
+func (s *Server) inputMessage(httpReq *HTTPRequest) func(name string) *descriptorpb.DescriptorProto {
+	loader := s.httpProxy.Loader(httpReq.Tenant)
+	if loader == nil {
+		return nil
+	}
+	method := loader.FindMethodDescriptor(httpReq.ServiceName, httpReq.MethodName)
+	if method == nil {
+		return nil
+	}
+	return func(name string) *descriptorpb.DescriptorProto {
+		if name == "" {
+			name = method.GetInputType()
+		}
+		return loader.FindMessageDescriptor(strings.TrimPrefix(name, "."))
+	}
+}
+
+// setFields 将捕获值按点分隔的字段路径设置到 JSON 请求体中，覆盖请求体中的同名字段。
+// 请求体为空时从空对象开始；布尔字段的值转换为 JSON 布尔值，其他值保持字符串，
+// protojson 接受字符串形式的数值
+func setFields(body []byte, fields map[string]string, messages func(name string) *descriptorpb.DescriptorProto) ([]byte, error) {
+	if len(fields) == 0 && len(body) > 0 {
+		return body, nil
+	}
+	object := make(map[string]any)
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, fmt.Errorf("request body must be a JSON object: %w", err)
+		}
+	}
+	for path, value := range fields {
+		var message *descriptorpb.DescriptorProto
+		if messages != nil {
+			message = messages("")
+		}
+		parts := strings.Split(path, ".")
+		target := object
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := target[part].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				target[part] = next
+			}
+			target = next
+			message = nestedMessage(message, part, messages)
+		}
+		last := parts[len(parts)-1]
+		target[last] = value
+		if field := findField(message, last); field != nil && field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", path, err)
+			}
+			target[last] = b
+		}
+	}
+	return json.Marshal(object)
+}
+
+// nestedMessage 返回消息字段的类型，未知时返回 nil
+func nestedMessage(message *descriptorpb.DescriptorProto, name string, messages func(name string) *descriptorpb.DescriptorProto) *descriptorpb.DescriptorProto {
+	field := findField(message, name)
+	if field == nil || field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return nil
+	}
+	return messages(field.GetTypeName())
+}
+
+// findField 按 protobuf 字段名或 JSON 名查找字段
+func findField(message *descriptorpb.DescriptorProto, name string) *descriptorpb.FieldDescriptorProto {
+	if message == nil {
+		return nil
+	}
+	for _, field := range message.GetField() {
+		if field.GetName() == name || field.GetJsonName() == name {
+			return field
+		}
+	}
+	return nil
+}
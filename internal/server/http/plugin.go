@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+	"github.com/heytom-labs/heytom-gateway/pkg/plugin"
+)
+
+// PluginMiddleware 将外部插件的过滤器作为中间件：转发前用插件过滤请求，拒绝时直接返回；
+// 转发后用插件过滤上游响应。插件调用失败（且未配置 fail_open）时返回 502
+func PluginMiddleware(name string, filter plugin.Filter) middleware.Middleware {
+	return middleware.New(name, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpReq := middleware.RequestFromContext(r.Context())
+			if httpReq == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			headers := make(map[string]string, len(r.Header))
+			for key := range r.Header {
+				headers[http.CanonicalHeaderKey(key)] = r.Header.Get(key)
+			}
+			result, err := filter.FilterRequest(r.Context(), &plugin.Request{
+				Protocol:   "http",
+				Tenant:     httpReq.Tenant,
+				Service:    httpReq.ServiceName,
+				Method:     httpReq.MethodName,
+				Headers:    headers,
+				RemoteAddr: r.RemoteAddr,
+				Body:       string(httpReq.Body),
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				fmt.Fprintf(w, "Plugin failed: %v", err)
+				return
+			}
+			if result.Reject {
+				status := result.Status
+				if status == 0 {
+					status = http.StatusForbidden
+				}
+				w.WriteHeader(status)
+				fmt.Fprintf(w, "Rejected by plugin %s: %s", name, result.Reason)
+				return
+			}
+
+			ctx := r.Context()
+			if result.Body != nil {
+				httpReq.Body = []byte(*result.Body)
+				if entry := requestinfo.FromContext(ctx); entry != nil {
+					entry.RequestBody = httpReq.Body
+				}
+			}
+			for key, value := range result.Headers {
+				ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+			}
+
+			// 缓冲响应，使插件可以检查并改写
+			rec := &responseBuffer{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			result, err = filter.FilterResponse(ctx, &plugin.Response{
+				Protocol: "http",
+				Tenant:   httpReq.Tenant,
+				Service:  httpReq.ServiceName,
+				Method:   httpReq.MethodName,
+				Status:   rec.status,
+				Body:     rec.body.String(),
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				fmt.Fprintf(w, "Plugin failed: %v", err)
+				return
+			}
+
+			for key, values := range rec.header {
+				w.Header()[key] = values
+			}
+			for key, value := range result.Headers {
+				w.Header().Set(key, value)
+			}
+			status := rec.status
+			if result.Status != 0 {
+				status = result.Status
+			}
+			body := rec.body.Bytes()
+			if result.Body != nil {
+				body = []byte(*result.Body)
+				if entry := requestinfo.FromContext(ctx); entry != nil && entry.ResponseBody != nil {
+					entry.ResponseBody = body
+				}
+			}
+			w.WriteHeader(status)
+			w.Write(body)
+		})
+	})
+}
+
+// responseBuffer 缓冲内层处理器写出的响应
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header 实现 http.ResponseWriter
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader 实现 http.ResponseWriter
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+// Write 实现 http.ResponseWriter
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+)
+
+// ContentTypeXProtobuf /rpc 请求使用 protobuf 编码请求体时的 Content-Type，未指定 Accept 时响应使用相同编码
+const ContentTypeXProtobuf = "application/x-protobuf"
+
+// isXProtobuf 判断 /rpc 请求体是否为 protobuf 编码
+func isXProtobuf(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == ContentTypeXProtobuf
+}
+
+// passthrough 判断 protobuf 请求体能否不经解码转发：路由规则、插件与自定义中间件读取或改写 JSON 请求体，
+// 请求体日志记录 JSON，选择响应字段或响应使用其他编码时需要解码响应，这些对请求生效时请求体仍转换为 JSON
+func (s *Server) passthrough(httpReq *HTTPRequest) bool {
+	return !s.hasCustom && len(httpReq.Fields) == 0 && httpReq.Accept == ContentTypeXProtobuf &&
+		!s.routes.Matches(httpReq.ServiceName, httpReq.MethodName) &&
+		!s.payloadLog.Enabled(httpReq.ServiceName, httpReq.MethodName)
+}
+
+// prepareProtobuf 处理 protobuf 编码的请求体：可以透传时原样保留，否则按方法的输入类型转换为 JSON，
+// 使中间件与上游调用与 JSON 请求相同。请求体同时记入请求信息供观察者使用
+func (s *Server) prepareProtobuf(r *http.Request, httpReq *HTTPRequest) error {
+	entry := requestinfo.FromContext(r.Context())
+	if s.passthrough(httpReq) {
+		httpReq.Passthrough = true
+		if entry != nil {
+			entry.RequestMessage = httpReq.Body
+		}
+		return nil
+	}
+
+	body, err := s.httpProxy.DecodeRequest(httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, httpReq.Body)
+	if err != nil {
+		return err
+	}
+	httpReq.Body = body
+	if entry != nil {
+		entry.RequestBody = body
+	}
+	return nil
+}
+
+// writeProtobuf 写出 protobuf 编码的响应，Content-Type 与请求相同
+func writeProtobuf(w http.ResponseWriter, httpReq *HTTPRequest, data []byte) {
+	contentType := ContentTypeXProtobuf
+	if httpReq.Twirp {
+		contentType = twirp.ContentTypeProtobuf
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -1,69 +1,167 @@
 package http
 
 import (
+	"log/slog"
+
 	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/accesslog"
+	"github.com/heytom-labs/heytom-gateway/internal/admin"
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/cache"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
 	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/latency"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/internal/payloadlog"
+	"github.com/heytom-labs/heytom-gateway/internal/plugins"
 	"github.com/heytom-labs/heytom-gateway/internal/proto"
 	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
 	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/tap"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+	"github.com/heytom-labs/heytom-gateway/internal/upstreams"
+	"github.com/heytom-labs/heytom-gateway/internal/webhook"
 )
 
 // ProviderSet HTTP server provider set
 var ProviderSet = wire.NewSet(
 	ProvideServer,
 	ProvideHTTPProxy,
+	ProvideRESTProxy,
 )
 
 // ProvideServer provides HTTP server instance
-func ProvideServer(cfg *config.Config, httpProxy *proxy.HTTPProxy) *Server {
+func ProvideServer(cfg *config.Config, log *slog.Logger, httpProxy *proxy.HTTPProxy, authzClient *authz.Client, accessLog *accesslog.Logger, payloadLog *payloadlog.Logger, h *health.Health, adminHandler *admin.Handler, tracker *latency.Tracker, upstreamTracker *upstreams.Tracker, hub *tap.Hub, pluginManager *plugins.Manager, routeEngine *routes.Engine, webhooks *webhook.Client, tenants *tenancy.Manager, publisher *publish.Manager, restProxy *proxy.RESTProxy, watcher *reload.Watcher, maintenanceManager *maintenance.Manager, ho *handover.Handover, recorder *capture.Recorder, limiter *concurrency.Limiter, policy *exposure.Policy, trust *identity.Trust, tracer *tracing.Tracer, responseCache *cache.Cache) (*Server, error) {
 	server := New(cfg.Server.HTTPPort)
+	server.SetLogger(logger.Component(log, "http_server"))
 	server.SetHTTPProxy(httpProxy)
-	return server
+	server.SetAuthorizer(authzClient)
+	if accessLog != nil {
+		server.AddObserver(accessLog)
+	}
+	if tracker != nil {
+		server.AddObserver(tracker)
+	}
+	if hub != nil {
+		server.AddObserver(hub)
+	}
+	if tenants != nil {
+		server.AddObserver(tenants)
+	}
+	server.AddObserver(upstreamTracker)
+	if tracer != nil {
+		server.AddObserver(tracer)
+	}
+	if recorder != nil {
+		server.AddObserver(recorder)
+	}
+	server.SetPayloadLogger(payloadLog)
+	server.SetHealth(h)
+	server.SetAdmin(adminHandler)
+	server.SetMiddleware(cfg.Server.HTTP)
+	server.SetMaxBufferedResponse(cfg.Server.HTTP.MaxBufferedResponse)
+	server.SetUpstreamHeaders(cfg.Server.HTTP.UpstreamHeaders)
+	server.SetConnLimits(cfg.Server.HTTP)
+	server.SetRoutes(routeEngine)
+	server.SetWebhooks(webhooks)
+	server.SetTenants(tenants)
+	server.SetPublisher(publisher)
+	server.SetRESTProxy(restProxy)
+	server.SetMaintenance(maintenanceManager)
+	server.SetHandover(ho)
+	server.SetConcurrencyLimiter(limiter)
+	server.SetExposure(policy)
+	server.SetIdentity(trust)
+	server.SetTracer(tracer)
+	server.SetCache(responseCache)
+	if err := server.SetListeners(cfg.Server.Listeners); err != nil {
+		return nil, err
+	}
+	if err := server.SetHTTPRoutes(cfg.HTTPRoutes); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("http_routes", func(_, next *config.Config) error {
+		return server.SetHTTPRoutes(next.HTTPRoutes)
+	})
+	if err := server.SetFallback(cfg.Fallback); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("fallback", func(_, next *config.Config) error {
+		return server.SetFallback(next.Fallback)
+	})
+	if err := server.SetCollapse(cfg.Collapse); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("collapse", func(_, next *config.Config) error {
+		return server.SetCollapse(next.Collapse)
+	})
+	if err := server.SetErrors(cfg.Errors); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("errors", func(_, next *config.Config) error {
+		return server.SetErrors(next.Errors)
+	})
+	if err := server.SetValidation(cfg.Validation); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("validation", func(_, next *config.Config) error {
+		return server.SetValidation(next.Validation)
+	})
+	if err := server.SetPathRoutes(cfg.PathRoutes); err != nil {
+		return nil, err
+	}
+	watcher.OnChange("path_routes", func(_, next *config.Config) error {
+		return server.SetPathRoutes(next.PathRoutes)
+	})
+	for _, p := range pluginManager.Plugins() {
+		server.Use(PluginMiddleware(p.Name, p.Filter))
+	}
+	return server, nil
 }
 
-// ProvideHTTPProxy provides HTTP proxy instance
-func ProvideHTTPProxy(cfg *config.Config, reg registry.Registry) (*proxy.HTTPProxy, error) {
+// ProvideRESTProxy provides the reverse proxy for plain HTTP services, which
+// shares the service policies of the gRPC proxies
+func ProvideRESTProxy(cfg *config.Config, log *slog.Logger, reg registry.Registry, policies *proxy.ServicePolicies) *proxy.RESTProxy {
 	if !cfg.Registry.Enabled {
+		return nil
+	}
+	return proxy.NewRESTProxy(reg, policies, logger.Component(log, "rest_proxy"))
+}
+
+// ProvideHTTPProxy provides HTTP proxy instance
+func ProvideHTTPProxy(cfg *config.Config, log *slog.Logger, reg registry.Registry, protoLoader *proto.DescriptorLoader, tenants *proto.Tenants, pool *proxy.ConnectionPool, policies *proxy.ServicePolicies, hotReload *proto.HotReloadManager) (*proxy.HTTPProxy, error) {
+	if !cfg.Registry.Enabled || protoLoader == nil {
 		return nil, nil
 	}
 
-	// Load protoset
-	protoLoader, err := proto.NewDescriptorLoader(cfg.Proto.ProtoSetPath)
+	// Create HTTP proxy
+	httpProxy, err := proxy.NewHTTPProxy(protoLoader, reg, pool, policies, logger.Component(log, "http_proxy"))
 	if err != nil {
 		return nil, err
 	}
 
-	// Load additional protosets if configured
-	for _, ps := range cfg.Proto.ProtoSets {
-		if ps.Path != "" {
-			if err := protoLoader.LoadProtoset(ps.Path); err != nil {
-				return nil, err
-			}
-		}
+	if err := httpProxy.SetJSONFormat(cfg.Server.HTTP.JSON); err != nil {
+		return nil, err
 	}
 
-	// Create HTTP proxy
-	httpProxy, err := proxy.NewHTTPProxy(protoLoader, reg)
-	if err != nil {
+	// Resolve /rpc/{tenant}/... against the tenant's own descriptors
+	if err := httpProxy.SetTenants(tenants); err != nil {
 		return nil, err
 	}
 
-	// Start hot reload if enabled
-	if cfg.Proto.HotReload.Enabled {
-		hotReloadMgr := proto.NewHotReloadManager(
-			protoLoader,
-			&cfg.Proto.HotReload,
-			cfg.Proto.ProtoSets,
-		)
-
-		// Set message cache clear callback
-		hotReloadMgr.SetMessageCacheClearFunc(func() {
-			httpProxy.ClearMessageCache()
-		})
-
-		// TODO: Start hot reload in app initialization
-		// This should be done in the app.go main function
-		// hotReloadMgr.Start(context.Background())
+	// Rebuild the message registry whenever protosets are reloaded
+	if hotReload != nil {
+		hotReload.SetReloadFunc(httpProxy.RebuildDescriptors)
 	}
 
 	return httpProxy, nil
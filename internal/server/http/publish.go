@@ -0,0 +1,56 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/statusmap"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// SetPublisher 设置路由规则发布消息使用的消息队列（依赖注入）
+func (s *Server) SetPublisher(publisher *publish.Manager) {
+	s.publisher = publisher
+}
+
+// publish 将请求体按路由规则配置的消息类型校验并编码后发布到消息队列，代替转发到上游。
+// 转发给上游的元数据（租户、路由规则设置的头部等）作为消息头，发布成功返回 202
+func (s *Server) publish(target *routes.Publish) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpReq := middleware.RequestFromContext(r.Context())
+		payload, err := s.httpProxy.EncodeMessage(httpReq.Tenant, target.MessageType, httpReq.Body)
+		if err != nil {
+			w.WriteHeader(statusmap.HTTPStatus(status.Code(err)))
+			fmt.Fprintf(w, "Publish failed: %s", status.Convert(err).Message())
+			return
+		}
+
+		msg := &publish.Message{Topic: target.Topic, Key: target.Key, Payload: payload}
+		if md, ok := metadata.FromOutgoingContext(r.Context()); ok {
+			msg.Headers = make(map[string]string, len(md))
+			for key, values := range md {
+				msg.Headers[key] = strings.Join(values, ", ")
+			}
+		}
+		if entry := requestinfo.FromContext(r.Context()); entry != nil {
+			entry.Upstream = target.Broker + "/" + target.Topic
+		}
+		if err := s.publisher.Publish(r.Context(), target.Broker, msg); err != nil {
+			s.logger.Warn("Publish failed", "route", target.Route, "broker", target.Broker, "topic", target.Topic, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "Publish failed: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("{}"))
+	})
+}
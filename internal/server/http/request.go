@@ -2,16 +2,16 @@ package http
 
 import (
 	"fmt"
+	"mime"
+	"net/http"
 	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
 )
 
-// HTTPRequest HTTP 请求信息
-type HTTPRequest struct {
-	Tenant      string // 租户标识
-	ServiceName string // 完整的 protobuf 服务名 (package.ServiceName)
-	MethodName  string // 方法名
-	Body        []byte // 请求体
-}
+// HTTPRequest HTTP 请求信息，中间件通过 middleware.RequestFromContext 取得
+type HTTPRequest = middleware.Request
 
 // ParseHTTPRequest 解析 HTTP 请求路径
 // 路径格式支持两种:
@@ -55,3 +55,60 @@ func ParseHTTPRequest(path string, body []byte) (*HTTPRequest, error) {
 		Body:        body,
 	}, nil
 }
+
+// ParseTwirpRequest 解析 Twirp 协议请求
+// 路径格式: /twirp/{full.proto.Service}/{Method}，例如: /twirp/order.OrderService/Create
+// 请求体为 JSON（application/json）或 protobuf（application/protobuf）
+func ParseTwirpRequest(path, contentType string, body []byte) (*HTTPRequest, error) {
+	serviceName, methodName, err := twirp.ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case twirp.ContentTypeJSON, twirp.ContentTypeProtobuf:
+	default:
+		return nil, fmt.Errorf("unexpected Content-Type %q, expected %s or %s", contentType, twirp.ContentTypeJSON, twirp.ContentTypeProtobuf)
+	}
+
+	return &HTTPRequest{
+		ServiceName: serviceName,
+		MethodName:  methodName,
+		Body:        body,
+		Twirp:       true,
+		Protobuf:    mediaType == twirp.ContentTypeProtobuf,
+		Accept:      responseType(mediaType == twirp.ContentTypeProtobuf),
+	}, nil
+}
+
+// responseFields 解析查询参数 fields 中以逗号分隔的响应字段
+func responseFields(r *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// fillFieldMasks 由查询参数或请求头填充请求体中未设置的 FieldMask 字段，例如 update_mask
+// 取自查询参数 update_mask（或 JSON 名 updateMask）或请求头 X-Update-Mask。透传的 protobuf 请求体不变
+func (s *Server) fillFieldMasks(r *http.Request, httpReq *HTTPRequest) error {
+	if httpReq.Passthrough {
+		return nil
+	}
+	query := r.URL.Query()
+	body, err := s.httpProxy.FillFieldMasks(httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, httpReq.Body, func(name string) string {
+		if value := query.Get(name); value != "" {
+			return value
+		}
+		return r.Header.Get("X-" + strings.ReplaceAll(name, "_", "-"))
+	})
+	if err != nil {
+		return err
+	}
+	httpReq.Body = body
+	return nil
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+)
+
+// defaultMaxBufferedResponse 未配置 server.http.max_buffered_response 时 JSON 响应在内存中缓冲的最大字节数
+const defaultMaxBufferedResponse = 1 << 20
+
+// SetMaxBufferedResponse 设置 JSON 响应在内存中缓冲的最大字节数（依赖注入），0 使用默认值 1 MiB
+func (s *Server) SetMaxBufferedResponse(limit int) {
+	if limit <= 0 {
+		limit = defaultMaxBufferedResponse
+	}
+	s.maxBufferedResponse = limit
+}
+
+// SetUpstreamHeaders 设置是否在响应中加入上游实例信息的调试响应头（依赖注入）
+func (s *Server) SetUpstreamHeaders(enabled bool) {
+	s.upstreamHeaders = enabled
+}
+
+// withPeer 开启上游调试响应头时，在上下文中记录处理请求的上游实例
+func (s *Server) withPeer(ctx context.Context) context.Context {
+	if !s.upstreamHeaders {
+		return ctx
+	}
+	return proxy.WithPeer(ctx)
+}
+
+// responseStream 接收代理生成的 JSON 响应：不超过 limit 的响应缓冲在内存中，上游调用失败时仍可返回错误并重试；
+// 超过 limit 后写出响应头与已缓冲的内容，之后的内容边生成边写出，Flush 时立即发送给客户端
+type responseStream struct {
+	ctx   context.Context // 请求上下文，开始发送时从中读取上游尝试次数
+	w     http.ResponseWriter
+	limit int
+	buf   bytes.Buffer
+	sent  bool // 响应头已写出，内容无法撤回
+}
+
+// Write 实现 proxy.ResponseWriter
+func (s *responseStream) Write(p []byte) (int, error) {
+	if !s.sent {
+		if s.buf.Len()+len(p) <= s.limit {
+			return s.buf.Write(p)
+		}
+		s.sent = true
+		s.w.Header().Set("Content-Type", "application/json")
+		proxy.SetUpstreamHeaders(s.w, s.ctx)
+		s.w.WriteHeader(http.StatusOK)
+		buffered := s.buf.Bytes()
+		s.buf = bytes.Buffer{}
+		if _, err := s.w.Write(buffered); err != nil {
+			return 0, err
+		}
+	}
+	return s.w.Write(p)
+}
+
+// Flush 实现 proxy.ResponseWriter，响应仍在缓冲时不发送
+func (s *responseStream) Flush() {
+	if s.sent {
+		// 插件缓冲响应时不支持 Flush，忽略错误
+		http.NewResponseController(s.w).Flush()
+	}
+}
+
+// Reset 实现 proxy.ResponseWriter
+func (s *responseStream) Reset() bool {
+	if s.sent {
+		return false
+	}
+	s.buf.Reset()
+	return true
+}
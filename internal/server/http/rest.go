@@ -0,0 +1,92 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// SetRESTProxy 设置普通 HTTP 服务的反向代理（依赖注入）
+func (s *Server) SetRESTProxy(restProxy *proxy.RESTProxy) {
+	s.restProxy = restProxy
+}
+
+// SetHTTPRoutes 设置反向代理到普通 HTTP 服务的路由，可在运行时替换。
+// 路由按前缀由长到短匹配，前缀相同时指定了主机的路由优先
+func (s *Server) SetHTTPRoutes(routes []config.HTTPRouteConfig) error {
+	sorted := make([]config.HTTPRouteConfig, 0, len(routes))
+	for i, route := range routes {
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("http_routes[%d]", i)
+		}
+		if !strings.HasPrefix(route.Prefix, "/") || route.Service == "" {
+			return fmt.Errorf("HTTP route %s requires a prefix starting with / and a service", route.Name)
+		}
+		if route.Prefix == "/rpc" || strings.HasPrefix(route.Prefix, "/rpc/") {
+			return fmt.Errorf("HTTP route %s: prefix %s is reserved for gRPC routes", route.Name, route.Prefix)
+		}
+		route.Host = strings.ToLower(route.Host)
+		sorted = append(sorted, route)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if len(sorted[i].Prefix) != len(sorted[j].Prefix) {
+			return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+		}
+		return sorted[i].Host != "" && sorted[j].Host == ""
+	})
+	s.httpRoutes.Store(&sorted)
+	return nil
+}
+
+// matchHTTPRoute 返回请求匹配的反向代理路由，没有匹配或为 /rpc/ 下的路径时返回 nil
+func (s *Server) matchHTTPRoute(r *http.Request) *config.HTTPRouteConfig {
+	routes := s.httpRoutes.Load()
+	if routes == nil || strings.HasPrefix(r.URL.Path, "/rpc/") {
+		return nil
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for i := range *routes {
+		route := &(*routes)[i]
+		if (route.Host == "" || route.Host == host) && strings.HasPrefix(r.URL.Path, route.Prefix) {
+			return route
+		}
+	}
+	return nil
+}
+
+// handleHTTPRoute 将匹配反向代理路由的请求经过授权与全局限流中间件后转发到普通 HTTP 服务
+func (s *Server) handleHTTPRoute(w http.ResponseWriter, r *http.Request, route *config.HTTPRouteConfig) {
+	if s.restProxy == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "HTTP backend proxy not configured")
+		return
+	}
+
+	path := r.URL.Path
+	if route.StripPrefix {
+		path = "/" + strings.TrimPrefix(strings.TrimPrefix(path, route.Prefix), "/")
+	}
+	httpReq := &HTTPRequest{ServiceName: route.Service, MethodName: path}
+	if entry := requestinfo.FromContext(r.Context()); entry != nil {
+		entry.Service = route.Service
+		entry.Method = path
+	}
+	s.restHandler.ServeHTTP(w, r.WithContext(middleware.NewContext(r.Context(), httpReq)))
+}
+
+// serveREST 转发到普通 HTTP 服务
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	httpReq := middleware.RequestFromContext(r.Context())
+	s.restProxy.Forward(w, r.WithContext(s.withPeer(r.Context())), httpReq.ServiceName, httpReq.MethodName)
+}
@@ -3,28 +3,107 @@ package http
 import (
 	"context"
 	"fmt"
-	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/admin"
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/cache"
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/payloadlog"
 	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
+	"github.com/heytom-labs/heytom-gateway/internal/recovery"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/statusmap"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+	"github.com/heytom-labs/heytom-gateway/internal/version"
+	"github.com/heytom-labs/heytom-gateway/internal/webhook"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
 )
 
 // Server HTTP服务器结构体
 type Server struct {
-	httpServer *http.Server
-	httpProxy  *proxy.HTTPProxy
+	httpServer  *http.Server
+	listener    net.Listener
+	httpProxy   *proxy.HTTPProxy
+	authz       *authz.Client
+	logger      *slog.Logger
+	observers   []requestinfo.Observer
+	payloadLog  *payloadlog.Logger
+	health      *health.Health
+	admin       *admin.Handler
+	middleware  []string
+	rateLimit   config.RateLimitConfig
+	custom      []middleware.Middleware // 通过 Use 注册的自定义中间件
+	hasCustom   bool                    // 注册了自定义中间件，protobuf 请求体需转换为 JSON
+	routes      *routes.Engine
+	webhooks    *webhook.Client
+	tenants     *tenancy.Manager
+	publisher   *publish.Manager
+	restProxy   *proxy.RESTProxy
+	maintenance *maintenance.Manager
+	handover    *handover.Handover
+	concurrency *concurrency.Limiter // 转发请求共享的并发限制
+	exposure    *exposure.Policy     // 对外开放的方法，为空时开放全部方法
+	identity    *identity.Trust      // 可信的身份请求头
+	tracer      *tracing.Tracer      // W3C 追踪上下文的传播与 span 导出
+	cache       *cache.Cache         // 方法的响应缓存
+	endpoints   []*endpoint          // http_port 之外的监听器
+	httpRoutes  atomic.Pointer[[]config.HTTPRouteConfig]
+	pathRoutes  atomic.Pointer[[]pathRoute]
+	fallback    atomic.Pointer[config.FallbackConfig]
+	collapse    atomic.Pointer[collapsePolicy]
+	errors      atomic.Pointer[config.ErrorsConfig]
+	validation  atomic.Pointer[[]validationRule]
+	inflight    singleflight.Group
+	handler     http.Handler // 中间件包装后的代理处理器
+	restHandler http.Handler // 中间件包装后的普通 HTTP 服务反向代理处理器
+
+	maxBufferedResponse int        // JSON 响应在内存中缓冲的最大字节数，超出后边生成边写出
+	upstreamHeaders     bool       // 响应中加入上游实例信息的调试响应头
+	limits              connLimits // 连接的超时与请求头大小限制
 }
 
 // New 创建HTTP服务器实例
 func New(address string) *Server {
 	mux := http.NewServeMux()
 
-	return &Server{
+	s := &Server{
 		httpServer: &http.Server{
 			Addr:    address,
 			Handler: mux,
 		},
+		logger:   slog.Default(),
+		webhooks: webhook.New(slog.Default()),
+
+		maxBufferedResponse: defaultMaxBufferedResponse,
+		limits:              defaultConnLimits,
 	}
+	s.limits.apply(s.httpServer)
+	return s
+}
+
+// SetLogger 设置日志记录器（依赖注入）
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger = logger
 }
 
 // SetHTTPProxy 设置HTTP代理器（依赖注入）
@@ -32,44 +111,134 @@ func (s *Server) SetHTTPProxy(proxy *proxy.HTTPProxy) {
 	s.httpProxy = proxy
 }
 
-// Start 启动HTTP服务器
-func (s *Server) Start() error {
-	// 定义库底路由处理器
-	s.httpServer.Handler = http.HandlerFunc(s.handleRequest)
+// SetAuthorizer 设置外部授权客户端（依赖注入）
+func (s *Server) SetAuthorizer(client *authz.Client) {
+	s.authz = client
+}
+
+// AddObserver 添加请求完成观察者，如访问日志、延迟统计（依赖注入）
+func (s *Server) AddObserver(observer requestinfo.Observer) {
+	s.observers = append(s.observers, observer)
+}
+
+// SetPayloadLogger 设置请求/响应体日志记录器（依赖注入）
+func (s *Server) SetPayloadLogger(payloadLog *payloadlog.Logger) {
+	s.payloadLog = payloadLog
+}
+
+// SetHealth 设置健康检查聚合器（依赖注入）
+func (s *Server) SetHealth(h *health.Health) {
+	s.health = h
+}
+
+// SetHandover 设置监听套接字交接（依赖注入）：热重启时继承旧进程的监听器
+func (s *Server) SetHandover(h *handover.Handover) {
+	s.handover = h
+}
+
+// SetAdmin 设置管理接口处理器（依赖注入）
+func (s *Server) SetAdmin(h *admin.Handler) {
+	s.admin = h
+}
+
+// Listen 构建路由与中间件并绑定监听端口，中间件配置错误或端口不可用时立即返回错误
+func (s *Server) Listen() error {
+	handler, err := s.chain(http.HandlerFunc(s.handleProxy))
+	if err != nil {
+		return err
+	}
+	s.handler = handler
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "HTTP Server is healthy")
-	})
-	mux.HandleFunc("/", s.handleRequest)
-	s.httpServer.Handler = mux
+	mux.HandleFunc("/healthz", s.health.LivenessHandler())
+	mux.HandleFunc("/health", s.health.LivenessHandler()) // 兼容旧的健康检查路径
+	mux.HandleFunc("/readyz", s.health.ReadinessHandler())
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/version", version.Handler())
+	if s.admin != nil {
+		mux.Handle("/admin/", s.admin)
+	}
+	// 代理请求的 panic 在观察者内部恢复，使其以 500 被记录；外层的恢复覆盖管理接口等其他路由
+	// 并发限制位于观察者之内，被拒绝的请求同样被记录
+	mux.Handle("/", requestinfo.Middleware(recovery.Middleware(s.limitConcurrency(http.HandlerFunc(s.handleRequest)), s.logger), s.observers...))
+	s.httpServer.Handler = recovery.Middleware(mux, s.logger)
 
-	return s.httpServer.ListenAndServe()
+	lis, err := s.handover.Listen(s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = lis
+	return s.listenEndpoints(s.httpServer.Handler)
+}
+
+// Addr 返回 Listen 绑定的地址（端口为 0 时为实际分配的端口），尚未监听时返回 nil
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Serve 在 Listen 绑定的端口上处理请求，直到服务器停止；任一监听器失败时返回其错误
+func (s *Server) Serve() error {
+	errs := make(chan error, len(s.endpoints)+1)
+	for _, e := range s.endpoints {
+		s.logger.Info("HTTP listener starting", "name", e.listener.Name, "address", e.listener.Address, "tls", e.listener.TLS != nil)
+		go func(e *endpoint) {
+			errs <- e.serve()
+		}(e)
+	}
+	go func() {
+		errs <- s.httpServer.Serve(s.listener)
+	}()
+	return <-errs
+}
+
+// Start 启动HTTP服务器
+func (s *Server) Start() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
 }
 
 // handleRequest 处理HTTP请求
 func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/health" {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "HTTP Server is healthy")
+	r = s.trustIdentity(r)
+	r = s.startTrace(r)
+	if route, groups := s.matchPathRoute(r); route != nil {
+		s.handlePathRoute(w, r, route, groups)
+		return
+	}
+	if r.Method == http.MethodOptions && s.handlePathOptions(w, r) {
+		return
+	}
+	if route := s.matchHTTPRoute(r); route != nil {
+		s.handleHTTPRoute(w, r, route)
 		return
 	}
+	if strings.HasPrefix(r.URL.Path, twirp.PathPrefix) {
+		s.handleTwirp(w, r)
+		return
+	}
+
+	// 没有路由匹配的其他路径转发到 fallback.service，或返回自定义的 404
+	if !rpcPath(r.URL.Path) && (s.forwardFallback(w, r, nil) || s.writeNotFound(w)) {
+		return
+	}
+
 	if s.httpProxy == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "HTTP proxy not configured")
+		s.writeError(w, nil, http.StatusInternalServerError, "HTTP proxy not configured")
 		return
 	}
 
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprintf(w, "Only POST method is allowed")
+		s.writeMethodNotAllowed(w)
 		return
 	}
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Failed to read request body: %v", err)
+		s.writeError(w, nil, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
 		return
 	}
 	defer r.Body.Close()
@@ -77,33 +246,219 @@ func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
 	// 解析HTTP请求
 	httpReq, err := ParseHTTPRequest(r.URL.Path, body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Invalid request: %v", err)
+		s.writeError(w, nil, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	// 描述符中没有的方法转发到 fallback.service，或返回自定义的 404
+	if s.unknownMethod(httpReq) && (s.forwardFallback(w, r, body) || s.writeNotFound(w)) {
+		return
+	}
+	if err := s.validateRequest(r, httpReq.ServiceName, httpReq.MethodName, body); err != nil {
+		s.writeError(w, httpReq, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+
+	httpReq.Protobuf = isXProtobuf(r.Header.Get("Content-Type"))
+	httpReq.Fields = responseFields(r)
+	accept, ok := negotiate(r, httpReq.Protobuf)
+	if !ok {
+		s.writeNotAcceptable(w, httpReq)
+		return
+	}
+	httpReq.Accept = accept
+
+	if entry := requestinfo.FromContext(r.Context()); entry != nil {
+		entry.Tenant = httpReq.Tenant
+		entry.Service = httpReq.ServiceName
+		entry.Method = httpReq.MethodName
+	}
+
+	// protobuf 请求体可以透传时原样转发，否则先按方法的输入类型转换为 JSON
+	if httpReq.Protobuf {
+		if err := s.prepareProtobuf(r, httpReq); err != nil {
+			s.writeStatusError(w, httpReq, err, "Invalid request")
+			return
+		}
+	}
+	if err := s.fillFieldMasks(r, httpReq); err != nil {
+		s.writeStatusError(w, httpReq, err, "Invalid request")
+		return
+	}
+	if entry := requestinfo.FromContext(r.Context()); entry != nil && !httpReq.Passthrough {
+		entry.RequestBody = httpReq.Body
+	}
+
+	// 路由解析之后依次经过中间件，再转发到上游
+	s.handler.ServeHTTP(w, r.WithContext(middleware.NewContext(r.Context(), httpReq)))
+}
+
+// handleProxy 将路由解析后的请求转发到上游并写回响应
+func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	httpReq := middleware.RequestFromContext(r.Context())
+	ctx := s.withPeer(proxy.WithAttempts(proxy.WithResponseFields(r.Context(), httpReq.Fields)))
+	r = r.WithContext(ctx)
+	collapseKey := s.collapseKey(r, httpReq)
+	cacheKey := s.cacheKey(r, httpReq)
+
+	// 透传的 protobuf 请求不经解码转发
+	if httpReq.Passthrough {
+		response, err := s.callCached(ctx, w, cacheKey, httpReq, func(ctx context.Context) ([]byte, error) {
+			return s.callCollapsed(ctx, collapseKey, httpReq, func(ctx context.Context) ([]byte, error) {
+				return s.httpProxy.ProxyProtobuf(ctx, httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, httpReq.Body)
+			})
+		})
+		proxy.SetUpstreamHeaders(w, ctx)
+		if err != nil {
+			s.logger.Warn("RPC call failed", "service", httpReq.ServiceName, "method", httpReq.MethodName, "error", err)
+			s.writeRPCError(w, httpReq, err)
+			return
+		}
+		writeProtobuf(w, httpReq, response)
+		return
+	}
+	// protobuf 编码、请求体日志、合并与缓存的请求需要完整的 JSON 响应，其他响应边生成边写出
+	if httpReq.Accept == ContentTypeJSON && collapseKey == "" && cacheKey == "" && !s.payloadLog.Enabled(httpReq.ServiceName, httpReq.MethodName) {
+		s.streamProxy(w, r, httpReq)
 		return
 	}
 
 	// 调用HTTP代理
-	response, err := s.httpProxy.ProxyHTTPRequest(r.Context(), httpReq.ServiceName, httpReq.MethodName, body)
+	s.payloadLog.LogRequest(httpReq.ServiceName, httpReq.MethodName, httpReq.Body)
+	response, err := s.callCached(ctx, w, cacheKey, httpReq, func(ctx context.Context) ([]byte, error) {
+		return s.callCollapsed(ctx, collapseKey, httpReq, func(ctx context.Context) ([]byte, error) {
+			return s.httpProxy.ProxyHTTPRequest(ctx, httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, httpReq.Body)
+		})
+	})
+	proxy.SetUpstreamHeaders(w, ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "RPC call failed: %v", err)
+		s.logger.Warn("RPC call failed", "service", httpReq.ServiceName, "method", httpReq.MethodName, "error", err)
+		s.writeRPCError(w, httpReq, err)
 		return
 	}
 
 	// 返回响应
+	s.payloadLog.LogResponse(httpReq.ServiceName, httpReq.MethodName, response)
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.ResponseBody = response
+	}
+	switch httpReq.Accept {
+	case ContentTypeXProtobuf:
+		// 客户端接受 protobuf 编码时，响应按方法的输出类型编码
+		data, err := s.httpProxy.EncodeResponse(httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, response)
+		if err != nil {
+			s.writeRPCError(w, httpReq, err)
+			return
+		}
+		writeProtobuf(w, httpReq, data)
+		return
+	case ContentTypeXML:
+		data, err := s.httpProxy.EncodeXML(httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, response)
+		if err != nil {
+			s.writeRPCError(w, httpReq, err)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeXML)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// streamProxy 转发请求并写出 JSON 响应：不超过 max_buffered_response 的响应完整缓冲后写出，并记入请求信息供观察者使用；
+// 更大的响应边生成边写出，开始写出后上游调用失败时中断连接，使客户端不会把截断的响应当作完整响应
+func (s *Server) streamProxy(w http.ResponseWriter, r *http.Request, httpReq *HTTPRequest) {
+	ctx := r.Context()
+	out := &responseStream{ctx: ctx, w: w, limit: s.maxBufferedResponse}
+	err := s.httpProxy.ProxyHTTPResponse(ctx, httpReq.Tenant, httpReq.ServiceName, httpReq.MethodName, httpReq.Body, out)
+	if !out.sent {
+		proxy.SetUpstreamHeaders(w, ctx)
+	}
+	if err != nil {
+		s.logger.Warn("RPC call failed", "service", httpReq.ServiceName, "method", httpReq.MethodName, "error", err, "response_sent", out.sent)
+		if out.sent {
+			if entry := requestinfo.FromContext(ctx); entry != nil {
+				entry.Error = status.Convert(err).Message()
+			}
+			panic(http.ErrAbortHandler)
+		}
+		s.writeRPCError(w, httpReq, err)
+		return
+	}
+	if out.sent {
+		return
+	}
+
+	response := out.buf.Bytes()
+	if entry := requestinfo.FromContext(ctx); entry != nil {
+		entry.ResponseBody = response
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(response)
 }
 
+// writeRPCError 写出上游调用失败的响应：Twirp 请求按 Twirp 格式，其他请求按 gRPC 状态码映射 HTTP 状态码，例如限流返回 429；
+// 适用 JSON 错误格式时按配置的信封写出
+func (s *Server) writeRPCError(w http.ResponseWriter, httpReq *HTTPRequest, err error) {
+	if httpReq.Twirp {
+		twirp.FromStatus(err).Write(w)
+		return
+	}
+	st := status.Convert(err)
+	if format := s.errorEnvelope(httpReq); format != nil {
+		writeEnvelope(w, format, statusmap.HTTPStatus(st.Code()), st.Code(), upstreamMessage(format, st))
+		return
+	}
+	w.WriteHeader(statusmap.HTTPStatus(st.Code()))
+	fmt.Fprintf(w, "RPC call failed: %v", err)
+}
+
 // StartTLS 启动HTTPS服务器
 func (s *Server) StartTLS(certFile, keyFile string) error {
+	handler, err := s.chain(http.HandlerFunc(s.handleProxy))
+	if err != nil {
+		return err
+	}
+	s.handler = handler
+
 	// 定义库底路由处理器
-	s.httpServer.Handler = http.HandlerFunc(s.handleRequest)
+	s.httpServer.Handler = recovery.Middleware(http.HandlerFunc(s.handleRequest), s.logger)
 	return s.httpServer.ListenAndServeTLS(certFile, keyFile)
 }
 
-// Stop 停止HTTP服务器
+// Stop 优雅停止HTTP服务器：所有监听器停止接受新请求并等待进行中的请求结束；
+// ctx 结束时仍未完成的连接被强制关闭，并返回 ctx 的错误
 func (s *Server) Stop(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	servers := []*http.Server{s.httpServer}
+	for _, e := range s.endpoints {
+		if e.server != nil {
+			servers = append(servers, e.server)
+		}
+	}
+
+	for _, e := range s.endpoints {
+		e.listener.Close()
+	}
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if errs[i] = srv.Shutdown(ctx); errs[i] != nil {
+				srv.Close()
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
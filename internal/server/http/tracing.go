@@ -0,0 +1,24 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+)
+
+// SetTracer 设置追踪上下文的传播与 span 导出（依赖注入）
+func (s *Server) SetTracer(tracer *tracing.Tracer) {
+	s.tracer = tracer
+}
+
+// startTrace 开始网关的 span：延续请求携带的追踪或开始新的追踪并决定是否采样，
+// 以网关 span 的 traceparent 替换请求头（转发到普通 HTTP 服务）与转发到 gRPC 上游的元数据中调用方的值
+func (s *Server) startTrace(r *http.Request) *http.Request {
+	if s.tracer == nil {
+		return r
+	}
+	traceparent := s.tracer.FromHTTP(r.Header, requestinfo.FromContext(r.Context()))
+	return r.WithContext(proxy.SetOutgoingMetadata(r.Context(), map[string]string{tracing.Header: traceparent}))
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// handleTwirp 处理 Twirp 协议请求：与 /rpc 请求一样经过中间件转发到上游，
+// 租户取自租户元数据头。中间件返回的非 JSON 错误响应转换为 Twirp 错误
+func (s *Server) handleTwirp(w http.ResponseWriter, r *http.Request) {
+	if s.httpProxy == nil {
+		(&twirp.Error{Code: "internal", Msg: "HTTP proxy not configured"}).Write(w)
+		return
+	}
+	if r.Method != http.MethodPost {
+		(&twirp.Error{Code: "bad_route", Msg: "Only POST method is allowed"}).Write(w)
+		return
+	}
+	body, err := readBody(r.Body)
+	if err != nil {
+		(&twirp.Error{Code: "malformed", Msg: fmt.Sprintf("Failed to read request body: %v", err)}).Write(w)
+		return
+	}
+	defer r.Body.Close()
+
+	httpReq, err := ParseTwirpRequest(r.URL.Path, r.Header.Get("Content-Type"), body)
+	if err != nil {
+		(&twirp.Error{Code: "bad_route", Msg: fmt.Sprintf("Invalid request: %v", err)}).Write(w)
+		return
+	}
+	if err := s.validateRequest(r, httpReq.ServiceName, httpReq.MethodName, body); err != nil {
+		(&twirp.Error{Code: "invalid_argument", Msg: fmt.Sprintf("Invalid request: %v", err)}).Write(w)
+		return
+	}
+	tenantKey := tenancy.DefaultMetadataKey
+	if s.tenants != nil {
+		tenantKey = s.tenants.MetadataKey()
+	}
+	httpReq.Tenant = r.Header.Get(tenantKey)
+	httpReq.Fields = responseFields(r)
+
+	if entry := requestinfo.FromContext(r.Context()); entry != nil {
+		entry.Tenant = httpReq.Tenant
+		entry.Service = httpReq.ServiceName
+		entry.Method = httpReq.MethodName
+	}
+
+	// protobuf 请求体可以透传时原样转发，否则先按方法的输入类型转换为 JSON
+	if httpReq.Protobuf {
+		if err := s.prepareProtobuf(r, httpReq); err != nil {
+			twirp.FromStatus(err).Write(w)
+			return
+		}
+	}
+	if err := s.fillFieldMasks(r, httpReq); err != nil {
+		twirp.FromStatus(err).Write(w)
+		return
+	}
+	if entry := requestinfo.FromContext(r.Context()); entry != nil && !httpReq.Passthrough {
+		entry.RequestBody = httpReq.Body
+	}
+
+	tw := &twirpWriter{ResponseWriter: w}
+	defer tw.finish()
+	s.handler.ServeHTTP(tw, r.WithContext(middleware.NewContext(r.Context(), httpReq)))
+}
+
+// twirpWriter 将中间件写出的纯文本错误响应（如认证失败、限流）改写为 Twirp 错误
+type twirpWriter struct {
+	http.ResponseWriter
+	status int          // 待改写的错误状态码，0 表示原样写出
+	msg    bytes.Buffer // 错误响应体
+}
+
+// WriteHeader 缓存非 JSON 的错误响应，其他响应原样写出
+func (w *twirpWriter) WriteHeader(code int) {
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if code >= http.StatusBadRequest && mediaType != twirp.ContentTypeJSON {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 实现 http.ResponseWriter
+func (w *twirpWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.msg.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap 返回原始 ResponseWriter，供 http.ResponseController 使用
+func (w *twirpWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish 写出缓存的错误响应
+func (w *twirpWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	w.Header().Del("Content-Length")
+	twirp.FromHTTPStatus(w.status, w.msg.String()).Write(w.ResponseWriter)
+}
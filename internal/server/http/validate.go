@@ -0,0 +1,136 @@
+package http
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/twirp"
+)
+
+var invalidRequests = metrics.NewCounterVec(
+	"gateway_invalid_requests_total",
+	"HTTP requests rejected by validation rules before their bodies were decoded.",
+	"service", "method",
+)
+
+// validationRule 编译后的请求校验规则
+type validationRule struct {
+	match        string
+	headers      map[string]*regexp.Regexp // 为 nil 的表达式只要求请求头存在
+	contentTypes []string
+	maxBodyBytes int
+	maxJSONDepth int
+}
+
+// SetValidation 设置按方法校验请求的规则，可在运行时替换
+func (s *Server) SetValidation(cfgs []config.ValidationRuleConfig) error {
+	rules := make([]validationRule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if _, err := path.Match(cfg.Match, ""); err != nil {
+			return fmt.Errorf("invalid validation[%d].match %q: %w", i, cfg.Match, err)
+		}
+		rule := validationRule{match: cfg.Match, headers: make(map[string]*regexp.Regexp, len(cfg.Headers)), maxBodyBytes: cfg.MaxBodyBytes, maxJSONDepth: cfg.MaxJSONDepth}
+		for name, expr := range cfg.Headers {
+			if expr == "" {
+				rule.headers[name] = nil
+				continue
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("invalid validation[%d].headers[%q]: %w", i, name, err)
+			}
+			rule.headers[name] = re
+		}
+		for _, contentType := range cfg.ContentTypes {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil {
+				return fmt.Errorf("invalid validation[%d].content_types %q: %w", i, contentType, err)
+			}
+			rule.contentTypes = append(rule.contentTypes, mediaType)
+		}
+		rules = append(rules, rule)
+	}
+	s.validation.Store(&rules)
+	return nil
+}
+
+// validateRequest 按匹配方法的全部规则检查请求头、Content-Type 与请求体的大小和 JSON 嵌套深度，
+// 在解码请求体之前执行；不满足时返回错误
+func (s *Server) validateRequest(r *http.Request, service, method string, body []byte) error {
+	rules := s.validation.Load()
+	if rules == nil {
+		return nil
+	}
+	route := service + "/" + method
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if ok, _ := path.Match(rule.match, route); !ok {
+			continue
+		}
+		if err := rule.check(r, body); err != nil {
+			invalidRequests.Inc(service, method)
+			return err
+		}
+	}
+	return nil
+}
+
+// check 检查请求是否满足规则
+func (rule *validationRule) check(r *http.Request, body []byte) error {
+	for name, re := range rule.headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return fmt.Errorf("missing required header %s", name)
+		}
+		if re != nil && !re.MatchString(values[0]) {
+			return fmt.Errorf("header %s does not match %s", name, re)
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if len(rule.contentTypes) > 0 && !slices.Contains(rule.contentTypes, mediaType) {
+		return fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	if rule.maxBodyBytes > 0 && len(body) > rule.maxBodyBytes {
+		return fmt.Errorf("request body of %d bytes exceeds %d bytes", len(body), rule.maxBodyBytes)
+	}
+	binary := mediaType == ContentTypeXProtobuf || mediaType == twirp.ContentTypeProtobuf
+	if rule.maxJSONDepth > 0 && !binary {
+		if depth := jsonDepth(body); depth > rule.maxJSONDepth {
+			return fmt.Errorf("JSON body nested %d levels deep exceeds %d", depth, rule.maxJSONDepth)
+		}
+	}
+	return nil
+}
+
+// jsonDepth 返回 JSON 中对象与数组嵌套的最大深度，不解码请求体
+func jsonDepth(body []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+	for _, c := range body {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			deepest = max(deepest, depth)
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return deepest
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/webhook"
+)
+
+// SetWebhooks 设置路由规则的 webhook 客户端（依赖注入）
+func (s *Server) SetWebhooks(client *webhook.Client) {
+	s.webhooks = client
+}
+
+// serveWithHooks 调用路由规则的 webhook：before 在转发前同步调用，可以拒绝请求、追加元数据或替换请求体；
+// after 在响应写出后异步调用，不影响响应。事件只包含 webhook 配置中列出的请求头
+func (s *Server) serveWithHooks(w http.ResponseWriter, r *http.Request, next http.Handler, httpReq *HTTPRequest, headers map[string]string, hooks []routes.Hook) {
+	ctx := r.Context()
+	event := func(phase string, hook routes.Hook) *webhook.Event {
+		e := &webhook.Event{
+			Phase:      phase,
+			Route:      hook.Route,
+			Tenant:     httpReq.Tenant,
+			Service:    httpReq.ServiceName,
+			Method:     httpReq.MethodName,
+			RemoteAddr: r.RemoteAddr,
+		}
+		e.SetRequest(httpReq.Body)
+		for _, name := range hook.Headers {
+			if value, ok := headers[strings.ToLower(name)]; ok {
+				if e.Headers == nil {
+					e.Headers = make(map[string]string)
+				}
+				e.Headers[strings.ToLower(name)] = value
+			}
+		}
+		return e
+	}
+
+	var after []routes.Hook
+	for _, hook := range hooks {
+		if hook.Phase == webhook.PhaseAfter {
+			after = append(after, hook)
+			continue
+		}
+
+		result, err := s.webhooks.Before(ctx, hook.WebhookConfig, event(webhook.PhaseBefore, hook))
+		if err != nil {
+			s.logger.Warn("Webhook failed", "route", hook.Route, "url", hook.URL, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "Webhook failed: %v", err)
+			return
+		}
+		if !result.Allowed {
+			status := result.Status
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "Rejected by webhook of route %s: %s", hook.Route, result.Reason)
+			return
+		}
+		if result.Body != nil {
+			httpReq.Body = result.Body
+			if entry := requestinfo.FromContext(ctx); entry != nil {
+				entry.RequestBody = result.Body
+			}
+		}
+		for key, value := range result.Headers {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+		}
+	}
+
+	if len(after) == 0 {
+		next.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	start := time.Now()
+	tee := &responseTee{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(tee, r.WithContext(ctx))
+	for _, hook := range after {
+		e := event(webhook.PhaseAfter, hook)
+		e.Status = tee.status
+		e.SetResponse(tee.body.Bytes())
+		e.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		s.webhooks.After(hook.WebhookConfig, e)
+	}
+}
+
+// responseTee 写出响应的同时保留状态码与响应体的副本
+type responseTee struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader 实现 http.ResponseWriter
+func (t *responseTee) WriteHeader(status int) {
+	t.status = status
+	t.ResponseWriter.WriteHeader(status)
+}
+
+// Write 实现 http.ResponseWriter
+func (t *responseTee) Write(p []byte) (int, error) {
+	t.body.Write(p)
+	return t.ResponseWriter.Write(p)
+}
+
+// Flush 实现 http.Flusher
+func (t *responseTee) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 返回底层的 ResponseWriter，供 http.ResponseController 使用
+func (t *responseTee) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
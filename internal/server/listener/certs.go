@@ -0,0 +1,208 @@
+package listener
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// reloadDelay 证书文件最后一次变化后重新加载前的等待时间，证书与私钥先后写入时只加载一次
+const reloadDelay = 500 * time.Millisecond
+
+// certSet 一次加载的监听器证书
+type certSet struct {
+	fallback *tls.Certificate            // cert_file，未配置时为空
+	sni      []*tls.Certificate          // 与 Listener.sni 一一对应，条目未配置证书时为空
+	names    map[string]*tls.Certificate // cert_dir 中证书的小写域名，含通配符域名
+}
+
+// loadCerts 加载 TLS 配置中的全部证书，至少需要一个证书
+func loadCerts(cfg *config.ListenerTLSConfig) (*certSet, error) {
+	set := &certSet{names: make(map[string]*tls.Certificate)}
+	count := 0
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		set.fallback = &cert
+		count++
+	}
+	for i, sc := range cfg.SNI {
+		var cert *tls.Certificate
+		if sc.CertFile != "" {
+			c, err := tls.LoadX509KeyPair(sc.CertFile, sc.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("tls.sni[%d]: failed to load certificate: %w", i, err)
+			}
+			cert = &c
+			count++
+		}
+		set.sni = append(set.sni, cert)
+	}
+	if cfg.CertDir != "" {
+		n, err := set.loadDir(cfg.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		count += n
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no certificate configured, set cert_file, cert_dir or sni[].cert_file")
+	}
+	return set, nil
+}
+
+// loadDir 加载目录中的每对 <name>.crt 与 <name>.key，按证书中的域名索引，返回加载的证书数
+func (set *certSet) loadDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cert_dir: %w", err)
+	}
+	count := 0
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".crt")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		certFile := filepath.Join(dir, entry.Name())
+		cert, err := tls.LoadX509KeyPair(certFile, filepath.Join(dir, name+".key"))
+		if err != nil {
+			return 0, fmt.Errorf("failed to load certificate %s: %w", certFile, err)
+		}
+		hosts := cert.Leaf.DNSNames
+		if len(hosts) == 0 && cert.Leaf.Subject.CommonName != "" {
+			hosts = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, host := range hosts {
+			set.names[normalizeHost(host)] = &cert
+		}
+		count++
+	}
+	return count, nil
+}
+
+// byName 返回 cert_dir 中包含服务器名称的证书，精确的域名优先于通配符域名
+func (set *certSet) byName(name string) *tls.Certificate {
+	if cert, ok := set.names[name]; ok {
+		return cert
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		return set.names["*."+parent]
+	}
+	return nil
+}
+
+// getCertificate 按客户端的 SNI 选择证书：匹配的 SNI 条目的证书、cert_dir 中包含该名称的证书、默认证书
+func (l *Listener) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := l.certs.Load()
+	name := normalizeHost(hello.ServerName)
+	if i := l.matchSNI(name); i >= 0 && set.sni[i] != nil {
+		return set.sni[i], nil
+	}
+	if cert := set.byName(name); cert != nil {
+		return cert, nil
+	}
+	if set.fallback != nil {
+		return set.fallback, nil
+	}
+	return nil, fmt.Errorf("no certificate for server name %q", hello.ServerName)
+}
+
+// WatchCerts 监听证书文件所在的目录，文件变化后重新加载全部证书，加载失败时继续使用之前的证书；
+// 监听器没有 TLS 时不做任何事。Close 停止监听
+func (l *Listener) WatchCerts(logger *slog.Logger) error {
+	if l.tlsConfig == nil {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create certificate watcher: %w", err)
+	}
+	for dir := range certDirs(l.tlsConfig) {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	l.watcher = watcher
+
+	go func() {
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Remove) == 0 {
+					continue
+				}
+				if timer == nil {
+					timer = time.AfterFunc(reloadDelay, func() {
+						l.reloadCerts(logger)
+					})
+				} else {
+					timer.Reset(reloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Certificate watcher error", "listener", l.Name, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadCerts 重新加载证书，之后的 TLS 握手使用新证书
+func (l *Listener) reloadCerts(logger *slog.Logger) {
+	set, err := loadCerts(l.tlsConfig)
+	if err != nil {
+		logger.Error("Failed to reload TLS certificates, keeping the previous ones", "listener", l.Name, "error", err)
+		return
+	}
+	l.certs.Store(set)
+	logger.Info("TLS certificates reloaded", "listener", l.Name)
+}
+
+// Close 停止监听证书文件
+func (l *Listener) Close() error {
+	if l.watcher == nil {
+		return nil
+	}
+	return l.watcher.Close()
+}
+
+// certDirs 返回需要监听的目录：cert_dir 与各证书、私钥文件所在的目录。
+// 监听目录而不是文件，使原子替换（写入临时文件后重命名）与 Kubernetes Secret 的更新同样可以发现
+func certDirs(cfg *config.ListenerTLSConfig) map[string]bool {
+	dirs := make(map[string]bool)
+	if cfg.CertDir != "" {
+		dirs[filepath.Clean(cfg.CertDir)] = true
+	}
+	files := []string{cfg.CertFile, cfg.KeyFile}
+	for _, sc := range cfg.SNI {
+		files = append(files, sc.CertFile, sc.KeyFile)
+	}
+	for _, file := range files {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	return dirs
+}
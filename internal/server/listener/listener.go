@@ -0,0 +1,152 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// 监听器协议
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// Listener 额外的监听器：绑定地址、TLS 与开放的路由
+type Listener struct {
+	Name    string
+	Address string
+	TLS     *tls.Config // 为空时不使用 TLS
+	// Internal 内网监听器，开放标记为内部的方法
+	Internal bool
+
+	routes []string // 开放的 package.Service/Method 通配符，为空时开放全部路由
+	paths  []string // 开放的路径前缀，为空时开放全部路径
+
+	tlsConfig *config.ListenerTLSConfig
+	sni       []*SNI                  // 按顺序匹配的 SNI 条目
+	certs     atomic.Pointer[certSet] // 当前的证书，文件变化后替换
+	watcher   *fsnotify.Watcher       // WatchCerts 之后监听证书文件
+}
+
+// FromConfig 创建配置中指定协议的监听器，加载证书并校验路由通配符
+func FromConfig(cfgs []config.ListenerConfig, protocol string) ([]*Listener, error) {
+	var listeners []*Listener
+	for i, cfg := range cfgs {
+		if cfg.Protocol != ProtocolHTTP && cfg.Protocol != ProtocolGRPC {
+			return nil, fmt.Errorf("listener %d: unknown protocol %q, expected %s or %s", i, cfg.Protocol, ProtocolHTTP, ProtocolGRPC)
+		}
+		if cfg.Protocol != protocol {
+			continue
+		}
+		l, err := New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("listener %d: %w", i, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// New 按配置创建监听器
+func New(cfg config.ListenerConfig) (*Listener, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	if len(cfg.Paths) > 0 && cfg.Protocol != ProtocolHTTP {
+		return nil, fmt.Errorf("paths only apply to %s listeners", ProtocolHTTP)
+	}
+	for _, pattern := range cfg.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", pattern, err)
+		}
+	}
+
+	l := &Listener{
+		Name:     cfg.Name,
+		Address:  cfg.Address,
+		Internal: cfg.Internal,
+		routes:   cfg.Routes,
+		paths:    cfg.Paths,
+	}
+	if l.Name == "" {
+		l.Name = cfg.Address
+	}
+	if cfg.TLS != nil {
+		if err := l.loadTLS(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// AllowsRoute 判断监听器是否开放 package.Service/Method 路由
+func (l *Listener) AllowsRoute(service, method string) bool {
+	if len(l.routes) == 0 {
+		return true
+	}
+	route := service + "/" + method
+	for _, pattern := range l.routes {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath 判断 HTTP 监听器是否开放路径
+func (l *Listener) AllowsPath(p string) bool {
+	if len(l.paths) == 0 {
+		return true
+	}
+	for _, prefix := range l.paths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTLS 加载服务端证书与 SNI 条目，证书按客户端的 SNI 选择；配置了客户端 CA 时要求并校验客户端证书
+func (l *Listener) loadTLS(cfg *config.ListenerTLSConfig) error {
+	for i, sc := range cfg.SNI {
+		sni, err := newSNI(sc)
+		if err != nil {
+			return fmt.Errorf("tls.sni[%d]: %w", i, err)
+		}
+		l.sni = append(l.sni, sni)
+	}
+	l.tlsConfig = cfg
+	set, err := loadCerts(cfg)
+	if err != nil {
+		return err
+	}
+	l.certs.Store(set)
+
+	tlsConfig := &tls.Config{
+		GetCertificate: l.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	l.TLS = tlsConfig
+	return nil
+}
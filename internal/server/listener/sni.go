@@ -0,0 +1,93 @@
+package listener
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+)
+
+// SNI 一组 TLS 服务器名称映射的租户、后端命名空间与开放的路由
+type SNI struct {
+	Tenant    string // 经这些名称到达的请求所属的租户，为空时不限定
+	Namespace string // 请求只转发到该命名空间内的实例，为空时不限定
+
+	hosts  []string // 小写的服务器名称，可以为 *.example.com
+	routes []string // 开放的 package.Service/Method 通配符，为空时不限制
+}
+
+// newSNI 按配置创建 SNI 条目，校验服务器名称与路由通配符
+func newSNI(cfg config.SNIConfig) (*SNI, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("hosts is required")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+	sni := &SNI{Tenant: cfg.Tenant, Namespace: cfg.Namespace, routes: cfg.Routes}
+	for _, host := range cfg.Hosts {
+		host = normalizeHost(host)
+		if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return nil, fmt.Errorf("invalid host %q, expected a server name or *.domain", host)
+		}
+		sni.hosts = append(sni.hosts, host)
+	}
+	for _, pattern := range cfg.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", pattern, err)
+		}
+	}
+	return sni, nil
+}
+
+// MatchSNI 返回服务器名称匹配的第一个 SNI 条目，没有匹配时返回 nil
+func (l *Listener) MatchSNI(serverName string) *SNI {
+	if i := l.matchSNI(normalizeHost(serverName)); i >= 0 {
+		return l.sni[i]
+	}
+	return nil
+}
+
+// matchSNI 返回小写的服务器名称匹配的第一个 SNI 条目的序号，没有匹配时返回 -1
+func (l *Listener) matchSNI(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, sni := range l.sni {
+		for _, host := range sni.hosts {
+			if matchHost(host, name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// AllowsRoute 判断经这些服务器名称是否开放 package.Service/Method 路由；sni 为空时开放全部路由
+func (sni *SNI) AllowsRoute(service, method string) bool {
+	if sni == nil || len(sni.routes) == 0 {
+		return true
+	}
+	route := service + "/" + method
+	for _, pattern := range sni.routes {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost 判断服务器名称是否匹配 host；*.example.com 匹配一级子域名，不匹配 example.com 本身
+func matchHost(host, name string) bool {
+	if suffix, ok := strings.CutPrefix(host, "*"); ok {
+		label, found := strings.CutSuffix(name, suffix)
+		return found && label != "" && !strings.Contains(label, ".")
+	}
+	return host == name
+}
+
+// normalizeHost 返回小写、去掉末尾点号的服务器名称
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+}
@@ -0,0 +1,23 @@
+package tap
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet traffic tap provider set
+var ProviderSet = wire.NewSet(
+	ProvideHub,
+)
+
+// ProvideHub provides the traffic tap hub, or nil when the tap is disabled.
+// The tap is served by the admin API, so it also requires the admin API.
+func ProvideHub(cfg *config.Config, log *slog.Logger) *Hub {
+	if !cfg.Tap.Enabled || !cfg.Admin.Enabled {
+		return nil
+	}
+	return New(cfg.Tap, logger.Component(log, "tap"))
+}
@@ -0,0 +1,197 @@
+package tap
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/payloadlog"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const (
+	defaultMaxSubscribers = 4
+	defaultBufferSize     = 256
+)
+
+// ErrTooManySubscribers is returned when the subscriber limit is reached
+var ErrTooManySubscribers = errors.New("too many tap subscribers")
+
+// Event is a single tapped request sent to subscribers
+type Event struct {
+	Time       time.Time `json:"time"`
+	Protocol   string    `json:"protocol"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Service    string    `json:"service"`
+	Method     string    `json:"method"`
+	Upstream   string    `json:"upstream,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	GRPCCode   string    `json:"grpc_code,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	Request    string    `json:"request,omitempty"`
+	Response   string    `json:"response,omitempty"`
+}
+
+// Filter selects which requests a subscriber receives
+type Filter struct {
+	Match      string  // Glob on "package.Service/Method" (empty matches all)
+	SampleRate float64 // Fraction of matching requests to deliver (0 means all)
+	Bodies     bool    // Include redacted request and response bodies
+}
+
+// Subscription is a live tap session
+type Subscription struct {
+	filter  Filter
+	events  chan *Event
+	dropped atomic.Uint64
+}
+
+// Events returns the channel of tapped requests
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the subscriber was too slow
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Hub fans out completed requests to tap subscribers
+type Hub struct {
+	mu             sync.RWMutex
+	subs           map[*Subscription]struct{}
+	active         atomic.Int32
+	maxSubscribers int
+	bufferSize     int
+	redactor       *payloadlog.Redactor
+	logger         *slog.Logger
+}
+
+// New creates a tap hub
+func New(cfg config.TapConfig, logger *slog.Logger) *Hub {
+	maxSubscribers := cfg.MaxSubscribers
+	if maxSubscribers <= 0 {
+		maxSubscribers = defaultMaxSubscribers
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	return &Hub{
+		subs:           make(map[*Subscription]struct{}),
+		maxSubscribers: maxSubscribers,
+		bufferSize:     bufferSize,
+		redactor:       payloadlog.NewRedactor(cfg.Redact, cfg.MaxBodyBytes),
+		logger:         logger,
+	}
+}
+
+// Subscribe starts a tap session
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	if filter.Match != "" {
+		if _, err := path.Match(filter.Match, ""); err != nil {
+			return nil, fmt.Errorf("invalid tap pattern %q: %w", filter.Match, err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	sub := &Subscription{filter: filter, events: make(chan *Event, h.bufferSize)}
+	h.subs[sub] = struct{}{}
+	h.active.Add(1)
+	h.logger.Info("Tap session started", "match", filter.Match, "sample_rate", filter.SampleRate, "bodies", filter.Bodies)
+	return sub, nil
+}
+
+// Unsubscribe ends a tap session
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	h.active.Add(-1)
+	close(sub.events)
+	h.logger.Info("Tap session ended", "match", sub.filter.Match, "dropped", sub.Dropped())
+}
+
+// Observe implements requestinfo.Observer
+func (h *Hub) Observe(info *requestinfo.Info) {
+	if h == nil || h.active.Load() == 0 {
+		return
+	}
+
+	route := info.Service + "/" + info.Method
+	var plain, withBodies *Event
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs {
+		if !sub.filter.selects(route) {
+			continue
+		}
+		var event *Event
+		if sub.filter.Bodies {
+			if withBodies == nil {
+				withBodies = h.event(info, true)
+			}
+			event = withBodies
+		} else {
+			if plain == nil {
+				plain = h.event(info, false)
+			}
+			event = plain
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// event builds a tap event, redacting bodies when requested
+func (h *Hub) event(info *requestinfo.Info, bodies bool) *Event {
+	e := &Event{
+		Time:       info.Time,
+		Protocol:   info.Protocol,
+		Tenant:     info.Tenant,
+		Service:    info.Service,
+		Method:     info.Method,
+		Upstream:   info.Upstream,
+		Status:     info.Status,
+		GRPCCode:   info.GRPCCode,
+		DurationMs: float64(info.Duration.Microseconds()) / 1000,
+		Error:      info.Error,
+	}
+	if bodies {
+		if len(info.RequestBody) > 0 {
+			e.Request = h.redactor.Redact(info.RequestBody)
+		}
+		if len(info.ResponseBody) > 0 {
+			e.Response = h.redactor.Redact(info.ResponseBody)
+		}
+	}
+	return e
+}
+
+// selects reports whether a request on route should be delivered
+func (f Filter) selects(route string) bool {
+	if f.Match != "" {
+		if ok, _ := path.Match(f.Match, route); !ok {
+			return false
+		}
+	}
+	return f.SampleRate <= 0 || f.SampleRate >= 1 || rand.Float64() < f.SampleRate
+}
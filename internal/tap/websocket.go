@@ -0,0 +1,91 @@
+package tap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Handler streams tapped requests as JSON messages over WebSocket.
+//
+// Query parameters:
+//   - match:  glob on "package.Service/Method"
+//   - sample: fraction of matching requests to deliver
+//   - bodies: include redacted request and response bodies
+func (h *Hub) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Access is guarded by the admin token, so the browser origin check is skipped
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			// The session outlives the server's read and write timeouts
+			ws.SetDeadline(time.Time{})
+			sub, err := h.Subscribe(filter)
+			if err != nil {
+				websocket.JSON.Send(ws, map[string]string{"error": err.Error()})
+				return
+			}
+			defer h.Unsubscribe(sub)
+			h.stream(ws, sub)
+		}}.ServeHTTP(w, r)
+	}
+}
+
+// stream forwards events until the client disconnects
+func (h *Hub) stream(ws *websocket.Conn, sub *Subscription) {
+	closed := make(chan struct{})
+	go func() {
+		// Drain client frames to detect disconnects
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event := <-sub.Events():
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				h.logger.Debug("Tap session write failed", "error", err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// parseFilter reads the subscription filter from the query string
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	filter := Filter{Match: q.Get("match")}
+	if filter.Match != "" {
+		if _, err := path.Match(filter.Match, ""); err != nil {
+			return filter, fmt.Errorf("invalid match pattern: %w", err)
+		}
+	}
+	if v := q.Get("sample"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return filter, errors.New("sample must be a number between 0 and 1")
+		}
+		filter.SampleRate = rate
+	}
+	if v := q.Get("bodies"); v != "" {
+		bodies, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("bodies must be a boolean")
+		}
+		filter.Bodies = bodies
+	}
+	return filter, nil
+}
@@ -0,0 +1,36 @@
+package tenancy
+
+import (
+	"log/slog"
+	"reflect"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet tenancy provider set
+var ProviderSet = wire.NewSet(
+	ProvideManager,
+)
+
+// ProvideManager provides the tenant manager, or nil when the tenants section
+// is empty. The manager is updated when the tenants section is reloaded;
+// tenant descriptors are loaded at startup, so changing them still requires
+// a restart.
+func ProvideManager(cfg *config.Config, log *slog.Logger, watcher *reload.Watcher) *Manager {
+	if !cfg.Tenants.Enabled() {
+		return nil
+	}
+	log = logger.Component(log, "tenancy")
+	m := New(cfg.Tenants)
+	watcher.OnChange("tenants", func(prev, next *config.Config) error {
+		if !reflect.DeepEqual(prev.TenantProtos(), next.TenantProtos()) {
+			log.Warn("Tenant descriptors changed, restart the gateway to load them")
+		}
+		m.Update(next.Tenants)
+		return nil
+	})
+	return m
+}
@@ -0,0 +1,255 @@
+package tenancy
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/ratelimit"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/pkg/claims"
+)
+
+// DefaultMetadataKey carries the tenant when tenants.metadata_key is not set
+const DefaultMetadataKey = "x-tenant-id"
+
+// APIKeyHeader carries a tenant API key on both listeners
+const APIKeyHeader = "x-api-key"
+
+// Metric label values for requests without a tenant and for tenants that are
+// not configured, which keeps the label cardinality bounded
+const (
+	labelNone    = "none"
+	labelUnknown = "unknown"
+)
+
+var (
+	tenantRequests = metrics.NewCounterVec(
+		"gateway_tenant_requests_total",
+		"Proxied requests by tenant, listener protocol and result code",
+		"tenant", "protocol", "code",
+	)
+	tenantDuration = metrics.NewHistogramVec(
+		"gateway_tenant_request_duration_seconds",
+		"Duration of proxied requests in seconds by tenant",
+		metrics.DefaultBuckets,
+		"tenant", "protocol",
+	)
+	tenantRejected = metrics.NewCounterVec(
+		"gateway_tenant_rejected_total",
+		"Requests rejected by tenant admission, by tenant and reason",
+		"tenant", "reason",
+	)
+)
+
+// tenant is the runtime state of a configured tenant
+type tenant struct {
+	rateLimit config.RateLimitConfig
+	apiKeys   []string
+	limiter   *ratelimit.Limiter
+	namespace string
+	metadata  map[string]string
+}
+
+// settings holds the tenant configuration, replaced atomically on config reload
+type settings struct {
+	metadataKey string
+	claim       string
+	strict      bool
+	tenants     map[string]*tenant
+}
+
+// Manager admits requests per tenant and carries the tenant upstream
+type Manager struct {
+	settings atomic.Pointer[settings]
+}
+
+// New creates a tenant manager
+func New(cfg config.TenantsConfig) *Manager {
+	m := &Manager{}
+	m.Update(cfg)
+	return m
+}
+
+// Update replaces the tenant settings. Rate limiters of tenants whose limit
+// did not change keep their state.
+func (m *Manager) Update(cfg config.TenantsConfig) {
+	key := strings.ToLower(cfg.MetadataKey)
+	if key == "" {
+		key = DefaultMetadataKey
+	}
+
+	var previous map[string]*tenant
+	if old := m.settings.Load(); old != nil {
+		previous = old.tenants
+	}
+	tenants := make(map[string]*tenant, len(cfg.Tenants))
+	for name, t := range cfg.Tenants {
+		limiter := ratelimit.New(t.RateLimit.RequestsPerSecond, t.RateLimit.Burst)
+		if old, ok := previous[name]; ok && old.rateLimit == t.RateLimit {
+			limiter = old.limiter
+		}
+		tenants[name] = &tenant{
+			rateLimit: t.RateLimit,
+			apiKeys:   t.APIKeys,
+			limiter:   limiter,
+			namespace: t.Namespace,
+			metadata:  t.Metadata,
+		}
+	}
+	m.settings.Store(&settings{metadataKey: key, claim: cfg.Claim, strict: cfg.Strict, tenants: tenants})
+}
+
+// MetadataKey returns the metadata key carrying the tenant
+func (m *Manager) MetadataKey() string {
+	return m.settings.Load().metadataKey
+}
+
+// Claim returns the claim holding the tenant of authenticated requests, or
+// an empty string when tenants are not derived from claims
+func (m *Manager) Claim() string {
+	return m.settings.Load().claim
+}
+
+// FromIncoming returns the tenant of a gRPC call from its metadata
+func (m *Manager) FromIncoming(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(m.MetadataKey()); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// boundTenantKey is the context key of the tenant bound to a connection
+type boundTenantKey struct{}
+
+// WithBoundTenant binds requests to a tenant, such as the tenant mapped to
+// the TLS server name of their connection. An empty tenant binds nothing.
+func WithBoundTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, boundTenantKey{}, tenant)
+}
+
+// Resolve returns the tenant of a request given the requested tenant. A
+// tenant bound with WithBoundTenant is used when none is requested, and a
+// different requested tenant is rejected with PermissionDenied. When a claim
+// is configured and the authenticated claims carry it, the claim is the
+// tenant and a different tenant is rejected in the same way.
+func (m *Manager) Resolve(ctx context.Context, requested string) (string, error) {
+	if bound, _ := ctx.Value(boundTenantKey{}).(string); bound != "" {
+		if requested != "" && requested != bound {
+			tenantRejected.Inc(m.label(bound), "server_name_mismatch")
+			return "", status.Errorf(codes.PermissionDenied, "tenant %s does not match the tenant of the server name", requested)
+		}
+		requested = bound
+	}
+	name := m.settings.Load().claim
+	if name == "" {
+		return requested, nil
+	}
+	claimed, _ := claims.FromContext(ctx)[name].(string)
+	if claimed == "" {
+		return requested, nil
+	}
+	if requested != "" && requested != claimed {
+		tenantRejected.Inc(m.label(claimed), "claim_mismatch")
+		return "", status.Errorf(codes.PermissionDenied, "tenant %s does not match the authenticated tenant", requested)
+	}
+	return claimed, nil
+}
+
+// Admit checks that the tenant may send a request: it must be configured in
+// strict mode, present one of its API keys if it has any, and be within its
+// rate limit. The error carries the gRPC status code to return.
+func (m *Manager) Admit(name, apiKey string) error {
+	cfg := m.settings.Load()
+	t, ok := cfg.tenants[name]
+	if !ok {
+		if cfg.strict {
+			tenantRejected.Inc(m.label(name), "unknown_tenant")
+			if name == "" {
+				return status.Error(codes.InvalidArgument, "tenant is required")
+			}
+			return status.Errorf(codes.NotFound, "unknown tenant: %s", name)
+		}
+		return nil
+	}
+
+	if len(t.apiKeys) > 0 && !validKey(t.apiKeys, apiKey) {
+		tenantRejected.Inc(name, "api_key")
+		return status.Errorf(codes.Unauthenticated, "invalid API key for tenant %s", name)
+	}
+	if !t.limiter.Allow() {
+		tenantRejected.Inc(name, "rate_limit")
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for tenant %s", name)
+	}
+	return nil
+}
+
+// validKey compares the presented key with every configured key in constant time
+func validKey(keys []string, presented string) bool {
+	valid := 0
+	for _, key := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(presented))
+	}
+	return presented != "" && valid == 1
+}
+
+// Namespace returns the backend namespace of the tenant, or "" when unrestricted
+func (m *Manager) Namespace(name string) string {
+	if t, ok := m.settings.Load().tenants[name]; ok {
+		return t.namespace
+	}
+	return ""
+}
+
+// Metadata returns the metadata sent upstream with the tenant's requests: the
+// tenant under the metadata key and the tenant's additional metadata
+func (m *Manager) Metadata(name string) []string {
+	cfg := m.settings.Load()
+	var kv []string
+	if name != "" {
+		kv = append(kv, cfg.metadataKey, name)
+	}
+	if t, ok := cfg.tenants[name]; ok {
+		for key, value := range t.metadata {
+			kv = append(kv, strings.ToLower(key), value)
+		}
+	}
+	return kv
+}
+
+// label returns the metrics label of a tenant
+func (m *Manager) label(name string) string {
+	if name == "" {
+		return labelNone
+	}
+	if _, ok := m.settings.Load().tenants[name]; !ok {
+		return labelUnknown
+	}
+	return name
+}
+
+// Observe implements requestinfo.Observer, recording per-tenant request metrics
+func (m *Manager) Observe(info *requestinfo.Info) {
+	if info.Service == "" {
+		return
+	}
+	code := info.GRPCCode
+	if code == "" {
+		code = fmt.Sprint(info.Status)
+	}
+	label := m.label(info.Tenant)
+	tenantRequests.Inc(label, info.Protocol, code)
+	tenantDuration.Observe(info.Duration.Seconds(), label, info.Protocol)
+}
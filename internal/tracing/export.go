@@ -0,0 +1,272 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+	"github.com/heytom-labs/heytom-gateway/internal/version"
+)
+
+const (
+	defaultServiceName   = "heytom-gateway"
+	defaultTimeout       = 5 * time.Second
+	defaultBatchSize     = 512
+	defaultBufferSize    = 2048
+	defaultFlushInterval = 5 * time.Second
+
+	// OTLP span kind and status codes
+	spanKindServer  = 2
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+var exports = metrics.NewCounterVec(
+	"gateway_trace_spans_total",
+	"Spans by export result: sent, dropped (queue full) or failed",
+	"result",
+)
+
+// span is an OTLP/JSON span
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes"`
+	Status            spanStatus  `json:"status"`
+}
+
+// spanStatus is the OTLP status of a span
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// attribute is an OTLP key/value pair
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+// attributeValue is an OTLP string or integer value
+type attributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// stringAttribute returns a string attribute
+func stringAttribute(key, value string) attribute {
+	return attribute{Key: key, Value: attributeValue{StringValue: &value}}
+}
+
+// intAttribute returns an integer attribute, encoded as a string as OTLP/JSON does for 64-bit integers
+func intAttribute(key string, value int64) attribute {
+	s := strconv.FormatInt(value, 10)
+	return attribute{Key: key, Value: attributeValue{IntValue: &s}}
+}
+
+// newSpan returns the server span of a completed request
+func newSpan(info *requestinfo.Info, reason string) *span {
+	name := info.HTTPMethod
+	if info.Service != "" {
+		name = info.Service + "/" + info.Method
+	}
+	s := &span{
+		TraceID:           info.TraceID,
+		SpanID:            info.SpanID,
+		ParentSpanID:      info.ParentSpanID,
+		Name:              name,
+		Kind:              spanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(info.Time.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(info.Time.Add(info.Duration).UnixNano(), 10),
+		Status:            spanStatus{Code: statusCodeOK},
+	}
+	attrs := []attribute{
+		stringAttribute("gateway.protocol", info.Protocol),
+		stringAttribute("gateway.sampling.reason", reason),
+		intAttribute("http.response.status_code", int64(info.Status)),
+		intAttribute("gateway.attempts", int64(info.Attempts)),
+	}
+	if info.Service != "" {
+		attrs = append(attrs, stringAttribute("rpc.service", info.Service), stringAttribute("rpc.method", info.Method))
+	}
+	if info.HTTPMethod != "" {
+		attrs = append(attrs, stringAttribute("http.request.method", info.HTTPMethod), stringAttribute("url.path", info.Path))
+	}
+	if info.GRPCCode != "" {
+		attrs = append(attrs, stringAttribute("rpc.grpc.status_code", info.GRPCCode))
+	}
+	if info.Tenant != "" {
+		attrs = append(attrs, stringAttribute("gateway.tenant", info.Tenant))
+	}
+	if info.Upstream != "" {
+		attrs = append(attrs, stringAttribute("server.address", info.Upstream))
+	}
+	if info.RemoteAddr != "" {
+		attrs = append(attrs, stringAttribute("client.address", info.RemoteAddr))
+	}
+	s.Attributes = attrs
+	if failed(info) {
+		s.Status = spanStatus{Code: statusCodeError, Message: info.Error}
+	}
+	return s
+}
+
+// exporter sends spans in batches to an OTLP/HTTP traces endpoint. Spans are
+// sent in the background and dropped when the queue is full, so exporting
+// never blocks a request.
+type exporter struct {
+	endpoint      string
+	headers       map[string]string
+	resource      []attribute
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	mu     sync.RWMutex // Guards sending on spans against close
+	closed bool
+	spans  chan *span
+	done   chan struct{}
+}
+
+// newExporter starts the exporter of cfg
+func newExporter(cfg config.TracingConfig) *exporter {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	e := &exporter{
+		endpoint:      cfg.Endpoint,
+		headers:       cfg.Headers,
+		resource:      []attribute{stringAttribute("service.name", serviceName), stringAttribute("service.version", version.Version)},
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		done:          make(chan struct{}),
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultBatchSize
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = defaultFlushInterval
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	e.client = &http.Client{Timeout: timeout}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	e.spans = make(chan *span, bufferSize)
+	go e.run()
+	return e
+}
+
+// add queues a span, dropping it when the queue is full
+func (e *exporter) add(s *span) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.spans <- s:
+	default:
+		exports.Inc("dropped")
+	}
+}
+
+// run sends full batches, and partial ones every flush interval, until the exporter is closed
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	batch := make([]*span, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			exports.Add(float64(len(batch)), "failed")
+			slog.Default().Warn("Failed to export spans", "spans", len(batch), "error", err)
+		} else {
+			exports.Add(float64(len(batch)), "sent")
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send posts a batch of spans as an OTLP/JSON export request
+func (e *exporter) send(spans []*span) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": e.resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": defaultServiceName, "version": version.Version},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("trace collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// close sends the queued spans
+func (e *exporter) close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.spans)
+	e.mu.Unlock()
+	<-e.done
+}
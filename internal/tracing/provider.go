@@ -0,0 +1,25 @@
+package tracing
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet tracing provider set
+var ProviderSet = wire.NewSet(
+	ProvideTracer,
+)
+
+// ProvideTracer provides the tracer, or nil when tracing is disabled; the
+// sampling configuration is updated when tracing.sampling is reloaded
+func ProvideTracer(cfg *config.Config, watcher *reload.Watcher) (*Tracer, error) {
+	t, err := New(cfg.Tracing)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	watcher.OnChange("tracing.sampling", func(_, next *config.Config) error {
+		return t.Update(next.Tracing.Sampling)
+	})
+	return t, nil
+}
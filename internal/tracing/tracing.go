@@ -0,0 +1,225 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+	"github.com/heytom-labs/heytom-gateway/internal/ratelimit"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+// Header is the W3C trace context header, lower-case as in gRPC metadata
+const Header = "traceparent"
+
+// Reasons for exporting the span of a request
+const (
+	reasonSampled = "sampled"
+	reasonError   = "error"
+	reasonSlow    = "slow"
+)
+
+var decisions = metrics.NewCounterVec(
+	"gateway_trace_requests_total",
+	"Traced requests by sampling result: sampled, error or slow (exported although not sampled), or dropped (not exported)",
+	"result",
+)
+
+// settings holds the sampling configuration, replaced atomically on config reload
+type settings struct {
+	bound       uint64 // Sampled when the random part of the trace ID is below it
+	limiter     *ratelimit.Limiter
+	parentBased bool
+	errors      bool
+	slow        time.Duration
+}
+
+// Tracer propagates the W3C trace context of proxied requests and exports a
+// span for each request that is sampled, failed or slow
+type Tracer struct {
+	settings atomic.Pointer[settings]
+	exporter *exporter
+}
+
+// New validates cfg and starts the exporter; it returns nil when tracing is disabled
+func New(cfg config.TracingConfig) (*Tracer, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("tracing.endpoint is required")
+	}
+	t := &Tracer{}
+	if err := t.Update(cfg.Sampling); err != nil {
+		return nil, err
+	}
+	t.exporter = newExporter(cfg)
+	return t, nil
+}
+
+// Update replaces the sampling configuration
+func (t *Tracer) Update(cfg config.TraceSamplingConfig) error {
+	ratio := 1.0
+	if cfg.Ratio != nil {
+		ratio = *cfg.Ratio
+	}
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("tracing.sampling.ratio must be in [0, 1]")
+	}
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("tracing.sampling.rate_limit must not be negative")
+	}
+	bound := uint64(ratio * (1 << 63))
+	if ratio == 1 {
+		bound = 1 << 63
+	}
+	t.settings.Store(&settings{
+		bound:       bound,
+		limiter:     ratelimit.New(cfg.RateLimit, 0),
+		parentBased: cfg.ParentBased,
+		errors:      cfg.Errors,
+		slow:        cfg.SlowThreshold,
+	})
+	return nil
+}
+
+// FromHTTP starts the gateway's span of an HTTP request, recording it in info,
+// and replaces the traceparent header with the gateway's, as sent to plain
+// HTTP backends. It returns the traceparent to send to gRPC backends.
+func (t *Tracer) FromHTTP(header http.Header, info *requestinfo.Info) string {
+	traceparent := t.start(header.Get(Header), info)
+	header.Set(Header, traceparent)
+	return traceparent
+}
+
+// FromMetadata is FromHTTP for the metadata of a gRPC call, which it modifies
+func (t *Tracer) FromMetadata(md metadata.MD, info *requestinfo.Info) {
+	var incoming string
+	if values := md.Get(Header); len(values) > 0 {
+		incoming = values[0]
+	}
+	md.Set(Header, t.start(incoming, info))
+}
+
+// start continues the trace of a valid incoming traceparent or starts a new
+// one, decides whether it is sampled and returns the traceparent of the
+// gateway's span
+func (t *Tracer) start(incoming string, info *requestinfo.Info) string {
+	var traceID [16]byte
+	var spanID [8]byte
+	parentID, parentSampled, ok := parseTraceparent(incoming, &traceID)
+	if !ok {
+		rand.Read(traceID[:])
+		parentID = ""
+	}
+	rand.Read(spanID[:])
+
+	s := t.settings.Load()
+	sampled := s.sample(traceID, ok, parentSampled)
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	if info != nil {
+		info.TraceID = hex.EncodeToString(traceID[:])
+		info.SpanID = hex.EncodeToString(spanID[:])
+		info.ParentSpanID = parentID
+		info.TraceSampled = sampled
+	}
+	return "00-" + hex.EncodeToString(traceID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-" + flags
+}
+
+// sample decides whether a trace is sampled: as the caller decided with
+// parent_based, otherwise by the random part of the trace ID, so that every
+// gateway replica takes the same decision for a trace, within the rate limit
+func (s *settings) sample(traceID [16]byte, hasParent, parentSampled bool) bool {
+	var sampled bool
+	if hasParent && s.parentBased {
+		sampled = parentSampled
+	} else {
+		sampled = binary.BigEndian.Uint64(traceID[8:])>>1 < s.bound
+	}
+	return sampled && s.limiter.Allow()
+}
+
+// parseTraceparent parses a version 00 traceparent into traceID and returns
+// the parent span ID and whether the caller sampled the trace
+func parseTraceparent(value string, traceID *[16]byte) (string, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", false, false
+	}
+	var spanID [8]byte
+	var flags [1]byte
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || isZero(traceID[:]) {
+		return "", false, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || isZero(spanID[:]) {
+		return "", false, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return "", false, false
+	}
+	return strings.ToLower(parts[2]), flags[0]&1 == 1, true
+}
+
+// isZero reports whether every byte of b is zero, an invalid trace or span ID
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Observe implements requestinfo.Observer, exporting the span of a completed
+// request that was sampled, failed or slow
+func (t *Tracer) Observe(info *requestinfo.Info) {
+	if t == nil || info.TraceID == "" {
+		return
+	}
+	s := t.settings.Load()
+	var reason string
+	switch {
+	case info.TraceSampled:
+		reason = reasonSampled
+	case s.errors && failed(info):
+		reason = reasonError
+	case s.slow > 0 && info.Duration > s.slow:
+		reason = reasonSlow
+	default:
+		decisions.Inc("dropped")
+		return
+	}
+	decisions.Inc(reason)
+	t.exporter.add(newSpan(info, reason))
+}
+
+// failed reports whether the request completed with an error
+func failed(info *requestinfo.Info) bool {
+	if info.GRPCCode != "" {
+		return info.GRPCCode != "OK"
+	}
+	return info.Status >= 500
+}
+
+// Close exports the queued spans
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.exporter.close()
+}
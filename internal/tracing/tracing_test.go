@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// collector records the spans of OTLP/JSON export requests
+type collector struct {
+	mu    sync.Mutex
+	spans []span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []span `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func newTracer(t *testing.T, sampling config.TraceSamplingConfig) (*Tracer, *collector) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	tracer, err := New(config.TracingConfig{Enabled: true, Endpoint: srv.URL, Sampling: sampling})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tracer.Close)
+	return tracer, c
+}
+
+func ratio(r float64) *float64 {
+	return &r
+}
+
+func TestFromHTTPContinuesIncomingTrace(t *testing.T) {
+	tracer, _ := newTracer(t, config.TraceSamplingConfig{Ratio: ratio(0), ParentBased: true})
+	header := http.Header{}
+	header.Set("Traceparent", incoming)
+	info := &requestinfo.Info{}
+
+	traceparent := tracer.FromHTTP(header, info)
+	if info.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || info.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("trace %s, parent %s, want the incoming trace and span", info.TraceID, info.ParentSpanID)
+	}
+	if !info.TraceSampled {
+		t.Fatal("trace sampled by the caller not sampled with parent_based")
+	}
+	want := "00-" + info.TraceID + "-" + info.SpanID + "-01"
+	if traceparent != want || header.Get("Traceparent") != want {
+		t.Fatalf("traceparent %q, header %q, want %q", traceparent, header.Get("Traceparent"), want)
+	}
+}
+
+func TestFromMetadataStartsTraceForInvalidTraceparent(t *testing.T) {
+	tracer, _ := newTracer(t, config.TraceSamplingConfig{Ratio: ratio(0)})
+	md := metadata.Pairs(Header, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	info := &requestinfo.Info{}
+
+	tracer.FromMetadata(md, info)
+	if info.TraceID == "" || info.TraceID == strings.Repeat("0", 32) || info.ParentSpanID != "" {
+		t.Fatalf("trace %q, parent %q, want a new trace", info.TraceID, info.ParentSpanID)
+	}
+	if info.TraceSampled {
+		t.Fatal("trace sampled with ratio 0")
+	}
+	if got := md.Get(Header); len(got) != 1 || got[0] != "00-"+info.TraceID+"-"+info.SpanID+"-00" {
+		t.Fatalf("traceparent metadata %v", got)
+	}
+}
+
+func TestRateLimitCapsSampledRequests(t *testing.T) {
+	tracer, _ := newTracer(t, config.TraceSamplingConfig{RateLimit: 1})
+	sampled := 0
+	for range 10 {
+		info := &requestinfo.Info{}
+		tracer.FromHTTP(http.Header{}, info)
+		if info.TraceSampled {
+			sampled++
+		}
+	}
+	if sampled != 1 {
+		t.Fatalf("%d requests sampled, want 1 with a rate limit of 1/s", sampled)
+	}
+}
+
+func TestObserveExportsErrorsAndSlowRequestsNotSampled(t *testing.T) {
+	tracer, c := newTracer(t, config.TraceSamplingConfig{Ratio: ratio(0), Errors: true, SlowThreshold: time.Second})
+	requests := []*requestinfo.Info{
+		{Service: "order.OrderService", Method: "GetOrder", GRPCCode: "Unavailable", Duration: time.Millisecond},
+		{Service: "order.OrderService", Method: "ListOrders", GRPCCode: "OK", Duration: 2 * time.Second},
+		{Service: "order.OrderService", Method: "GetOrder", GRPCCode: "OK", Duration: time.Millisecond},
+	}
+	for _, info := range requests {
+		info.Time = time.Now()
+		tracer.FromMetadata(metadata.MD{}, info)
+		tracer.Observe(info)
+	}
+	tracer.Close()
+
+	reasons := make(map[string]string)
+	for _, s := range c.spans {
+		for _, attr := range s.Attributes {
+			if attr.Key == "gateway.sampling.reason" {
+				reasons[s.SpanID] = *attr.Value.StringValue
+			}
+		}
+	}
+	if len(c.spans) != 2 || reasons[requests[0].SpanID] != reasonError || reasons[requests[1].SpanID] != reasonSlow {
+		t.Fatalf("exported spans %+v, want the failed and the slow request", c.spans)
+	}
+	if c.spans[0].Status.Code != statusCodeError {
+		t.Fatalf("status of the failed request %+v", c.spans[0].Status)
+	}
+}
+
+func TestNewValidatesSampling(t *testing.T) {
+	if _, err := New(config.TracingConfig{Enabled: true, Endpoint: "http://collector:4318/v1/traces", Sampling: config.TraceSamplingConfig{Ratio: ratio(1.5)}}); err == nil {
+		t.Fatal("ratio above 1 accepted")
+	}
+	if _, err := New(config.TracingConfig{Enabled: true}); err == nil {
+		t.Fatal("missing endpoint accepted")
+	}
+	if tracer, err := New(config.TracingConfig{}); tracer != nil || err != nil {
+		t.Fatalf("disabled tracing returned %v, %v", tracer, err)
+	}
+}
@@ -0,0 +1,208 @@
+package twirp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// PathPrefix is the path prefix of Twirp routes: /twirp/package.Service/Method
+const PathPrefix = "/twirp/"
+
+// Content types of Twirp requests and responses
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// Error is the JSON body of a Twirp error response
+type Error struct {
+	Code string            `json:"code"`
+	Msg  string            `json:"msg"`
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// codeNames maps gRPC codes to Twirp error codes
+var codeNames = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "dataloss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+// httpStatus maps Twirp error codes to the HTTP status of the response, as
+// defined by the Twirp specification
+var httpStatus = map[string]int{
+	"canceled":            http.StatusRequestTimeout,
+	"unknown":             http.StatusInternalServerError,
+	"invalid_argument":    http.StatusBadRequest,
+	"malformed":           http.StatusBadRequest,
+	"deadline_exceeded":   http.StatusRequestTimeout,
+	"not_found":           http.StatusNotFound,
+	"bad_route":           http.StatusNotFound,
+	"already_exists":      http.StatusConflict,
+	"permission_denied":   http.StatusForbidden,
+	"unauthenticated":     http.StatusUnauthorized,
+	"resource_exhausted":  http.StatusTooManyRequests,
+	"failed_precondition": http.StatusPreconditionFailed,
+	"aborted":             http.StatusConflict,
+	"out_of_range":        http.StatusBadRequest,
+	"unimplemented":       http.StatusNotImplemented,
+	"internal":            http.StatusInternalServerError,
+	"unavailable":         http.StatusServiceUnavailable,
+	"dataloss":            http.StatusInternalServerError,
+}
+
+// FromStatus converts a gRPC status error into a Twirp error
+func FromStatus(err error) *Error {
+	st := status.Convert(err)
+	name, ok := codeNames[st.Code()]
+	if !ok {
+		name = "unknown"
+	}
+	return &Error{Code: name, Msg: st.Message()}
+}
+
+// FromHTTPStatus creates a Twirp error for a plain HTTP error response, such
+// as a rejection by a middleware that does not know about Twirp
+func FromHTTPStatus(statusCode int, msg string) *Error {
+	var name string
+	switch statusCode {
+	case http.StatusBadRequest:
+		name = "invalid_argument"
+	case http.StatusUnauthorized:
+		name = "unauthenticated"
+	case http.StatusForbidden:
+		name = "permission_denied"
+	case http.StatusNotFound:
+		name = "bad_route"
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		name = "deadline_exceeded"
+	case http.StatusConflict:
+		name = "aborted"
+	case http.StatusTooManyRequests:
+		name = "resource_exhausted"
+	case http.StatusNotImplemented:
+		name = "unimplemented"
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		name = "unavailable"
+	default:
+		name = "internal"
+	}
+	return &Error{Code: name, Msg: msg}
+}
+
+// GRPCStatus converts the Twirp error into a gRPC status
+func (e *Error) GRPCStatus() *status.Status {
+	code := codes.Unknown
+	switch e.Code {
+	case "malformed":
+		code = codes.InvalidArgument
+	case "bad_route":
+		code = codes.Unimplemented
+	default:
+		for c, name := range codeNames {
+			if name == e.Code {
+				code = c
+				break
+			}
+		}
+	}
+	return status.New(code, e.Msg)
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("twirp error %s: %s", e.Code, e.Msg)
+}
+
+// HTTPStatus returns the HTTP status of the error response
+func (e *Error) HTTPStatus() int {
+	if s, ok := httpStatus[e.Code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// Write writes the error as a Twirp error response
+func (e *Error) Write(w http.ResponseWriter) {
+	body, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(e.HTTPStatus())
+	w.Write(body)
+}
+
+// ParsePath splits a Twirp path /twirp/package.Service/Method
+func ParsePath(path string) (service, method string, err error) {
+	rest, ok := strings.CutPrefix(path, PathPrefix)
+	if !ok {
+		return "", "", fmt.Errorf("path must start with %s", PathPrefix)
+	}
+	service, method, ok = strings.Cut(rest, "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", fmt.Errorf("invalid path format, expected %spackage.Service/Method, got %s", PathPrefix, path)
+	}
+	return service, method, nil
+}
+
+// Invoke calls a Twirp backend at baseURL with a protobuf-encoded request.
+// Non-binary metadata is sent as request headers. A Twirp error response is
+// returned as a gRPC status error.
+func Invoke(ctx context.Context, transport http.RoundTripper, baseURL, service, method string, md metadata.MD, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+PathPrefix+service+"/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create Twirp request: %v", err)
+	}
+	for key, values := range md {
+		if strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", ContentTypeProtobuf)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Errorf(codes.Unavailable, "failed to call Twirp backend: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to read Twirp response: %v", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return body, nil
+	}
+
+	var twerr Error
+	if err := json.Unmarshal(body, &twerr); err != nil || twerr.Code == "" {
+		// Not a Twirp error, e.g. from a proxy in front of the backend
+		twerr = *FromHTTPStatus(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil, twerr.GRPCStatus().Err()
+}
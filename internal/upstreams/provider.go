@@ -0,0 +1,37 @@
+package upstreams
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+)
+
+// ProviderSet upstream tracker provider set
+var ProviderSet = wire.NewSet(
+	ProvideTracker,
+)
+
+// ProvideTracker provides the upstream tracker. Known services are the
+// services of the loaded descriptors and those named in the current config.
+func ProvideTracker(cfg *config.Config, recorder *registry.Recorder, pool *proxy.ConnectionPool, loader *proto.DescriptorLoader, watcher *reload.Watcher) *Tracker {
+	return New(recorder, pool, func() []string {
+		current := cfg
+		if watcher != nil {
+			current = watcher.Current()
+		}
+		var services []string
+		if loader != nil {
+			services = loader.ServiceNames()
+		}
+		for service := range current.Services {
+			services = append(services, service)
+		}
+		for _, route := range current.HTTPRoutes {
+			services = append(services, route.Service)
+		}
+		return append(services, current.Health.CriticalServices...)
+	}, cfg.Health.CheckTimeout)
+}
@@ -0,0 +1,260 @@
+package upstreams
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/requestinfo"
+)
+
+// Window is the period over which the recent error rate of a service is computed
+const Window = time.Minute
+
+// buckets is the number of slots the window is divided into
+const buckets = 6
+
+// Circuit states derived from the pooled connections to a service's instances
+const (
+	CircuitClosed   = "closed"    // At least one connection is usable
+	CircuitHalfOpen = "half_open" // Connections are being re-established
+	CircuitOpen     = "open"      // Every connection is failing, calls fail fast
+)
+
+// Upstream is the operational overview of one upstream service
+type Upstream struct {
+	Service        string            `json:"service"`
+	Healthy        int               `json:"healthy"`
+	Unhealthy      *int              `json:"unhealthy"` // Null when the registry only reports passing instances
+	Draining       int               `json:"draining"`
+	Circuit        string            `json:"circuit"`
+	Connections    map[string]int    `json:"connections"` // Pooled connections by state
+	Requests       int               `json:"requests"`    // Requests within the window
+	ErrorRate      float64           `json:"error_rate"`
+	LastRefresh    *registry.Refresh `json:"last_refresh"` // Null when the service has not been discovered yet
+	DiscoveryError string            `json:"discovery_error,omitempty"`
+	WindowSeconds  float64           `json:"window_seconds"`
+}
+
+// counts holds the requests and errors of one bucket
+type counts struct {
+	slot     int64 // Index of the bucket period since the epoch
+	requests int
+	errors   int
+}
+
+// Tracker records recent per-service error rates from completed requests and
+// builds the upstream overview together with the registry and connection pool
+type Tracker struct {
+	recorder *registry.Recorder
+	pool     *proxy.ConnectionPool
+	services func() []string // Services known from configuration and descriptors
+	timeout  time.Duration   // Bounds the discovery of each service in a snapshot
+
+	mu      sync.Mutex
+	windows map[string]*[buckets]counts
+}
+
+// New creates an upstream tracker; recorder may be nil when no registry is configured
+func New(recorder *registry.Recorder, pool *proxy.ConnectionPool, services func() []string, timeout time.Duration) *Tracker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Tracker{
+		recorder: recorder,
+		pool:     pool,
+		services: services,
+		timeout:  timeout,
+		windows:  make(map[string]*[buckets]counts),
+	}
+}
+
+// Observe implements requestinfo.Observer
+func (t *Tracker) Observe(info *requestinfo.Info) {
+	if t == nil || info.Service == "" {
+		return
+	}
+	slot := slotOf(info.Time.Add(info.Duration))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window, ok := t.windows[info.Service]
+	if !ok {
+		window = new([buckets]counts)
+		t.windows[info.Service] = window
+	}
+	bucket := &window[slot%buckets]
+	switch {
+	case bucket.slot > slot:
+		return // Older than the window
+	case bucket.slot < slot:
+		*bucket = counts{slot: slot}
+	}
+	bucket.requests++
+	if failed(info) {
+		bucket.errors++
+	}
+}
+
+// recent returns the requests and errors of a service within the window
+func (t *Tracker) recent(service string, now time.Time) (requests, errors int) {
+	current := slotOf(now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window, ok := t.windows[service]
+	if !ok {
+		return 0, 0
+	}
+	for _, bucket := range window {
+		if current-bucket.slot < buckets {
+			requests += bucket.requests
+			errors += bucket.errors
+		}
+	}
+	return requests, errors
+}
+
+// Snapshot returns the overview of every known service: services from the
+// configuration and descriptors, services that were discovered and services
+// that received requests. Instances are discovered concurrently.
+func (t *Tracker) Snapshot(ctx context.Context) []Upstream {
+	names := make(map[string]bool)
+	if t.services != nil {
+		for _, name := range t.services() {
+			names[name] = true
+		}
+	}
+	if t.recorder != nil {
+		for _, name := range t.recorder.Services() {
+			names[name] = true
+		}
+	}
+	t.mu.Lock()
+	for name := range t.windows {
+		names[name] = true
+	}
+	t.mu.Unlock()
+	delete(names, "")
+
+	states := t.connectionStates()
+	now := time.Now()
+	result := make([]Upstream, 0, len(names))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			upstream := t.upstream(ctx, name, states, now)
+			mu.Lock()
+			result = append(result, upstream)
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Service < result[j].Service
+	})
+	return result
+}
+
+// upstream builds the overview of one service
+func (t *Tracker) upstream(ctx context.Context, service string, states map[string][]string, now time.Time) Upstream {
+	u := Upstream{
+		Service:       service,
+		Connections:   make(map[string]int),
+		WindowSeconds: Window.Seconds(),
+	}
+
+	// Instances are listed past the recorder so the overview itself does not count as a refresh
+	if t.recorder != nil {
+		ctx, cancel := context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+		if refresh, ok := t.recorder.LastRefresh(service); ok {
+			u.LastRefresh = &refresh
+		}
+		healthy, unhealthy, err := t.recorder.DiscoverAll(ctx, service)
+		if err == nil {
+			n := len(unhealthy)
+			u.Unhealthy = &n
+		} else {
+			healthy, err = t.recorder.Registry.Discover(ctx, service)
+		}
+		if err != nil {
+			u.DiscoveryError = err.Error()
+		}
+		for _, instance := range healthy {
+			if proxy.Draining(instance) {
+				u.Draining++
+			} else {
+				u.Healthy++
+			}
+			target := net.JoinHostPort(instance.Address, strconv.Itoa(instance.Port))
+			for _, state := range states[target] {
+				u.Connections[state]++
+			}
+		}
+	}
+	u.Circuit = circuit(u.Connections)
+
+	requests, errors := t.recent(service, now)
+	u.Requests = requests
+	if requests > 0 {
+		u.ErrorRate = float64(errors) / float64(requests)
+	}
+	return u
+}
+
+// connectionStates returns the states of pooled connections by target
+func (t *Tracker) connectionStates() map[string][]string {
+	states := make(map[string][]string)
+	if t.pool == nil {
+		return states
+	}
+	for _, conn := range t.pool.Stats() {
+		if conn.Draining || conn.State == "NONE" {
+			continue
+		}
+		states[conn.Target] = append(states[conn.Target], conn.State)
+	}
+	return states
+}
+
+// circuit derives the circuit state from connection states: calls on a
+// connection in TRANSIENT_FAILURE fail immediately until it reconnects
+func circuit(connections map[string]int) string {
+	if connections["READY"] > 0 || connections["IDLE"] > 0 {
+		return CircuitClosed
+	}
+	if connections["CONNECTING"] > 0 {
+		return CircuitHalfOpen
+	}
+	if connections["TRANSIENT_FAILURE"] > 0 {
+		return CircuitOpen
+	}
+	return CircuitClosed
+}
+
+// failed reports whether the request failed on the upstream side; client
+// errors such as invalid arguments do not count against the service
+func failed(info *requestinfo.Info) bool {
+	switch info.GRPCCode {
+	case "":
+		return info.Status >= 500
+	case "Unknown", "DeadlineExceeded", "ResourceExhausted", "Internal", "Unavailable", "DataLoss":
+		return true
+	default:
+		return false
+	}
+}
+
+// slotOf returns the bucket period containing t
+func slotOf(t time.Time) int64 {
+	return t.UnixNano() / int64(Window/buckets)
+}
@@ -0,0 +1,79 @@
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at link time via -ldflags "-X"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+func init() {
+	// Binaries built with go build or go install without the ldflags still
+	// carry the module version and VCS stamp in their build info
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && Commit == "unknown" && len(s.Value) >= 7:
+			Commit = s.Value[:7]
+		case s.Key == "vcs.time" && BuildDate == "unknown":
+			BuildDate = s.Value
+		}
+	}
+}
+
+// Info is the build information reported by the /version endpoint
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build information
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// String returns a human-readable description of the build
+func String() string {
+	return fmt.Sprintf("heytom-gateway %s (commit %s, built %s, %s %s/%s)",
+		Version, Commit, BuildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Metadata returns the build information added to the registry metadata of the gateway instance
+func Metadata() map[string]string {
+	return map[string]string{
+		"version":    Version,
+		"commit":     Commit,
+		"build_date": BuildDate,
+	}
+}
+
+// Handler serves the build information as JSON
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Get())
+	}
+}
@@ -0,0 +1,18 @@
+package webhook
+
+import (
+	"log/slog"
+
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+)
+
+// ProviderSet webhook provider set
+var ProviderSet = wire.NewSet(
+	ProvideClient,
+)
+
+// ProvideClient provides the webhook client used by route rules
+func ProvideClient(log *slog.Logger) *Client {
+	return New(logger.Component(log, "webhook"))
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/metrics"
+)
+
+// Webhook phases
+const (
+	PhaseBefore = "before"
+	PhaseAfter  = "after"
+)
+
+// defaultTimeout bounds a webhook call when the hook has no timeout configured
+const defaultTimeout = time.Second
+
+var webhookFailures = metrics.NewCounterVec(
+	"gateway_webhook_failures_total",
+	"Failed webhook calls, by route and phase",
+	"route", "phase",
+)
+
+// Event is the request context POSTed to a webhook as JSON
+type Event struct {
+	Phase      string            `json:"phase"`
+	Route      string            `json:"route"` // Name of the route rule the hook belongs to
+	Tenant     string            `json:"tenant,omitempty"`
+	Service    string            `json:"service"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Request    json.RawMessage   `json:"request,omitempty"`
+	Status     int               `json:"status,omitempty"`   // HTTP status returned to the client (after only)
+	Response   json.RawMessage   `json:"response,omitempty"` // Response body (after only)
+	DurationMs float64           `json:"duration_ms,omitempty"`
+}
+
+// SetRequest sets the request body when it is valid JSON
+func (e *Event) SetRequest(body []byte) {
+	e.Request = rawJSON(body)
+}
+
+// SetResponse sets the response body when it is valid JSON
+func (e *Event) SetResponse(body []byte) {
+	e.Response = rawJSON(body)
+}
+
+// rawJSON returns body as a raw JSON value, or nil when it is not valid JSON
+func rawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 || !json.Valid(body) {
+		return nil
+	}
+	return json.RawMessage(body)
+}
+
+// Result is the outcome of a before hook. A 2xx response allows the request
+// and any other status below 500 rejects it; an optional JSON body adds
+// upstream metadata or replaces the request body.
+type Result struct {
+	Allowed bool              `json:"-"`
+	Status  int               `json:"-"` // HTTP status for a rejection
+	Reason  string            `json:"reason,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // Forwarded upstream as gRPC metadata
+	Body    json.RawMessage   `json:"body,omitempty"`    // Replaces the request body when set
+}
+
+// Client calls webhooks
+type Client struct {
+	client *http.Client
+	logger *slog.Logger
+}
+
+// New creates a webhook client
+func New(logger *slog.Logger) *Client {
+	return &Client{client: &http.Client{}, logger: logger}
+}
+
+// Before calls a before hook. When the hook fails and it fails open, the
+// request is allowed; otherwise the failure is returned.
+func (c *Client) Before(ctx context.Context, hook config.WebhookConfig, event *Event) (*Result, error) {
+	result, err := c.before(ctx, hook, event)
+	if err == nil {
+		return result, nil
+	}
+	webhookFailures.Inc(event.Route, PhaseBefore)
+	if hook.FailOpen {
+		c.logger.Warn("Webhook failed, letting the request through", "route", event.Route, "url", hook.URL, "error", err)
+		return &Result{Allowed: true}, nil
+	}
+	return nil, err
+}
+
+// before POSTs the event and decodes the hook's decision
+func (c *Client) before(ctx context.Context, hook config.WebhookConfig, event *Event) (*Result, error) {
+	resp, err := c.post(ctx, hook, event)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook response: %w", err)
+	}
+
+	result := &Result{Allowed: resp.StatusCode >= 200 && resp.StatusCode < 300}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, result); err != nil && result.Allowed {
+			return nil, fmt.Errorf("failed to unmarshal webhook response: %w", err)
+		}
+	}
+	if !result.Allowed {
+		result.Status = resp.StatusCode
+	}
+	return result, nil
+}
+
+// After calls an after hook in the background. Failures are only logged.
+func (c *Client) After(hook config.WebhookConfig, event *Event) {
+	go func() {
+		resp, err := c.post(context.Background(), hook, event)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+		}
+		webhookFailures.Inc(event.Route, PhaseAfter)
+		c.logger.Warn("Webhook failed", "route", event.Route, "url", hook.URL, "phase", PhaseAfter, "error", err)
+	}()
+}
+
+// post sends the event to the hook within its timeout. The returned
+// response body must be read before the timeout elapses.
+func (c *Client) post(ctx context.Context, hook config.WebhookConfig, event *Event) (*http.Response, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(data))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the request timeout when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,24 @@
+// Package claims carries the authenticated claims of a request through its
+// context.
+//
+// The gateway attaches the claims returned by the external authorization
+// service. Custom middleware (see package middleware) that authenticates
+// callers itself attaches them with NewContext; middleware listed after it in
+// server.http.middleware, route rules and the tenant claim see them.
+package claims
+
+import "context"
+
+// claimsKey is the context key of the claims
+type claimsKey struct{}
+
+// NewContext returns a context carrying the authenticated claims
+func NewContext(ctx context.Context, claims map[string]any) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims attached to the context, or nil
+func FromContext(ctx context.Context) map[string]any {
+	claims, _ := ctx.Value(claimsKey{}).(map[string]any)
+	return claims
+}
@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"log/slog"
+
+	"github.com/heytom-labs/heytom-gateway/internal/accesslog"
+	"github.com/heytom-labs/heytom-gateway/internal/cache"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/errorreport"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/plugins"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+	"github.com/heytom-labs/heytom-gateway/internal/server/grpc"
+	"github.com/heytom-labs/heytom-gateway/internal/server/http"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+)
+
+// app holds the components the gateway starts and stops
+type app struct {
+	Config           *config.Config
+	Logger           *slog.Logger
+	HTTPServer       *http.Server
+	GRPCServer       *grpc.Server
+	Registry         registry.Registry
+	Health           *health.Health          // Readiness checks gating registration at startup
+	HotReloadManager *proto.HotReloadManager // Optional hot reload manager
+	ConfigWatcher    *reload.Watcher         // Optional config file watcher
+	ConnectionPool   *proxy.ConnectionPool   // Upstream connections, closed after the servers drain
+	Plugins          *plugins.Manager        // Plugin processes, stopped after the servers drain
+	Brokers          *publish.Manager        // Message queue connections, flushed after the servers drain
+	Handover         *handover.Handover      // Passes the listeners to a new process on upgrade
+	Capture          *capture.Recorder       // Optional traffic capture, flushed after the servers drain
+	AccessLog        *accesslog.Logger       // Optional access log, flushed after the servers drain
+	ErrorReporter    *errorreport.Reporter   // Optional error reporting, flushed last
+	Tracer           *tracing.Tracer         // Optional span export, flushed after the servers drain
+	Cache            *cache.Cache            // Response cache, closed after the servers drain
+}
@@ -0,0 +1,325 @@
+// Package gateway embeds the gateway in a Go program.
+//
+// A Gateway is built from the same configuration file as the gateway binary
+// and runs the same components: the HTTP and gRPC listeners, the proxies,
+// the descriptor loader and the registry. Run starts it and stops it
+// gracefully when the context is done:
+//
+//	gw, err := gateway.New(
+//		gateway.WithConfigFile("configs/config.json"),
+//		gateway.WithMiddleware(middleware.New("audit", audit)),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if err := gw.Run(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Programs that manage the lifecycle themselves call Start, watch Err and
+// call Shutdown. Custom registries are made available with RegisterRegistry
+// and selected by registry.type.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/errorreport"
+	"github.com/heytom-labs/heytom-gateway/internal/logger"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	_ "github.com/heytom-labs/heytom-gateway/internal/registry/consul" // Register Consul implementation
+	"github.com/heytom-labs/heytom-gateway/internal/version"
+)
+
+const (
+	// defaultStartupTimeout bounds the readiness wait when server.startup_timeout is not set
+	defaultStartupTimeout = 30 * time.Second
+	// defaultShutdownTimeout bounds request draining when server.shutdown_timeout is not set
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+type (
+	// Config is the gateway configuration, as loaded from the configuration file
+	Config = config.Config
+	// Registry is a service registry used for discovery and registration
+	Registry = registry.Registry
+	// RegistryWatcher reports changes of the instances of a service
+	RegistryWatcher = registry.Watcher
+	// ServiceInstance is an instance of a service in the registry
+	ServiceInstance = registry.ServiceInstance
+	// RegistryFactory creates a registry from the configuration
+	RegistryFactory = registry.RegistryFactory
+)
+
+// RegisterRegistry makes a registry implementation available under
+// registryType, for use with registry.type. It must be called before New.
+func RegisterRegistry(registryType string, factory RegistryFactory) {
+	registry.RegisterFactory(registryType, factory)
+}
+
+// Gateway is an embedded gateway
+type Gateway struct {
+	app        *app
+	errs       chan error
+	registered bool // Registered with the registry, deregistered on shutdown
+	handedOver bool // Listeners and registration were passed to a new process
+}
+
+// New loads the configuration and descriptors and builds the gateway without
+// starting it
+func New(opts ...Option) (*Gateway, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	a, err := initializeApp(&o.config, o)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range o.middlewares {
+		a.HTTPServer.Use(m)
+	}
+	return &Gateway{app: a, errs: make(chan error, 2)}, nil
+}
+
+// provideLogger provides the logger set with WithLogger, or the application logger
+func provideLogger(cfg *config.Config, reporter *errorreport.Reporter, o *options) (*slog.Logger, error) {
+	if o.logger != nil {
+		return o.logger, nil
+	}
+	return logger.ProvideLogger(cfg, reporter)
+}
+
+// Config returns the loaded configuration
+func (g *Gateway) Config() *Config {
+	return g.app.Config
+}
+
+// Logger returns the gateway logger
+func (g *Gateway) Logger() *slog.Logger {
+	return g.app.Logger
+}
+
+// HTTPAddr returns the address of the HTTP listener once started, with the
+// port assigned by the system when server.http_port has port 0
+func (g *Gateway) HTTPAddr() net.Addr {
+	return g.app.HTTPServer.Addr()
+}
+
+// GRPCAddr returns the address of the gRPC listener once started
+func (g *Gateway) GRPCAddr() net.Addr {
+	return g.app.GRPCServer.Addr()
+}
+
+// RegisterService registers a gRPC service implemented in this process on
+// the gRPC listeners, so that generated RegisterXxxServer functions accept
+// the Gateway. It must be called before Start. The service takes precedence
+// over proxying: its methods are served locally and methods it does not
+// implement are still proxied. Services listed in server.grpc.prefer_upstream
+// are proxied while the registry has instances of them and served locally
+// otherwise.
+func (g *Gateway) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	g.app.GRPCServer.RegisterService(desc, impl)
+}
+
+// Start binds the HTTP and gRPC listeners and serves them in the background,
+// then waits for the readiness checks to pass and registers the gateway with
+// the registry. When Start fails, call Shutdown to release what was started.
+func (g *Gateway) Start(ctx context.Context) error {
+	a := g.app
+	logger := a.Logger
+
+	logger.Info("Configuration loaded",
+		"version", version.Version,
+		"http_port", a.Config.Server.HTTPPort,
+		"grpc_port", a.Config.Server.GRPCPort)
+	if a.Config.Registry.Enabled {
+		logger.Info("Registry enabled", "type", a.Config.Registry.Type, "address", a.Config.Registry.Address)
+	}
+
+	// Start protoset hot reload if enabled
+	if a.HotReloadManager != nil {
+		logger.Info("Hot reload is enabled, starting protoset update monitor",
+			"check_period", a.Config.Proto.HotReload.CheckPeriod,
+			"watch_files", a.Config.Proto.HotReload.WatchFiles)
+		if err := a.HotReloadManager.Start(context.Background()); err != nil {
+			return fmt.Errorf("failed to start protoset hot reload: %w", err)
+		}
+	}
+
+	// Watch config file for changes that can be applied at runtime
+	if a.ConfigWatcher != nil {
+		a.ConfigWatcher.Start(context.Background())
+	}
+
+	// Bind both listeners before serving so that a port conflict fails startup
+	if err := a.HTTPServer.Listen(); err != nil {
+		return fmt.Errorf("could not listen for HTTP: %w", err)
+	}
+	if err := a.GRPCServer.Listen(); err != nil {
+		return fmt.Errorf("could not listen for gRPC: %w", err)
+	}
+
+	go func() {
+		logger.Info("HTTP server starting", "address", a.Config.Server.HTTPPort)
+		if err := a.HTTPServer.Serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			g.errs <- fmt.Errorf("HTTP server failed: %w", err)
+		}
+	}()
+	go func() {
+		logger.Info("gRPC server starting", "address", a.Config.Server.GRPCPort)
+		if err := a.GRPCServer.Serve(); err != nil {
+			g.errs <- fmt.Errorf("gRPC server failed: %w", err)
+		}
+	}()
+
+	// Register only once the readiness checks pass, so that discovery never
+	// routes traffic to an instance that cannot serve it
+	if a.Registry != nil {
+		timeout := a.Config.Server.StartupTimeout
+		if timeout <= 0 {
+			timeout = defaultStartupTimeout
+		}
+		if err := waitReady(ctx, a.Health, timeout); err != nil {
+			return fmt.Errorf("readiness checks did not pass: %w", err)
+		}
+		logger.Info("Readiness checks passed")
+
+		if err := registerService(ctx, a.Registry, a.Config); err != nil {
+			return fmt.Errorf("could not register service: %w", err)
+		}
+		g.registered = true
+		logger.Info("Service registered", "service", a.Config.Registry.ServiceName, "id", a.Config.Registry.ServiceID)
+	}
+
+	// After an upgrade, the previous process drains once this one serves and is registered
+	if a.Handover.Inherited() {
+		if err := a.Handover.Ready(); err != nil {
+			logger.Error("Failed to notify previous process of readiness", "error", err)
+		} else {
+			logger.Info("Took over listeners and registration from previous process")
+		}
+	}
+	return nil
+}
+
+// Err reports the error of the HTTP or gRPC server when one stops serving
+// before Shutdown
+func (g *Gateway) Err() <-chan error {
+	return g.errs
+}
+
+// Upgrade starts a new process with the same arguments and hands the
+// listeners over to it. It returns once the new process is ready, after
+// which Shutdown drains without deregistering, or an error when the new
+// process failed, in which case the gateway keeps serving.
+func (g *Gateway) Upgrade() error {
+	if err := g.app.Handover.Upgrade(); err != nil {
+		return err
+	}
+	g.handedOver = true
+	return nil
+}
+
+// Shutdown deregisters the gateway, stops accepting new requests and drains
+// in-flight requests and streams for up to server.shutdown_timeout or until
+// ctx is done, then closes upstream connections, plugins and brokers
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	a := g.app
+	logger := a.Logger
+	logger.Info("Shutting down servers...")
+
+	// Stop hot reload manager if running
+	if a.HotReloadManager != nil {
+		a.HotReloadManager.Stop()
+		logger.Info("Hot reload manager stopped")
+	}
+
+	// Stop config watcher if running
+	if a.ConfigWatcher != nil {
+		a.ConfigWatcher.Stop()
+	}
+
+	// Deregister first so that discovery stops routing new requests to this instance;
+	// after a handover the new process has registered under the same ID
+	if g.registered && !g.handedOver {
+		deregisterCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := a.Registry.Deregister(deregisterCtx, a.Config.Registry.ServiceID); err != nil {
+			logger.Error("Failed to deregister service", "error", err)
+		} else {
+			logger.Info("Service deregistered", "id", a.Config.Registry.ServiceID)
+		}
+		cancel()
+		if delay := a.Config.Server.DeregisterDelay; delay > 0 {
+			logger.Info("Waiting for clients to observe deregistration", "delay", delay)
+			time.Sleep(delay)
+		}
+	}
+
+	// Stop accepting new requests and drain in-flight requests and streams on both listeners
+	timeout := a.Config.Server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	logger.Info("Draining in-flight requests", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var httpErr, grpcErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if httpErr = a.HTTPServer.Stop(ctx); httpErr != nil {
+			logger.Error("HTTP server shutdown error", "error", httpErr)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if grpcErr = a.GRPCServer.Stop(ctx); grpcErr != nil {
+			logger.Error("gRPC server did not drain in time, remaining streams were closed", "error", grpcErr)
+		}
+	}()
+	wg.Wait()
+
+	// Close upstream connections, stop plugins and flush brokers only after no request can use them
+	a.ConnectionPool.Close()
+	a.Plugins.Close()
+	a.AccessLog.Close() // Before the brokers, which kafka sinks publish to
+	brokersErr := a.Brokers.Close()
+	if brokersErr != nil {
+		logger.Error("Failed to flush brokers", "error", brokersErr)
+	}
+	a.Capture.Close()
+	a.Tracer.Close()
+	a.Cache.Close()
+
+	logger.Info("Servers gracefully stopped")
+	a.ErrorReporter.Close()
+	return errors.Join(httpErr, grpcErr, brokersErr)
+}
+
+// Run starts the gateway and serves until ctx is done or a server fails,
+// then shuts it down gracefully
+func (g *Gateway) Run(ctx context.Context) error {
+	err := g.Start(ctx)
+	if err == nil {
+		select {
+		case <-ctx.Done():
+		case err = <-g.errs:
+		}
+	}
+	return errors.Join(err, g.Shutdown(context.WithoutCancel(ctx)))
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"log/slog"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/pkg/middleware"
+)
+
+// options collects the settings applied by Option
+type options struct {
+	config      config.Options
+	logger      *slog.Logger
+	middlewares []middleware.Middleware
+}
+
+// Option configures a Gateway created by New
+type Option func(*options)
+
+// WithConfigFile loads the configuration from path instead of the default
+// configs/config.json
+func WithConfigFile(path string) Option {
+	return func(o *options) {
+		o.config.ConfigPath = path
+	}
+}
+
+// WithEnv layers the environment override file, such as config.prod.json,
+// over the configuration file
+func WithEnv(env string) Option {
+	return func(o *options) {
+		o.config.Env = env
+	}
+}
+
+// WithHTTPPort overrides server.http_port, as in ":8080" or "8080"
+func WithHTTPPort(addr string) Option {
+	return func(o *options) {
+		o.config.HTTPPort = addr
+	}
+}
+
+// WithGRPCPort overrides server.grpc_port, as in ":9091" or "9091"
+func WithGRPCPort(addr string) Option {
+	return func(o *options) {
+		o.config.GRPCPort = addr
+	}
+}
+
+// WithLogLevel overrides log.level
+func WithLogLevel(level string) Option {
+	return func(o *options) {
+		o.config.LogLevel = level
+	}
+}
+
+// WithLogger makes the gateway log to logger instead of building one from
+// the log configuration. The logger is used as is: log.level, its hot reload
+// and error reporting do not apply to it.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMiddleware adds custom HTTP middleware to this gateway only. Like
+// middleware registered with middleware.Register, it runs in the order of
+// server.http.middleware, or after the built-in middleware when that is not
+// configured.
+func WithMiddleware(m ...middleware.Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, m...)
+	}
+}
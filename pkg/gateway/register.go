@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/registry/cloud"
+	"github.com/heytom-labs/heytom-gateway/internal/version"
+)
+
+// waitReady polls the readiness checks until they all pass or timeout elapses,
+// returning the checks that were still failing
+func waitReady(ctx context.Context, h *health.Health, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var failed []error
+		for name, err := range h.Ready(ctx) {
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Join(failed...)
+		}
+	}
+}
+
+// registerService registers service to registry
+func registerService(ctx context.Context, reg registry.Registry, cfg *config.Config) error {
+	// 解析gRPC端口
+	grpcPort, err := parsePort(cfg.Server.GRPCPort)
+	if err != nil {
+		return fmt.Errorf("invalid grpc port: %w", err)
+	}
+
+	// 解析HTTP端口
+	httpPort := strings.TrimPrefix(cfg.Server.HTTPPort, ":")
+
+	// 注册信息中带上构建版本，便于确认每个实例运行的网关版本
+	metadata := version.Metadata()
+	metadata["http_port"] = httpPort
+	metadata["protocol"] = "grpc"
+	instance := &registry.ServiceInstance{
+		ID:       cfg.Registry.ServiceID,
+		Name:     cfg.Registry.ServiceName,
+		Version:  version.Version,
+		Port:     grpcPort,
+		Tags:     append(slices.Clone(cfg.Registry.Tags), "version="+version.Version),
+		Metadata: metadata,
+	}
+
+	// 配置了云元数据时使用查询到的地址，并在注册信息中带上可用区、区域与实例标签
+	cloudMetadata, err := cloud.Lookup(ctx, cfg.Registry.CloudMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to look up %s instance metadata: %w", cfg.Registry.CloudMetadata.Provider, err)
+	}
+	if cloudMetadata != nil {
+		instance.Address = cloudMetadata.Address
+		if cloudMetadata.Zone != "" {
+			metadata["zone"] = cloudMetadata.Zone
+		}
+		if cloudMetadata.Region != "" {
+			metadata["region"] = cloudMetadata.Region
+		}
+		for _, key := range slices.Sorted(maps.Keys(cloudMetadata.Labels)) {
+			instance.Tags = append(instance.Tags, key+"="+cloudMetadata.Labels[key])
+		}
+	}
+
+	// 未从云元数据得到地址时使用 server.host，未设置时自动检测
+	if instance.Address == "" {
+		if instance.Address, err = registry.AdvertiseAddress(cfg.Server.Host, cfg.Server.Advertise); err != nil {
+			return err
+		}
+	}
+	return reg.Register(ctx, instance)
+}
+
+// parsePort 解析端口号，地址可以带有主机名，如 "127.0.0.1:9091"
+func parsePort(portStr string) (int, error) {
+	return strconv.Atoi(portStr[strings.LastIndexByte(portStr, ':')+1:])
+}
@@ -0,0 +1,75 @@
+//go:build wireinject
+// +build wireinject
+
+package gateway
+
+import (
+	"github.com/google/wire"
+	"github.com/heytom-labs/heytom-gateway/internal/accesslog"
+	"github.com/heytom-labs/heytom-gateway/internal/admin"
+	"github.com/heytom-labs/heytom-gateway/internal/authz"
+	"github.com/heytom-labs/heytom-gateway/internal/cache"
+	"github.com/heytom-labs/heytom-gateway/internal/capture"
+	"github.com/heytom-labs/heytom-gateway/internal/concurrency"
+	"github.com/heytom-labs/heytom-gateway/internal/config"
+	"github.com/heytom-labs/heytom-gateway/internal/errorreport"
+	"github.com/heytom-labs/heytom-gateway/internal/exposure"
+	"github.com/heytom-labs/heytom-gateway/internal/handover"
+	"github.com/heytom-labs/heytom-gateway/internal/health"
+	"github.com/heytom-labs/heytom-gateway/internal/identity"
+	"github.com/heytom-labs/heytom-gateway/internal/latency"
+	"github.com/heytom-labs/heytom-gateway/internal/maintenance"
+	"github.com/heytom-labs/heytom-gateway/internal/payloadlog"
+	"github.com/heytom-labs/heytom-gateway/internal/plugins"
+	"github.com/heytom-labs/heytom-gateway/internal/proto"
+	"github.com/heytom-labs/heytom-gateway/internal/proxy"
+	"github.com/heytom-labs/heytom-gateway/internal/publish"
+	"github.com/heytom-labs/heytom-gateway/internal/registry"
+	"github.com/heytom-labs/heytom-gateway/internal/reload"
+	"github.com/heytom-labs/heytom-gateway/internal/routes"
+	"github.com/heytom-labs/heytom-gateway/internal/server/grpc"
+	"github.com/heytom-labs/heytom-gateway/internal/server/http"
+	"github.com/heytom-labs/heytom-gateway/internal/tap"
+	"github.com/heytom-labs/heytom-gateway/internal/tenancy"
+	"github.com/heytom-labs/heytom-gateway/internal/tracing"
+	"github.com/heytom-labs/heytom-gateway/internal/upstreams"
+	"github.com/heytom-labs/heytom-gateway/internal/webhook"
+)
+
+// initializeApp builds the gateway components from the configuration
+func initializeApp(opts *config.Options, o *options) (*app, error) {
+	wire.Build(
+		config.ProviderSet,
+		errorreport.ProviderSet,
+		provideLogger,
+		authz.ProviderSet,
+		accesslog.ProviderSet,
+		payloadlog.ProviderSet,
+		health.ProviderSet,
+		handover.ProviderSet,
+		maintenance.ProviderSet,
+		admin.ProviderSet,
+		latency.ProviderSet,
+		upstreams.ProviderSet,
+		tap.ProviderSet,
+		capture.ProviderSet,
+		exposure.ProviderSet,
+		identity.ProviderSet,
+		tracing.ProviderSet,
+		cache.ProviderSet,
+		concurrency.ProviderSet,
+		plugins.ProviderSet,
+		routes.ProviderSet,
+		webhook.ProviderSet,
+		tenancy.ProviderSet,
+		publish.ProviderSet,
+		http.ProviderSet,
+		grpc.ProviderSet,
+		registry.ProviderSet,
+		proto.ProviderSet,
+		proxy.ProviderSet,
+		reload.ProviderSet,
+		wire.Struct(new(app), "*"),
+	)
+	return &app{}, nil
+}
@@ -0,0 +1,167 @@
+package gatewaytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// EchoServer is an upstream gRPC server for every service of a protoset.
+// Each method answers with its request copied into the response message:
+// fields present in both messages by JSON name are kept, the others dropped.
+// Unary and server streaming methods answer once, client streaming methods
+// answer the last request and bidirectional streaming methods echo every
+// request. The metadata of the call is returned as response headers.
+type EchoServer struct {
+	files    *protoregistry.Files
+	types    *dynamicpb.Types
+	services []string
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// NewEchoServer starts an echo server on a loopback port for the services of
+// the protoset, a FileDescriptorSet including its imports
+func NewEchoServer(protoset string) (*EchoServer, error) {
+	files, err := loadProtoset(protoset)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EchoServer{files: files, types: dynamicpb.NewTypes(files), listener: lis}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			s.services = append(s.services, string(fd.Services().Get(i).FullName()))
+		}
+		return true
+	})
+	s.server = grpc.NewServer(grpc.UnknownServiceHandler(s.handle))
+	go s.server.Serve(lis)
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *EchoServer) Addr() *net.TCPAddr {
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
+// Services returns the full names of the services the server implements
+func (s *EchoServer) Services() []string {
+	return s.services
+}
+
+// Close stops the server, closing open calls
+func (s *EchoServer) Close() {
+	s.server.Stop()
+}
+
+// handle echoes the calls of every method
+func (s *EchoServer) handle(_ any, stream grpc.ServerStream) error {
+	fullMethod, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "missing method")
+	}
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+	d, err := s.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+	method, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+	if err := stream.SendHeader(echoMetadata(stream.Context())); err != nil {
+		return err
+	}
+
+	var last proto.Message
+	for {
+		req := dynamicpb.NewMessage(method.Input())
+		if err := stream.RecvMsg(req); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		last = req
+		if method.IsStreamingClient() && method.IsStreamingServer() {
+			if err := s.echo(stream, method, req); err != nil {
+				return err
+			}
+		}
+		if !method.IsStreamingClient() {
+			break
+		}
+	}
+	if method.IsStreamingClient() && method.IsStreamingServer() {
+		return nil
+	}
+	if last == nil {
+		return status.Error(codes.InvalidArgument, "no request received")
+	}
+	return s.echo(stream, method, last)
+}
+
+// echo sends the request converted to the response message of the method
+func (s *EchoServer) echo(stream grpc.ServerStream, method protoreflect.MethodDescriptor, req proto.Message) error {
+	data, err := protojson.MarshalOptions{Resolver: s.types}.Marshal(req)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode request: %v", err)
+	}
+	resp := dynamicpb.NewMessage(method.Output())
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true, Resolver: s.types}).Unmarshal(data, resp); err != nil {
+		return status.Errorf(codes.Internal, "failed to convert request to %s: %v", method.Output().FullName(), err)
+	}
+	return stream.SendMsg(resp)
+}
+
+// echoMetadata returns the metadata of the call without the pseudo-headers
+// and the headers set by the gRPC transport
+func echoMetadata(ctx context.Context) metadata.MD {
+	in, _ := metadata.FromIncomingContext(ctx)
+	md := metadata.MD{}
+	for key, values := range in {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || key == "content-type" || key == "user-agent" || key == "te" {
+			continue
+		}
+		md[key] = values
+	}
+	return md
+}
+
+// loadProtoset reads a FileDescriptorSet file
+func loadProtoset(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protoset: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to parse protoset %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build descriptors from %s: %w", path, err)
+	}
+	return files, nil
+}
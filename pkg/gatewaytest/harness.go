@@ -0,0 +1,182 @@
+// Package gatewaytest provides utilities for testing gateway extensions.
+//
+// Registry is an in-memory registry for testing code that discovers or
+// registers instances, and EchoServer is an upstream that implements every
+// service of a protoset by echoing requests. Start runs the whole gateway
+// against both, so middleware and registries can be tested end to end:
+//
+//	func TestAudit(t *testing.T) {
+//		h := gatewaytest.Start(t, "testdata/echo.protoset", nil,
+//			gateway.WithMiddleware(middleware.New("audit", audit)))
+//		resp, err := http.Post(h.URL+"/rpc/echo.EchoService/Echo", "application/json", strings.NewReader(`{"message":"hi"}`))
+//		...
+//	}
+package gatewaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/heytom-labs/heytom-gateway/pkg/gateway"
+)
+
+// registryType is the registry.type of the harness registries, which are
+// selected by registry.address
+const registryType = "gatewaytest"
+
+var (
+	registerOnce sync.Once
+	registriesMu sync.Mutex
+	registries   = make(map[string]*Registry)
+	harnessID    atomic.Int64
+)
+
+// Harness is a gateway serving on loopback ports with an echo upstream
+// registered in an in-memory registry
+type Harness struct {
+	Registry *Registry        // Registry of the gateway, with the upstream registered for each of its services
+	Upstream *EchoServer      // Upstream for every service of the protoset
+	Gateway  *gateway.Gateway // The started gateway
+	URL      string           // Base URL of the HTTP listener, as in http://127.0.0.1:8080
+	GRPCAddr string           // Address of the gRPC listener
+	t        testing.TB
+}
+
+// Start starts an echo upstream for the services of the protoset and a
+// gateway routing to it, both stopped when the test ends. config is merged
+// over the harness configuration, as the configuration file would be, and may
+// be nil; opts are applied after the harness configuration file.
+func Start(t testing.TB, protoset string, config map[string]any, opts ...gateway.Option) *Harness {
+	t.Helper()
+	registerOnce.Do(func() {
+		gateway.RegisterRegistry(registryType, func(cfg *gateway.Config) (gateway.Registry, error) {
+			registriesMu.Lock()
+			defer registriesMu.Unlock()
+			reg, ok := registries[cfg.Registry.Address]
+			if !ok {
+				return nil, fmt.Errorf("unknown gatewaytest registry %s", cfg.Registry.Address)
+			}
+			return reg, nil
+		})
+	})
+
+	upstream, err := NewEchoServer(protoset)
+	if err != nil {
+		t.Fatalf("gatewaytest: failed to start echo server: %v", err)
+	}
+	t.Cleanup(upstream.Close)
+
+	reg := NewRegistry()
+	for _, service := range upstream.Services() {
+		instance := &gateway.ServiceInstance{
+			ID:      service + "-echo",
+			Name:    service,
+			Address: upstream.Addr().IP.String(),
+			Port:    upstream.Addr().Port,
+		}
+		if err := reg.Register(context.Background(), instance); err != nil {
+			t.Fatalf("gatewaytest: failed to register %s: %v", service, err)
+		}
+	}
+	id := fmt.Sprintf("harness-%d", harnessID.Add(1))
+	registriesMu.Lock()
+	registries[id] = reg
+	registriesMu.Unlock()
+	t.Cleanup(func() {
+		registriesMu.Lock()
+		delete(registries, id)
+		registriesMu.Unlock()
+	})
+
+	path, err := writeConfig(t.TempDir(), protoset, id, config)
+	if err != nil {
+		t.Fatalf("gatewaytest: failed to write config: %v", err)
+	}
+	gw, err := gateway.New(append([]gateway.Option{gateway.WithConfigFile(path)}, opts...)...)
+	if err != nil {
+		t.Fatalf("gatewaytest: failed to create gateway: %v", err)
+	}
+	t.Cleanup(func() {
+		gw.Shutdown(context.Background())
+	})
+	if err := gw.Start(context.Background()); err != nil {
+		t.Fatalf("gatewaytest: failed to start gateway: %v", err)
+	}
+
+	return &Harness{
+		Registry: reg,
+		Upstream: upstream,
+		Gateway:  gw,
+		URL:      "http://" + gw.HTTPAddr().String(),
+		GRPCAddr: gw.GRPCAddr().String(),
+		t:        t,
+	}
+}
+
+// Dial returns a client connection to the gRPC listener of the gateway,
+// closed when the test ends
+func (h *Harness) Dial(opts ...grpc.DialOption) *grpc.ClientConn {
+	h.t.Helper()
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.Dial(h.GRPCAddr, opts...)
+	if err != nil {
+		h.t.Fatalf("gatewaytest: failed to dial gateway: %v", err)
+	}
+	h.t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+// writeConfig writes the harness configuration to dir and returns the path
+// of the configuration file, which includes it below the caller's config
+func writeConfig(dir, protoset, registryAddress string, config map[string]any) (string, error) {
+	protoset, err := filepath.Abs(protoset)
+	if err != nil {
+		return "", err
+	}
+	base := map[string]any{
+		"server": map[string]any{
+			"http_port": "127.0.0.1:0",
+			"grpc_port": "127.0.0.1:0",
+			"host":      "127.0.0.1",
+		},
+		"registry": map[string]any{
+			"enabled":      true,
+			"type":         registryType,
+			"address":      registryAddress,
+			"service_name": "gatewaytest",
+			"service_id":   "gatewaytest-" + registryAddress,
+		},
+		"proto": map[string]any{
+			"protoset_path": protoset,
+		},
+		"log": map[string]any{
+			"level": "warn",
+		},
+	}
+	doc := map[string]any{"include": "harness.json"}
+	for key, value := range config {
+		doc[key] = value
+	}
+
+	for name, content := range map[string]map[string]any{"harness.json": base, "config.json": doc} {
+		data, err := json.Marshal(content)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
@@ -0,0 +1,153 @@
+package gatewaytest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/heytom-labs/heytom-gateway/pkg/gateway"
+)
+
+// Registry is an in-memory gateway.Registry. Instances registered with it
+// are discovered immediately and reported to every watcher of their service.
+type Registry struct {
+	mu        sync.Mutex
+	instances map[string]*gateway.ServiceInstance // By instance ID
+	watchers  map[string][]*watcher               // By service name
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		instances: make(map[string]*gateway.ServiceInstance),
+		watchers:  make(map[string][]*watcher),
+	}
+}
+
+// Register implements gateway.Registry. Registering an existing ID replaces
+// the instance.
+func (r *Registry) Register(ctx context.Context, instance *gateway.ServiceInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.instances[instance.ID]; ok && old.Name != instance.Name {
+		delete(r.instances, instance.ID)
+		r.notify(old.Name)
+	}
+	r.instances[instance.ID] = clone(instance)
+	r.notify(instance.Name)
+	return nil
+}
+
+// Deregister implements gateway.Registry
+func (r *Registry) Deregister(ctx context.Context, instanceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance, ok := r.instances[instanceID]
+	if !ok {
+		return fmt.Errorf("instance %s is not registered", instanceID)
+	}
+	delete(r.instances, instanceID)
+	r.notify(instance.Name)
+	return nil
+}
+
+// Discover implements gateway.Registry, returning the instances of the
+// service ordered by ID
+func (r *Registry) Discover(ctx context.Context, serviceName string) ([]*gateway.ServiceInstance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.discover(serviceName), nil
+}
+
+// Watch implements gateway.Registry. The first call to Next returns the
+// current instances, later calls block until the instances change.
+func (r *Registry) Watch(ctx context.Context, serviceName string) (gateway.RegistryWatcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{ctx: ctx, cancel: cancel, changes: make(chan []*gateway.ServiceInstance, 1)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchers[serviceName] = append(r.watchers[serviceName], w)
+	w.changes <- r.discover(serviceName)
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.watchers[serviceName] = slices.DeleteFunc(r.watchers[serviceName], func(other *watcher) bool {
+			return other == w
+		})
+	}()
+	return w, nil
+}
+
+// HealthCheck implements gateway.Registry, failing for instances that are
+// not registered
+func (r *Registry) HealthCheck(ctx context.Context, instanceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.instances[instanceID]; !ok {
+		return fmt.Errorf("instance %s is not registered", instanceID)
+	}
+	return nil
+}
+
+// discover returns copies of the instances of the service; r.mu must be held
+func (r *Registry) discover(serviceName string) []*gateway.ServiceInstance {
+	var instances []*gateway.ServiceInstance
+	for _, instance := range r.instances {
+		if instance.Name == serviceName {
+			instances = append(instances, clone(instance))
+		}
+	}
+	slices.SortFunc(instances, func(a, b *gateway.ServiceInstance) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return instances
+}
+
+// notify sends the current instances of the service to its watchers, replacing
+// a change they have not read yet; r.mu must be held
+func (r *Registry) notify(serviceName string) {
+	for _, w := range r.watchers[serviceName] {
+		instances := r.discover(serviceName)
+		select {
+		case <-w.changes:
+		default:
+		}
+		w.changes <- instances
+	}
+}
+
+// watcher reports the instances of one service
+type watcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changes chan []*gateway.ServiceInstance
+}
+
+// Next implements gateway.RegistryWatcher
+func (w *watcher) Next() ([]*gateway.ServiceInstance, error) {
+	select {
+	case instances := <-w.changes:
+		return instances, nil
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	}
+}
+
+// Stop implements gateway.RegistryWatcher
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
+
+// clone copies an instance so that callers cannot modify the registered one
+func clone(instance *gateway.ServiceInstance) *gateway.ServiceInstance {
+	c := *instance
+	c.Tags = slices.Clone(instance.Tags)
+	c.Metadata = maps.Clone(instance.Metadata)
+	return &c
+}
@@ -0,0 +1,105 @@
+// Package middleware is the API for custom HTTP middleware of the gateway.
+//
+// Middleware wraps proxied HTTP requests after the route is resolved and
+// before the request is forwarded upstream. Register it before the gateway
+// starts and place it by name in server.http.middleware:
+//
+//	func init() {
+//		middleware.Register(middleware.New("audit", func(next http.Handler) http.Handler {
+//			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//				if req := middleware.RequestFromContext(r.Context()); req != nil {
+//					log.Printf("%s/%s", req.ServiceName, req.MethodName)
+//				}
+//				next.ServeHTTP(w, r)
+//			})
+//		}))
+//	}
+//
+// Metadata for the upstream call is added to the request context with
+// metadata.AppendToOutgoingContext.
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Request is a proxied HTTP request as resolved by the gateway
+type Request struct {
+	Tenant      string   // Tenant of the request, from the path or the authenticated claims
+	ServiceName string   // Full protobuf service name (package.ServiceName)
+	MethodName  string   // Method name
+	Body        []byte   // JSON request body; the raw protobuf body when Passthrough is set
+	Twirp       bool     // Twirp request, errors are returned in the Twirp format
+	Protobuf    bool     // The body is protobuf encoded and so is the response
+	Passthrough bool     // The protobuf body is forwarded and returned without decoding
+	Accept      string   // Media type of the response: application/json, application/x-protobuf or application/xml
+	Fields      []string // Response fields selected with the fields query parameter; empty returns all fields
+}
+
+// Middleware wraps proxied HTTP requests
+type Middleware interface {
+	// Name returns the name used to order the middleware in server.http.middleware
+	Name() string
+	// Wrap wraps the next handler
+	Wrap(next http.Handler) http.Handler
+}
+
+// middlewareFunc is a Middleware made of a name and a wrap function
+type middlewareFunc struct {
+	name string
+	wrap func(next http.Handler) http.Handler
+}
+
+// Name implements Middleware
+func (m middlewareFunc) Name() string {
+	return m.name
+}
+
+// Wrap implements Middleware
+func (m middlewareFunc) Wrap(next http.Handler) http.Handler {
+	return m.wrap(next)
+}
+
+// New creates a middleware from a name and a wrap function
+func New(name string, wrap func(next http.Handler) http.Handler) Middleware {
+	return middlewareFunc{name: name, wrap: wrap}
+}
+
+// requestKey is the context key of the resolved request
+type requestKey struct{}
+
+// NewContext returns a context carrying the resolved request
+func NewContext(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFromContext returns the resolved request, or nil when the request
+// is not proxied
+func RequestFromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+var (
+	mu         sync.Mutex
+	registered []Middleware
+)
+
+// Register makes a middleware available to the gateway. It must be called
+// before the gateway starts, typically from an init function. Registered
+// middleware runs in the order of server.http.middleware, or after the
+// built-in middleware when that is not configured.
+func Register(m Middleware) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, m)
+}
+
+// Registered returns the registered middleware in registration order
+func Registered() []Middleware {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Middleware(nil), registered...)
+}
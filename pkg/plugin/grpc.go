@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The plugin gRPC API. Like the authorization API, every request and
+// response is a google.protobuf.Struct carrying the JSON form of Request,
+// Response and Result, so plugins can be written without generated code.
+const (
+	ServiceName          = "heytom.gateway.plugin.v1.Filter"
+	FilterRequestMethod  = "/" + ServiceName + "/FilterRequest"
+	FilterResponseMethod = "/" + ServiceName + "/FilterResponse"
+)
+
+// GRPCPlugin adapts a Filter to go-plugin's gRPC transport
+type GRPCPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	Impl Filter // Served by the plugin process; unused by the gateway
+}
+
+// GRPCServer implements goplugin.GRPCPlugin
+func (p *GRPCPlugin) GRPCServer(_ *goplugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&serviceDesc, p.Impl)
+	return nil
+}
+
+// GRPCClient implements goplugin.GRPCPlugin
+func (p *GRPCPlugin) GRPCClient(_ context.Context, _ *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &grpcClient{conn: conn}, nil
+}
+
+// grpcClient calls a Filter served by a plugin process
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+// FilterRequest implements Filter
+func (c *grpcClient) FilterRequest(ctx context.Context, req *Request) (*Result, error) {
+	return c.invoke(ctx, FilterRequestMethod, req)
+}
+
+// FilterResponse implements Filter
+func (c *grpcClient) FilterResponse(ctx context.Context, resp *Response) (*Result, error) {
+	return c.invoke(ctx, FilterResponseMethod, resp)
+}
+
+// invoke calls method with in and decodes the Result
+func (c *grpcClient) invoke(ctx context.Context, method string, in any) (*Result, error) {
+	msg, err := toStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	out := &structpb.Struct{}
+	if err := c.conn.Invoke(ctx, method, msg, out); err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	if err := fromStruct(out, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Filter)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "FilterRequest",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				req := &Request{}
+				if err := decode(dec, req); err != nil {
+					return nil, err
+				}
+				result, err := srv.(Filter).FilterRequest(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+				return toStruct(result)
+			},
+		},
+		{
+			MethodName: "FilterResponse",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				resp := &Response{}
+				if err := decode(dec, resp); err != nil {
+					return nil, err
+				}
+				result, err := srv.(Filter).FilterResponse(ctx, resp)
+				if err != nil {
+					return nil, err
+				}
+				return toStruct(result)
+			},
+		},
+	},
+}
+
+// decode reads the incoming Struct into v
+func decode(dec func(any) error, v any) error {
+	in := &structpb.Struct{}
+	if err := dec(in); err != nil {
+		return err
+	}
+	return fromStruct(in, v)
+}
+
+// toStruct converts v into a google.protobuf.Struct through its JSON form
+func toStruct(v any) (*structpb.Struct, error) {
+	if result, ok := v.(*Result); ok && result == nil {
+		v = &Result{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plugin message: %w", err)
+	}
+	s := &structpb.Struct{}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to convert plugin message: %w", err)
+	}
+	return s, nil
+}
+
+// fromStruct converts a google.protobuf.Struct into v through its JSON form
+func fromStruct(s *structpb.Struct, v any) error {
+	data, err := s.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin message: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal plugin message: %w", err)
+	}
+	return nil
+}
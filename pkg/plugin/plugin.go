@@ -0,0 +1,78 @@
+// Package plugin is the API for out-of-process gateway plugins.
+//
+// A plugin is an executable started by the gateway through hashicorp/go-plugin.
+// It implements Filter and calls Serve from its main function:
+//
+//	func main() {
+//		plugin.Serve(myFilter{})
+//	}
+//
+// The gateway calls the filter for every proxied HTTP request before it is
+// forwarded upstream, and again with the upstream response.
+package plugin
+
+import (
+	"context"
+
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// Name is the name under which the filter is dispensed from a plugin process
+const Name = "filter"
+
+// Handshake is shared by the gateway and its plugins. A binary started
+// without the magic cookie, for example by hand, exits with a notice instead
+// of serving, and a protocol version mismatch fails the gateway startup.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "HEYTOM_GATEWAY_PLUGIN",
+	MagicCookieValue: "filter",
+}
+
+// Request is a proxied request passed to FilterRequest
+type Request struct {
+	Protocol   string            `json:"protocol"` // http
+	Tenant     string            `json:"tenant,omitempty"`
+	Service    string            `json:"service"` // Full protobuf service name
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Body       string            `json:"body"` // JSON request body
+}
+
+// Response is an upstream response passed to FilterResponse
+type Response struct {
+	Protocol string `json:"protocol"` // http
+	Tenant   string `json:"tenant,omitempty"`
+	Service  string `json:"service"`
+	Method   string `json:"method"`
+	Status   int    `json:"status"` // HTTP status returned by the gateway
+	Body     string `json:"body"`
+}
+
+// Result is a filter's decision. The zero value lets the request or response
+// through unchanged.
+type Result struct {
+	Reject bool    `json:"reject,omitempty"` // Stop the request and reply with Status and Reason
+	Status int     `json:"status,omitempty"` // HTTP status for a rejection (0 means 403), or a replacement response status
+	Reason string  `json:"reason,omitempty"`
+	Body   *string `json:"body,omitempty"` // Replaces the request or response body when set
+	// Headers are forwarded upstream as gRPC metadata for a request, and set
+	// on the HTTP response for a response
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Filter inspects and rewrites proxied requests and responses
+type Filter interface {
+	FilterRequest(ctx context.Context, req *Request) (*Result, error)
+	FilterResponse(ctx context.Context, resp *Response) (*Result, error)
+}
+
+// Serve serves impl to the gateway. It blocks until the gateway stops the plugin.
+func Serve(impl Filter) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{Name: &GRPCPlugin{Impl: impl}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}